@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/scott-mescudi/codelet/service/backup"
+	"github.com/scott-mescudi/codelet/service/config"
+	dataAccess "github.com/scott-mescudi/codelet/service/data_access"
+)
+
+func runBackup(c *cli, path string, args []string) error {
+	fs, l := c.flags(path, "Write a backup of all users and snippets. The archive is a zstd compressed tar\nunless -uncompressed is given. Nothing but the archive goes to stdout.")
+	output := fs.String("output", "-", "file to write, - for stdout")
+	uncompressed := fs.Bool("uncompressed", false, "write a plain tar")
+	cfg, err := c.parse(fs, l, args)
+	if err != nil {
+		return err
+	}
+
+	db, err := c.openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	out := c.stdout
+	if *output != "-" {
+		// Write next to the target and rename, so a failed run never leaves
+		// something that looks like a finished backup.
+		f, err := os.CreateTemp(filepath.Dir(*output), ".codelet-backup-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		out = f
+	}
+
+	manifest, err := backup.Write(c.ctx, db, out, backup.Options{Uncompressed: *uncompressed})
+	if err != nil {
+		return err
+	}
+
+	if f, ok := out.(*os.File); ok {
+		if err := f.Sync(); err != nil {
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(f.Name(), *output); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(c.stderr, "backed up %d users and %d snippets at schema version %d\n", manifest.Users, manifest.Snippets, manifest.SchemaVersion)
+	return nil
+}
+
+func runRestore(c *cli, path string, args []string) error {
+	fs, l := c.flags(path, "Restore a backup into an empty database. Pending migrations are applied first,\nthe restore itself runs in one transaction and is only committed once every\nchecksum matched. With -verify the archive is checked without a database.")
+	input := fs.String("input", "-", "archive to read, - for stdin")
+	verify := fs.Bool("verify", false, "only check the archive, no configuration is needed")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// Checking an archive touches no database, so -verify works on a
+	// machine without the server configuration.
+	var cfg *config.Config
+	if !*verify {
+		var err error
+		if cfg, err = loadConfig(l, c.sections); err != nil {
+			return err
+		}
+	}
+
+	in := c.stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	if *verify {
+		manifest, err := backup.Verify(c.ctx, in)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.stdout, "archive is valid: %d users and %d snippets from %s\n", manifest.Users, manifest.Snippets, manifest.Created.Format("2006-01-02 15:04:05 MST"))
+		return nil
+	}
+
+	db, err := c.openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := dataAccess.Migrate(c.ctx, db); err != nil {
+		return err
+	}
+
+	manifest, err := backup.Restore(c.ctx, db, in)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stdout, "restored %d users and %d snippets\n", manifest.Users, manifest.Snippets)
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+func runConfigCheck(c *cli, path string, args []string) error {
+	fs, l := c.flags(path, fmt.Sprintf("Load the configuration from defaults, file, environment and flags and validate\nwhat a command reads, the server by default. Exits with %d when it is invalid.", exitUsage))
+	show := fs.Bool("print", false, "print the effective configuration as YAML, secrets redacted")
+	name := fs.String("command", "serve", "command whose settings are validated, for example \"user create\"")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	cmd := findCommand(commands(), strings.Fields(*name))
+	if cmd == nil || cmd.run == nil {
+		return usageError("-command: unknown command %q", *name)
+	}
+
+	cfg, err := loadConfig(l, cmd.sections)
+	if err != nil {
+		return err
+	}
+
+	if *show {
+		out, err := yaml.Marshal(cfg)
+		if err != nil {
+			return err
+		}
+		c.stdout.Write(out)
+		return nil
+	}
+
+	fmt.Fprintln(c.stdout, "configuration is valid")
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	dataAccess "github.com/scott-mescudi/codelet/service/data_access"
+)
+
+func runDedup(c *cli, path string, args []string) error {
+	fs, l := c.flags(path, "Move snippet code stored inline, from before code blobs existed, into\ncode blobs shared by snippets with the same code. Safe to run while the\nserver is up.")
+	batch := fs.Int("batch", 500, "rows changed per transaction")
+	cfg, err := c.parse(fs, l, args)
+	if err != nil {
+		return err
+	}
+
+	if *batch <= 0 {
+		return usageError("-batch must be greater than 0")
+	}
+
+	db, store, err := c.openCodeDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	defer store.Close()
+
+	done, err := dataAccess.Dedup(c.ctx, db, store, *batch, func(n int) {
+		fmt.Fprintf(c.stdout, "moved %d snippets\n", n)
+	})
+	if err != nil {
+		if errors.Is(err, dataAccess.ErrNoKeyring) {
+			return usageError("%v", err)
+		}
+		return fmt.Errorf("dedup stopped after %d snippets: %w", done, err)
+	}
+
+	fmt.Fprintf(c.stdout, "done, %d snippets moved to code blobs\n", done)
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	srv "github.com/scott-mescudi/codelet/service"
+	"github.com/scott-mescudi/codelet/service/config"
+	dataAccess "github.com/scott-mescudi/codelet/service/data_access"
+	cmp "github.com/scott-mescudi/codelet/shared/compression"
+	"github.com/scott-mescudi/codelet/shared/languages"
+)
+
+// minSamples is the fewest snippets worth training a dictionary on, with less
+// it mostly memorises them.
+const minSamples = 50
+
+// openCodeDatabase opens the database with what is needed to read snippet
+// code: the master keys and the stored dictionaries.
+func (c *cli) openCodeDatabase(cfg *config.Config) (*pgxpool.Pool, *dataAccess.CodeStore, error) {
+	store, err := srv.NewCodeStore(cfg)
+	if err != nil {
+		return nil, nil, usageError("invalid master keys: %v", err)
+	}
+
+	db, err := c.openDatabase(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := store.LoadDictionaries(c.ctx, db); err != nil {
+		store.Close()
+		db.Close()
+		return nil, nil, err
+	}
+	return db, store, nil
+}
+
+func runDictTrain(c *cli, path string, args []string) error {
+	fs, l := c.flags(path, "Train a zstd dictionary from the most recently updated snippets of a\nlanguage. Servers compress new snippets with it after a restart, run\nrecompress afterwards to move existing ones onto it.")
+	language := fs.String("language", "", "language to train for (required)")
+	samples := fs.Int("samples", 2000, "most snippets to learn from")
+	size := fs.Int("size", 64<<10, "largest dictionary size in bytes")
+	cfg, err := c.parse(fs, l, args)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(*language) == "" {
+		return usageError("-language is required")
+	}
+	if *samples < minSamples {
+		return usageError("-samples must be at least %d", minSamples)
+	}
+	if *size < 1<<10 {
+		return usageError("-size must be at least 1024")
+	}
+
+	// Snippets store canonical language ids, train for the one typed.
+	if id, ok := languages.Normalize(*language); ok {
+		*language = id
+	}
+
+	db, store, err := c.openCodeDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	defer store.Close()
+
+	code, err := dataAccess.DictionarySamples(c.ctx, db, store, *language, *samples)
+	if err != nil {
+		if errors.Is(err, dataAccess.ErrNoKeyring) {
+			return usageError("%v", err)
+		}
+		return err
+	}
+	if len(code) < minSamples {
+		return fmt.Errorf("only %d %s snippets, at least %d are needed", len(code), *language, minSamples)
+	}
+
+	id, err := dataAccess.NextDictionaryID(c.ctx, db)
+	if err != nil {
+		return err
+	}
+
+	d, err := cmp.TrainDictionary(*language, id, code, *size)
+	if err != nil {
+		return fmt.Errorf("training failed: %w", err)
+	}
+
+	if err := dataAccess.AddDictionary(c.ctx, db, d, len(code)); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stdout, "trained dictionary %d for %s from %d snippets, %d bytes\n", d.ID, d.Language, len(code), len(d.Data))
+	return nil
+}
+
+func runDictList(c *cli, path string, args []string) error {
+	fs, l := c.flags(path, "List stored dictionaries, oldest first. The last one of each language is\nthe one new snippets are compressed with.")
+	cfg, err := c.parse(fs, l, args)
+	if err != nil {
+		return err
+	}
+
+	db, err := c.openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	dicts, err := dataAccess.ListDictionaries(c.ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range dicts {
+		fmt.Fprintf(c.stdout, "%d\t%s\t%d bytes\n", d.ID, d.Language, len(d.Data))
+	}
+	return nil
+}
+
+func runRecompress(c *cli, path string, args []string) error {
+	fs, l := c.flags(path, "Recompress snippets that aren't compressed with the current dictionary of\ntheir language. Safe to run while the server is up.")
+	batch := fs.Int("batch", 500, "rows changed per transaction")
+	cfg, err := c.parse(fs, l, args)
+	if err != nil {
+		return err
+	}
+
+	if *batch <= 0 {
+		return usageError("-batch must be greater than 0")
+	}
+
+	db, store, err := c.openCodeDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	defer store.Close()
+
+	done, err := dataAccess.Recompress(c.ctx, db, store, *batch, func(p dataAccess.RecompressProgress) {
+		fmt.Fprintf(c.stdout, "checked %d snippets, recompressed %d\n", p.Checked, p.Recompressed)
+	})
+	if err != nil {
+		if errors.Is(err, dataAccess.ErrNoKeyring) {
+			return usageError("%v", err)
+		}
+		return fmt.Errorf("recompress stopped after %d snippets: %w", done.Checked, err)
+	}
+
+	fmt.Fprintf(c.stdout, "done, %d of %d snippets recompressed\n", done.Recompressed, done.Checked)
+	return nil
+}
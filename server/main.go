@@ -1,14 +1,31 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
-	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
 	srv "github.com/scott-mescudi/codelet/service"
-	"github.com/scott-mescudi/codelet/service/middleware"
+	"github.com/scott-mescudi/codelet/service/config"
+)
+
+// Exit codes are part of the command line interface, scripts branch on them.
+const (
+	exitOK       = 0
+	exitFailure  = 1
+	exitUsage    = 2
+	exitPending  = 3
+	exitNotFound = 4
 )
 
 func PrintEndpoints(port string) (local string, network string) {
@@ -20,38 +37,214 @@ func PrintEndpoints(port string) (local string, network string) {
 	}
 
 	for _, addr := range addrs {
-		if ipNEt, ok := addr.(*net.IPNet); ok && !ipNEt.IP.IsLoopback(){
+		if ipNEt, ok := addr.(*net.IPNet); ok && !ipNEt.IP.IsLoopback() {
 			if ipNEt.IP.To4() != nil {
 				localIp = ipNEt.IP.String()
 			}
 		}
 	}
 
-	return fmt.Sprintf("- Local: http://localhost%s\n", port), fmt.Sprintf("- Local: http://%s%s\n", localIp ,port)
+	return fmt.Sprintf("- Local: http://localhost%s\n", port), fmt.Sprintf("- Network: http://%s%s\n", localIp, port)
 }
 
 func main() {
-	if err := os.MkdirAll("/src/logs", 0755); err != nil {
-		log.Fatalln("Failed to create logs directory")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	c := &cli{ctx: ctx, stop: stop, stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+
+	code := c.run(os.Args[1:])
+	stop()
+	os.Exit(code)
+}
+
+// cli carries what every command needs, tests swap the streams.
+type cli struct {
+	ctx    context.Context
+	stop   context.CancelFunc
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	// sections of the configuration the running command reads, parse
+	// validates only those.
+	sections config.Section
+}
+
+type command struct {
+	name     string
+	summary  string
+	sections config.Section
+	run      func(c *cli, path string, args []string) error
+	sub      []*command
+}
+
+// codeSections are what commands reading snippet code need.
+const codeSections = config.SectionDatabase | config.SectionEncryption
+
+func commands() []*command {
+	return []*command{
+		{name: "serve", summary: "Run the HTTP API. This is the default when no command is given.", sections: config.AllSections, run: runServe},
+		{name: "migrate", summary: "Apply pending database migrations.", sections: config.SectionDatabase, run: runMigrate},
+		{name: "user", summary: "Manage user accounts.", sub: []*command{
+			{name: "create", summary: "Create a user.", sections: config.SectionDatabase, run: runUserCreate},
+			{name: "set-role", summary: "Change the role of a user.", sections: config.SectionDatabase, run: runUserSetRole},
+			{name: "reset-password", summary: "Set a new password and sign the user out everywhere.", sections: config.SectionDatabase, run: runUserResetPassword},
+			{name: "disable", summary: "Block a user from signing in.", sections: config.SectionDatabase, run: runUserDisable},
+		}},
+		{name: "backup", summary: "Write a backup archive of all users and snippets.", sections: config.SectionDatabase, run: runBackup},
+		{name: "restore", summary: "Restore a backup archive into an empty database.", sections: config.SectionDatabase, run: runRestore},
+		{name: "rekey", summary: "Move all data keys to the active master key and encrypt legacy snippets.", sections: codeSections, run: runRekey},
+		{name: "dict", summary: "Manage zstd compression dictionaries.", sub: []*command{
+			{name: "train", summary: "Train a dictionary for one language from its snippets.", sections: codeSections, run: runDictTrain},
+			{name: "list", summary: "List stored dictionaries.", sections: config.SectionDatabase, run: runDictList},
+		}},
+		{name: "dedup", summary: "Move snippet code stored inline into shared code blobs.", sections: codeSections, run: runDedup},
+		{name: "recompress", summary: "Recompress snippets with the current dictionary of their language.", sections: codeSections, run: runRecompress},
+		{name: "reindex", summary: "Rebuild table indexes and planner statistics.", sections: config.SectionDatabase, run: runReindex},
+		{name: "config", summary: "Inspect the configuration.", sub: []*command{
+			{name: "check", summary: "Load and validate the configuration without starting anything.", run: runConfigCheck},
+		}},
+	}
+}
+
+// findCommand returns the command path names, or nil.
+func findCommand(cmds []*command, path []string) *command {
+	for _, cmd := range cmds {
+		if len(path) == 0 || cmd.name != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return cmd
+		}
+		return findCommand(cmd.sub, path[1:])
+	}
+	return nil
+}
+
+// exitError carries the exit code a failed command should end with.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+func usageError(format string, args ...any) error {
+	return &exitError{code: exitUsage, err: fmt.Errorf(format, args...)}
+}
+
+func (c *cli) run(args []string) int {
+	// Flags without a command keep the old "just start the server" behaviour.
+	if len(args) == 0 || (strings.HasPrefix(args[0], "-") && !isHelp(args[0])) {
+		args = append([]string{"serve"}, args...)
+	}
+
+	err := c.dispatch(commands(), "", args)
+	var exit *exitError
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &exit):
+		if exit.err != nil {
+			fmt.Fprintln(c.stderr, "codelet:", exit.err)
+		}
+		return exit.code
+	default:
+		fmt.Fprintln(c.stderr, "codelet:", err)
+		return exitFailure
+	}
+}
+
+func (c *cli) dispatch(cmds []*command, path string, args []string) error {
+	if len(args) == 0 || isHelp(args[0]) || args[0] == "help" {
+		c.printCommands(cmds, path)
+		if len(args) == 0 {
+			return &exitError{code: exitUsage}
+		}
+		return nil
+	}
+
+	for _, cmd := range cmds {
+		if cmd.name != args[0] {
+			continue
+		}
+
+		full := strings.TrimSpace(path + " " + cmd.name)
+		if cmd.sub != nil {
+			return c.dispatch(cmd.sub, full, args[1:])
+		}
+		c.sections = cmd.sections
+		return cmd.run(c, full, args[1:])
+	}
+
+	c.printCommands(cmds, path)
+	return usageError("unknown command %q", strings.TrimSpace(path+" "+args[0]))
+}
+
+func (c *cli) printCommands(cmds []*command, path string) {
+	prefix := "codelet "
+	if path != "" {
+		prefix += path + " "
+	}
+
+	fmt.Fprintf(c.stderr, "Usage: %s<command> [flags]\n\nCommands:\n", prefix)
+	for _, cmd := range cmds {
+		fmt.Fprintf(c.stderr, "  %-16s %s\n", cmd.name, cmd.summary)
 	}
+	fmt.Fprintf(c.stderr, "\nRun '%s<command> -help' for the flags of a command.\n", prefix)
+}
+
+func isHelp(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
 
-	app, clean := srv.NewCodeletServer()
-	defer clean()
+// flags returns a flag set for a command that also accepts every
+// configuration flag, so commands read the same settings as the server.
+func (c *cli) flags(path, summary string) (*flag.FlagSet, *config.Loader) {
+	fs := flag.NewFlagSet(path, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: codelet %s [flags]\n\n%s\n\nFlags:\n", path, summary)
+		fs.PrintDefaults()
+	}
 
-	port := os.Getenv("APP_PORT")
+	return fs, config.NewLoader(fs)
+}
+
+// parse parses args and loads the configuration, validating the sections
+// the command reads. Bad flags and invalid configuration both end with
+// exitUsage.
+func (c *cli) parse(fs *flag.FlagSet, l *config.Loader, args []string) (*config.Config, error) {
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	return loadConfig(l, c.sections)
+}
 
-	local, network := PrintEndpoints(port)
-	log.Println(local)
-	log.Println(network)
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return &exitError{code: exitUsage}
+	}
 
-	server := http.Server{
-		Addr:    port,
-		Handler: middleware.CorsMiddleware(app),
+	if fs.NArg() > 0 {
+		return usageError("unexpected arguments: %s", strings.Join(fs.Args(), " "))
 	}
+	return nil
+}
 
-	fmt.Println("Server starting on port: ", port)
-	if err := server.ListenAndServe(); err != nil {
-		fmt.Println(err)
-		return
+func loadConfig(l *config.Loader, sections config.Section) (*config.Config, error) {
+	cfg, err := l.LoadSections(sections)
+	if err != nil {
+		return nil, &exitError{code: exitUsage, err: err}
 	}
+	return cfg, nil
+}
+
+// openDatabase connects the way the server does, logging retries to stderr.
+func (c *cli) openDatabase(cfg *config.Config) (*pgxpool.Pool, error) {
+	logger := zerolog.New(zerolog.ConsoleWriter{Out: c.stderr, NoColor: true}).With().Timestamp().Logger()
+	return srv.OpenDatabase(c.ctx, cfg, logger)
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func newTestCLI(stdin string) (*cli, *bytes.Buffer, *bytes.Buffer) {
+	var stdout, stderr bytes.Buffer
+	return &cli{ctx: context.Background(), stop: func() {}, stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr}, &stdout, &stderr
+}
+
+var validConfig = []string{"-database-url", "postgres://u:p@localhost/db", "-auth-jwt-secret", strings.Repeat("k", 32), "-cors-origins", "https://codelet.dev"}
+
+func TestRunExitCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected int
+		stdout   string
+		stderr   string
+	}{
+		{name: "Help", args: []string{"-help"}, expected: exitOK, stderr: "Commands:"},
+		{name: "Unknown command", args: []string{"bogus"}, expected: exitUsage, stderr: `unknown command "bogus"`},
+		{name: "Group without subcommand", args: []string{"user"}, expected: exitUsage, stderr: "reset-password"},
+		{name: "Subcommand help", args: []string{"user", "create", "-h"}, expected: exitOK, stderr: "-password-stdin"},
+		{name: "Bad flag", args: []string{"config", "check", "-nope"}, expected: exitUsage, stderr: "-nope"},
+		{name: "Invalid config", args: []string{"config", "check"}, expected: exitUsage, stderr: "database.url"},
+		{name: "Valid config", args: append([]string{"config", "check"}, validConfig...), expected: exitOK, stdout: "configuration is valid"},
+		{name: "Printed config is redacted", args: append([]string{"config", "check", "-print"}, validConfig...), expected: exitOK, stdout: "url: '[REDACTED]'"},
+		{name: "Serve is the default", args: []string{"-server-addr", "nope"}, expected: exitUsage, stderr: "server.addr"},
+		{name: "Check another command", args: []string{"config", "check", "-command", "user create", "-database-url", "postgres://u:p@localhost/db"}, expected: exitOK, stdout: "configuration is valid"},
+		{name: "Check unknown command", args: append([]string{"config", "check", "-command", "bogus"}, validConfig...), expected: exitUsage, stderr: `unknown command "bogus"`},
+		{name: "Missing email", args: append([]string{"user", "create", "-username", "bob"}, validConfig...), expected: exitUsage, stderr: "-email"},
+		{name: "Only read sections validated", args: []string{"user", "create", "-username", "bob", "-database-url", "postgres://u:p@localhost/db"}, expected: exitUsage, stderr: "-email"},
+		{name: "Verify empty archive", args: append([]string{"restore", "-verify"}, validConfig...), expected: exitFailure, stderr: "no manifest"},
+		{name: "Verify without configuration", args: []string{"restore", "-verify", "-database-url", "nope"}, expected: exitFailure, stderr: "no manifest"},
+		{name: "Rekey without master keys", args: append([]string{"rekey"}, validConfig...), expected: exitUsage, stderr: "no master keys"},
+		{name: "Train without language", args: append([]string{"dict", "train"}, validConfig...), expected: exitUsage, stderr: "-language"},
+		{name: "Recompress bad batch", args: append([]string{"recompress", "-batch", "0"}, validConfig...), expected: exitUsage, stderr: "-batch"},
+		{name: "Bad role", args: append([]string{"user", "set-role", "-email", "b@codelet.dev", "-role", "root"}, validConfig...), expected: exitUsage, stderr: "-role"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, stdout, stderr := newTestCLI("")
+			if got := c.run(tt.args); got != tt.expected {
+				t.Errorf("expected exit code %d, got %d\nstderr: %s", tt.expected, got, stderr)
+			}
+
+			if !strings.Contains(stdout.String(), tt.stdout) {
+				t.Errorf("stdout %q does not contain %q", stdout, tt.stdout)
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("stderr %q does not contain %q", stderr, tt.stderr)
+			}
+		})
+	}
+}
+
+func TestPassword(t *testing.T) {
+	tests := []struct {
+		name      string
+		stdin     string
+		fromStdin bool
+		expected  string
+		generated bool
+		fails     bool
+	}{
+		{name: "Generated", fromStdin: false, generated: true},
+		{name: "From stdin", stdin: "hunter22\nignored\n", fromStdin: true, expected: "hunter22"},
+		{name: "Windows line ending", stdin: "hunter22\r\n", fromStdin: true, expected: "hunter22"},
+		{name: "No trailing newline", stdin: "hunter22", fromStdin: true, expected: "hunter22"},
+		{name: "Empty stdin", stdin: "", fromStdin: true, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _, _ := newTestCLI(tt.stdin)
+			password, generated, err := c.password(tt.fromStdin)
+			if (err != nil) != tt.fails {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if generated != tt.generated {
+				t.Errorf("expected generated=%v", tt.generated)
+			}
+			if tt.generated && len(password) < 20 {
+				t.Errorf("generated password too short: %q", password)
+			}
+			if !tt.generated && password != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, password)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	dataAccess "github.com/scott-mescudi/codelet/service/data_access"
+)
+
+func runMigrate(c *cli, path string, args []string) error {
+	fs, l := c.flags(path, fmt.Sprintf("Apply pending database migrations. With -status nothing is changed and the\ncommand exits with %d when migrations are pending.", exitPending))
+	status := fs.Bool("status", false, "only report the schema version")
+	cfg, err := c.parse(fs, l, args)
+	if err != nil {
+		return err
+	}
+
+	db, err := c.openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if *status {
+		version, err := dataAccess.SchemaVersion(c.ctx, db)
+		if err != nil {
+			return err
+		}
+
+		latest := dataAccess.LatestSchemaVersion()
+		fmt.Fprintf(c.stdout, "schema version %d, latest %d\n", version, latest)
+		if version < latest {
+			return &exitError{code: exitPending}
+		}
+		return nil
+	}
+
+	applied, err := dataAccess.Migrate(c.ctx, db)
+	for _, m := range applied {
+		fmt.Fprintf(c.stdout, "applied %04d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		fmt.Fprintln(c.stdout, "schema is up to date")
+	}
+	return nil
+}
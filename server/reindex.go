@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+
+	dataAccess "github.com/scott-mescudi/codelet/service/data_access"
+)
+
+func runReindex(c *cli, path string, args []string) error {
+	fs, l := c.flags(path, "Rebuild the indexes of every table and refresh planner statistics. REINDEX\nblocks writes while it runs, consider PUT /read-only on the admin listener first.")
+	cfg, err := c.parse(fs, l, args)
+	if err != nil {
+		return err
+	}
+
+	db, err := c.openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return dataAccess.Reindex(c.ctx, db, func(table string) {
+		fmt.Fprintf(c.stdout, "reindexing %s\n", table)
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	dataAccess "github.com/scott-mescudi/codelet/service/data_access"
+)
+
+func runRekey(c *cli, path string, args []string) error {
+	fs, l := c.flags(path, "Rewrap every data key with the first configured master key and move\nsnippets stored before encryption was turned on, or before code blobs\nexisted, into encrypted blobs. Safe to run while the server is up, as\nlong as it already has the same master keys.")
+	batch := fs.Int("batch", 500, "rows changed per transaction")
+	cfg, err := c.parse(fs, l, args)
+	if err != nil {
+		return err
+	}
+
+	if *batch <= 0 {
+		return usageError("-batch must be greater than 0")
+	}
+
+	if cfg.Encryption.MasterKeys == "" {
+		return usageError("no master keys configured, set encryption.master_keys or ENCRYPTION_MASTER_KEYS")
+	}
+
+	// Moving code into blobs decompresses it, which needs the dictionaries.
+	db, store, err := c.openCodeDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	defer store.Close()
+
+	done, err := dataAccess.Rekey(c.ctx, db, store, *batch, func(p dataAccess.RekeyProgress) {
+		fmt.Fprintf(c.stdout, "rewrapped %d data keys, encrypted %d snippets\n", p.DataKeys, p.Snippets)
+	})
+	if err != nil {
+		if errors.Is(err, dataAccess.ErrNoKeyring) {
+			return usageError("%v", err)
+		}
+		return fmt.Errorf("rekey stopped after %d data keys and %d snippets: %w", done.DataKeys, done.Snippets, err)
+	}
+
+	fmt.Fprintf(c.stdout, "done, %d data keys rewrapped and %d snippets encrypted\n", done.DataKeys, done.Snippets)
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	srv "github.com/scott-mescudi/codelet/service"
+)
+
+func runServe(c *cli, path string, args []string) error {
+	fs, l := c.flags(path, "Run the HTTP API and, when admin.addr is set, the admin listener.")
+	cfg, err := c.parse(fs, l, args)
+	if err != nil {
+		return err
+	}
+
+	app, err := srv.NewCodeletServer(c.ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	port := cfg.Server.Addr
+
+	local, network := PrintEndpoints(port)
+	log.Println(local)
+	log.Println(network)
+
+	servers := []*http.Server{srv.NewHTTPServer(cfg, app.Handler)}
+	if cfg.Admin.Addr != "" {
+		servers = append(servers, srv.NewAdminServer(cfg, app.Admin))
+		fmt.Println("Admin listener on: ", cfg.Admin.Addr)
+	}
+
+	errc := make(chan error, len(servers))
+	for _, s := range servers {
+		go func() {
+			if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				errc <- fmt.Errorf("listener %s stopped: %w", s.Addr, err)
+			}
+		}()
+	}
+
+	fmt.Println("Server starting on port: ", port)
+
+	var serveErr error
+	select {
+	case <-c.ctx.Done():
+		app.Logger.Info().Msg("Shutting down, draining in-flight requests")
+	case serveErr = <-errc:
+		app.Logger.Error().Err(serveErr).Msg("Shutting down after listener failure")
+	}
+	// A second signal kills the process instead of waiting for the drain.
+	c.stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := app.Shutdown(shutdownCtx, servers...); err != nil {
+		return fmt.Errorf("shutdown did not complete cleanly: %w", err)
+	}
+	return serveErr
+}
@@ -0,0 +1,64 @@
+package admin
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/scott-mescudi/codelet/service/backup"
+	errs "github.com/scott-mescudi/codelet/shared/errors"
+)
+
+// Backup streams a full backup archive. Pass ?compress=false for a plain tar.
+func (s *AdminService) Backup(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if !s.requireAdmin(w, r, "Backup") {
+		return
+	}
+
+	opts := backup.Options{Uncompressed: r.URL.Query().Get("compress") == "false"}
+	name := "codelet-backup-" + time.Now().UTC().Format("20060102T150405Z") + ".tar"
+	contentType := "application/x-tar"
+	if !opts.Uncompressed {
+		name += ".zst"
+		contentType = "application/zstd"
+	}
+
+	// A large backup takes longer than the server write timeout allows.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		s.logger(r).Warn().Str("function", "Backup").Err(err).Msg("unable to lift the write deadline")
+	}
+
+	cw := &countingWriter{w: w}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+
+	manifest, err := backup.Write(r.Context(), s.Db, cw, opts)
+	if err != nil {
+		s.logger(r).Error().Str("function", "Backup").Err(err).Int64("bytes", cw.n).Msg("backup failed")
+		if cw.n == 0 {
+			w.Header().Del("Content-Disposition")
+			errs.ErrorWithJson(w, http.StatusInternalServerError, "backup failed")
+			return
+		}
+
+		// Part of the archive is out already. Cutting the connection makes
+		// the download fail visibly, and the missing manifest makes a
+		// restore of what did arrive fail too.
+		panic(http.ErrAbortHandler)
+	}
+
+	s.logger(r).Info().Str("function", "Backup").Int("users", manifest.Users).Int("snippets", manifest.Snippets).Int64("bytes", cw.n).Msg("Served backup")
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
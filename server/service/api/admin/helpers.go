@@ -0,0 +1,46 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog"
+	dba "github.com/scott-mescudi/codelet/service/data_access"
+	errs "github.com/scott-mescudi/codelet/shared/errors"
+)
+
+// logger returns the request scoped logger set up by middleware.RequestLogger,
+// or the service logger when the handler is called without it.
+func (s *AdminService) logger(r *http.Request) *zerolog.Logger {
+	if l := zerolog.Ctx(r.Context()); l.GetLevel() != zerolog.Disabled {
+		return l
+	}
+	return &s.Logger
+}
+
+// requireAdmin answers the request itself unless the user set by
+// AuthMiddleware currently has the admin role. The role is read from the
+// database every time so a demotion takes effect immediately.
+func (s *AdminService) requireAdmin(w http.ResponseWriter, r *http.Request, function string) bool {
+	userID, err := strconv.Atoi(r.Header.Get("X-USERID"))
+	if err != nil {
+		s.logger(r).Warn().Str("function", function).Msg("invalid 'X-USERID' header format")
+		errs.ErrorWithJson(w, http.StatusForbidden, "forbidden")
+		return false
+	}
+
+	role, err := dba.GetUserRole(r.Context(), s.Db, userID)
+	if err != nil {
+		s.logger(r).Warn().Str("function", function).Err(err).Msg("failed to look up user role")
+		errs.ErrorWithJson(w, http.StatusForbidden, "forbidden")
+		return false
+	}
+
+	if role != "admin" {
+		s.logger(r).Warn().Str("function", function).Str("role", role).Msg("non admin tried to use an admin endpoint")
+		errs.ErrorWithJson(w, http.StatusForbidden, "forbidden")
+		return false
+	}
+
+	return true
+}
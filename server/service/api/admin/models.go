@@ -0,0 +1,11 @@
+package admin
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+type AdminService struct {
+	Db     *pgxpool.Pool
+	Logger zerolog.Logger
+}
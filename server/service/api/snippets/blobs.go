@@ -0,0 +1,78 @@
+package snippets
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+
+	dba "github.com/scott-mescudi/codelet/service/data_access"
+	errs "github.com/scott-mescudi/codelet/shared/errors"
+)
+
+// parseCodeHash decodes a hex SHA-256 as sent in code_sha256.
+func parseCodeHash(s string) ([]byte, bool) {
+	hash, err := hex.DecodeString(s)
+	if err != nil || len(hash) != 32 {
+		return nil, false
+	}
+	return hash, true
+}
+
+// snippetCode turns the code and code_sha256 fields of a request into the
+// code to store. When both are sent the hash has to match the code. It
+// returns a message for the client when they don't add up.
+func snippetCode(text, hash string) (dba.Code, string) {
+	if hash == "" {
+		return dba.Code{Text: text}, ""
+	}
+
+	sum, ok := parseCodeHash(hash)
+	if !ok {
+		return dba.Code{}, "code_sha256 must be 64 hex characters"
+	}
+
+	if text != "" && !bytes.Equal(sum, dba.CodeHash([]byte(text))) {
+		return dba.Code{}, "code does not match code_sha256"
+	}
+	return dba.Code{Text: text, SHA256: sum}, ""
+}
+
+// CheckCode answers 204 when the user already stored code with the SHA-256
+// in the path, in which case snippets can send code_sha256 instead of the
+// code, and 404 otherwise.
+func (s *SnippetService) CheckCode(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	userID, err := strconv.Atoi(r.Header.Get("X-USERID"))
+	if err != nil {
+		s.logger(r).Warn().Str("function", "CheckCode").Msg("invalid 'X-USERID' header format")
+		errs.ErrorWithJson(w, http.StatusUnauthorized, "invalid 'X-USERID' header format")
+		return
+	}
+
+	hash, ok := parseCodeHash(r.PathValue("sha256"))
+	if !ok {
+		s.logger(r).Warn().Str("function", "CheckCode").Msg("invalid hash in uri")
+		errs.ErrorWithJson(w, http.StatusBadRequest, "hash must be 64 hex characters")
+		return
+	}
+
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	exists, err := dba.HasBlob(ctx, s.Db, userID, hash)
+	if err != nil {
+		if s.interrupted(w, r, "CheckCode", err) {
+			return
+		}
+
+		s.logger(r).Error().Str("function", "CheckCode").Err(err).Msg("failed to look up code")
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to look up code")
+		return
+	}
+
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,51 @@
+package snippets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestSnippetCode(t *testing.T) {
+	sum := sha256.Sum256([]byte("fmt.Println()"))
+	hash := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name     string
+		text     string
+		hash     string
+		byHash   bool
+		expected string
+	}{
+		{name: "Text only", text: "fmt.Println()"},
+		{name: "Hash only", hash: hash, byHash: true},
+		{name: "Upper case hash", hash: strings.ToUpper(hash), byHash: true},
+		{name: "Matching text and hash", text: "fmt.Println()", hash: hash},
+		{name: "Mismatch", text: "fmt.Print()", hash: hash, expected: "does not match"},
+		{name: "Short hash", hash: hash[:62], expected: "64 hex"},
+		{name: "Not hex", hash: strings.Repeat("z", 64), expected: "64 hex"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, msg := snippetCode(tt.text, tt.hash)
+			if tt.expected != "" {
+				if !strings.Contains(msg, tt.expected) {
+					t.Errorf("expected message containing %q, got %q", tt.expected, msg)
+				}
+				return
+			}
+
+			if msg != "" {
+				t.Fatalf("unexpected message %q", msg)
+			}
+			if code.Text != tt.text {
+				t.Errorf("expected text %q, got %q", tt.text, code.Text)
+			}
+			if tt.byHash && hex.EncodeToString(code.SHA256) != hash {
+				t.Errorf("expected hash %s, got %x", hash, code.SHA256)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package snippets
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	dba "github.com/scott-mescudi/codelet/service/data_access"
+)
+
+// Cache-Control of snippet responses. Private ones may only be kept by the
+// client and have to be revalidated, which is cheap with their ETag. Public
+// ones are the same for everyone and may be shared for a short while.
+const (
+	cachePrivate = "private, no-cache"
+	cachePublic  = "public, max-age=60, stale-while-revalidate=60"
+	// The language registry and the highlight themes only change with a
+	// new release.
+	cacheRelease = "public, max-age=86400"
+)
+
+// Formats snippets are sent in besides JSON, they get their own ETags.
+const (
+	formatJSON   = ""
+	formatRaw    = "raw"
+	formatNDJSON = "ndjson"
+	// Highlighted code, see codeRendering.
+	formatHTML = "html"
+	formatANSI = "ansi"
+)
+
+// viewTag is the part of an ETag that tells representations of the same
+// snippets apart, "" for the full JSON one.
+func viewTag(v dba.View, format string) string {
+	var tag string
+	if (v.Fields != 0 && v.Fields != dba.AllFields) || v.PreviewLines != 0 {
+		tag = fmt.Sprintf(".%x.%d", uint16(v.Fields), v.PreviewLines)
+	}
+	if format != formatJSON {
+		tag += "." + format
+	}
+	return tag
+}
+
+// snippetETag is the strong ETag of one snippet, its id and update time
+// followed by the view and format.
+func snippetETag(id int, updated time.Time, v dba.View, format string) string {
+	return fmt.Sprintf(`"%d.%d%s"`, id, updated.UnixMicro(), viewTag(v, format))
+}
+
+// parseSnippetETag returns the update time in an ETag of snippet id. Any
+// view of the version matches, they only differ in what they leave out.
+func parseSnippetETag(etag string, id int) (time.Time, bool) {
+	tag, ok := strings.CutPrefix(etag, `"`)
+	if !ok {
+		return time.Time{}, false
+	}
+	tag, ok = strings.CutSuffix(tag, `"`)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	parts := strings.Split(tag, ".")
+	if len(parts) < 2 || parts[0] != strconv.Itoa(id) {
+		return time.Time{}, false
+	}
+
+	micros, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMicro(micros).UTC(), true
+}
+
+// pageETag is the weak ETag of a page of snippets.
+func pageETag(p dba.PageVersion, v dba.View, format string) string {
+	return fmt.Sprintf(`W/"%s%s"`, p.Tag, viewTag(v, format))
+}
+
+// etagList splits an If-None-Match or If-Match header.
+func etagList(header string) []string {
+	var tags []string
+	for tag := range strings.SplitSeq(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// notModified reports whether the client already has the representation
+// with etag, last changed at modified. If-None-Match wins over
+// If-Modified-Since when both are sent.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, tag := range etagList(header) {
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.IsZero() {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// validators sets the headers a client revalidates with.
+func validators(w http.ResponseWriter, cacheControl, etag string, modified time.Time) {
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// writeNotModified answers a conditional GET the client is up to date for.
+func writeNotModified(w http.ResponseWriter, cacheControl, etag string, modified time.Time) {
+	validators(w, cacheControl, etag, modified)
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// conditional reports whether r asks for a 304, only then are versions
+// looked up ahead of the snippets.
+func conditional(r *http.Request) bool {
+	return r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != ""
+}
+
+// ifMatch reads the If-Match header of an update of snippet id. It returns
+// the version the update is based on, nil when any version will do, and
+// false when none of the tags is one of the snippet's.
+func ifMatch(r *http.Request, id int) (*time.Time, bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" || strings.TrimSpace(header) == "*" {
+		return nil, true
+	}
+
+	for _, tag := range etagList(header) {
+		if updated, ok := parseSnippetETag(tag, id); ok {
+			return &updated, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,82 @@
+package snippets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dba "github.com/scott-mescudi/codelet/service/data_access"
+)
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2025, 3, 1, 12, 0, 0, 500, time.UTC)
+	etag := snippetETag(7, modified, dba.View{}, formatJSON)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    bool
+	}{
+		{name: "Unconditional", want: false},
+		{name: "Same ETag", headers: map[string]string{"If-None-Match": etag}, want: true},
+		{name: "ETag in list", headers: map[string]string{"If-None-Match": `"1.2", ` + etag}, want: true},
+		{name: "Weak ETag", headers: map[string]string{"If-None-Match": "W/" + etag}, want: true},
+		{name: "Any", headers: map[string]string{"If-None-Match": "*"}, want: true},
+		{name: "Other ETag", headers: map[string]string{"If-None-Match": `"7.1"`}, want: false},
+		{name: "Sparse view", headers: map[string]string{"If-None-Match": snippetETag(7, modified, dba.View{Fields: dba.FieldID}, formatJSON)}, want: false},
+		{name: "Not modified since", headers: map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, want: true},
+		{name: "Modified since", headers: map[string]string{"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat)}, want: false},
+		{name: "ETag wins", headers: map[string]string{"If-None-Match": `"7.1"`, "If-Modified-Since": modified.Format(http.TimeFormat)}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/user/snippets/7", http.NoBody)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			if got := notModified(r, etag, modified); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	updated := time.Date(2025, 3, 1, 12, 0, 0, 123000, time.UTC)
+
+	tests := []struct {
+		name    string
+		ifMatch string
+		want    *time.Time
+		ok      bool
+	}{
+		{name: "Missing", ok: true},
+		{name: "Any", ifMatch: "*", ok: true},
+		{name: "Full view", ifMatch: snippetETag(7, updated, dba.View{}, formatJSON), want: &updated, ok: true},
+		{name: "Sparse view", ifMatch: snippetETag(7, updated, dba.View{Fields: dba.FieldTitle, PreviewLines: 2}, formatJSON), want: &updated, ok: true},
+		{name: "Raw", ifMatch: snippetETag(7, updated, dba.View{}, formatRaw), want: &updated, ok: true},
+		{name: "Other snippet", ifMatch: snippetETag(8, updated, dba.View{}, formatJSON), ok: false},
+		{name: "Weak", ifMatch: "W/" + snippetETag(7, updated, dba.View{}, formatJSON), ok: false},
+		{name: "Garbage", ifMatch: `"abc"`, ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/api/v1/user/snippets/7", http.NoBody)
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			got, ok := ifMatch(r, 7)
+			if ok != tt.ok {
+				t.Fatalf("got ok %v, want %v", ok, tt.ok)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
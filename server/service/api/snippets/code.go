@@ -1,6 +1,7 @@
 package snippets
 
 import (
+	"errors"
 	"io"
 	"net/http"
 	"strconv"
@@ -11,6 +12,7 @@ import (
 	jsoniter "github.com/json-iterator/go"
 	dba "github.com/scott-mescudi/codelet/service/data_access"
 	errs "github.com/scott-mescudi/codelet/shared/errors"
+	"github.com/scott-mescudi/codelet/shared/languages"
 )
 
 var SnippetPool = &sync.Pool{
@@ -29,7 +31,7 @@ var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
 func (s *SnippetService) AddSnippet(w http.ResponseWriter, r *http.Request) {
 	if r.Header.Get("Content-Type") != "application/json" {
-		s.Logger.Warn().Str("function", "AddSnippet").Str("origin", r.RemoteAddr).Msg("Invalid Content-Type, expected application/json")
+		s.logger(r).Warn().Str("function", "AddSnippet").Msg("Invalid Content-Type, expected application/json")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "Content-Type must be 'application/json'")
 		return
 	}
@@ -37,72 +39,120 @@ func (s *SnippetService) AddSnippet(w http.ResponseWriter, r *http.Request) {
 
 	useridStr := r.Header.Get("X-USERID")
 	if useridStr == "" {
-		s.Logger.Warn().Str("function", "AddSnippet").Str("origin", r.RemoteAddr).Msg("Missing 'X-USERID' header")
+		s.logger(r).Warn().Str("function", "AddSnippet").Msg("Missing 'X-USERID' header")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "missing 'X-USERID' header")
 		return
 	}
 
 	userID, err := strconv.Atoi(useridStr)
 	if err != nil {
-		s.Logger.Warn().Str("function", "AddSnippet").Str("origin", r.RemoteAddr).Msg("invalid 'X-USERID' header format")
+		s.logger(r).Warn().Str("function", "AddSnippet").Msg("invalid 'X-USERID' header format")
 		errs.ErrorWithJson(w, http.StatusInternalServerError, "invalid 'X-USERID' header format")
 		return
 	}
 
 	var info = SnippetPool.Get().(*Snippet)
 	defer SnippetPool.Put(info)
+	*info = Snippet{}
 	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
-		s.Logger.Warn().Int("userID", userID).Str("function", "AddSnippet").Str("origin", r.RemoteAddr).Msg("unable to parse request body")
+		if errs.IsBodyTooLarge(err) {
+			s.logger(r).Warn().Str("function", "AddSnippet").Msg("Request body too large")
+			errs.ErrorWithJson(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+
+		s.logger(r).Warn().Str("function", "AddSnippet").Msg("unable to parse request body")
 		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "unable to parse request body")
 		return
 	}
 
+	if info.Vault != nil {
+		s.addVaultSnippet(w, r, userID, info)
+		return
+	}
+
 	if info.Title == "" {
-		s.Logger.Warn().Int("userID", userID).Str("function", "AddSnippet").Str("origin", r.RemoteAddr).Msg("Missing snippet title")
+		s.logger(r).Warn().Str("function", "AddSnippet").Msg("Missing snippet title")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "missing title")
 		return
 	}
 
-	if info.Language == "" {
-		s.Logger.Warn().Int("userID", userID).Str("function", "AddSnippet").Str("origin", r.RemoteAddr).Msg("Missing snippet language")
-		errs.ErrorWithJson(w, http.StatusBadRequest, "missing language")
-		return
+	detect := detectLanguage(info.Language)
+	if !detect {
+		info.Language = snippetLanguage(info.Language)
 	}
 
-	if info.Code == "" {
-		s.Logger.Warn().Int("userID", userID).Str("function", "AddSnippet").Str("origin", r.RemoteAddr).Msg("Missing snippet code")
+	if info.Code == "" && info.CodeSHA256 == "" {
+		s.logger(r).Warn().Str("function", "AddSnippet").Msg("Missing snippet code")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "missing code text")
 		return
 	}
 
 	if len(info.Code) > 3072 {
-		s.Logger.Warn().Int("userID", userID).Str("function", "AddSnippet").Str("origin", r.RemoteAddr).Msg("Data too large")
+		s.logger(r).Warn().Str("function", "AddSnippet").Msg("Data too large")
 		errs.ErrorWithJson(w, http.StatusRequestEntityTooLarge, "code too large")
 		return
 	}
 
-	if err := dba.AddSnippet(s.Db, userID, info.Language, info.Description, info.Title, info.Code, info.Private, info.Favorite, info.Tags, time.Now(), time.Now()); err != nil {
-		s.Logger.Error().Int("userID", userID).Str("function", "AddSnippet").Str("origin", r.RemoteAddr).Msg(err.Error())
+	code, msg := snippetCode(info.Code, info.CodeSHA256)
+	if msg != "" {
+		s.logger(r).Warn().Str("function", "AddSnippet").Msg(msg)
+		errs.ErrorWithJson(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if detect {
+		if info.Code == "" {
+			s.logger(r).Warn().Str("function", "AddSnippet").Msg("Language detection without code")
+			errs.ErrorWithJson(w, http.StatusBadRequest, "missing language, it can only be detected from the code itself")
+			return
+		}
+
+		d := languages.Detect(info.Code, info.Title)
+		s.logger(r).Info().Str("function", "AddSnippet").Str("language", d.Language).Str("source", d.Source).Float64("confidence", d.Confidence).Msg("Detected snippet language")
+		info.Language = d.Language
+	}
+
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	if err := dba.AddSnippet(ctx, s.Db, s.Store, userID, info.Language, info.Description, info.Title, code, info.Private, info.Favorite, info.Tags, time.Now(), time.Now()); err != nil {
+		if s.interrupted(w, r, "AddSnippet", err) {
+			return
+		}
+
+		if errors.Is(err, dba.ErrUnknownBlob) {
+			s.logger(r).Warn().Str("function", "AddSnippet").Msg("Unknown code hash")
+			errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "no code with that code_sha256, send the code instead")
+			return
+		}
+
+		s.logger(r).Error().Str("function", "AddSnippet").Msg(err.Error())
 		errs.ErrorWithJson(w, http.StatusConflict, "failed to add snippet to database")
 		return
 	}
 
-	s.Logger.Info().Int("userID", userID).Str("function", "AddSnippet").Str("origin", r.RemoteAddr).Msg("Served user")
+	s.logger(r).Info().Str("function", "AddSnippet").Msg("Served user")
 	w.WriteHeader(http.StatusCreated)
 }
 
 func (s *SnippetService) GetUserSnippets(w http.ResponseWriter, r *http.Request) {
+	s.userSnippets(w, r, true)
+}
+
+// userSnippets sends a page of the caller's snippets. Without paged, a
+// request with neither page nor limit gets every snippet.
+func (s *SnippetService) userSnippets(w http.ResponseWriter, r *http.Request, paged bool) {
 	defer r.Body.Close()
 	useridStr := r.Header.Get("X-USERID")
 	if useridStr == "" {
-		s.Logger.Warn().Str("function", "GetUserSnippets").Str("origin", r.RemoteAddr).Msg("Missing 'X-USERID' header")
+		s.logger(r).Warn().Str("function", "GetUserSnippets").Msg("Missing 'X-USERID' header")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "missing 'X-USERID' header")
 		return
 	}
 
 	userID, err := strconv.Atoi(useridStr)
 	if err != nil {
-		s.Logger.Warn().Str("function", "GetUserSnippets").Str("origin", r.RemoteAddr).Msg("invalid 'X-USERID' header format")
+		s.logger(r).Warn().Str("function", "GetUserSnippets").Msg("invalid 'X-USERID' header format")
 		errs.ErrorWithJson(w, http.StatusInternalServerError, "invalid 'X-USERID' header format")
 		return
 	}
@@ -112,58 +162,94 @@ func (s *SnippetService) GetUserSnippets(w http.ResponseWriter, r *http.Request)
 	pagestr := params.Get("page")
 
 	var snippets []dba.DBsnippet
-	if limitstr == "" || pagestr == "" {
-		s.Logger.Warn().Str("function", "GetUserSnippets").Str("origin", r.RemoteAddr).Msg("missing 'limit' or 'page' parametr")
-		errs.ErrorWithJson(w, http.StatusBadRequest, "Missing 'limit' or 'page' parameter")
-		return
-	}
-
-	limit, err := strconv.Atoi(limitstr)
-	if err != nil {
-		s.Logger.Warn().Str("function", "GetUserSnippets").Str("origin", r.RemoteAddr).Msg("invalid 'limit' parameter")
-		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid 'limit' parameter")
-		return
-	}
-
-	page, err := strconv.Atoi(pagestr)
-	if err != nil {
-		s.Logger.Warn().Str("function", "GetUserSnippets").Str("origin", r.RemoteAddr).Msg("invalid 'page' parameter")
-		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid 'page' parameter")
-		return
-	}
-
-	if limit <= 0 || page <= 0 {
-		s.Logger.Warn().Str("function", "GetUserSnippets").Str("origin", r.RemoteAddr).Msg("limit or page is smaller or equal to 0")
-		errs.ErrorWithJson(w, http.StatusBadRequest, "'limit' and 'page' parameter must be greater than 0")
-		return
-	}
-
-	if limit > 100 {
-		s.Logger.Warn().Str("function", "GetUserSnippets").Str("origin", r.RemoteAddr).Msg("max 'limit' is 100")
-		errs.ErrorWithJson(w, http.StatusBadRequest, "max 'limit' is 100")
-		return
-	}
+	// A limit of 0 reads every snippet.
+	limit, page := 0, 1
+	if paged || limitstr != "" || pagestr != "" {
+		if limitstr == "" || pagestr == "" {
+			s.logger(r).Warn().Str("function", "GetUserSnippets").Msg("missing 'limit' or 'page' parametr")
+			errs.ErrorWithJson(w, http.StatusBadRequest, "Missing 'limit' or 'page' parameter")
+			return
+		}
+
+		limit, err = strconv.Atoi(limitstr)
+		if err != nil {
+			s.logger(r).Warn().Str("function", "GetUserSnippets").Msg("invalid 'limit' parameter")
+			errs.ErrorWithJson(w, http.StatusBadRequest, "invalid 'limit' parameter")
+			return
+		}
+
+		page, err = strconv.Atoi(pagestr)
+		if err != nil {
+			s.logger(r).Warn().Str("function", "GetUserSnippets").Msg("invalid 'page' parameter")
+			errs.ErrorWithJson(w, http.StatusBadRequest, "invalid 'page' parameter")
+			return
+		}
+
+		if limit <= 0 || page <= 0 {
+			s.logger(r).Warn().Str("function", "GetUserSnippets").Msg("limit or page is smaller or equal to 0")
+			errs.ErrorWithJson(w, http.StatusBadRequest, "'limit' and 'page' parameter must be greater than 0")
+			return
+		}
+
+		if limit > 100 {
+			s.logger(r).Warn().Str("function", "GetUserSnippets").Msg("max 'limit' is 100")
+			errs.ErrorWithJson(w, http.StatusBadRequest, "max 'limit' is 100")
+			return
+		}
+	}
+
+	view, msg := snippetView(params)
+	if msg != "" {
+		s.logger(r).Warn().Str("function", "GetUserSnippets").Msg(msg)
+		errs.ErrorWithJson(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+	format := listFormat(r)
 
 	offset := (page - 1) * limit
-	snippets, err = dba.GetSnippetsByUserID(s.Db, userID, limit, offset)
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	if conditional(r) {
+		version, err := dba.UserSnippetsVersion(ctx, s.Db, userID, limit, offset)
+		if err != nil {
+			if s.interrupted(w, r, "GetUserSnippets", err) {
+				return
+			}
+
+			s.logger(r).Error().Str("function", "GetUserSnippets").Err(err).Msg("failed to fetch snippet versions")
+			errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to fetch snippets from database")
+			return
+		}
+
+		// Lists only revalidate by ETag, their latest update doesn't
+		// change when a snippet leaves the page.
+		if etag := pageETag(version, view, format); version.Snippets > 0 && notModified(r, etag, time.Time{}) {
+			writeNotModified(w, cachePrivate, etag, time.Time{})
+			return
+		}
+	}
+
+	snippets, err = dba.GetSnippetsByUserID(ctx, s.Db, s.Store, userID, limit, offset, view)
 	if err != nil {
-		s.Logger.Error().Int("userID", userID).Str("function", "GetUserSnippets").Str("origin", r.RemoteAddr).Msg("failed to fetch snippets")
+		if s.interrupted(w, r, "GetUserSnippets", err) {
+			return
+		}
+
+		s.logger(r).Error().Str("function", "GetUserSnippets").Msg("failed to fetch snippets")
 		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to fetch snippets from database")
 		return
 	}
 
 	if len(snippets) == 0 {
-		s.Logger.Warn().Int("userID", userID).Str("function", "GetUserSnippets").Str("origin", r.RemoteAddr).Msg("no snippets found for user")
+		s.logger(r).Warn().Str("function", "GetUserSnippets").Msg("no snippets found for user")
 		errs.ErrorWithJson(w, http.StatusNotFound, "no snippets found for user")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(snippets); err != nil {
-		s.Logger.Error().Int("userID", userID).Str("function", "GetUserSnippets").Str("origin", r.RemoteAddr).Msg("failed to encode snippets")
-		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode snippets as JSON")
-		return
-	}
+	validators(w, cachePrivate, pageETag(dba.VersionOf(snippets), view, format), time.Time{})
+	s.writeSnippets(w, r, "GetUserSnippets", snippets, format)
 }
 
 func (s *SnippetService) GetPublicSnippets(w http.ResponseWriter, r *http.Request) {
@@ -173,7 +259,7 @@ func (s *SnippetService) GetPublicSnippets(w http.ResponseWriter, r *http.Reques
 	pagestr := params.Get("page")
 
 	if limitstr == "" || pagestr == "" {
-		s.Logger.Warn().Str("function", "GetPublicSnippets").Str("origin", r.RemoteAddr).Msg("missing 'limit' or 'page' url parameter")
+		s.logger(r).Warn().Str("function", "GetPublicSnippets").Msg("missing 'limit' or 'page' url parameter")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "missing 'limit' or 'page' url parameter.")
 		return
 	}
@@ -182,120 +268,146 @@ func (s *SnippetService) GetPublicSnippets(w http.ResponseWriter, r *http.Reques
 
 	limit, err := strconv.Atoi(limitstr)
 	if err != nil {
-		s.Logger.Warn().Str("function", "GetPublicSnippets").Str("origin", r.RemoteAddr).Msg("invalid 'limit' parameter")
+		s.logger(r).Warn().Str("function", "GetPublicSnippets").Msg("invalid 'limit' parameter")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid 'limit' parameter")
 		return
 	}
 
 	page, err := strconv.Atoi(pagestr)
 	if err != nil {
-		s.Logger.Warn().Str("function", "GetPublicSnippets").Str("origin", r.RemoteAddr).Msg("invalid 'page' parameter")
+		s.logger(r).Warn().Str("function", "GetPublicSnippets").Msg("invalid 'page' parameter")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid 'page' parameter")
 		return
 	}
 
 	if limit <= 0 || page <= 0 {
-		s.Logger.Warn().Str("function", "GetUserSnippets").Str("origin", r.RemoteAddr).Msg("limit or page is smaller or equal to 0")
+		s.logger(r).Warn().Str("function", "GetUserSnippets").Msg("limit or page is smaller or equal to 0")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "'limit' and 'page' parameter must be greater than 0")
 		return
 	}
 
 	if limit > 100 {
-		s.Logger.Warn().Str("function", "GetPublicSnippets").Str("origin", r.RemoteAddr).Msg("max 'limit' is 100")
+		s.logger(r).Warn().Str("function", "GetPublicSnippets").Msg("max 'limit' is 100")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "max 'limit' is 100")
 		return
 	}
 
+	view, msg := snippetView(params)
+	if msg != "" {
+		s.logger(r).Warn().Str("function", "GetPublicSnippets").Msg(msg)
+		errs.ErrorWithJson(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+	format := listFormat(r)
+
 	offset := (page - 1) * limit
-	snippets, err = dba.GetPublicSnippets(s.Db, limit, offset)
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	if conditional(r) {
+		version, err := dba.PublicSnippetsVersion(ctx, s.Db, limit, offset)
+		if err != nil {
+			if s.interrupted(w, r, "GetPublicSnippets", err) {
+				return
+			}
+
+			s.logger(r).Error().Str("function", "GetPublicSnippets").Err(err).Msg("failed to fetch snippet versions")
+			errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to fetch snippets from database")
+			return
+		}
+
+		// Lists only revalidate by ETag, their latest update doesn't
+		// change when a snippet leaves the page.
+		if etag := pageETag(version, view, format); version.Snippets > 0 && notModified(r, etag, time.Time{}) {
+			writeNotModified(w, cachePublic, etag, time.Time{})
+			return
+		}
+	}
+
+	snippets, err = dba.GetPublicSnippets(ctx, s.Db, s.Store, limit, offset, view)
 	if err != nil {
-		s.Logger.Error().Str("function", "GetPublicSnippets").Str("origin", r.RemoteAddr).Msg("failed to fetch public snippets")
+		if s.interrupted(w, r, "GetPublicSnippets", err) {
+			return
+		}
+
+		s.logger(r).Error().Str("function", "GetPublicSnippets").Msg("failed to fetch public snippets")
 		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to fetch snippets from database")
 		return
 	}
 
 	if len(snippets) == 0 {
-		s.Logger.Warn().Str("function", "GetPublicSnippets").Str("origin", r.RemoteAddr).Msg("no public snippets found")
+		s.logger(r).Warn().Str("function", "GetPublicSnippets").Msg("no public snippets found")
 		errs.ErrorWithJson(w, http.StatusNotFound, "no snippets found")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(snippets); err != nil {
-		s.Logger.Error().Str("function", "GetPublicSnippets").Str("origin", r.RemoteAddr).Msg("failed to encode snippets")
-		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode snippets as JSON")
-		return
-	}
+	validators(w, cachePublic, pageETag(dba.VersionOf(snippets), view, format), time.Time{})
+	s.writeSnippets(w, r, "GetPublicSnippets", snippets, format)
 }
 
+// DeleteSnippet deletes a snippet of the caller. A snippet of another user
+// gets a 404 like one that doesn't exist, it is neither deleted nor
+// revealed.
 func (s *SnippetService) DeleteSnippet(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	path := r.URL.Path
 	idString := strings.TrimPrefix(path, "/api/v1/user/snippets/")
 	id, err := strconv.Atoi(idString)
 	if err != nil {
-		s.Logger.Warn().Str("function", "DeleteSnippet").Str("origin", r.RemoteAddr).Msg("failed to parse snippet id in uri")
+		s.logger(r).Warn().Str("function", "DeleteSnippet").Msg("failed to parse snippet id in uri")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "failed to parse snippet id in uri")
 		return
 	}
 
 	if id <= 0 {
-		s.Logger.Warn().Str("function", "DeleteSnippet").Str("origin", r.RemoteAddr).Msg("Snippet id must be a positive integer")
+		s.logger(r).Warn().Str("function", "DeleteSnippet").Msg("Snippet id must be a positive integer")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "Snippet id must be a positive integer")
 		return
 	}
 
-	if err := dba.DeleteSnippet(s.Db, id); err != nil {
-		s.Logger.Error().Int("snippetID", id).Str("function", "DeleteSnippet").Str("origin", r.RemoteAddr).Msg("failed to delete snippet")
-		errs.ErrorWithJson(w, http.StatusBadRequest, "failed to delete snippet")
+	userID, err := strconv.Atoi(r.Header.Get("X-USERID"))
+	if err != nil {
+		s.logger(r).Warn().Str("function", "DeleteSnippet").Msg("invalid 'X-USERID' header format")
+		errs.ErrorWithJson(w, http.StatusUnauthorized, "invalid 'X-USERID' header format")
 		return
 	}
 
-	s.Logger.Info().Int("snippetID", id).Str("function", "DeleteSnippet").Str("origin", r.RemoteAddr).Msg("Successfully deleted snippet")
-}
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	if err := dba.DeleteSnippet(ctx, s.Db, userID, id); err != nil {
+		if s.interrupted(w, r, "DeleteSnippet", err) {
+			return
+		}
 
-func (s *SnippetService) GetSmallUserSnippets(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	useridStr := r.Header.Get("X-USERID")
-	if useridStr == "" {
-		s.Logger.Warn().Str("function", "GetUserSnippets").Str("origin", r.RemoteAddr).Msg("Missing 'X-USERID' header")
-		errs.ErrorWithJson(w, http.StatusBadRequest, "missing 'X-USERID' header")
-		return
-	}
-
-	userID, err := strconv.Atoi(useridStr)
-	if err != nil {
-		s.Logger.Warn().Str("function", "GetUserSnippets").Str("origin", r.RemoteAddr).Msg("invalid 'X-USERID' header format")
-		errs.ErrorWithJson(w, http.StatusInternalServerError, "invalid 'X-USERID' header format")
-		return
-	}
+		if errors.Is(err, dba.ErrSnippetNotFound) {
+			s.logger(r).Warn().Int("snippetID", id).Str("function", "DeleteSnippet").Msg("snippet not found")
+			errs.ErrorWithJson(w, http.StatusNotFound, "snippet not found")
+			return
+		}
 
-	snippets, err := dba.GetSmallUserSnippets(s.Db, userID)
-	if err != nil {
-		s.Logger.Error().Int("userID", userID).Str("function", "GetSmallSnippets").Str("origin", r.RemoteAddr).Err(err).Msg("failed to fetch user snippets")
-		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to fetch snippets from database")
+		s.logger(r).Error().Int("snippetID", id).Str("function", "DeleteSnippet").Msg("failed to delete snippet")
+		errs.ErrorWithJson(w, http.StatusBadRequest, "failed to delete snippet")
 		return
 	}
 
-	if len(snippets) == 0 {
-		s.Logger.Warn().Int("userID", userID).Str("function", "GetSmallSnippets").Str("origin", r.RemoteAddr).Msg("no snippets found for user")
-		errs.ErrorWithJson(w, http.StatusNotFound, "no snippets found for user")
-		return
-	}
+	s.logger(r).Info().Int("snippetID", id).Str("function", "DeleteSnippet").Msg("Successfully deleted snippet")
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(snippets); err != nil {
-		s.Logger.Error().Int("userID", userID).Str("function", "GetUserSnippets").Str("origin", r.RemoteAddr).Msg("failed to encode snippets")
-		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode snippets as JSON")
-		return
-	}
+// GetSmallUserSnippets is GetUserSnippets with the fields the dashboard
+// lists, unless fields asks for others. Without page and limit it sends
+// every snippet, as it did before it took them.
+func (s *SnippetService) GetSmallUserSnippets(w http.ResponseWriter, r *http.Request) {
+	r = r.Clone(r.Context())
+	r.URL.RawQuery = smallSnippetsQuery(r.URL.Query()).Encode()
+	s.userSnippets(w, r, false)
 }
 
 func (s *SnippetService) GetUserSnippetByID(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	useridStr := r.Header.Get("X-USERID")
 	if useridStr == "" {
-		s.Logger.Warn().Str("function", "GetUserSnippets").Str("origin", r.RemoteAddr).Msg("Missing 'X-USERID' header")
+		s.logger(r).Warn().Str("function", "GetUserSnippets").Msg("Missing 'X-USERID' header")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "missing 'X-USERID' header")
 		return
 	}
@@ -304,37 +416,72 @@ func (s *SnippetService) GetUserSnippetByID(w http.ResponseWriter, r *http.Reque
 	idString := strings.TrimPrefix(path, "/api/v1/user/snippets/")
 	id, err := strconv.Atoi(idString)
 	if err != nil {
-		s.Logger.Warn().Str("function", "DeleteSnippet").Str("origin", r.RemoteAddr).Msg("failed to parse snippet id in uri")
+		s.logger(r).Warn().Str("function", "DeleteSnippet").Msg("failed to parse snippet id in uri")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "failed to parse snippet id in uri")
 		return
 	}
 
 	userID, err := strconv.Atoi(useridStr)
 	if err != nil {
-		s.Logger.Warn().Str("function", "GetUserSnippets").Str("origin", r.RemoteAddr).Msg("invalid 'X-USERID' header format")
+		s.logger(r).Warn().Str("function", "GetUserSnippets").Msg("invalid 'X-USERID' header format")
 		errs.ErrorWithJson(w, http.StatusInternalServerError, "invalid 'X-USERID' header format")
 		return
 	}
 
-	snippet, err := dba.GetSnippetByIDAndUserID(s.Db, userID, id)
-	if err != nil {
-		s.Logger.Error().Int("userID", userID).Str("function", "GetSmallSnippets").Str("origin", r.RemoteAddr).Err(err).Msg("failed to fetch user snippets")
-		errs.ErrorWithJson(w, http.StatusNotFound, "failed to fetch snippets from database")
+	params := r.URL.Query()
+	view, msg := snippetView(params)
+	if msg != "" {
+		s.logger(r).Warn().Str("function", "GetUserSnippetByID").Msg(msg)
+		errs.ErrorWithJson(w, http.StatusBadRequest, msg)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(snippet); err != nil {
-		s.Logger.Error().Int("userID", userID).Str("function", "GetUserSnippets").Str("origin", r.RemoteAddr).Msg("failed to encode snippets")
-		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode snippets as JSON")
+	w.Header().Add("Vary", "Accept")
+	format := snippetFormat(r)
+	if format == formatRaw {
+		s.userCode(w, r, "GetUserSnippetByID", false)
 		return
 	}
+
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	if conditional(r) {
+		updated, err := dba.SnippetVersion(ctx, s.Db, userID, id)
+		if err != nil && !errors.Is(err, dba.ErrSnippetNotFound) {
+			if s.interrupted(w, r, "GetUserSnippetByID", err) {
+				return
+			}
+
+			s.logger(r).Error().Str("function", "GetUserSnippetByID").Err(err).Msg("failed to fetch snippet version")
+			errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to fetch snippets from database")
+			return
+		}
+
+		if etag := snippetETag(id, updated, view, format); err == nil && notModified(r, etag, updated) {
+			writeNotModified(w, cachePrivate, etag, updated)
+			return
+		}
+	}
+
+	snippet, err := dba.GetSnippetByIDAndUserID(ctx, s.Db, s.Store, userID, id, view)
+	if err != nil {
+		if s.interrupted(w, r, "GetUserSnippetByID", err) {
+			return
+		}
+
+		s.logger(r).Error().Str("function", "GetSmallSnippets").Err(err).Msg("failed to fetch user snippets")
+		errs.ErrorWithJson(w, http.StatusNotFound, "failed to fetch snippets from database")
+		return
+	}
+
+	validators(w, cachePrivate, snippetETag(snippet.ID, snippet.Updated, view, format), snippet.Updated)
+	s.writeSnippet(w, r, "GetUserSnippetByID", snippet, format)
 }
 
 func (s *SnippetService) UpdateUserSnippetByID(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	if r.Header.Get("Content-Type") != "application/json" {
-		s.Logger.Warn().Str("function", "UpdateUserSnippetByID").Str("origin", r.RemoteAddr).Msg("Invalid Content-Type, expected application/json")
+		s.logger(r).Warn().Str("function", "UpdateUserSnippetByID").Msg("Invalid Content-Type, expected application/json")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "Content-Type must be 'application/json'")
 		return
 	}
@@ -343,30 +490,115 @@ func (s *SnippetService) UpdateUserSnippetByID(w http.ResponseWriter, r *http.Re
 	idString := strings.TrimPrefix(path, "/api/v1/user/snippets/")
 	id, err := strconv.Atoi(idString)
 	if err != nil {
-		s.Logger.Warn().Str("function", "UpdateUserSnippetByID").Str("origin", r.RemoteAddr).Msg("failed to parse snippet id in uri")
+		s.logger(r).Warn().Str("function", "UpdateUserSnippetByID").Msg("failed to parse snippet id in uri")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "failed to parse snippet id in uri")
 		return
 	}
 
+	userID, err := strconv.Atoi(r.Header.Get("X-USERID"))
+	if err != nil {
+		s.logger(r).Warn().Str("function", "UpdateUserSnippetByID").Msg("invalid 'X-USERID' header format")
+		errs.ErrorWithJson(w, http.StatusUnauthorized, "invalid 'X-USERID' header format")
+		return
+	}
+
 	var info = UpdateSnippetPool.Get().(*UpdateSnippet)
 	defer UpdateSnippetPool.Put(info)
+	*info = UpdateSnippet{}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		s.Logger.Warn().Str("function", "UpdateUserSnippetByID").Str("origin", r.RemoteAddr).Msg("failed to read body")
+		if errs.IsBodyTooLarge(err) {
+			s.logger(r).Warn().Str("function", "UpdateUserSnippetByID").Msg("Request body too large")
+			errs.ErrorWithJson(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+
+		s.logger(r).Warn().Str("function", "UpdateUserSnippetByID").Msg("failed to read body")
 		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "failed to read body")
 		return
 	}
 
 	if err := info.UnmarshalJSON(body); err != nil {
-		s.Logger.Warn().Str("function", "UpdateUserSnippetByID").Str("origin", r.RemoteAddr).Msg("failed to decode json")
+		s.logger(r).Warn().Str("function", "UpdateUserSnippetByID").Msg("failed to decode json")
 		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "failed to decode json")
 		return
 	}
 
-	if err := dba.UpdateUserSnippetByID(s.Db, id, info.Language, info.Title, info.Code, info.Favorite, info.Private, info.Tags, info.Description); err != nil {
-		s.Logger.Warn().Str("function", "UpdateUserSnippetByID").Str("origin", r.RemoteAddr).Err(err).Msg("failed to update snippet in db")
+	if info.Vault != nil {
+		if msg := checkVaultSnippet(info.Vault); msg != "" {
+			s.logger(r).Warn().Str("function", "UpdateUserSnippetByID").Msg(msg)
+			errs.ErrorWithJson(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+
+	if info.Language != nil {
+		language := snippetLanguage(*info.Language)
+		info.Language = &language
+	}
+
+	var code *dba.Code
+	if info.Code != nil || info.CodeSHA256 != nil {
+		var text, hash string
+		if info.Code != nil {
+			text = *info.Code
+		}
+		if info.CodeSHA256 != nil {
+			hash = *info.CodeSHA256
+		}
+
+		c, msg := snippetCode(text, hash)
+		if msg != "" {
+			s.logger(r).Warn().Str("function", "UpdateUserSnippetByID").Msg(msg)
+			errs.ErrorWithJson(w, http.StatusBadRequest, msg)
+			return
+		}
+		code = &c
+	}
+
+	version, ok := ifMatch(r, id)
+	if !ok {
+		s.logger(r).Warn().Str("function", "UpdateUserSnippetByID").Int("snippet", id).Msg("If-Match is not a version of the snippet")
+		errs.ErrorWithJson(w, http.StatusPreconditionFailed, "snippet changed, fetch it again")
+		return
+	}
+
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	updated, err := dba.UpdateUserSnippetByID(ctx, s.Db, s.Store, userID, id, info.Language, info.Title, code, info.Favorite, info.Private, info.Tags, info.Description, info.Vault, version)
+	if err != nil {
+		if s.interrupted(w, r, "UpdateUserSnippetByID", err) {
+			return
+		}
+
+		if errors.Is(err, dba.ErrSnippetChanged) {
+			s.logger(r).Warn().Str("function", "UpdateUserSnippetByID").Int("snippet", id).Msg("snippet changed since If-Match")
+			errs.ErrorWithJson(w, http.StatusPreconditionFailed, "snippet changed, fetch it again")
+			return
+		}
+
+		if errors.Is(err, dba.ErrUnknownBlob) {
+			s.logger(r).Warn().Str("function", "UpdateUserSnippetByID").Msg("Unknown code hash")
+			errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "no code with that code_sha256, send the code instead")
+			return
+		}
+
+		if errors.Is(err, dba.ErrSnippetNotFound) {
+			s.logger(r).Warn().Str("function", "UpdateUserSnippetByID").Int("snippet", id).Msg("snippet not found")
+			errs.ErrorWithJson(w, http.StatusNotFound, "snippet not found")
+			return
+		}
+
+		if errors.Is(err, dba.ErrVaultMismatch) {
+			s.logger(r).Warn().Str("function", "UpdateUserSnippetByID").Int("snippet", id).Msg("plain and vault fields mixed up")
+			errs.ErrorWithJson(w, http.StatusConflict, "vault snippets only take 'vault', 'language' and 'favorite', other snippets can't take 'vault'")
+			return
+		}
+
+		s.logger(r).Warn().Str("function", "UpdateUserSnippetByID").Err(err).Msg("failed to update snippet in db")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "failed to update snippet")
 		return
 	}
+	w.Header().Set("ETag", snippetETag(id, updated, dba.View{}, formatJSON))
 }
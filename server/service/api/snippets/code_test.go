@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 
 	"testing"
 	"time"
@@ -21,6 +22,9 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// testSecret signs the tokens of the tests.
+var testSecret = []byte("codelet-test-secret-codelet-test-secret")
+
 func setupTestDB(testData string) (*pgxpool.Pool, func(), error) {
 	ctx := context.Background()
 
@@ -55,6 +59,9 @@ func setupTestDB(testData string) (*pgxpool.Pool, func(), error) {
 		password_hash VARCHAR(255) NOT NULL,
 		last_login TIMESTAMP,
 		refresh_token text DEFAULT null,
+		disabled BOOLEAN NOT NULL DEFAULT false,
+		delete_after TIMESTAMPTZ,
+		vault JSONB,
 		created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		);
@@ -65,6 +72,41 @@ func setupTestDB(testData string) (*pgxpool.Pool, func(), error) {
 		return nil, nil, fmt.Errorf("failed to create users table: %v", err)
 	}
 
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS data_keys (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+		master_key_id TEXT NOT NULL,
+		wrapped_key BYTEA NOT NULL,
+		created TIMESTAMPTZ NOT NULL DEFAULT now(),
+		rotated TIMESTAMPTZ
+		);
+	`)
+
+	if err != nil {
+		clean()
+		return nil, nil, fmt.Errorf("failed to create data_keys table: %v", err)
+	}
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS code_blobs (
+		id BIGSERIAL PRIMARY KEY,
+		hash BYTEA NOT NULL,
+		key_id INT REFERENCES data_keys(id) ON DELETE CASCADE,
+		language TEXT NOT NULL DEFAULT '',
+		code BYTEA NOT NULL,
+		refs INT NOT NULL DEFAULT 0,
+		created TIMESTAMPTZ NOT NULL DEFAULT now(),
+		unreferenced TIMESTAMPTZ DEFAULT now()
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS code_blobs_hash_key_idx ON code_blobs(hash, COALESCE(key_id, 0));
+	`)
+
+	if err != nil {
+		clean()
+		return nil, nil, fmt.Errorf("failed to create code_blobs table: %v", err)
+	}
+
 	_, err = conn.Exec(ctx, `
 		CREATE TABLE IF NOT EXISTS snippets (
 		id SERIAL PRIMARY KEY,
@@ -72,7 +114,12 @@ func setupTestDB(testData string) (*pgxpool.Pool, func(), error) {
 		language VARCHAR(50) NOT NULL,
 		favorite boolean DEFAULT false,
 		title VARCHAR(255) NOT NULL UNIQUE,
-		code BYTEA NOT NULL,
+		code BYTEA,
+		key_id INT REFERENCES data_keys(id),
+		blob_id BIGINT REFERENCES code_blobs(id),
+		vault BOOLEAN NOT NULL DEFAULT false,
+		vault_title BYTEA,
+		vault_description BYTEA,
 		description TEXT,
 		private boolean NOT NULL,
 		tags VARCHAR(50)[],
@@ -109,7 +156,7 @@ func TestAddUser(t *testing.T) {
 	}
 	defer clean()
 
-	sp := &vsr.UserService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	sp := &vsr.UserService{Db: conn, Logger: zerolog.New(os.Stdout), AccessTokenTTL: time.Hour, RefreshTokenTTL: 2 * time.Hour, JWTSecret: testSecret}
 
 	body, err := json.Marshal(vsr.UserLogin{Email: "fakeuser@example.com", Password: "hashedpassword123"})
 	if err != nil {
@@ -172,8 +219,35 @@ func TestAddUser(t *testing.T) {
 				Tags:        []string{"sigma", "wobc"},
 				Description: "wljkhf",
 			},
+			expected: http.StatusCreated,
+		},
+		{
+			name: "Auto language request",
+			info: Snippet{
+				Language: "auto",
+				Title:    "main.go",
+				Code:     "fmt.Println('hello)",
+			},
+			expected: http.StatusCreated,
+		},
+		{
+			name: "Auto language without code request",
+			info: Snippet{
+				Language:   "auto",
+				Title:      "go test",
+				CodeSHA256: strings.Repeat("ab", 32),
+			},
 			expected: http.StatusBadRequest,
 		},
+		{
+			name: "Unknown language request",
+			info: Snippet{
+				Language: "klingon",
+				Title:    "go test",
+				Code:     "fmt.Println('hello)",
+			},
+			expected: http.StatusCreated,
+		},
 		{
 			name: "Empty code request",
 			info: Snippet{
@@ -202,7 +276,7 @@ func TestAddUser(t *testing.T) {
 		},
 	}
 
-	app := SnippetService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	app := SnippetService{Db: conn, Store: dba.NewCodeStore(nil), Logger: zerolog.New(os.Stdout)}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -215,7 +289,7 @@ func TestAddUser(t *testing.T) {
 			req.Header.Set("Content-Type", "application/json")
 			req.Header.Set("Authorization", rr.Token)
 
-			handler := middleware.AuthMiddleware(http.HandlerFunc(app.AddSnippet))
+			handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.AddSnippet))
 			handler.ServeHTTP(rec, req)
 
 			if rec.Code != tt.expected {
@@ -234,7 +308,7 @@ func TestAddUser(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Authorization", rr.Token)
 
-		handler := middleware.AuthMiddleware(http.HandlerFunc(app.AddSnippet))
+		handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.AddSnippet))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusUnprocessableEntity {
@@ -252,7 +326,7 @@ func TestAddUser(t *testing.T) {
 		req.Header.Set("Content-Type", "json/text")
 		req.Header.Set("Authorization", rr.Token)
 
-		handler := middleware.AuthMiddleware(http.HandlerFunc(app.AddSnippet))
+		handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.AddSnippet))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
@@ -322,7 +396,7 @@ func TestGetUserSnippets(t *testing.T) {
 	}
 	defer clean()
 
-	sp := &vsr.UserService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	sp := &vsr.UserService{Db: conn, Logger: zerolog.New(os.Stdout), AccessTokenTTL: time.Hour, RefreshTokenTTL: 2 * time.Hour, JWTSecret: testSecret}
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -346,7 +420,7 @@ func TestGetUserSnippets(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	app := SnippetService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	app := SnippetService{Db: conn, Store: dba.NewCodeStore(nil), Logger: zerolog.New(os.Stdout)}
 
 	info := Snippet{
 		Language:    "go",
@@ -368,7 +442,7 @@ func TestGetUserSnippets(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", rr.Token)
 
-	handler := middleware.AuthMiddleware(http.HandlerFunc(app.AddSnippet))
+	handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.AddSnippet))
 	handler.ServeHTTP(rec, req)
 
 	if rec.Code != http.StatusCreated {
@@ -380,7 +454,7 @@ func TestGetUserSnippets(t *testing.T) {
 		req := httptest.NewRequest("GET", "/api/v1/user/snippets?page=1&limit=5", bytes.NewBuffer(body))
 		req.Header.Set("Authorization", rr.Token)
 
-		handler := middleware.AuthMiddleware(http.HandlerFunc(app.GetUserSnippets))
+		handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.GetUserSnippets))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusOK {
@@ -393,7 +467,7 @@ func TestGetUserSnippets(t *testing.T) {
 		req := httptest.NewRequest("GET", "/api/v1/user/snippets", bytes.NewBuffer(body))
 		req.Header.Set("Authorization", rr.Token)
 
-		handler := middleware.AuthMiddleware(http.HandlerFunc(app.GetUserSnippets))
+		handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.GetUserSnippets))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
@@ -406,7 +480,7 @@ func TestGetUserSnippets(t *testing.T) {
 		req := httptest.NewRequest("GET", "/api/v1/user/snippets?page=3&limit=5", bytes.NewBuffer(body))
 		req.Header.Set("Authorization", rr.Token)
 
-		handler := middleware.AuthMiddleware(http.HandlerFunc(app.GetUserSnippets))
+		handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.GetUserSnippets))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusNotFound {
@@ -419,7 +493,7 @@ func TestGetUserSnippets(t *testing.T) {
 		req := httptest.NewRequest("GET", "/api/v1/user/snippets?page=1&limit=2048", bytes.NewBuffer(body))
 		req.Header.Set("Authorization", rr.Token)
 
-		handler := middleware.AuthMiddleware(http.HandlerFunc(app.GetUserSnippets))
+		handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.GetUserSnippets))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
@@ -444,7 +518,7 @@ func TestGetUserSnippets(t *testing.T) {
 		req := httptest.NewRequest("GET", "/api/v1/user/snippets?page=-2&limit=-2048", bytes.NewBuffer(body))
 		req.Header.Set("Authorization", rr.Token)
 
-		handler := middleware.AuthMiddleware(http.HandlerFunc(app.GetUserSnippets))
+		handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.GetUserSnippets))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
@@ -465,7 +539,7 @@ func TestGetPublicSnippets(t *testing.T) {
 	}
 	defer clean()
 
-	sp := &vsr.UserService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	sp := &vsr.UserService{Db: conn, Logger: zerolog.New(os.Stdout), AccessTokenTTL: time.Hour, RefreshTokenTTL: 2 * time.Hour, JWTSecret: testSecret}
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -489,7 +563,7 @@ func TestGetPublicSnippets(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	app := SnippetService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	app := SnippetService{Db: conn, Store: dba.NewCodeStore(nil), Logger: zerolog.New(os.Stdout)}
 
 	info := Snippet{
 		Language:    "go",
@@ -511,7 +585,7 @@ func TestGetPublicSnippets(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", rr.Token)
 
-	handler := middleware.AuthMiddleware(http.HandlerFunc(app.AddSnippet))
+	handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.AddSnippet))
 	handler.ServeHTTP(rec, req)
 
 	if rec.Code != http.StatusCreated {
@@ -584,6 +658,29 @@ func TestGetPublicSnippets(t *testing.T) {
 		}
 	})
 
+	t.Run("Scheduled for deletion", func(t *testing.T) {
+		if err := dba.ScheduleUserDeletion(context.Background(), conn, 1, time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		app.GetPublicSnippets(rec, httptest.NewRequest("GET", "/api/v1/public/snippets?page=1&limit=5", http.NoBody))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected the snippets of a scheduled account to be hidden, got %d", rec.Code)
+		}
+
+		login, err := json.Marshal(vsr.UserLogin{Email: "fakeuser@example.com", Password: "hashedpassword123"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sp.Login(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/v1/login", bytes.NewReader(login)))
+
+		rec = httptest.NewRecorder()
+		app.GetPublicSnippets(rec, httptest.NewRequest("GET", "/api/v1/public/snippets?page=1&limit=5", http.NoBody))
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected a login to bring the snippets back, got %d", rec.Code)
+		}
+	})
 }
 
 func TestDeleteSnippet(t *testing.T) {
@@ -592,13 +689,13 @@ func TestDeleteSnippet(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	conn, clean, err := setupTestDB(fmt.Sprintf(`INSERT INTO users (username, email, role, password_hash) VALUES ('fakeuser', 'fakeuser@example.com', 'user', '%s');`, string(hashedPassword)))
+	conn, clean, err := setupTestDB(fmt.Sprintf(`INSERT INTO users (username, email, role, password_hash) VALUES ('fakeuser', 'fakeuser@example.com', 'user', '%s'), ('otheruser', 'otheruser@example.com', 'user', '%s');`, string(hashedPassword), string(hashedPassword)))
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer clean()
 
-	sp := &vsr.UserService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	sp := &vsr.UserService{Db: conn, Logger: zerolog.New(os.Stdout), AccessTokenTTL: time.Hour, RefreshTokenTTL: 2 * time.Hour, JWTSecret: testSecret}
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -622,7 +719,7 @@ func TestDeleteSnippet(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	app := SnippetService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	app := SnippetService{Db: conn, Store: dba.NewCodeStore(nil), Logger: zerolog.New(os.Stdout)}
 
 	info := Snippet{
 		Language:    "go",
@@ -644,7 +741,7 @@ func TestDeleteSnippet(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", rr.Token)
 
-	handler := middleware.AuthMiddleware(http.HandlerFunc(app.AddSnippet))
+	handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.AddSnippet))
 	handler.ServeHTTP(rec, req)
 
 	if rec.Code != http.StatusCreated {
@@ -656,7 +753,7 @@ func TestDeleteSnippet(t *testing.T) {
 		req := httptest.NewRequest("DELETE", "/api/v1/user/snippets/sluyfd", nil)
 		req.Header.Set("Authorization", rr.Token)
 
-		handler := middleware.AuthMiddleware(http.HandlerFunc(app.DeleteSnippet))
+		handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.DeleteSnippet))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
@@ -669,7 +766,7 @@ func TestDeleteSnippet(t *testing.T) {
 		req := httptest.NewRequest("DELETE", "/api/v1/user/snippets/-23", nil)
 		req.Header.Set("Authorization", rr.Token)
 
-		handler := middleware.AuthMiddleware(http.HandlerFunc(app.DeleteSnippet))
+		handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.DeleteSnippet))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
@@ -677,12 +774,42 @@ func TestDeleteSnippet(t *testing.T) {
 		}
 	})
 
+	t.Run("Another user's snippet", func(t *testing.T) {
+		body, err := json.Marshal(vsr.UserLogin{Email: "otheruser@example.com", Password: "hashedpassword123"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		loginReq := httptest.NewRequest("POST", "/api/v1/login", bytes.NewReader(body))
+		loginReq.Header.Set("Content-Type", "application/json")
+		loginRec := httptest.NewRecorder()
+		sp.Login(loginRec, loginReq)
+
+		var other struct {
+			Token string `json:"access_token"`
+		}
+		if err := json.NewDecoder(loginRec.Body).Decode(&other); err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", "/api/v1/user/snippets/1", nil)
+		req.Header.Set("Authorization", other.Token)
+
+		handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.DeleteSnippet))
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rec.Code)
+		}
+	})
+
 	t.Run("Valid Delete", func(t *testing.T) {
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest("DELETE", "/api/v1/user/snippets/1", nil)
 		req.Header.Set("Authorization", rr.Token)
 
-		handler := middleware.AuthMiddleware(http.HandlerFunc(app.DeleteSnippet))
+		handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.DeleteSnippet))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusOK {
@@ -690,6 +817,18 @@ func TestDeleteSnippet(t *testing.T) {
 		}
 	})
 
+	t.Run("Already deleted", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", "/api/v1/user/snippets/1", nil)
+		req.Header.Set("Authorization", rr.Token)
+
+		handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.DeleteSnippet))
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rec.Code)
+		}
+	})
 }
 
 func TestGetSmallUserSnippets(t *testing.T) {
@@ -704,7 +843,7 @@ func TestGetSmallUserSnippets(t *testing.T) {
 	}
 	defer clean()
 
-	sp := &vsr.UserService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	sp := &vsr.UserService{Db: conn, Logger: zerolog.New(os.Stdout), AccessTokenTTL: time.Hour, RefreshTokenTTL: 2 * time.Hour, JWTSecret: testSecret}
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -728,7 +867,7 @@ func TestGetSmallUserSnippets(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	app := SnippetService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	app := SnippetService{Db: conn, Store: dba.NewCodeStore(nil), Logger: zerolog.New(os.Stdout)}
 
 	info := Snippet{
 		Language:    "go",
@@ -750,7 +889,7 @@ func TestGetSmallUserSnippets(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", rr.Token)
 
-	handler := middleware.AuthMiddleware(http.HandlerFunc(app.AddSnippet))
+	handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.AddSnippet))
 	handler.ServeHTTP(rec, req)
 
 	if rec.Code != http.StatusCreated {
@@ -763,13 +902,26 @@ func TestGetSmallUserSnippets(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Authorization", rr.Token)
 
-		handler := middleware.AuthMiddleware((http.HandlerFunc(app.GetSmallUserSnippets)))
+		handler := middleware.AuthMiddleware(testSecret, (http.HandlerFunc(app.GetSmallUserSnippets)))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusOK {
 			t.Fatal("Failed to get small snippet")
 		}
 	})
+
+	t.Run("Limit over maximum", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/v1/user/small/snippets?page=1&limit=101", http.NoBody)
+		req.Header.Set("Authorization", rr.Token)
+
+		handler := middleware.AuthMiddleware(testSecret, (http.HandlerFunc(app.GetSmallUserSnippets)))
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected %d, got %d", http.StatusBadRequest, rec.Code)
+		}
+	})
 }
 
 func TestGetUserSnippetByID(t *testing.T) {
@@ -784,7 +936,7 @@ func TestGetUserSnippetByID(t *testing.T) {
 	}
 	defer clean()
 
-	sp := &vsr.UserService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	sp := &vsr.UserService{Db: conn, Logger: zerolog.New(os.Stdout), AccessTokenTTL: time.Hour, RefreshTokenTTL: 2 * time.Hour, JWTSecret: testSecret}
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -808,7 +960,7 @@ func TestGetUserSnippetByID(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	app := SnippetService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	app := SnippetService{Db: conn, Store: dba.NewCodeStore(nil), Logger: zerolog.New(os.Stdout)}
 
 	info := Snippet{
 		Language:    "go",
@@ -830,7 +982,7 @@ func TestGetUserSnippetByID(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", rr.Token)
 
-	handler := middleware.AuthMiddleware(http.HandlerFunc(app.AddSnippet))
+	handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.AddSnippet))
 	handler.ServeHTTP(rec, req)
 
 	if rec.Code != http.StatusCreated {
@@ -843,7 +995,7 @@ func TestGetUserSnippetByID(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Authorization", rr.Token)
 
-		handler := middleware.AuthMiddleware((http.HandlerFunc(app.GetSmallUserSnippets)))
+		handler := middleware.AuthMiddleware(testSecret, (http.HandlerFunc(app.GetSmallUserSnippets)))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusOK {
@@ -864,7 +1016,7 @@ func TestUpdateUserSnippetByID(t *testing.T) {
 	}
 	defer clean()
 
-	sp := &vsr.UserService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	sp := &vsr.UserService{Db: conn, Logger: zerolog.New(os.Stdout), AccessTokenTTL: time.Hour, RefreshTokenTTL: 2 * time.Hour, JWTSecret: testSecret}
 
 	body, err := json.Marshal(vsr.UserLogin{Email: "fakeuser@example.com", Password: "hashedpassword123"})
 	if err != nil {
@@ -924,7 +1076,7 @@ func TestUpdateUserSnippetByID(t *testing.T) {
 		},
 	}
 
-	app := &SnippetService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	app := &SnippetService{Db: conn, Store: dba.NewCodeStore(nil), Logger: zerolog.New(os.Stdout)}
 	info := Snippet{
 		Language:    "go",
 		Title:       "go test",
@@ -945,7 +1097,7 @@ func TestUpdateUserSnippetByID(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", rr.Token)
 
-	handler := middleware.AuthMiddleware(http.HandlerFunc(app.AddSnippet))
+	handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.AddSnippet))
 	handler.ServeHTTP(rec, req)
 
 	if rec.Code != http.StatusCreated {
@@ -964,7 +1116,7 @@ func TestUpdateUserSnippetByID(t *testing.T) {
 			req.Header.Set("Content-Type", "application/json")
 			req.Header.Set("Authorization", rr.Token)
 
-			handler := middleware.AuthMiddleware(http.HandlerFunc(app.UpdateUserSnippetByID))
+			handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.UpdateUserSnippetByID))
 			handler.ServeHTTP(rec, req)
 
 			if rec.Code != info.expectedCode {
@@ -983,7 +1135,7 @@ func TestUpdateUserSnippetByID(t *testing.T) {
 		req := httptest.NewRequest("UPDATE", "/api/v1/user/snippets/1", bytes.NewReader(body))
 		req.Header.Set("Authorization", rr.Token)
 
-		handler := middleware.AuthMiddleware(http.HandlerFunc(app.UpdateUserSnippetByID))
+		handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.UpdateUserSnippetByID))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
@@ -998,7 +1150,7 @@ func TestUpdateUserSnippetByID(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Authorization", rr.Token)
 
-		handler := middleware.AuthMiddleware(http.HandlerFunc(app.UpdateUserSnippetByID))
+		handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.UpdateUserSnippetByID))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusUnprocessableEntity {
@@ -1016,7 +1168,7 @@ func TestUpdateUserSnippetByID(t *testing.T) {
 		req := httptest.NewRequest("UPDATE", "/api/v1/user/snippets/1", bytes.NewReader(body))
 		req.Header.Set("Content-Type", "application/json")
 
-		handler := middleware.AuthMiddleware(http.HandlerFunc(app.UpdateUserSnippetByID))
+		handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.UpdateUserSnippetByID))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusForbidden {
@@ -1035,7 +1187,7 @@ func TestUpdateUserSnippetByID(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Authorization", rr.Token)
 
-		handler := middleware.AuthMiddleware(http.HandlerFunc(app.UpdateUserSnippetByID))
+		handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.UpdateUserSnippetByID))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusBadRequest {
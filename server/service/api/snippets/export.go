@@ -0,0 +1,178 @@
+package snippets
+
+import (
+	"archive/zip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	dba "github.com/scott-mescudi/codelet/service/data_access"
+	errs "github.com/scott-mescudi/codelet/shared/errors"
+	"github.com/scott-mescudi/codelet/shared/languages"
+)
+
+// ExportMetadata is written to metadata.json at the root of an export, it
+// carries everything about a snippet except its code.
+type ExportMetadata struct {
+	Exported time.Time         `json:"exported"`
+	Snippets []ExportedSnippet `json:"snippets"`
+}
+
+type ExportedSnippet struct {
+	ID          int       `json:"id"`
+	File        string    `json:"file"`
+	Language    string    `json:"language"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Tags        []string  `json:"tags"`
+	Private     bool      `json:"private"`
+	Favorite    bool      `json:"favorite"`
+	Vault       bool      `json:"vault,omitempty"`
+	Created     time.Time `json:"created"`
+	Updated     time.Time `json:"updated"`
+}
+
+// ExportSnippets sends every snippet of the caller as a zip archive, one file
+// per snippet under snippets/ plus a metadata.json describing them. Vault
+// snippets are exported as their sealed JSON, only the owner's client can
+// open them.
+func (s *SnippetService) ExportSnippets(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	useridStr := r.Header.Get("X-USERID")
+	if useridStr == "" {
+		s.logger(r).Warn().Str("function", "ExportSnippets").Msg("Missing 'X-USERID' header")
+		errs.ErrorWithJson(w, http.StatusBadRequest, "missing 'X-USERID' header")
+		return
+	}
+
+	userID, err := strconv.Atoi(useridStr)
+	if err != nil {
+		s.logger(r).Warn().Str("function", "ExportSnippets").Msg("invalid 'X-USERID' header format")
+		errs.ErrorWithJson(w, http.StatusBadRequest, "invalid 'X-USERID' header format")
+		return
+	}
+
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	snippets, err := dba.GetAllSnippetsByUserID(ctx, s.Db, s.Store, userID)
+	if err != nil {
+		if s.interrupted(w, r, "ExportSnippets", err) {
+			return
+		}
+
+		s.logger(r).Error().Str("function", "ExportSnippets").Err(err).Msg("failed to get snippets from database")
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get snippets from database")
+		return
+	}
+
+	// Writing out a large archive can take longer than the server write
+	// timeout allows.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		s.logger(r).Warn().Str("function", "ExportSnippets").Err(err).Msg("unable to lift the write deadline")
+	}
+
+	now := time.Now().UTC()
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="codelet-export-`+now.Format("2006-01-02")+`.zip"`)
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := writeExport(w, snippets, now); err != nil {
+		// The headers are out already, cutting the connection is the only
+		// way left to tell the client the archive is incomplete.
+		s.logger(r).Error().Str("function", "ExportSnippets").Err(err).Msg("failed to write export")
+		panic(http.ErrAbortHandler)
+	}
+
+	s.logger(r).Info().Str("function", "ExportSnippets").Int("snippets", len(snippets)).Msg("Exported snippets")
+}
+
+func writeExport(w io.Writer, snippets []dba.DBsnippet, now time.Time) error {
+	zw := zip.NewWriter(w)
+	meta := ExportMetadata{Exported: now, Snippets: make([]ExportedSnippet, 0, len(snippets))}
+
+	for _, sn := range snippets {
+		name := exportFileName(sn)
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: sn.Updated})
+		if err != nil {
+			return err
+		}
+
+		if sn.Vault != nil {
+			err = json.NewEncoder(f).Encode(sn.Vault)
+		} else {
+			_, err = io.WriteString(f, sn.Code)
+		}
+		if err != nil {
+			return err
+		}
+
+		meta.Snippets = append(meta.Snippets, ExportedSnippet{
+			ID:          sn.ID,
+			File:        name,
+			Language:    sn.Language,
+			Title:       sn.Title,
+			Description: sn.Description,
+			Tags:        sn.Tags,
+			Private:     sn.Private,
+			Favorite:    sn.Favorite,
+			Vault:       sn.Vault != nil,
+			Created:     sn.Created,
+			Updated:     sn.Updated,
+		})
+	}
+
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: "metadata.json", Method: zip.Deflate, Modified: now})
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(meta); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// exportFileName names a snippet inside the archive. The ID keeps names
+// unique when titles repeat.
+func exportFileName(sn dba.DBsnippet) string {
+	if sn.Vault != nil {
+		return "snippets/" + strconv.Itoa(sn.ID) + "-vault.json"
+	}
+	return "snippets/" + strconv.Itoa(sn.ID) + "-" + slug(sn.Title) + languages.Extension(sn.Language)
+}
+
+// slug reduces a title to lowercase ASCII letters, digits and single dashes,
+// so it is a safe file name on every platform.
+func slug(title string) string {
+	const maxLen = 60
+
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(title) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(c)
+		default:
+			dash = true
+		}
+
+		if b.Len() >= maxLen {
+			break
+		}
+	}
+
+	if b.Len() == 0 {
+		return "snippet"
+	}
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package snippets
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	dba "github.com/scott-mescudi/codelet/service/data_access"
+	"github.com/scott-mescudi/codelet/shared/vault"
+)
+
+func TestSlug(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{title: "Hello World", want: "hello-world"},
+		{title: "  Sort a map -- by value!  ", want: "sort-a-map-by-value"},
+		{title: "../../etc/passwd", want: "etc-passwd"},
+		{title: "日本語", want: "snippet"},
+		{title: "", want: "snippet"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			if got := slug(tt.title); got != tt.want {
+				t.Errorf("slug(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteExport(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	snippets := []dba.DBsnippet{
+		{ID: 7, Language: "Go", Title: "Main", Code: "package main\n", Tags: []string{"go"}, Created: now, Updated: now},
+		{ID: 9, Language: "brainfuck", Title: "Main", Code: "+++.", Private: true, Created: now, Updated: now},
+		{ID: 11, Language: "go", Private: true, Vault: &vault.Snippet{Title: []byte{1}, Code: []byte{2}}, Created: now, Updated: now},
+	}
+
+	var buf bytes.Buffer
+	if err := writeExport(&buf, snippets, now); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(data)
+	}
+
+	want := map[string]string{
+		"snippets/7-main.go":     "package main\n",
+		"snippets/9-main.txt":    "+++.",
+		"snippets/11-vault.json": `{"title":"AQ==","code":"Ag=="}` + "\n",
+	}
+	for name, code := range want {
+		if files[name] != code {
+			t.Errorf("%s = %q, want %q", name, files[name], code)
+		}
+	}
+
+	var meta ExportMetadata
+	if err := json.Unmarshal([]byte(files["metadata.json"]), &meta); err != nil {
+		t.Fatalf("metadata.json: %v", err)
+	}
+
+	if len(meta.Snippets) != 3 || meta.Snippets[0].File != "snippets/7-main.go" || !meta.Snippets[1].Private || !meta.Snippets[2].Vault {
+		t.Errorf("unexpected metadata %+v", meta.Snippets)
+	}
+}
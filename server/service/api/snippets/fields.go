@@ -0,0 +1,39 @@
+package snippets
+
+import (
+	"net/url"
+	"strconv"
+
+	dba "github.com/scott-mescudi/codelet/service/data_access"
+)
+
+// snippetView reads the fields and preview_lines parameters of a request
+// that returns snippets. It returns a message for the client when they are
+// invalid.
+func snippetView(params url.Values) (dba.View, string) {
+	fields, err := dba.ParseFields(params.Get("fields"))
+	if err != nil {
+		return dba.View{}, err.Error()
+	}
+
+	v := dba.View{Fields: fields}
+	if s := params.Get("preview_lines"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return dba.View{}, "'preview_lines' must be a positive integer"
+		}
+		v.PreviewLines = n
+	}
+	return v, ""
+}
+
+// smallSnippetFields are the fields GetSmallUserSnippets sends by default.
+const smallSnippetFields = "id,language,title,favorite"
+
+// smallSnippetsQuery fills in the defaults of GetSmallUserSnippets.
+func smallSnippetsQuery(params url.Values) url.Values {
+	if params.Get("fields") == "" {
+		params.Set("fields", smallSnippetFields)
+	}
+	return params
+}
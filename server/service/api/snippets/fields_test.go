@@ -0,0 +1,67 @@
+package snippets
+
+import (
+	"net/url"
+	"testing"
+
+	dba "github.com/scott-mescudi/codelet/service/data_access"
+)
+
+func TestSnippetView(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		want   dba.View
+		errMsg bool
+	}{
+		{name: "Defaults", query: "", want: dba.View{Fields: dba.AllFields}},
+		{name: "Fields", query: "fields=id,title", want: dba.View{Fields: dba.FieldID | dba.FieldTitle}},
+		{name: "Preview", query: "fields=code&preview_lines=3", want: dba.View{Fields: dba.FieldCode, PreviewLines: 3}},
+		{name: "Unknown field", query: "fields=id,owner", errMsg: true},
+		{name: "Zero preview", query: "preview_lines=0", errMsg: true},
+		{name: "Bad preview", query: "preview_lines=ten", errMsg: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, msg := snippetView(params)
+			if (msg != "") != tt.errMsg {
+				t.Fatalf("got message %q, want one: %v", msg, tt.errMsg)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSmallSnippetsQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "Defaults", query: "", want: "fields=id%2Clanguage%2Ctitle%2Cfavorite"},
+		{name: "Page", query: "page=2&limit=10", want: "fields=id%2Clanguage%2Ctitle%2Cfavorite&limit=10&page=2"},
+		{name: "Fields and preview", query: "fields=id,code&preview_lines=2", want: "fields=id%2Ccode&preview_lines=2"},
+		{name: "Half a page", query: "limit=10", want: "fields=id%2Clanguage%2Ctitle%2Cfavorite&limit=10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := smallSnippetsQuery(params).Encode(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,5 +1,34 @@
 package snippets
 
+import (
+	"context"
+	"net/http"
+
+	"github.com/rs/zerolog"
+	"github.com/scott-mescudi/codelet/service/middleware"
+)
+
+// logger returns the request scoped logger set up by middleware.RequestLogger,
+// or the service logger when the handler is called without it.
+func (s *SnippetService) logger(r *http.Request) *zerolog.Logger {
+	if l := zerolog.Ctx(r.Context()); l.GetLevel() != zerolog.Disabled {
+		return l
+	}
+	return &s.Logger
+}
+
+// queryContext bounds a single data access call by the configured query
+// timeout, see middleware.QueryContext.
+func (s *SnippetService) queryContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return middleware.QueryContext(r, s.QueryTimeout)
+}
+
+// interrupted answers requests whose database work was cancelled or timed
+// out, see middleware.Interrupted.
+func (s *SnippetService) interrupted(w http.ResponseWriter, r *http.Request, function string, err error) bool {
+	return middleware.Interrupted(w, s.logger(r), function, s.QueryTimeout, err)
+}
+
 func (u *UpdateSnippet) UnmarshalJSON(data []byte) error {
 	type Alias UpdateSnippet
 	aux := &struct {
@@ -22,6 +51,9 @@ func (u *UpdateSnippet) UnmarshalJSON(data []byte) error {
 	if u.Code != nil && *u.Code == "" {
 		u.Code = nil
 	}
+	if u.CodeSHA256 != nil && *u.CodeSHA256 == "" {
+		u.CodeSHA256 = nil
+	}
 	if u.Description != nil && *u.Description == "" {
 		u.Description = nil
 	}
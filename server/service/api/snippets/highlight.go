@@ -0,0 +1,150 @@
+package snippets
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	errs "github.com/scott-mescudi/codelet/shared/errors"
+	"github.com/scott-mescudi/codelet/shared/highlight"
+)
+
+// rendering is how the raw endpoints send code: as it is, or highlighted as
+// HTML or for a terminal.
+type rendering struct {
+	format string
+	// inline styles HTML in style attributes rather than with classes.
+	inline bool
+	theme  *highlight.Theme
+}
+
+// codeRendering reads the format, style and theme parameters of a raw code
+// request. It returns a message for the client when they are invalid.
+func codeRendering(params url.Values) (rendering, string) {
+	rd := rendering{format: formatRaw}
+	switch f := params.Get("format"); f {
+	case "", formatRaw:
+	case formatHTML, formatANSI:
+		rd.format = f
+	default:
+		return rendering{}, "'format' must be raw, html or ansi"
+	}
+
+	switch params.Get("style") {
+	case "", "classes":
+	case "inline":
+		rd.inline = true
+	default:
+		return rendering{}, "'style' must be classes or inline"
+	}
+
+	name := params.Get("theme")
+	if name == "" {
+		name = highlight.DefaultTheme
+	}
+	theme, ok := highlight.ThemeByName(name)
+	if !ok {
+		return rendering{}, "unknown 'theme', must be one of " + strings.Join(highlight.ThemeNames(), ", ")
+	}
+	rd.theme = theme
+	return rd, ""
+}
+
+// tag is the format part of the ETag of code in this rendering. HTML with
+// classes looks the same in every theme.
+func (rd rendering) tag() string {
+	switch {
+	case rd.format == formatRaw || (rd.format == formatHTML && !rd.inline):
+		return rd.format
+	case rd.format == formatHTML:
+		return formatHTML + "-inline-" + rd.theme.Name
+	}
+	return rd.format + "-" + rd.theme.Name
+}
+
+// embedPolicy is the Content-Security-Policy of highlighted HTML. It is
+// meant to be framed by other sites and may be styled inline, but still
+// loads and runs nothing.
+const embedPolicy = "default-src 'none'; style-src 'unsafe-inline'; base-uri 'none'"
+
+// setHeaders sets the content type of code in this rendering, and lets
+// highlighted HTML be styled and embedded.
+func (rd rendering) setHeaders(h http.Header) {
+	h.Set("Content-Type", rd.contentType())
+	if rd.format == formatHTML {
+		h.Set("Content-Security-Policy", embedPolicy)
+		h.Del("X-Frame-Options")
+	}
+}
+
+func (rd rendering) contentType() string {
+	if rd.format == formatHTML {
+		return "text/html; charset=utf-8"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// render highlights code in language.
+func (rd rendering) render(language string, code []byte) ([]byte, error) {
+	tokens := highlight.Tokenize(language, string(code))
+
+	var b bytes.Buffer
+	var err error
+	switch {
+	case rd.format == formatANSI:
+		err = highlight.ANSI(&b, tokens, rd.theme)
+	case rd.inline:
+		err = highlight.InlineHTML(&b, tokens, rd.theme)
+	default:
+		err = highlight.HTML(&b, tokens)
+	}
+	return b.Bytes(), err
+}
+
+// stylesheet is the CSS of a theme and its ETag.
+type stylesheet struct {
+	body []byte
+	etag string
+}
+
+// themeCSS holds the stylesheet of every theme, they only change with a new
+// binary.
+var themeCSS = sync.OnceValue(func() map[string]stylesheet {
+	css := map[string]stylesheet{}
+	for _, name := range highlight.ThemeNames() {
+		theme, _ := highlight.ThemeByName(name)
+		body := []byte(highlight.CSS(theme))
+		sum := sha256.Sum256(body)
+		css[name] = stylesheet{body: body, etag: `"` + hex.EncodeToString(sum[:16]) + `"`}
+	}
+	return css
+})
+
+// GetThemeCSS serves the stylesheet of a theme, /api/v1/highlight/github.css,
+// for highlighted HTML with classes.
+func (s *SnippetService) GetThemeCSS(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	name, ok := strings.CutSuffix(r.PathValue("file"), ".css")
+	css, found := themeCSS()[name]
+	if !ok || !found {
+		s.logger(r).Warn().Str("function", "GetThemeCSS").Str("file", r.PathValue("file")).Msg("unknown theme")
+		errs.ErrorWithJson(w, http.StatusNotFound, "unknown theme, must be one of "+strings.Join(highlight.ThemeNames(), ", "))
+		return
+	}
+
+	if notModified(r, css.etag, time.Time{}) {
+		writeNotModified(w, cacheRelease, css.etag, time.Time{})
+		return
+	}
+
+	validators(w, cacheRelease, css.etag, time.Time{})
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	if _, err := w.Write(css.body); err != nil {
+		s.logger(r).Warn().Str("function", "GetThemeCSS").Err(err).Msg("failed to write theme")
+	}
+}
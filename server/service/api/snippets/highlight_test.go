@@ -0,0 +1,153 @@
+package snippets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/scott-mescudi/codelet/service/middleware"
+)
+
+func TestCodeRendering(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		tag         string
+		contentType string
+		errMsg      bool
+	}{
+		{name: "Default", query: "", tag: formatRaw, contentType: "text/plain; charset=utf-8"},
+		{name: "Raw ignores the theme", query: "format=raw&theme=monokai", tag: formatRaw, contentType: "text/plain; charset=utf-8"},
+		{name: "HTML classes", query: "format=html&theme=monokai", tag: "html", contentType: "text/html; charset=utf-8"},
+		{name: "HTML inline", query: "format=html&style=inline&theme=monokai", tag: "html-inline-monokai", contentType: "text/html; charset=utf-8"},
+		{name: "ANSI default theme", query: "format=ansi", tag: "ansi-github", contentType: "text/plain; charset=utf-8"},
+		{name: "Unknown format", query: "format=pdf", errMsg: true},
+		{name: "Unknown style", query: "format=html&style=bold", errMsg: true},
+		{name: "Unknown theme", query: "format=ansi&theme=neon", errMsg: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rd, msg := codeRendering(q)
+			if (msg != "") != tt.errMsg {
+				t.Fatalf("unexpected message %q", msg)
+			}
+			if tt.errMsg {
+				return
+			}
+			if rd.tag() != tt.tag || rd.contentType() != tt.contentType {
+				t.Errorf("expected %s as %s, got %s as %s", tt.tag, tt.contentType, rd.tag(), rd.contentType())
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	q, _ := url.ParseQuery("format=html")
+	rd, _ := codeRendering(q)
+
+	body, err := rd.render("go", []byte("<-ch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `<span class="hl-operator">&lt;-</span>`) {
+		t.Errorf("code not highlighted and escaped: %s", body)
+	}
+
+	q.Set("format", "ansi")
+	rd, _ = codeRendering(q)
+	body, err = rd.render("cobol", []byte("DISPLAY 'HI'."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "DISPLAY 'HI'." {
+		t.Errorf("languages without a lexer should come out as they are, got %q", body)
+	}
+}
+
+// Highlighted HTML goes out through the same security headers as the rest of
+// the API and has to stay embeddable.
+func TestRenderingHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		csp         string
+		frameOption string
+	}{
+		{name: "HTML", query: "format=html&style=inline", csp: embedPolicy},
+		{name: "Raw", query: "", frameOption: "DENY"},
+	}
+
+	headers := middleware.SecurityHeaders{ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := url.ParseQuery(tt.query)
+			rd, _ := codeRendering(q)
+			handler := middleware.SecurityHeadersMiddleware(headers, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				rd.setHeaders(w.Header())
+				w.Write([]byte("code"))
+			}))
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest("GET", "/api/v1/public/snippets/1/raw", nil))
+
+			if got := rw.Header().Get("Content-Security-Policy"); got != tt.csp {
+				t.Errorf("expected CSP %q, got %q", tt.csp, got)
+			}
+			if got := rw.Header().Get("X-Frame-Options"); got != tt.frameOption {
+				t.Errorf("expected X-Frame-Options %q, got %q", tt.frameOption, got)
+			}
+		})
+	}
+}
+
+func TestGetThemeCSS(t *testing.T) {
+	app := &SnippetService{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/highlight/{file}", app.GetThemeCSS)
+
+	tests := []struct {
+		name     string
+		file     string
+		expected int
+	}{
+		{name: "Theme", file: "monokai.css", expected: http.StatusOK},
+		{name: "Unknown theme", file: "neon.css", expected: http.StatusNotFound},
+		{name: "Not a stylesheet", file: "monokai", expected: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/highlight/"+tt.file, http.NoBody))
+			if rr.Code != tt.expected {
+				t.Fatalf("expected %d, got %d", tt.expected, rr.Code)
+			}
+			if tt.expected != http.StatusOK {
+				return
+			}
+
+			if ct := rr.Header().Get("Content-Type"); ct != "text/css; charset=utf-8" {
+				t.Errorf("expected CSS, got %q", ct)
+			}
+			if !strings.Contains(rr.Body.String(), ".hl-keyword{") {
+				t.Errorf("stylesheet misses the token classes: %s", rr.Body.String())
+			}
+
+			req := httptest.NewRequest("GET", "/api/v1/highlight/"+tt.file, http.NoBody)
+			req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+			rr = httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+			if rr.Code != http.StatusNotModified {
+				t.Errorf("expected 304 for the same ETag, got %d", rr.Code)
+			}
+		})
+	}
+}
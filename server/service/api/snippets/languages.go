@@ -0,0 +1,98 @@
+package snippets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	errs "github.com/scott-mescudi/codelet/shared/errors"
+	"github.com/scott-mescudi/codelet/shared/languages"
+)
+
+// autoLanguage asks for the language of a new snippet to be detected.
+const autoLanguage = "auto"
+
+// detectLanguage reports whether a client left the language of a new
+// snippet to the server.
+func detectLanguage(name string) bool {
+	name = strings.TrimSpace(name)
+	return name == "" || strings.EqualFold(name, autoLanguage)
+}
+
+// snippetLanguage returns the canonical id of a language sent by a client.
+// Languages outside the registry are stored as Text rather than rejected,
+// the dashboard takes any name. Migration 0009 did the same to existing
+// snippets.
+func snippetLanguage(name string) string {
+	id, ok := languages.Normalize(name)
+	if !ok {
+		return languages.Text
+	}
+	return id
+}
+
+// languageList is the body of GetLanguages and its ETag, the registry only
+// changes with a new binary.
+var languageList = sync.OnceValues(func() ([]byte, string) {
+	body, err := json.Marshal(languages.All())
+	if err != nil {
+		panic(err)
+	}
+	body = append(body, '\n')
+	sum := sha256.Sum256(body)
+	return body, `"` + hex.EncodeToString(sum[:16]) + `"`
+})
+
+// GetLanguages lists the languages snippets can be written in.
+func (s *SnippetService) GetLanguages(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	body, etag := languageList()
+	if notModified(r, etag, time.Time{}) {
+		writeNotModified(w, cacheRelease, etag, time.Time{})
+		return
+	}
+
+	validators(w, cacheRelease, etag, time.Time{})
+	w.Header().Set("Content-Type", mediaJSON)
+	if _, err := w.Write(body); err != nil {
+		s.logger(r).Warn().Str("function", "GetLanguages").Err(err).Msg("failed to write languages")
+	}
+}
+
+// DetectLanguage guesses the language of code the way AddSnippet does, for
+// editors to suggest one while the user types.
+func (s *SnippetService) DetectLanguage(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var info DetectLanguage
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		if errs.IsBodyTooLarge(err) {
+			s.logger(r).Warn().Str("function", "DetectLanguage").Msg("Request body too large")
+			errs.ErrorWithJson(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+
+		s.logger(r).Warn().Str("function", "DetectLanguage").Msg("unable to parse request body")
+		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "unable to parse request body")
+		return
+	}
+
+	if info.Code == "" && info.Title == "" {
+		s.logger(r).Warn().Str("function", "DetectLanguage").Msg("Missing code")
+		errs.ErrorWithJson(w, http.StatusBadRequest, "missing code text")
+		return
+	}
+
+	if len(info.Code) > 3072 {
+		s.logger(r).Warn().Str("function", "DetectLanguage").Msg("Data too large")
+		errs.ErrorWithJson(w, http.StatusRequestEntityTooLarge, "code too large")
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaJSON)
+	if err := json.NewEncoder(w).Encode(languages.Detect(info.Code, info.Title)); err != nil {
+		s.logger(r).Warn().Str("function", "DetectLanguage").Err(err).Msg("failed to write detection")
+	}
+}
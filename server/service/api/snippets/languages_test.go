@@ -0,0 +1,106 @@
+package snippets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/scott-mescudi/codelet/shared/languages"
+)
+
+func TestSnippetLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: "go", expected: "go"},
+		{name: "Golang", expected: "go"},
+		{name: "TS", expected: "typescript"},
+		{name: "svelte", expected: languages.Text},
+		{name: "klingon", expected: languages.Text},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := snippetLanguage(tt.name); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestGetLanguages(t *testing.T) {
+	app := &SnippetService{}
+
+	rr := httptest.NewRecorder()
+	app.GetLanguages(rr, httptest.NewRequest("GET", "/api/v1/languages", http.NoBody))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	var list []struct {
+		ID         string   `json:"id"`
+		Extensions []string `json:"extensions"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) == 0 || list[0].ID == "" || len(list[0].Extensions) == 0 {
+		t.Fatalf("unexpected languages %s", rr.Body.String())
+	}
+
+	etag := rr.Header().Get("ETag")
+	req := httptest.NewRequest("GET", "/api/v1/languages", http.NoBody)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	app.GetLanguages(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for If-None-Match %s, got %d", etag, rr.Code)
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+		language string
+	}{
+		{name: "Code", body: `{"code":"#!/usr/bin/env python3\nprint(1)"}`, expected: http.StatusOK, language: "python"},
+		{name: "Title only", body: `{"title":"deploy.sh"}`, expected: http.StatusOK, language: "bash"},
+		{name: "Nothing", body: `{}`, expected: http.StatusBadRequest},
+		{name: "Too large", body: `{"code":"` + strings.Repeat("x", 4000) + `"}`, expected: http.StatusRequestEntityTooLarge},
+		{name: "Invalid json", body: `"`, expected: http.StatusUnprocessableEntity},
+	}
+
+	app := &SnippetService{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			app.DetectLanguage(rr, httptest.NewRequest("POST", "/api/v1/detect-language", strings.NewReader(tt.body)))
+			if rr.Code != tt.expected {
+				t.Fatalf("expected %d, got %d", tt.expected, rr.Code)
+			}
+			if tt.expected != http.StatusOK {
+				return
+			}
+
+			var d languages.Detection
+			if err := json.Unmarshal(rr.Body.Bytes(), &d); err != nil {
+				t.Fatal(err)
+			}
+			if d.Language != tt.language || d.Confidence <= 0 {
+				t.Errorf("expected %s, got %+v", tt.language, d)
+			}
+		})
+	}
+}
+
+func TestDetectLanguageName(t *testing.T) {
+	for name, expected := range map[string]bool{"": true, " ": true, "auto": true, "Auto": true, "go": false, "automake": false} {
+		if got := detectLanguage(name); got != expected {
+			t.Errorf("detectLanguage(%q) = %v, expected %v", name, got, expected)
+		}
+	}
+}
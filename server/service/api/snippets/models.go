@@ -1,31 +1,54 @@
 package snippets
 
 import (
+	"time"
+
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog"
+	dba "github.com/scott-mescudi/codelet/service/data_access"
+	"github.com/scott-mescudi/codelet/shared/vault"
 )
 
 type SnippetService struct {
-	Db     *pgxpool.Pool
-	Logger zerolog.Logger
+	Db           *pgxpool.Pool
+	Store        *dba.CodeStore
+	Logger       zerolog.Logger
+	QueryTimeout time.Duration
 }
 
 type UpdateSnippet struct {
-	Language    *string   `json:"language"`
-	Title       *string   `json:"title"`
-	Code        *string   `json:"code"`
+	Language *string `json:"language"`
+	Title    *string `json:"title"`
+	Code     *string `json:"code"`
+	// CodeSHA256 is sent instead of Code to reuse code the user already
+	// stored, see CheckCode.
+	CodeSHA256  *string   `json:"code_sha256"`
 	Favorite    *bool     `json:"favorite"`
 	Private     *bool     `json:"private"`
 	Tags        *[]string `json:"tags"`
 	Description *string   `json:"description"`
+	// Vault replaces the sealed title, code and description of a vault
+	// snippet, all three at once.
+	Vault *vault.Snippet `json:"vault"`
 }
 
 type Snippet struct {
+	// Language is detected from Code and Title when it is empty or "auto".
 	Language    string   `json:"language"`
 	Title       string   `json:"title"`
 	Code        string   `json:"code"`
+	CodeSHA256  string   `json:"code_sha256"`
 	Favorite    bool     `json:"favorite"`
 	Private     bool     `json:"private"`
 	Tags        []string `json:"tags"`
 	Description string   `json:"description"`
+	// Vault is sent instead of Title, Code, Description and Tags to store a
+	// snippet encrypted by the client, see package shared/vault.
+	Vault *vault.Snippet `json:"vault"`
+}
+
+type DetectLanguage struct {
+	Code string `json:"code"`
+	// Title is searched for a file name, as for a new snippet.
+	Title string `json:"title"`
 }
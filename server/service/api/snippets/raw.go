@@ -0,0 +1,376 @@
+package snippets
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	dba "github.com/scott-mescudi/codelet/service/data_access"
+	"github.com/scott-mescudi/codelet/service/middleware"
+	errs "github.com/scott-mescudi/codelet/shared/errors"
+	"github.com/scott-mescudi/codelet/shared/languages"
+)
+
+// Media types snippets can be asked for in.
+const (
+	mediaJSON   = "application/json"
+	mediaText   = "text/plain"
+	mediaNDJSON = "application/x-ndjson"
+)
+
+// negotiateType picks the offer the Accept header weighs highest, the first
+// one on ties. Clients that accept none of them get the first one anyway,
+// like they did before snippets came in other types.
+func negotiateType(accept string, offers ...string) string {
+	best, bestQ, bestSpecificity := offers[0], 0.0, -1
+	for _, offer := range offers {
+		q, specificity := -1.0, -1
+		for part := range strings.SplitSeq(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+
+			s := matchMediaType(mediaType, offer)
+			if s < 0 || s < specificity {
+				continue
+			}
+
+			weight := 1.0
+			if v, ok := params["q"]; ok {
+				if weight, err = strconv.ParseFloat(v, 64); err != nil {
+					continue
+				}
+			}
+			q, specificity = weight, s
+		}
+
+		if q > bestQ || (q == bestQ && specificity > bestSpecificity && q > 0) {
+			best, bestQ, bestSpecificity = offer, q, specificity
+		}
+	}
+	return best
+}
+
+// matchMediaType reports how specific an Accept range matches offer: 2 for
+// the type itself, 1 for type/*, 0 for */* and -1 when it doesn't match.
+func matchMediaType(accepted, offer string) int {
+	switch {
+	case accepted == offer:
+		return 2
+	case accepted == "*/*":
+		return 0
+	case strings.HasSuffix(accepted, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(accepted, "*")):
+		return 1
+	}
+	return -1
+}
+
+// pathSnippetID reads the {id} of the route.
+func pathSnippetID(r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	return id, err == nil && id > 0
+}
+
+// downloadName is the file name a snippet downloads as.
+func downloadName(code *dba.RawCode) string {
+	return slug(code.Title) + languages.Extension(code.Language)
+}
+
+// codeSource looks up the code of one snippet, with the version lookup that
+// answers conditional requests without reading the code.
+type codeSource struct {
+	function     string
+	cacheControl string
+	version      func(ctx context.Context) (time.Time, error)
+	code         func(ctx context.Context, frame bool) (*dba.RawCode, error)
+}
+
+// serveCode sends the code of a snippet as text/plain, as an attachment when
+// download is set. A client that accepts zstd gets the stored frame when
+// there is one it can read, nothing is decompressed then. Code that isn't
+// downloaded can be asked for highlighted with ?format=html or ansi.
+func (s *SnippetService) serveCode(w http.ResponseWriter, r *http.Request, id int, src codeSource, download bool) {
+	rd := rendering{format: formatRaw}
+	if !download {
+		var msg string
+		if rd, msg = codeRendering(r.URL.Query()); msg != "" {
+			s.logger(r).Warn().Str("function", src.function).Msg(msg)
+			errs.ErrorWithJson(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	if conditional(r) {
+		updated, err := src.version(ctx)
+		if err != nil && !errors.Is(err, dba.ErrSnippetNotFound) {
+			if s.interrupted(w, r, src.function, err) {
+				return
+			}
+
+			s.logger(r).Error().Str("function", src.function).Err(err).Msg("failed to fetch snippet version")
+			errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to fetch snippet from database")
+			return
+		}
+
+		if etag := snippetETag(id, updated, dba.View{}, rd.tag()); err == nil && notModified(r, etag, updated) {
+			writeNotModified(w, src.cacheControl, etag, updated)
+			return
+		}
+	}
+
+	frame := rd.format == formatRaw && middleware.NegotiateEncoding(r.Header.Get("Accept-Encoding")) == "zstd"
+	code, err := src.code(ctx, frame)
+	if err != nil {
+		if s.interrupted(w, r, src.function, err) {
+			return
+		}
+
+		if errors.Is(err, dba.ErrSnippetNotFound) {
+			s.logger(r).Warn().Str("function", src.function).Int("snippet", id).Msg("snippet not found")
+			errs.ErrorWithJson(w, http.StatusNotFound, "snippet not found")
+			return
+		}
+
+		s.logger(r).Error().Str("function", src.function).Err(err).Msg("failed to fetch snippet code")
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to fetch snippet from database")
+		return
+	}
+
+	if code.Vault {
+		s.logger(r).Warn().Str("function", src.function).Int("snippet", id).Msg("raw code of a vault snippet")
+		errs.ErrorWithJson(w, http.StatusConflict, "vault snippets are encrypted, only your client can open them")
+		return
+	}
+
+	etag := snippetETag(code.ID, code.Updated, dba.View{}, rd.tag())
+	h := w.Header()
+	rd.setHeaders(h)
+	if download {
+		h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": downloadName(code)}))
+	}
+
+	body := code.Code
+	if rd.format != formatRaw {
+		if body, err = rd.render(code.Language, code.Code); err != nil {
+			s.logger(r).Error().Str("function", src.function).Err(err).Msg("failed to highlight code")
+			errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to highlight code")
+			return
+		}
+	} else if code.Frame != nil {
+		body = code.Frame
+		etag = middleware.EncodedETag(etag, "zstd")
+		h.Set("Content-Encoding", "zstd")
+		if !strings.Contains(strings.Join(h.Values("Vary"), ","), "Accept-Encoding") {
+			h.Add("Vary", "Accept-Encoding")
+		}
+	}
+	validators(w, src.cacheControl, etag, code.Updated)
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+
+	if _, err := w.Write(body); err != nil {
+		s.logger(r).Warn().Str("function", src.function).Err(err).Msg("failed to write code")
+	}
+}
+
+// userCode serves the code of a snippet of the caller.
+func (s *SnippetService) userCode(w http.ResponseWriter, r *http.Request, function string, download bool) {
+	defer r.Body.Close()
+	userID, err := strconv.Atoi(r.Header.Get("X-USERID"))
+	if err != nil {
+		s.logger(r).Warn().Str("function", function).Msg("invalid 'X-USERID' header format")
+		errs.ErrorWithJson(w, http.StatusUnauthorized, "invalid 'X-USERID' header format")
+		return
+	}
+
+	id, ok := pathSnippetID(r)
+	if !ok {
+		s.logger(r).Warn().Str("function", function).Msg("failed to parse snippet id in uri")
+		errs.ErrorWithJson(w, http.StatusBadRequest, "Snippet id must be a positive integer")
+		return
+	}
+
+	s.serveCode(w, r, id, codeSource{
+		function:     function,
+		cacheControl: cachePrivate,
+		version: func(ctx context.Context) (time.Time, error) {
+			return dba.SnippetVersion(ctx, s.Db, userID, id)
+		},
+		code: func(ctx context.Context, frame bool) (*dba.RawCode, error) {
+			return dba.GetSnippetCode(ctx, s.Db, s.Store, userID, id, frame)
+		},
+	}, download)
+}
+
+// publicCode serves the code of a public snippet.
+func (s *SnippetService) publicCode(w http.ResponseWriter, r *http.Request, function string, download bool) {
+	defer r.Body.Close()
+	id, ok := pathSnippetID(r)
+	if !ok {
+		s.logger(r).Warn().Str("function", function).Msg("failed to parse snippet id in uri")
+		errs.ErrorWithJson(w, http.StatusBadRequest, "Snippet id must be a positive integer")
+		return
+	}
+
+	s.serveCode(w, r, id, codeSource{
+		function:     function,
+		cacheControl: cachePublic,
+		version: func(ctx context.Context) (time.Time, error) {
+			return dba.PublicSnippetVersion(ctx, s.Db, id)
+		},
+		code: func(ctx context.Context, frame bool) (*dba.RawCode, error) {
+			return dba.GetPublicSnippetCode(ctx, s.Db, s.Store, id, frame)
+		},
+	}, download)
+}
+
+// GetUserSnippetRaw sends the code of a snippet of the caller as text/plain,
+// or highlighted for ?format=html or ansi.
+func (s *SnippetService) GetUserSnippetRaw(w http.ResponseWriter, r *http.Request) {
+	s.userCode(w, r, "GetUserSnippetRaw", false)
+}
+
+// GetUserSnippetDownload sends the code of a snippet of the caller as a file
+// named after its title and language.
+func (s *SnippetService) GetUserSnippetDownload(w http.ResponseWriter, r *http.Request) {
+	s.userCode(w, r, "GetUserSnippetDownload", true)
+}
+
+// GetPublicSnippetRaw sends the code of a public snippet as text/plain,
+// or highlighted for ?format=html or ansi.
+func (s *SnippetService) GetPublicSnippetRaw(w http.ResponseWriter, r *http.Request) {
+	s.publicCode(w, r, "GetPublicSnippetRaw", false)
+}
+
+// GetPublicSnippetDownload sends the code of a public snippet as a file.
+func (s *SnippetService) GetPublicSnippetDownload(w http.ResponseWriter, r *http.Request) {
+	s.publicCode(w, r, "GetPublicSnippetDownload", true)
+}
+
+// writeSnippets sends a page of snippets as a JSON array, or one JSON object
+// per line for application/x-ndjson.
+func (s *SnippetService) writeSnippets(w http.ResponseWriter, r *http.Request, function string, snippets []dba.DBsnippet, format string) {
+	if format != formatNDJSON {
+		w.Header().Set("Content-Type", mediaJSON)
+		if err := json.NewEncoder(w).Encode(snippets); err != nil {
+			s.logger(r).Error().Str("function", function).Msg("failed to encode snippets")
+			errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode snippets as JSON")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaNDJSON)
+	enc := json.NewEncoder(w)
+	for _, snippet := range snippets {
+		if err := enc.Encode(snippet); err != nil {
+			s.logger(r).Error().Str("function", function).Err(err).Msg("failed to encode snippets")
+			return
+		}
+	}
+}
+
+// listFormat is the format a list of snippets is asked for in.
+func listFormat(r *http.Request) string {
+	if negotiateType(r.Header.Get("Accept"), mediaJSON, mediaNDJSON) == mediaNDJSON {
+		return formatNDJSON
+	}
+	return formatJSON
+}
+
+// snippetFormat is the format one snippet is asked for in.
+func snippetFormat(r *http.Request) string {
+	switch negotiateType(r.Header.Get("Accept"), mediaJSON, mediaText, mediaNDJSON) {
+	case mediaText:
+		return formatRaw
+	case mediaNDJSON:
+		return formatNDJSON
+	}
+	return formatJSON
+}
+
+// GetPublicSnippetByID returns a public snippet. Like the snippets of the
+// caller it is sent as plain code for Accept: text/plain.
+func (s *SnippetService) GetPublicSnippetByID(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	w.Header().Add("Vary", "Accept")
+	format := snippetFormat(r)
+	if format == formatRaw {
+		s.publicCode(w, r, "GetPublicSnippetByID", false)
+		return
+	}
+
+	id, ok := pathSnippetID(r)
+	if !ok {
+		s.logger(r).Warn().Str("function", "GetPublicSnippetByID").Msg("failed to parse snippet id in uri")
+		errs.ErrorWithJson(w, http.StatusBadRequest, "Snippet id must be a positive integer")
+		return
+	}
+
+	view, msg := snippetView(r.URL.Query())
+	if msg != "" {
+		s.logger(r).Warn().Str("function", "GetPublicSnippetByID").Msg(msg)
+		errs.ErrorWithJson(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	if conditional(r) {
+		updated, err := dba.PublicSnippetVersion(ctx, s.Db, id)
+		if err != nil && !errors.Is(err, dba.ErrSnippetNotFound) {
+			if s.interrupted(w, r, "GetPublicSnippetByID", err) {
+				return
+			}
+
+			s.logger(r).Error().Str("function", "GetPublicSnippetByID").Err(err).Msg("failed to fetch snippet version")
+			errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to fetch snippet from database")
+			return
+		}
+
+		if etag := snippetETag(id, updated, view, format); err == nil && notModified(r, etag, updated) {
+			writeNotModified(w, cachePublic, etag, updated)
+			return
+		}
+	}
+
+	snippet, err := dba.GetPublicSnippetByID(ctx, s.Db, s.Store, id, view)
+	if err != nil {
+		if s.interrupted(w, r, "GetPublicSnippetByID", err) {
+			return
+		}
+
+		if errors.Is(err, dba.ErrSnippetNotFound) {
+			s.logger(r).Warn().Str("function", "GetPublicSnippetByID").Int("snippet", id).Msg("snippet not found")
+			errs.ErrorWithJson(w, http.StatusNotFound, "snippet not found")
+			return
+		}
+
+		s.logger(r).Error().Str("function", "GetPublicSnippetByID").Err(err).Msg("failed to fetch public snippet")
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to fetch snippet from database")
+		return
+	}
+
+	validators(w, cachePublic, snippetETag(snippet.ID, snippet.Updated, view, format), snippet.Updated)
+	s.writeSnippet(w, r, "GetPublicSnippetByID", snippet, format)
+}
+
+// writeSnippet sends one snippet as JSON, or as a single line of
+// application/x-ndjson.
+func (s *SnippetService) writeSnippet(w http.ResponseWriter, r *http.Request, function string, snippet *dba.DBsnippet, format string) {
+	if format == formatNDJSON {
+		w.Header().Set("Content-Type", mediaNDJSON)
+	} else {
+		w.Header().Set("Content-Type", mediaJSON)
+	}
+
+	if err := json.NewEncoder(w).Encode(snippet); err != nil {
+		s.logger(r).Error().Str("function", function).Msg("failed to encode snippet")
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode snippets as JSON")
+	}
+}
@@ -0,0 +1,54 @@
+package snippets
+
+import (
+	"testing"
+
+	dba "github.com/scott-mescudi/codelet/service/data_access"
+)
+
+func TestNegotiateType(t *testing.T) {
+	offers := []string{mediaJSON, mediaText, mediaNDJSON}
+
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{accept: "", expected: mediaJSON},
+		{accept: "*/*", expected: mediaJSON},
+		{accept: "text/plain", expected: mediaText},
+		{accept: "text/plain, */*", expected: mediaText},
+		{accept: "text/*", expected: mediaText},
+		{accept: "application/x-ndjson", expected: mediaNDJSON},
+		{accept: "application/json;q=0.5, text/plain;q=0.9", expected: mediaText},
+		{accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", expected: mediaJSON},
+		{accept: "*/*, text/plain;q=0", expected: mediaJSON},
+		{accept: "image/png", expected: mediaJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			if got := negotiateType(tt.accept, offers...); got != tt.expected {
+				t.Errorf("Expected %q but got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDownloadName(t *testing.T) {
+	tests := []struct {
+		code     dba.RawCode
+		expected string
+	}{
+		{code: dba.RawCode{Title: "Hello, World!", Language: "Go"}, expected: "hello-world.go"},
+		{code: dba.RawCode{Title: "deploy script", Language: "bash"}, expected: "deploy-script.sh"},
+		{code: dba.RawCode{Title: "???", Language: "cobol"}, expected: "snippet.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			if got := downloadName(&tt.code); got != tt.expected {
+				t.Errorf("Expected %q but got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package snippets
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	dba "github.com/scott-mescudi/codelet/service/data_access"
+	errs "github.com/scott-mescudi/codelet/shared/errors"
+	"github.com/scott-mescudi/codelet/shared/vault"
+)
+
+// Plaintext limits of vault snippet fields, the same ones regular snippets
+// have. The server only sees ciphertext, so it checks sizes with the vault
+// overhead added.
+const (
+	maxVaultTitle       = 255
+	maxVaultCode        = 3072
+	maxVaultDescription = 4096
+)
+
+// checkVaultSnippet returns what is wrong with v, or "" when it is fine.
+func checkVaultSnippet(v *vault.Snippet) string {
+	switch {
+	case len(v.Title) < vault.Overhead || len(v.Code) < vault.Overhead:
+		return "vault title and code are required"
+	case len(v.Description) > 0 && len(v.Description) < vault.Overhead:
+		return "vault description is not a valid ciphertext"
+	case len(v.Title) > maxVaultTitle+vault.Overhead:
+		return "vault title too large"
+	case len(v.Code) > maxVaultCode+vault.Overhead:
+		return "code too large"
+	case len(v.Description) > maxVaultDescription+vault.Overhead:
+		return "vault description too large"
+	}
+	return ""
+}
+
+func (s *SnippetService) addVaultSnippet(w http.ResponseWriter, r *http.Request, userID int, info *Snippet) {
+	if info.Title != "" || info.Code != "" || info.CodeSHA256 != "" || info.Description != "" || len(info.Tags) > 0 {
+		s.logger(r).Warn().Str("function", "AddSnippet").Msg("Plain fields sent with a vault snippet")
+		errs.ErrorWithJson(w, http.StatusBadRequest, "vault snippets can't have a plain title, code, description or tags")
+		return
+	}
+
+	if info.Language == "" {
+		s.logger(r).Warn().Str("function", "AddSnippet").Msg("Missing snippet language")
+		errs.ErrorWithJson(w, http.StatusBadRequest, "missing language")
+		return
+	}
+
+	if detectLanguage(info.Language) {
+		s.logger(r).Warn().Str("function", "AddSnippet").Msg("Language detection for a vault snippet")
+		errs.ErrorWithJson(w, http.StatusBadRequest, "the language of a vault snippet can't be detected, its code is encrypted")
+		return
+	}
+
+	info.Language = snippetLanguage(info.Language)
+
+	if msg := checkVaultSnippet(info.Vault); msg != "" {
+		s.logger(r).Warn().Str("function", "AddSnippet").Msg(msg)
+		errs.ErrorWithJson(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	if err := dba.AddVaultSnippet(ctx, s.Db, s.Store, userID, info.Language, info.Vault, info.Favorite, time.Now(), time.Now()); err != nil {
+		if s.interrupted(w, r, "AddSnippet", err) {
+			return
+		}
+
+		if errors.Is(err, dba.ErrNoVault) {
+			s.logger(r).Warn().Str("function", "AddSnippet").Msg("Vault snippet without a vault")
+			errs.ErrorWithJson(w, http.StatusConflict, "set up a vault with PUT /api/v1/user/vault first")
+			return
+		}
+
+		s.logger(r).Error().Str("function", "AddSnippet").Msg(err.Error())
+		errs.ErrorWithJson(w, http.StatusConflict, "failed to add snippet to database")
+		return
+	}
+
+	s.logger(r).Info().Str("function", "AddSnippet").Msg("Stored vault snippet")
+	w.WriteHeader(http.StatusCreated)
+}
+
+// GetVault returns the vault header clients derive the vault key from.
+func (s *SnippetService) GetVault(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, err := strconv.Atoi(r.Header.Get("X-USERID"))
+	if err != nil {
+		s.logger(r).Warn().Str("function", "GetVault").Msg("invalid 'X-USERID' header format")
+		errs.ErrorWithJson(w, http.StatusUnauthorized, "invalid 'X-USERID' header format")
+		return
+	}
+
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	header, err := dba.GetVault(ctx, s.Db, userID)
+	if err != nil {
+		if s.interrupted(w, r, "GetVault", err) {
+			return
+		}
+
+		if errors.Is(err, dba.ErrNoVault) || errors.Is(err, dba.ErrUserNotFound) {
+			errs.ErrorWithJson(w, http.StatusNotFound, "no vault set up")
+			return
+		}
+
+		s.logger(r).Error().Str("function", "GetVault").Err(err).Msg("failed to get vault")
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to get vault")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(header); err != nil {
+		s.logger(r).Error().Str("function", "GetVault").Err(err).Msg("failed to encode vault")
+	}
+}
+
+// SetVault stores the vault header a client generated with vault.New. It can
+// be replaced until the first vault snippet is stored.
+func (s *SnippetService) SetVault(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if r.Header.Get("Content-Type") != "application/json" {
+		s.logger(r).Warn().Str("function", "SetVault").Msg("Invalid Content-Type, expected application/json")
+		errs.ErrorWithJson(w, http.StatusBadRequest, "Content-Type must be 'application/json'")
+		return
+	}
+
+	userID, err := strconv.Atoi(r.Header.Get("X-USERID"))
+	if err != nil {
+		s.logger(r).Warn().Str("function", "SetVault").Msg("invalid 'X-USERID' header format")
+		errs.ErrorWithJson(w, http.StatusUnauthorized, "invalid 'X-USERID' header format")
+		return
+	}
+
+	var header vault.Header
+	if err := json.NewDecoder(r.Body).Decode(&header); err != nil {
+		if errs.IsBodyTooLarge(err) {
+			s.logger(r).Warn().Str("function", "SetVault").Msg("Request body too large")
+			errs.ErrorWithJson(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+
+		s.logger(r).Warn().Str("function", "SetVault").Msg("unable to parse request body")
+		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "unable to parse request body")
+		return
+	}
+
+	if err := header.Validate(); err != nil {
+		s.logger(r).Warn().Str("function", "SetVault").Err(err).Msg("invalid vault header")
+		errs.ErrorWithJson(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	if err := dba.SetVault(ctx, s.Db, userID, &header); err != nil {
+		if s.interrupted(w, r, "SetVault", err) {
+			return
+		}
+
+		if errors.Is(err, dba.ErrVaultInUse) {
+			s.logger(r).Warn().Str("function", "SetVault").Msg("vault already has snippets")
+			errs.ErrorWithJson(w, http.StatusConflict, "the vault already holds snippets, its passphrase can't change")
+			return
+		}
+
+		s.logger(r).Error().Str("function", "SetVault").Err(err).Msg("failed to store vault")
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to store vault")
+		return
+	}
+
+	s.logger(r).Info().Str("function", "SetVault").Msg("Vault set up")
+	w.WriteHeader(http.StatusNoContent)
+}
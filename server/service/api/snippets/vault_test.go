@@ -0,0 +1,33 @@
+package snippets
+
+import (
+	"testing"
+
+	"github.com/scott-mescudi/codelet/shared/vault"
+)
+
+func TestCheckVaultSnippet(t *testing.T) {
+	sealed := func(n int) []byte { return make([]byte, n+vault.Overhead) }
+
+	tests := []struct {
+		name  string
+		input vault.Snippet
+		valid bool
+	}{
+		{name: "Valid", input: vault.Snippet{Title: sealed(5), Code: sealed(100)}, valid: true},
+		{name: "With description", input: vault.Snippet{Title: sealed(5), Code: sealed(100), Description: sealed(10)}, valid: true},
+		{name: "Missing code", input: vault.Snippet{Title: sealed(5)}},
+		{name: "Truncated title", input: vault.Snippet{Title: []byte{1, 2}, Code: sealed(1)}},
+		{name: "Truncated description", input: vault.Snippet{Title: sealed(5), Code: sealed(1), Description: []byte{1}}},
+		{name: "Code too large", input: vault.Snippet{Title: sealed(5), Code: sealed(maxVaultCode + 1)}},
+		{name: "Title too large", input: vault.Snippet{Title: sealed(maxVaultTitle + 1), Code: sealed(1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if msg := checkVaultSnippet(&tt.input); (msg == "") != tt.valid {
+				t.Errorf("checkVaultSnippet() = %q, want valid %v", msg, tt.valid)
+			}
+		})
+	}
+}
@@ -1,7 +1,14 @@
 package users
 
 import (
+	"context"
+	"net/http"
 	"regexp"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/scott-mescudi/codelet/service/middleware"
+	auth "github.com/scott-mescudi/codelet/shared/auth"
 )
 
 func VerifyEmail(email string) bool {
@@ -14,3 +21,59 @@ func VerifyEmail(email string) bool {
 
 	return re.MatchString(email)
 }
+
+// logger returns the request scoped logger set up by middleware.RequestLogger,
+// or the service logger when the handler is called without it.
+func (s *UserService) logger(r *http.Request) *zerolog.Logger {
+	if l := zerolog.Ctx(r.Context()); l.GetLevel() != zerolog.Disabled {
+		return l
+	}
+	return &s.Logger
+}
+
+// queryContext bounds a single data access call by the configured query
+// timeout, see middleware.QueryContext.
+func (s *UserService) queryContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return middleware.QueryContext(r, s.QueryTimeout)
+}
+
+// interrupted answers requests whose database work was cancelled or timed
+// out, see middleware.Interrupted.
+func (s *UserService) interrupted(w http.ResponseWriter, r *http.Request, function string, err error) bool {
+	return middleware.Interrupted(w, s.logger(r), function, s.QueryTimeout, err)
+}
+
+// readOnly reports whether the server is in read-only maintenance mode.
+func (s *UserService) readOnly() bool {
+	return s.ReadOnly != nil && s.ReadOnly.Enabled()
+}
+
+func (s *UserService) deletionGrace() time.Duration {
+	if s.DeletionGrace > 0 {
+		return s.DeletionGrace
+	}
+	return 7 * 24 * time.Hour
+}
+
+// setSessionCookies writes the refresh token and the matching CSRF token. The
+// CSRF cookie is only ever compared against the X-CSRF-Token header, clients
+// get its value from the login and refresh response bodies.
+func setSessionCookies(w http.ResponseWriter, refreshToken, csrfToken string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "CODELET-JWT-REFRESH-TOKEN",
+		Value:    refreshToken,
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+		Secure:   true,
+	})
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.CSRFCookieName,
+		Value:    csrfToken,
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+		Secure:   true,
+	})
+}
@@ -1,13 +1,24 @@
 package users
 
 import (
+	"time"
+
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog"
+	"github.com/scott-mescudi/codelet/service/middleware"
 )
 
 type UserService struct {
-	Db     *pgxpool.Pool
-	Logger zerolog.Logger
+	Db              *pgxpool.Pool
+	Logger          zerolog.Logger
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	QueryTimeout    time.Duration
+	DeletionGrace   time.Duration
+	JWTSecret       []byte
+	// ReadOnly is the maintenance switch, login and refresh still answer
+	// while it is on even when their writes fail.
+	ReadOnly *middleware.ReadOnly
 }
 
 type UserLogin struct {
@@ -29,4 +40,12 @@ type ChangePassword struct {
 
 type UsernameResponse struct {
 	Username string `json:"username"`
-}
\ No newline at end of file
+}
+
+type DeleteAccount struct {
+	Password string `json:"password"`
+}
+
+type DeletionResponse struct {
+	DeleteAfter time.Time `json:"delete_after"`
+}
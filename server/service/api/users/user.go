@@ -37,10 +37,13 @@ var UpdatePasswordPool = &sync.Pool{
 	},
 }
 
+// Signup creates an account with the role "user". The role field is still
+// required but any other role asked for is ignored, so nobody can register
+// as an admin.
 func (s *UserService) Signup(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	if r.Header.Get("Content-Type") != "application/json" {
-		s.Logger.Warn().Str("function", "Signup").Str("origin", r.RemoteAddr).Msg("Invalid Content-Type, expected application/json")
+		s.logger(r).Warn().Str("function", "Signup").Msg("Invalid Content-Type, expected application/json")
 		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "Content-Type header must be application/json")
 		return
 	}
@@ -48,57 +51,75 @@ func (s *UserService) Signup(w http.ResponseWriter, r *http.Request) {
 	var info = SignupPool.Get().(*UserSignup)
 	defer SignupPool.Put(info)
 	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
-		s.Logger.Warn().Str("function", "Signup").Str("origin", r.RemoteAddr).Msg("Failed to decode body into json")
+		if errs.IsBodyTooLarge(err) {
+			s.logger(r).Warn().Str("function", "Signup").Msg("Request body too large")
+			errs.ErrorWithJson(w, http.StatusRequestEntityTooLarge, "Request body too large")
+			return
+		}
+
+		s.logger(r).Warn().Str("function", "Signup").Msg("Failed to decode body into json")
 		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "Invalid JSON payload: "+err.Error())
 		return
 	}
 
 	if !VerifyEmail(info.Email) {
-		s.Logger.Warn().Str("function", "Signup").Str("origin", r.RemoteAddr).Msg("Invalid email")
+		s.logger(r).Warn().Str("function", "Signup").Msg("Invalid email")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "Email field is invalid")
 		return
 	}
 
 	if info.Password == "" {
-		s.Logger.Warn().Str("function", "Signup").Str("origin", r.RemoteAddr).Msg("Invalid password")
+		s.logger(r).Warn().Str("function", "Signup").Msg("Invalid password")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "Password field is required")
 		return
 	}
 
 	if info.Username == "" {
-		s.Logger.Warn().Str("function", "Signup").Str("origin", r.RemoteAddr).Msg("Invalid Username")
+		s.logger(r).Warn().Str("function", "Signup").Msg("Invalid Username")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "Username field is required")
 		return
 	}
 
 	if info.Role == "" {
-		s.Logger.Warn().Str("function", "Signup").Str("origin", r.RemoteAddr).Msg("Invalid Role")
+		s.logger(r).Warn().Str("function", "Signup").Msg("Invalid Role")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "Role field is required")
 		return
 	}
 
+	// Self registered accounts are always plain users, other roles are
+	// handed out with the "user set-role" command.
+	if info.Role != "user" {
+		s.logger(r).Warn().Str("function", "Signup").Str("role", info.Role).Msg("Requested role ignored, creating a regular user")
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(info.Password), bcrypt.DefaultCost)
 	if err != nil {
-		s.Logger.Warn().Str("function", "Signup").Str("origin", r.RemoteAddr).Msg("Failed to hash password")
+		s.logger(r).Warn().Str("function", "Signup").Msg("Failed to hash password")
 		errs.ErrorWithJson(w, http.StatusInternalServerError, "Internal server error while processing password")
 		return
 	}
 
-	err = dba.AddUser(s.Db, info.Username, info.Email, info.Role, string(hashedPassword))
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	err = dba.AddUser(ctx, s.Db, info.Username, info.Email, "user", string(hashedPassword))
 	if err != nil {
-		s.Logger.Error().Str("function", "Signup").Str("origin", r.RemoteAddr).Err(err)
+		if s.interrupted(w, r, "Signup", err) {
+			return
+		}
+
+		s.logger(r).Error().Str("function", "Signup").Err(err).Msg("Failed to create user")
 		errs.ErrorWithJson(w, http.StatusBadRequest, fmt.Sprintf("Failed to create user: %v", err))
 		return
 	}
 
-	s.Logger.Info().Str("function", "Signup").Str("origin", r.RemoteAddr).Str("user", info.Username).Msg("Created new user")
+	s.logger(r).Info().Str("function", "Signup").Str("user", info.Username).Msg("Created new user")
 	w.WriteHeader(http.StatusCreated)
 }
 
 func (s *UserService) Login(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	if r.Header.Get("Content-Type") != "application/json" {
-		s.Logger.Warn().Str("function", "Login").Str("origin", r.RemoteAddr).Msg("Invalid Content-Type, expected application/json")
+		s.logger(r).Warn().Str("function", "Login").Msg("Invalid Content-Type, expected application/json")
 		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "Content-Type header must be application/json")
 		return
 	}
@@ -106,143 +127,172 @@ func (s *UserService) Login(w http.ResponseWriter, r *http.Request) {
 	var info = LoginPool.Get().(*UserLogin)
 	defer LoginPool.Put(info)
 	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
-		s.Logger.Warn().Str("function", "Login").Str("origin", r.RemoteAddr).Msg("Failed to decode body into json")
+		if errs.IsBodyTooLarge(err) {
+			s.logger(r).Warn().Str("function", "Login").Msg("Request body too large")
+			errs.ErrorWithJson(w, http.StatusRequestEntityTooLarge, "Request body too large")
+			return
+		}
+
+		s.logger(r).Warn().Str("function", "Login").Msg("Failed to decode body into json")
 		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "Invalid JSON payload: "+err.Error())
 		return
 	}
 
 	if info.Email == "" {
-		s.Logger.Warn().Str("function", "Login").Str("origin", r.RemoteAddr).Msg("Invalid email")
+		s.logger(r).Warn().Str("function", "Login").Msg("Invalid email")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "Email field is invalid")
 		return
 	}
 
 	if info.Password == "" {
-		s.Logger.Warn().Str("function", "Login").Str("origin", r.RemoteAddr).Msg("Invalid password")
+		s.logger(r).Warn().Str("function", "Login").Msg("Invalid password")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "Password field is required")
 		return
 	}
 
-	userID, passwordHash, last_login, err := dba.GetUserPasswordHashAndLastLogin(s.Db, info.Email)
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	userID, passwordHash, last_login, err := dba.GetUserPasswordHashAndLastLogin(ctx, s.Db, info.Email)
 	if err != nil {
-		s.Logger.Warn().Str("function", "Login").Str("origin", r.RemoteAddr).Err(err).Msg("Failed to retrieve user password hash")
+		if s.interrupted(w, r, "Login", err) {
+			return
+		}
+
+		s.logger(r).Warn().Str("function", "Login").Err(err).Msg("Failed to retrieve user password hash")
 		errs.ErrorWithJson(w, http.StatusUnauthorized, "Invalid email or password")
 		return
 	}
 
 	if last_login != nil && time.Since(*last_login) < 30*time.Second {
-		s.Logger.Warn().Str("function", "Login").Str("origin", r.RemoteAddr).Int("Userid", userID).Msg("Login attempt blocked: user must wait before trying again")
+		s.logger(r).Warn().Str("function", "Login").Int("Userid", userID).Msg("Login attempt blocked: user must wait before trying again")
 		errs.ErrorWithJson(w, http.StatusTooManyRequests, "Too many login attempts. Please wait a 30 seconds and try again.")
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(info.Password)); err != nil {
-		s.Logger.Warn().Str("function", "Login").Str("origin", r.RemoteAddr).Msg("Invalid password comparison")
+		s.logger(r).Warn().Str("function", "Login").Msg("Invalid password comparison")
 		errs.ErrorWithJson(w, http.StatusUnauthorized, "Invalid email or password")
 		return
 	}
 
-	accessToken := auth.GenerateHMac(userID, ACCESS, time.Now().Add(2*time.Hour))
-	refreshToken := auth.GenerateHMac(userID, REFRESH, time.Now().Add(48*time.Hour))
+	accessToken := auth.GenerateHMac(s.JWTSecret, userID, ACCESS, time.Now().Add(s.AccessTokenTTL))
+	refreshToken := auth.GenerateHMac(s.JWTSecret, userID, REFRESH, time.Now().Add(s.RefreshTokenTTL))
 
-	if err := dba.UpdateTokenAndLoginTime(s.Db, refreshToken, time.Now(), userID); err != nil {
-		s.Logger.Error().Str("function", "Login").Str("origin", r.RemoteAddr).Err(err).Msg("Failed to add refresh token")
-		errs.ErrorWithJson(w, http.StatusInternalServerError, "Failed to complete login process")
-		return
+	ctx, cancel = s.queryContext(r)
+	defer cancel()
+	if err := dba.UpdateTokenAndLoginTime(ctx, s.Db, refreshToken, time.Now(), userID); err != nil {
+		if s.interrupted(w, r, "Login", err) {
+			return
+		}
+
+		// In read-only mode the database may refuse writes. The access
+		// token still works, refreshing fails until the next login.
+		if !s.readOnly() {
+			s.logger(r).Error().Str("function", "Login").Err(err).Msg("Failed to add refresh token")
+			errs.ErrorWithJson(w, http.StatusInternalServerError, "Failed to complete login process")
+			return
+		}
+		s.logger(r).Warn().Str("function", "Login").Err(err).Msg("Refresh token and login time not saved in read-only mode")
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "CODELET-JWT-REFRESH-TOKEN",
-		Value:    refreshToken,
-		Expires:  time.Now().Add(48 * time.Hour),
-		HttpOnly: true,
-		SameSite: http.SameSiteNoneMode,
-		Secure:   true,
-	})
+	csrfToken := auth.GenerateCSRFToken()
+	setSessionCookies(w, refreshToken, csrfToken, time.Now().Add(s.RefreshTokenTTL))
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]string{"access_token": accessToken}); err != nil {
-		s.Logger.Error().Str("function", "Login").Err(err).Msg("Failed to encode response")
+	if err := json.NewEncoder(w).Encode(map[string]string{"access_token": accessToken, "csrf_token": csrfToken}); err != nil {
+		s.logger(r).Error().Str("function", "Login").Err(err).Msg("Failed to encode response")
 		errs.ErrorWithJson(w, http.StatusInternalServerError, "Failed to generate response")
 		return
 	}
 
-	s.Logger.Info().Str("function", "Login").Str("origin", r.RemoteAddr).Msg("User logged in successfully")
+	s.logger(r).Info().Str("function", "Login").Msg("User logged in successfully")
 }
 
 func (s *UserService) Refresh(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	cookie, err := r.Cookie("CODELET-JWT-REFRESH-TOKEN")
 	if err != nil {
-		s.Logger.Warn().Str("function", "Refresh").Str("origin", r.RemoteAddr).Err(err).Msg("No refresh token provided")
+		s.logger(r).Warn().Str("function", "Refresh").Err(err).Msg("No refresh token provided")
 		errs.ErrorWithJson(w, http.StatusUnauthorized, "No refresh token provided")
 		return
 	}
 
 	if cookie.Value == "" {
-		s.Logger.Warn().Str("function", "Refresh").Str("origin", r.RemoteAddr).Msg("Invalid refresh token")
+		s.logger(r).Warn().Str("function", "Refresh").Msg("Invalid refresh token")
 		errs.ErrorWithJson(w, http.StatusUnauthorized, "Invalid refresh token")
 		return
 	}
 
-	userID, tokenType, err := auth.ValidateHmac(cookie.Value)
+	userID, tokenType, err := auth.ValidateHmac(s.JWTSecret, cookie.Value)
 	if err != nil {
-		s.Logger.Warn().Str("function", "Refresh").Str("origin", r.RemoteAddr).Err(err).Msg("Invalid or expired refresh token")
+		s.logger(r).Warn().Str("function", "Refresh").Err(err).Msg("Invalid or expired refresh token")
 		errs.ErrorWithJson(w, http.StatusUnauthorized, "Invalid or expired refresh token")
 		return
 	}
 
 	if tokenType != REFRESH {
-		s.Logger.Warn().Str("function", "Refresh").Str("origin", r.RemoteAddr).Msg("Invalid token type")
+		s.logger(r).Warn().Str("function", "Refresh").Msg("Invalid token type")
 		errs.ErrorWithJson(w, http.StatusUnauthorized, "Invalid token type")
 		return
 	}
 
 	if userID == -1 {
-		s.Logger.Warn().Str("function", "Refresh").Str("origin", r.RemoteAddr).Msg("Invalid user token")
+		s.logger(r).Warn().Str("function", "Refresh").Msg("Invalid user token")
 		errs.ErrorWithJson(w, http.StatusUnauthorized, "Invalid user token")
 		return
 	}
 
-	dbToken, err := dba.GetRefreshToken(s.Db, userID)
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	dbToken, err := dba.GetRefreshToken(ctx, s.Db, userID)
 	if err != nil {
-		s.Logger.Error().Str("function", "Refresh").Str("origin", r.RemoteAddr).Err(err).Msg("Failed to retrieve refresh token from database")
+		if s.interrupted(w, r, "Refresh", err) {
+			return
+		}
+
+		s.logger(r).Error().Str("function", "Refresh").Err(err).Msg("Failed to retrieve refresh token from database")
 		errs.ErrorWithJson(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	if cookie.Value != dbToken {
-		s.Logger.Warn().Str("function", "Refresh").Str("origin", r.RemoteAddr).Msg("Refresh token mismatch")
+		s.logger(r).Warn().Str("function", "Refresh").Msg("Refresh token mismatch")
 		w.WriteHeader(http.StatusForbidden)
 		return
 	}
 
-	accessToken := auth.GenerateHMac(userID, ACCESS, time.Now().Add(2*time.Hour))
-	refreshToken := auth.GenerateHMac(userID, REFRESH, time.Now().Add(48*time.Hour))
+	accessToken := auth.GenerateHMac(s.JWTSecret, userID, ACCESS, time.Now().Add(s.AccessTokenTTL))
+	refreshToken := auth.GenerateHMac(s.JWTSecret, userID, REFRESH, time.Now().Add(s.RefreshTokenTTL))
 
-	if err := dba.AddRefreshToken(s.Db, refreshToken, userID); err != nil {
-		s.Logger.Error().Str("function", "Refresh").Str("origin", r.RemoteAddr).Err(err).Msg("Failed to add new refresh token")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	ctx, cancel = s.queryContext(r)
+	defer cancel()
+	if err := dba.AddRefreshToken(ctx, s.Db, refreshToken, userID); err != nil {
+		if s.interrupted(w, r, "Refresh", err) {
+			return
+		}
+
+		// In read-only mode the database may refuse writes, the client
+		// keeps the refresh token it has instead.
+		if !s.readOnly() {
+			s.logger(r).Error().Str("function", "Refresh").Err(err).Msg("Failed to add new refresh token")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.logger(r).Warn().Str("function", "Refresh").Err(err).Msg("Refresh token not rotated in read-only mode")
+		refreshToken = cookie.Value
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "CODELET-JWT-REFRESH-TOKEN",
-		Value:    refreshToken,
-		Expires:  time.Now().Add(48 * time.Hour),
-		HttpOnly: true,
-		SameSite: http.SameSiteNoneMode,
-		Secure:   true,
-	})
+	csrfToken := auth.GenerateCSRFToken()
+	setSessionCookies(w, refreshToken, csrfToken, time.Now().Add(s.RefreshTokenTTL))
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]string{"acess_token": accessToken}); err != nil {
-		s.Logger.Error().Str("function", "Refresh").Err(err).Msg("Failed to encode response")
+	if err := json.NewEncoder(w).Encode(map[string]string{"acess_token": accessToken, "csrf_token": csrfToken}); err != nil {
+		s.logger(r).Error().Str("function", "Refresh").Err(err).Msg("Failed to encode response")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	s.Logger.Info().Str("function", "Refresh").Str("origin", r.RemoteAddr).Msg("Refresh token successfully renewed")
+	s.logger(r).Info().Str("function", "Refresh").Msg("Refresh token successfully renewed")
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -260,16 +310,15 @@ func (s *UserService) Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "CODELET-JWT-REFRESH-TOKEN",
-		Value:    "",
-		Expires:  time.Now(),
-		HttpOnly: true,
-		SameSite: http.SameSiteNoneMode,
-		Secure:   true,
-	})
+	setSessionCookies(w, "", "", time.Now())
+
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	if err := dba.AddRefreshToken(ctx, s.Db, "", userID); err != nil {
+		if s.interrupted(w, r, "Logout", err) {
+			return
+		}
 
-	if err := dba.AddRefreshToken(s.Db, "", userID); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -279,7 +328,7 @@ func (s *UserService) Logout(w http.ResponseWriter, r *http.Request) {
 
 func (s *UserService) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	if r.Header.Get("Content-Type") != "application/json" {
-		s.Logger.Warn().Str("function", "ChangePassword").Str("origin", r.RemoteAddr).Msg("Invalid Content-Type, expected application/json")
+		s.logger(r).Warn().Str("function", "ChangePassword").Msg("Invalid Content-Type, expected application/json")
 		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "Content-Type header must be application/json")
 		return
 	}
@@ -289,59 +338,77 @@ func (s *UserService) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	var info = UpdatePasswordPool.Get().(*ChangePassword)
 	defer UpdatePasswordPool.Put(info)
 	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
-		s.Logger.Warn().Str("function", "ChangePassword").Str("origin", r.RemoteAddr).Err(err).Msg("Failed to decode body into json")
+		if errs.IsBodyTooLarge(err) {
+			s.logger(r).Warn().Str("function", "ChangePassword").Msg("Request body too large")
+			errs.ErrorWithJson(w, http.StatusRequestEntityTooLarge, "Request body too large")
+			return
+		}
+
+		s.logger(r).Warn().Str("function", "ChangePassword").Err(err).Msg("Failed to decode body into json")
 		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "Invalid JSON payload: "+err.Error())
 		return
 	}
 
 	if info.OldPassword == "" || info.NewPassword == "" {
-		s.Logger.Warn().Str("function", "ChangePassword").Str("origin", r.RemoteAddr).Msg("Both old and new passwords are required")
+		s.logger(r).Warn().Str("function", "ChangePassword").Msg("Both old and new passwords are required")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "Both old and new passwords are required")
 		return
 	}
 
 	useridStr := r.Header.Get("X-USERID")
 	if useridStr == "" {
-		s.Logger.Warn().Str("function", "ChangePassword").Str("origin", r.RemoteAddr).Msg("User ID not found in request")
+		s.logger(r).Warn().Str("function", "ChangePassword").Msg("User ID not found in request")
 		errs.ErrorWithJson(w, http.StatusUnauthorized, "User ID not found in request")
 		return
 	}
 
 	userID, err := strconv.Atoi(useridStr)
 	if err != nil {
-		s.Logger.Error().Str("function", "ChangePassword").Err(err).Msg("Failed to parse user ID")
+		s.logger(r).Error().Str("function", "ChangePassword").Err(err).Msg("Failed to parse user ID")
 		errs.ErrorWithJson(w, http.StatusInternalServerError, "Invalid user ID format")
 		return
 	}
 
-	passwordHash, err := dba.GetUserPasswordHashViaID(s.Db, userID)
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	passwordHash, err := dba.GetUserPasswordHashViaID(ctx, s.Db, userID)
 	if err != nil {
-		s.Logger.Warn().Str("function", "ChangePassword").Str("origin", r.RemoteAddr).Msg("User not found")
+		if s.interrupted(w, r, "ChangePassword", err) {
+			return
+		}
+
+		s.logger(r).Warn().Str("function", "ChangePassword").Msg("User not found")
 		errs.ErrorWithJson(w, http.StatusUnauthorized, "User not found")
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(info.OldPassword)); err != nil {
-		s.Logger.Warn().Str("function", "ChangePassword").Str("origin", r.RemoteAddr).Msg("Old password does not match")
+		s.logger(r).Warn().Str("function", "ChangePassword").Msg("Old password does not match")
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
 	hashedNewPassword, err := bcrypt.GenerateFromPassword([]byte(info.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
-		s.Logger.Error().Str("function", "ChangePassword").Err(err).Msg("Failed to hash new password")
+		s.logger(r).Error().Str("function", "ChangePassword").Err(err).Msg("Failed to hash new password")
 		errs.ErrorWithJson(w, http.StatusInternalServerError, "Failed to process new password")
 		return
 	}
 
-	err = dba.UpdatePassword(s.Db, string(hashedNewPassword), time.Now(), userID)
+	ctx, cancel = s.queryContext(r)
+	defer cancel()
+	err = dba.UpdatePassword(ctx, s.Db, string(hashedNewPassword), time.Now(), userID)
 	if err != nil {
-		s.Logger.Error().Str("function", "ChangePassword").Err(err).Msg("Failed to update password in database")
+		if s.interrupted(w, r, "ChangePassword", err) {
+			return
+		}
+
+		s.logger(r).Error().Str("function", "ChangePassword").Err(err).Msg("Failed to update password in database")
 		errs.ErrorWithJson(w, http.StatusInternalServerError, "Failed to update password in database")
 		return
 	}
 
-	s.Logger.Info().Str("function", "ChangePassword").Str("origin", r.RemoteAddr).Msg("Password changed successfully")
+	s.logger(r).Info().Str("function", "ChangePassword").Msg("Password changed successfully")
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -350,30 +417,123 @@ func (s *UserService) GetUsernameByID(w http.ResponseWriter, r *http.Request) {
 
 	useridStr := r.Header.Get("X-USERID")
 	if useridStr == "" {
-		s.Logger.Warn().Str("function", "GetUsernameByID").Str("origin", r.RemoteAddr).Msg("Missing 'X-USERID' header")
+		s.logger(r).Warn().Str("function", "GetUsernameByID").Msg("Missing 'X-USERID' header")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "missing 'X-USERID' header")
 		return
 	}
 
 	userID, err := strconv.Atoi(useridStr)
 	if err != nil {
-		s.Logger.Warn().Str("function", "GetUsernameByID").Str("origin", r.RemoteAddr).Msg("invalid 'X-USERID' header format")
+		s.logger(r).Warn().Str("function", "GetUsernameByID").Msg("invalid 'X-USERID' header format")
 		errs.ErrorWithJson(w, http.StatusInternalServerError, "invalid 'X-USERID' header format")
 		return
 	}
 
-	username, err := dba.GetUsernameByID(s.Db, userID)
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	username, err := dba.GetUsernameByID(ctx, s.Db, userID)
 	if err != nil {
-		s.Logger.Warn().Str("function", "GetUserNameByID").Str("origin", r.RemoteAddr).Err(err).Msg("failed to get user from database")
+		if s.interrupted(w, r, "GetUserNameByID", err) {
+			return
+		}
+
+		s.logger(r).Warn().Str("function", "GetUserNameByID").Err(err).Msg("failed to get user from database")
 		errs.ErrorWithJson(w, http.StatusBadRequest, "failed to get user from database")
 		return
 	}
 
-
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(UsernameResponse{Username: username}); err != nil {
-		s.Logger.Error().Int("userID", userID).Str("function", "GetUsernameByID").Str("origin", r.RemoteAddr).Msg("failed to encode username")
+		s.logger(r).Error().Str("function", "GetUsernameByID").Msg("failed to encode username")
 		errs.ErrorWithJson(w, http.StatusInternalServerError, "failed to encode username as JSON")
 		return
 	}
-}
\ No newline at end of file
+}
+
+// DeleteAccount schedules the caller's account for deletion once the grace
+// period has passed. The password has to be confirmed again, and logging in
+// before the deadline keeps the account.
+func (s *UserService) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		s.logger(r).Warn().Str("function", "DeleteAccount").Msg("Invalid Content-Type, expected application/json")
+		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "Content-Type header must be application/json")
+		return
+	}
+
+	defer r.Body.Close()
+
+	var info DeleteAccount
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		if errs.IsBodyTooLarge(err) {
+			s.logger(r).Warn().Str("function", "DeleteAccount").Msg("Request body too large")
+			errs.ErrorWithJson(w, http.StatusRequestEntityTooLarge, "Request body too large")
+			return
+		}
+
+		s.logger(r).Warn().Str("function", "DeleteAccount").Err(err).Msg("Failed to decode body into json")
+		errs.ErrorWithJson(w, http.StatusUnprocessableEntity, "Invalid JSON payload: "+err.Error())
+		return
+	}
+
+	if info.Password == "" {
+		s.logger(r).Warn().Str("function", "DeleteAccount").Msg("Password is required")
+		errs.ErrorWithJson(w, http.StatusBadRequest, "Password is required")
+		return
+	}
+
+	useridStr := r.Header.Get("X-USERID")
+	if useridStr == "" {
+		s.logger(r).Warn().Str("function", "DeleteAccount").Msg("User ID not found in request")
+		errs.ErrorWithJson(w, http.StatusUnauthorized, "User ID not found in request")
+		return
+	}
+
+	userID, err := strconv.Atoi(useridStr)
+	if err != nil {
+		s.logger(r).Error().Str("function", "DeleteAccount").Err(err).Msg("Failed to parse user ID")
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "Invalid user ID format")
+		return
+	}
+
+	ctx, cancel := s.queryContext(r)
+	defer cancel()
+	passwordHash, err := dba.GetUserPasswordHashViaID(ctx, s.Db, userID)
+	if err != nil {
+		if s.interrupted(w, r, "DeleteAccount", err) {
+			return
+		}
+
+		s.logger(r).Warn().Str("function", "DeleteAccount").Msg("User not found")
+		errs.ErrorWithJson(w, http.StatusUnauthorized, "User not found")
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(info.Password)); err != nil {
+		s.logger(r).Warn().Str("function", "DeleteAccount").Msg("Password does not match")
+		errs.ErrorWithJson(w, http.StatusUnauthorized, "Invalid password")
+		return
+	}
+
+	deleteAfter := time.Now().Add(s.deletionGrace()).UTC()
+
+	ctx, cancel = s.queryContext(r)
+	defer cancel()
+	if err := dba.ScheduleUserDeletion(ctx, s.Db, userID, deleteAfter); err != nil {
+		if s.interrupted(w, r, "DeleteAccount", err) {
+			return
+		}
+
+		s.logger(r).Error().Str("function", "DeleteAccount").Err(err).Msg("Failed to schedule account deletion")
+		errs.ErrorWithJson(w, http.StatusInternalServerError, "Failed to schedule account deletion")
+		return
+	}
+
+	setSessionCookies(w, "", "", time.Now())
+
+	s.logger(r).Info().Str("function", "DeleteAccount").Time("delete_after", deleteAfter).Msg("Account scheduled for deletion")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(DeletionResponse{DeleteAfter: deleteAfter}); err != nil {
+		s.logger(r).Error().Str("function", "DeleteAccount").Err(err).Msg("failed to encode response")
+	}
+}
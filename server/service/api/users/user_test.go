@@ -20,6 +20,9 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// testSecret signs the tokens of the tests.
+var testSecret = []byte("codelet-test-secret-codelet-test-secret")
+
 func setupTestDB(testData string) (*pgxpool.Pool, func(), error) {
 	ctx := context.Background()
 
@@ -54,6 +57,9 @@ func setupTestDB(testData string) (*pgxpool.Pool, func(), error) {
 		password_hash VARCHAR(255) NOT NULL,
 		last_login TIMESTAMP,
 		refresh_token text DEFAULT null,
+		disabled BOOLEAN NOT NULL DEFAULT false,
+		delete_after TIMESTAMPTZ,
+		vault JSONB,
 		created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		);
@@ -64,6 +70,41 @@ func setupTestDB(testData string) (*pgxpool.Pool, func(), error) {
 		return nil, nil, fmt.Errorf("failed to create users table: %v", err)
 	}
 
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS data_keys (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+		master_key_id TEXT NOT NULL,
+		wrapped_key BYTEA NOT NULL,
+		created TIMESTAMPTZ NOT NULL DEFAULT now(),
+		rotated TIMESTAMPTZ
+		);
+	`)
+
+	if err != nil {
+		clean()
+		return nil, nil, fmt.Errorf("failed to create data_keys table: %v", err)
+	}
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS code_blobs (
+		id BIGSERIAL PRIMARY KEY,
+		hash BYTEA NOT NULL,
+		key_id INT REFERENCES data_keys(id) ON DELETE CASCADE,
+		language TEXT NOT NULL DEFAULT '',
+		code BYTEA NOT NULL,
+		refs INT NOT NULL DEFAULT 0,
+		created TIMESTAMPTZ NOT NULL DEFAULT now(),
+		unreferenced TIMESTAMPTZ DEFAULT now()
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS code_blobs_hash_key_idx ON code_blobs(hash, COALESCE(key_id, 0));
+	`)
+
+	if err != nil {
+		clean()
+		return nil, nil, fmt.Errorf("failed to create code_blobs table: %v", err)
+	}
+
 	_, err = conn.Exec(ctx, `
 		CREATE TABLE IF NOT EXISTS snippets (
 		id SERIAL PRIMARY KEY,
@@ -71,7 +112,12 @@ func setupTestDB(testData string) (*pgxpool.Pool, func(), error) {
 		language VARCHAR(50) NOT NULL,
 		favorite boolean DEFAULT false,
 		title VARCHAR(255) NOT NULL UNIQUE,
-		code BYTEA NOT NULL,
+		code BYTEA,
+		key_id INT REFERENCES data_keys(id),
+		blob_id BIGINT REFERENCES code_blobs(id),
+		vault BOOLEAN NOT NULL DEFAULT false,
+		vault_title BYTEA,
+		vault_description BYTEA,
 		description TEXT,
 		private boolean NOT NULL,
 		tags VARCHAR(50)[],
@@ -104,7 +150,7 @@ func TestSignup(t *testing.T) {
 	}
 	defer clean()
 
-	app := &UserService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	app := &UserService{Db: conn, Logger: zerolog.New(os.Stdout), AccessTokenTTL: time.Hour, RefreshTokenTTL: 2 * time.Hour, JWTSecret: testSecret}
 
 	validTests := []struct {
 		name     string
@@ -198,6 +244,17 @@ func TestSignup(t *testing.T) {
 		})
 	}
 
+	t.Run("Requested role is ignored", func(t *testing.T) {
+		var role string
+		if err := conn.QueryRow(context.Background(), "SELECT role FROM users WHERE username=$1", "jacky").Scan(&role); err != nil {
+			t.Fatal(err)
+		}
+
+		if role != "user" {
+			t.Errorf("Expected a signup asking for admin to get role %q, got %q", "user", role)
+		}
+	})
+
 	t.Run("Rapid Login", func(t *testing.T) {})
 
 	t.Run("Malformed json", func(t *testing.T) {
@@ -248,7 +305,7 @@ func TestLogin(t *testing.T) {
 	}
 	defer clean()
 
-	app := &UserService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	app := &UserService{Db: conn, Logger: zerolog.New(os.Stdout), AccessTokenTTL: time.Hour, RefreshTokenTTL: 2 * time.Hour, JWTSecret: testSecret}
 
 	validTests := []struct {
 		name     string
@@ -349,7 +406,7 @@ func TestRefresh(t *testing.T) {
 	}
 	defer clean()
 
-	app := &UserService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	app := &UserService{Db: conn, Logger: zerolog.New(os.Stdout), AccessTokenTTL: time.Hour, RefreshTokenTTL: 2 * time.Hour, JWTSecret: testSecret}
 
 	body, err := json.Marshal(UserLogin{Email: "fakeuser@example.com", Password: "hashedpassword123"})
 	if err != nil {
@@ -375,7 +432,7 @@ func TestRefresh(t *testing.T) {
 			t.Fatal("No cookies set in login response")
 		}
 
-		refreshReq := httptest.NewRequest("GET", "/api/v1/refresh", nil)
+		refreshReq := httptest.NewRequest("POST", "/api/v1/refresh", nil)
 		refreshRec := httptest.NewRecorder()
 
 		app.Refresh(refreshRec, refreshReq)
@@ -390,7 +447,7 @@ func TestRefresh(t *testing.T) {
 			t.Fatal("No cookies set in login response")
 		}
 
-		refreshReq := httptest.NewRequest("GET", "/api/v1/refresh", nil)
+		refreshReq := httptest.NewRequest("POST", "/api/v1/refresh", nil)
 		refreshReq.Header.Set("Authorization", info.Token)
 		for _, cookie := range cookies {
 			refreshReq.AddCookie(cookie)
@@ -416,7 +473,7 @@ func TestLogout(t *testing.T) {
 	}
 	defer clean()
 
-	app := &UserService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	app := &UserService{Db: conn, Logger: zerolog.New(os.Stdout), AccessTokenTTL: time.Hour, RefreshTokenTTL: 2 * time.Hour, JWTSecret: testSecret}
 
 	body, err := json.Marshal(UserLogin{Email: "fakeuser@example.com", Password: "hashedpassword123"})
 	if err != nil {
@@ -447,7 +504,7 @@ func TestLogout(t *testing.T) {
 			logoutReq.AddCookie(cookie)
 		}
 
-		handler := middleware.AuthMiddleware(http.HandlerFunc(app.Logout))
+		handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.Logout))
 		handler.ServeHTTP(loginRec, logoutReq)
 
 		var cookie string
@@ -477,7 +534,7 @@ func TestChangePassword(t *testing.T) {
 	}
 	defer clean()
 
-	app := &UserService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	app := &UserService{Db: conn, Logger: zerolog.New(os.Stdout), AccessTokenTTL: time.Hour, RefreshTokenTTL: 2 * time.Hour, JWTSecret: testSecret}
 
 	body, err := json.Marshal(UserLogin{Email: "fakeuser@example.com", Password: "hashedpassword123"})
 	if err != nil {
@@ -541,7 +598,7 @@ func TestChangePassword(t *testing.T) {
 			Req.Header.Set("Authorization", rr.Token)
 			Rec := httptest.NewRecorder()
 
-			handler := middleware.AuthMiddleware(http.HandlerFunc(app.ChangePassword))
+			handler := middleware.AuthMiddleware(testSecret, http.HandlerFunc(app.ChangePassword))
 			handler.ServeHTTP(Rec, Req)
 
 			if Rec.Code != tt.expected {
@@ -553,7 +610,6 @@ func TestChangePassword(t *testing.T) {
 
 }
 
-
 func TestGetUsernameByID(t *testing.T) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("hashedpassword123"), bcrypt.DefaultCost)
 	if err != nil {
@@ -566,7 +622,7 @@ func TestGetUsernameByID(t *testing.T) {
 	}
 	defer clean()
 
-	app := &UserService{Db: conn, Logger: zerolog.New(os.Stdout)}
+	app := &UserService{Db: conn, Logger: zerolog.New(os.Stdout), AccessTokenTTL: time.Hour, RefreshTokenTTL: 2 * time.Hour, JWTSecret: testSecret}
 
 	body, err := json.Marshal(UserLogin{Email: "fakeuser@example.com", Password: "hashedpassword123"})
 	if err != nil {
@@ -586,21 +642,19 @@ func TestGetUsernameByID(t *testing.T) {
 	if err := json.NewDecoder(loginRec.Body).Decode(&info); err != nil {
 		t.Fatal(err)
 	}
-	
-	
+
 	t.Run("valid req", func(t *testing.T) {
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest("GET", "/api/v1/username", http.NoBody)
 		req.Header.Set("Authorization", info.Token)
 
-		handler := http.Handler(middleware.AuthMiddleware(app.GetUsernameByID))
+		handler := http.Handler(middleware.AuthMiddleware(testSecret, app.GetUsernameByID))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusOK {
 			t.Fatal("Failed to get 200 code", rec.Code)
 		}
 
-		
 		var info struct {
 			Username string `json:"username"`
 		}
@@ -618,11 +672,11 @@ func TestGetUsernameByID(t *testing.T) {
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest("GET", "/api/v1/username", http.NoBody)
 
-		handler := http.Handler(middleware.AuthMiddleware(app.GetUsernameByID))
+		handler := http.Handler(middleware.AuthMiddleware(testSecret, app.GetUsernameByID))
 		handler.ServeHTTP(rec, req)
 
 		if rec.Code != http.StatusForbidden {
 			t.Fatal("Failed to get 403 code", rec.Code)
 		}
 	})
-}
\ No newline at end of file
+}
@@ -0,0 +1,244 @@
+// Package backup writes and reads logical backups of a codelet database.
+//
+// An archive is a tar stream, zstd compressed unless asked otherwise.
+// Compression dictionaries, users, data keys, code blobs and snippets are
+// stored as JSON lines split into chunks of ChunkSize records, in that order
+// so a restore can remap IDs in one pass. Dictionaries keep their IDs, code
+// refers to them from inside its zstd frames.
+// Data keys stay wrapped, restoring encrypted snippets needs the master keys
+// they were wrapped with. The manifest
+// comes last and holds the checksum of every chunk: an archive cut short
+// has no manifest and is rejected.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/klauspost/compress/zstd"
+	dataAccess "github.com/scott-mescudi/codelet/service/data_access"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const (
+	Format       = "codelet-backup"
+	Version      = 4
+	ManifestName = "manifest.json"
+	ChunkSize    = 1000
+)
+
+type Manifest struct {
+	Format        string    `json:"format"`
+	Version       int       `json:"version"`
+	Created       time.Time `json:"created"`
+	SchemaVersion int       `json:"schema_version"`
+	Dictionaries  int       `json:"dictionaries"`
+	Users         int       `json:"users"`
+	DataKeys      int       `json:"data_keys"`
+	Blobs         int       `json:"blobs"`
+	Snippets      int       `json:"snippets"`
+	Files         []File    `json:"files"`
+}
+
+type File struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Records int    `json:"records"`
+	SHA256  string `json:"sha256"`
+}
+
+const (
+	kindDictionaries = "dictionaries"
+	kindUsers        = "users"
+	kindDataKeys     = "data_keys"
+	kindBlobs        = "blobs"
+	kindSnippets     = "snippets"
+)
+
+type Options struct {
+	// Uncompressed writes a plain tar instead of a zstd compressed one.
+	Uncompressed bool
+}
+
+// source is what a backup reads from, a *dataAccess.Snapshot in practice.
+type source interface {
+	Dictionaries(ctx context.Context, fn func(dataAccess.BackupDictionary) error) error
+	Users(ctx context.Context, fn func(dataAccess.BackupUser) error) error
+	DataKeys(ctx context.Context, fn func(dataAccess.BackupDataKey) error) error
+	Blobs(ctx context.Context, fn func(dataAccess.BackupBlob) error) error
+	Snippets(ctx context.Context, fn func(dataAccess.BackupSnippet) error) error
+}
+
+// Write streams a backup of everything in db to w and returns its manifest.
+// The data comes from a single snapshot, so it is consistent even while the
+// server keeps taking writes.
+func Write(ctx context.Context, db *pgxpool.Pool, w io.Writer, opts Options) (*Manifest, error) {
+	snap, err := dataAccess.BeginSnapshot(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Close(ctx)
+
+	return write(ctx, snap, snap.SchemaVersion, w, opts)
+}
+
+func write(ctx context.Context, src source, schemaVersion int, w io.Writer, opts Options) (*Manifest, error) {
+	out := w
+	var zw *zstd.Encoder
+	if !opts.Uncompressed {
+		var err error
+		zw, err = zstd.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		out = zw
+	}
+
+	aw := &archiveWriter{
+		tw:       tar.NewWriter(out),
+		manifest: &Manifest{Format: Format, Version: Version, Created: time.Now().UTC(), SchemaVersion: schemaVersion},
+	}
+
+	err := src.Dictionaries(ctx, func(d dataAccess.BackupDictionary) error {
+		aw.manifest.Dictionaries++
+		return aw.add(kindDictionaries, d)
+	})
+	if err == nil {
+		err = aw.flush()
+	}
+	if err == nil {
+		err = src.Users(ctx, func(u dataAccess.BackupUser) error {
+			aw.manifest.Users++
+			return aw.add(kindUsers, u)
+		})
+	}
+	if err == nil {
+		err = aw.flush()
+	}
+	if err == nil {
+		err = src.DataKeys(ctx, func(k dataAccess.BackupDataKey) error {
+			aw.manifest.DataKeys++
+			return aw.add(kindDataKeys, k)
+		})
+	}
+	if err == nil {
+		err = aw.flush()
+	}
+	if err == nil {
+		err = src.Blobs(ctx, func(b dataAccess.BackupBlob) error {
+			aw.manifest.Blobs++
+			return aw.add(kindBlobs, b)
+		})
+	}
+	if err == nil {
+		err = aw.flush()
+	}
+	if err == nil {
+		err = src.Snippets(ctx, func(s dataAccess.BackupSnippet) error {
+			aw.manifest.Snippets++
+			return aw.add(kindSnippets, s)
+		})
+	}
+	if err == nil {
+		err = aw.close()
+	}
+	if err == nil && zw != nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return aw.manifest, nil
+}
+
+type archiveWriter struct {
+	tw       *tar.Writer
+	manifest *Manifest
+
+	kind    string
+	records int
+	buf     bytes.Buffer
+}
+
+func (a *archiveWriter) add(kind string, record any) error {
+	if a.kind != kind || a.records == ChunkSize {
+		if err := a.flush(); err != nil {
+			return err
+		}
+		a.kind = kind
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	a.buf.Write(line)
+	a.buf.WriteByte('\n')
+	a.records++
+	return nil
+}
+
+func (a *archiveWriter) flush() error {
+	if a.records == 0 {
+		return nil
+	}
+
+	sum := sha256.Sum256(a.buf.Bytes())
+	file := File{
+		Name:    fmt.Sprintf("%s-%05d.jsonl", a.kind, len(a.manifest.Files)+1),
+		Kind:    a.kind,
+		Records: a.records,
+		SHA256:  hex.EncodeToString(sum[:]),
+	}
+
+	if err := a.writeFile(file.Name, a.buf.Bytes()); err != nil {
+		return err
+	}
+
+	a.manifest.Files = append(a.manifest.Files, file)
+	a.buf.Reset()
+	a.records = 0
+	return nil
+}
+
+func (a *archiveWriter) close() error {
+	if err := a.flush(); err != nil {
+		return err
+	}
+
+	manifest, err := json.MarshalIndent(a.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := a.writeFile(ManifestName, manifest); err != nil {
+		return err
+	}
+	return a.tw.Close()
+}
+
+func (a *archiveWriter) writeFile(name string, data []byte) error {
+	err := a.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: a.manifest.Created,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = a.tw.Write(data)
+	return err
+}
@@ -0,0 +1,326 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	dataAccess "github.com/scott-mescudi/codelet/service/data_access"
+)
+
+type fakeSource struct {
+	dicts    []dataAccess.BackupDictionary
+	users    []dataAccess.BackupUser
+	dataKeys []dataAccess.BackupDataKey
+	blobs    []dataAccess.BackupBlob
+	snippets []dataAccess.BackupSnippet
+}
+
+func (f *fakeSource) Dictionaries(_ context.Context, fn func(dataAccess.BackupDictionary) error) error {
+	for _, d := range f.dicts {
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeSource) Users(_ context.Context, fn func(dataAccess.BackupUser) error) error {
+	for _, u := range f.users {
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeSource) DataKeys(_ context.Context, fn func(dataAccess.BackupDataKey) error) error {
+	for _, k := range f.dataKeys {
+		if err := fn(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeSource) Blobs(_ context.Context, fn func(dataAccess.BackupBlob) error) error {
+	for _, b := range f.blobs {
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeSource) Snippets(_ context.Context, fn func(dataAccess.BackupSnippet) error) error {
+	for _, s := range f.snippets {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type fakeSink struct {
+	dicts    []dataAccess.BackupDictionary
+	users    []dataAccess.BackupUser
+	dataKeys []dataAccess.BackupDataKey
+	blobs    []dataAccess.BackupBlob
+	snippets []dataAccess.BackupSnippet
+}
+
+func (f *fakeSink) AddDictionary(_ context.Context, d dataAccess.BackupDictionary) error {
+	f.dicts = append(f.dicts, d)
+	return nil
+}
+
+func (f *fakeSink) AddUser(_ context.Context, u dataAccess.BackupUser) error {
+	f.users = append(f.users, u)
+	return nil
+}
+
+func (f *fakeSink) AddDataKey(_ context.Context, k dataAccess.BackupDataKey) error {
+	f.dataKeys = append(f.dataKeys, k)
+	return nil
+}
+
+func (f *fakeSink) AddBlob(_ context.Context, b dataAccess.BackupBlob) error {
+	f.blobs = append(f.blobs, b)
+	return nil
+}
+
+func (f *fakeSink) AddSnippets(_ context.Context, s []dataAccess.BackupSnippet) error {
+	f.snippets = append(f.snippets, s...)
+	return nil
+}
+
+func newSource(users, snippets int) *fakeSource {
+	src := &fakeSource{}
+	now := time.Now().UTC().Truncate(time.Second)
+	if snippets > 0 {
+		src.dicts = append(src.dicts, dataAccess.BackupDictionary{ID: 32768, Language: "go", Data: []byte{0x37, 0xa4, 0x30, 0xec}, Samples: 10, Created: now})
+	}
+	for i := 1; i <= users; i++ {
+		src.users = append(src.users, dataAccess.BackupUser{ID: i * 10, Username: fmt.Sprint("user", i), Email: fmt.Sprintf("u%d@codelet.dev", i), Role: "user", PasswordHash: "$2a$10$hash", Created: &now})
+		src.dataKeys = append(src.dataKeys, dataAccess.BackupDataKey{ID: i * 100, UserID: i * 10, MasterKeyID: "k1", WrappedKey: []byte{1, byte(i)}, Created: now})
+	}
+	for i := 1; i <= snippets; i++ {
+		sn := dataAccess.BackupSnippet{ID: i, UserID: 10 * (i%users + 1), Language: "go", Title: "t", Code: []byte{0x28, 0xb5, 0x2f, 0xfd, byte(i)}, Tags: []string{"a"}}
+		if i%2 == 0 {
+			keyID := 100 * (i%users + 1)
+			sn.KeyID = &keyID
+		}
+		if i%3 == 0 {
+			blobID := int64(1000 + i)
+			src.blobs = append(src.blobs, dataAccess.BackupBlob{ID: blobID, Hash: make([]byte, 32), KeyID: sn.KeyID, Language: "go", Code: sn.Code, Created: now})
+			sn.BlobID, sn.Code, sn.KeyID = &blobID, nil, nil
+		}
+		src.snippets = append(src.snippets, sn)
+	}
+	return src
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		users    int
+		snippets int
+		opts     Options
+	}{
+		{name: "Compressed", users: 3, snippets: 5},
+		{name: "Uncompressed", users: 3, snippets: 5, opts: Options{Uncompressed: true}},
+		{name: "Several chunks", users: 2, snippets: 2*ChunkSize + 1},
+		{name: "Empty", users: 0, snippets: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := newSource(tt.users, tt.snippets)
+
+			var buf bytes.Buffer
+			written, err := write(context.Background(), src, 3, &buf, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sink := &fakeSink{}
+			read, err := read(context.Background(), &buf, sink)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if read.Users != tt.users || read.DataKeys != tt.users || read.Snippets != tt.snippets || read.SchemaVersion != 3 {
+				t.Errorf("unexpected manifest %+v", read)
+			}
+			if len(read.Files) != len(written.Files) {
+				t.Errorf("expected %d files, got %d", len(written.Files), len(read.Files))
+			}
+			if len(sink.dicts) != len(src.dicts) || read.Dictionaries != len(src.dicts) {
+				t.Errorf("restored %d of %d dictionaries", len(sink.dicts), len(src.dicts))
+			}
+			if len(sink.blobs) != len(src.blobs) || read.Blobs != len(src.blobs) {
+				t.Errorf("restored %d of %d blobs", len(sink.blobs), len(src.blobs))
+			}
+			if len(sink.users) != tt.users || len(sink.dataKeys) != tt.users || len(sink.snippets) != tt.snippets {
+				t.Fatalf("restored %d users, %d data keys and %d snippets", len(sink.users), len(sink.dataKeys), len(sink.snippets))
+			}
+			if tt.snippets > 1 && (sink.snippets[1].KeyID == nil || *sink.snippets[1].KeyID != *src.snippets[1].KeyID) {
+				t.Error("snippet lost its data key")
+			}
+			if tt.snippets > 0 && !bytes.Equal(sink.snippets[0].Code, src.snippets[0].Code) {
+				t.Error("compressed code was not kept as-is")
+			}
+		})
+	}
+}
+
+// rewrite copies an uncompressed archive, letting edit change or drop entries.
+func rewrite(t *testing.T, archive []byte, edit func(name string, data []byte) []byte) []byte {
+	var out bytes.Buffer
+	tr := tar.NewReader(bytes.NewReader(archive))
+	tw := tar.NewWriter(&out)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, _ := io.ReadAll(tr)
+		if data = edit(hdr.Name, data); data == nil {
+			continue
+		}
+
+		hdr.Size = int64(len(data))
+		tw.WriteHeader(hdr)
+		tw.Write(data)
+	}
+	tw.Close()
+	return out.Bytes()
+}
+
+func TestRejectsDamagedArchives(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := write(context.Background(), newSource(2, 3), 1, &buf, Options{Uncompressed: true}); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	tests := []struct {
+		name     string
+		edit     func(name string, data []byte) []byte
+		contains string
+	}{
+		{
+			name: "Missing manifest",
+			edit: func(name string, data []byte) []byte {
+				if name == ManifestName {
+					return nil
+				}
+				return data
+			},
+			contains: "no manifest",
+		},
+		{
+			name: "Tampered chunk",
+			edit: func(name string, data []byte) []byte {
+				if strings.HasPrefix(name, "users-") {
+					return bytes.Replace(data, []byte("user1"), []byte("evil1"), 1)
+				}
+				return data
+			},
+			contains: "checksum mismatch",
+		},
+		{
+			name: "Dropped chunk",
+			edit: func(name string, data []byte) []byte {
+				if strings.HasPrefix(name, "snippets-") {
+					return nil
+				}
+				return data
+			},
+			contains: "manifest lists",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			damaged := rewrite(t, archive, tt.edit)
+			_, err := Verify(context.Background(), bytes.NewReader(damaged))
+			if err == nil || !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("expected error containing %q, got %v", tt.contains, err)
+			}
+		})
+	}
+
+	t.Run("Truncated stream", func(t *testing.T) {
+		if _, err := Verify(context.Background(), bytes.NewReader(archive[:len(archive)/2])); err == nil {
+			t.Error("truncated archive was accepted")
+		}
+	})
+}
+
+func TestVerifyRequiresUsersFirst(t *testing.T) {
+	src := newSource(1, 1)
+	src.snippets[0].UserID = 99
+
+	var buf bytes.Buffer
+	if _, err := write(context.Background(), src, 1, &buf, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(context.Background(), &buf); err == nil || !strings.Contains(err.Error(), "unknown user 99") {
+		t.Errorf("expected an unknown user error, got %v", err)
+	}
+}
+
+func TestVerifyRequiresDataKeysFirst(t *testing.T) {
+	src := newSource(1, 2)
+	missing := 7
+	src.snippets[1].KeyID = &missing
+
+	var buf bytes.Buffer
+	if _, err := write(context.Background(), src, 1, &buf, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(context.Background(), &buf); err == nil || !strings.Contains(err.Error(), "unknown data key 7") {
+		t.Errorf("expected an unknown data key error, got %v", err)
+	}
+}
+
+func TestVerifyRejectsDuplicateDictionaries(t *testing.T) {
+	src := newSource(1, 1)
+	src.dicts = append(src.dicts, src.dicts[0])
+
+	var buf bytes.Buffer
+	if _, err := write(context.Background(), src, 1, &buf, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(context.Background(), &buf); err == nil || !strings.Contains(err.Error(), "dictionary 32768 appears twice") {
+		t.Errorf("expected a duplicate dictionary error, got %v", err)
+	}
+}
+
+func TestVerifyRequiresBlobsFirst(t *testing.T) {
+	src := newSource(1, 3)
+	missing := int64(7)
+	src.snippets[2].BlobID = &missing
+
+	var buf bytes.Buffer
+	if _, err := write(context.Background(), src, 1, &buf, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(context.Background(), &buf); err == nil || !strings.Contains(err.Error(), "unknown blob 7") {
+		t.Errorf("expected an unknown blob error, got %v", err)
+	}
+}
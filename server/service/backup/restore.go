@@ -0,0 +1,330 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/klauspost/compress/zstd"
+	dataAccess "github.com/scott-mescudi/codelet/service/data_access"
+)
+
+// maxEntrySize bounds how much of a single archive entry is held in memory.
+// Chunks written by Write stay far below it.
+const maxEntrySize = 256 << 20
+
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// sink is what a restore writes to, a *dataAccess.Restore in practice.
+type sink interface {
+	AddDictionary(ctx context.Context, d dataAccess.BackupDictionary) error
+	AddUser(ctx context.Context, u dataAccess.BackupUser) error
+	AddDataKey(ctx context.Context, k dataAccess.BackupDataKey) error
+	AddBlob(ctx context.Context, b dataAccess.BackupBlob) error
+	AddSnippets(ctx context.Context, snippets []dataAccess.BackupSnippet) error
+}
+
+// Restore loads the archive in r into db, which must not have any users yet.
+// Everything happens in one transaction that is only committed once the
+// manifest has been read and every checksum matched.
+func Restore(ctx context.Context, db *pgxpool.Pool, r io.Reader) (*Manifest, error) {
+	version, err := dataAccess.SchemaVersion(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	rs, err := dataAccess.BeginRestore(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Rollback(ctx)
+
+	manifest, err := read(ctx, r, rs)
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest.SchemaVersion > version {
+		return nil, fmt.Errorf("backup was taken at schema version %d but the database is at %d, upgrade first", manifest.SchemaVersion, version)
+	}
+
+	if err := rs.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Verify reads the whole archive and checks it without touching a database.
+func Verify(ctx context.Context, r io.Reader) (*Manifest, error) {
+	return read(ctx, r, &discard{dictionaries: map[int64]bool{}, users: map[int]bool{}, dataKeys: map[int]bool{}, blobs: map[int64]bool{}})
+}
+
+type seenFile struct {
+	kind    string
+	records int
+	sha256  string
+}
+
+func read(ctx context.Context, r io.Reader, s sink) (*Manifest, error) {
+	br := bufio.NewReader(r)
+	in := io.Reader(br)
+	if magic, _ := br.Peek(len(zstdMagic)); bytes.Equal(magic, zstdMagic) {
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		in = zr
+	}
+
+	tr := tar.NewReader(in)
+	seen := map[string]seenFile{}
+	var order []string
+	var manifest *Manifest
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading archive: %w", err)
+		}
+
+		if manifest != nil {
+			return nil, fmt.Errorf("unexpected %s after the manifest", hdr.Name)
+		}
+
+		if hdr.Size > maxEntrySize {
+			return nil, fmt.Errorf("%s is larger than %d bytes", hdr.Name, maxEntrySize)
+		}
+
+		data, err := io.ReadAll(io.LimitReader(tr, maxEntrySize))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", hdr.Name, err)
+		}
+
+		if hdr.Name == ManifestName {
+			manifest = &Manifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+			continue
+		}
+
+		if _, dup := seen[hdr.Name]; dup {
+			return nil, fmt.Errorf("%s appears twice", hdr.Name)
+		}
+
+		kind, records, err := load(ctx, hdr.Name, data, s)
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(data)
+		seen[hdr.Name] = seenFile{kind: kind, records: records, sha256: hex.EncodeToString(sum[:])}
+		order = append(order, hdr.Name)
+	}
+
+	if manifest == nil {
+		return nil, errors.New("archive has no manifest, it is incomplete or not a codelet backup")
+	}
+
+	if err := check(manifest, seen, order); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// load parses one chunk and hands its records to s.
+func load(ctx context.Context, name string, data []byte, s sink) (string, int, error) {
+	var kind string
+	switch {
+	case strings.HasPrefix(name, kindDictionaries+"-"):
+		kind = kindDictionaries
+	case strings.HasPrefix(name, kindUsers+"-"):
+		kind = kindUsers
+	case strings.HasPrefix(name, kindDataKeys+"-"):
+		kind = kindDataKeys
+	case strings.HasPrefix(name, kindBlobs+"-"):
+		kind = kindBlobs
+	case strings.HasPrefix(name, kindSnippets+"-"):
+		kind = kindSnippets
+	default:
+		return "", 0, fmt.Errorf("unexpected file %s in archive", name)
+	}
+
+	var snippets []dataAccess.BackupSnippet
+	records := 0
+	for line := range bytes.Lines(data) {
+		records++
+		switch kind {
+		case kindDictionaries:
+			var d dataAccess.BackupDictionary
+			if err := json.Unmarshal(line, &d); err != nil {
+				return "", 0, fmt.Errorf("%s line %d: %w", name, records, err)
+			}
+			if err := s.AddDictionary(ctx, d); err != nil {
+				return "", 0, fmt.Errorf("%s line %d: %w", name, records, err)
+			}
+		case kindUsers:
+			var u dataAccess.BackupUser
+			if err := json.Unmarshal(line, &u); err != nil {
+				return "", 0, fmt.Errorf("%s line %d: %w", name, records, err)
+			}
+			if err := s.AddUser(ctx, u); err != nil {
+				return "", 0, fmt.Errorf("%s line %d: %w", name, records, err)
+			}
+		case kindDataKeys:
+			var k dataAccess.BackupDataKey
+			if err := json.Unmarshal(line, &k); err != nil {
+				return "", 0, fmt.Errorf("%s line %d: %w", name, records, err)
+			}
+			if err := s.AddDataKey(ctx, k); err != nil {
+				return "", 0, fmt.Errorf("%s line %d: %w", name, records, err)
+			}
+		case kindBlobs:
+			var b dataAccess.BackupBlob
+			if err := json.Unmarshal(line, &b); err != nil {
+				return "", 0, fmt.Errorf("%s line %d: %w", name, records, err)
+			}
+			if err := s.AddBlob(ctx, b); err != nil {
+				return "", 0, fmt.Errorf("%s line %d: %w", name, records, err)
+			}
+		case kindSnippets:
+			var sn dataAccess.BackupSnippet
+			if err := json.Unmarshal(line, &sn); err != nil {
+				return "", 0, fmt.Errorf("%s line %d: %w", name, records, err)
+			}
+			snippets = append(snippets, sn)
+		}
+	}
+
+	if len(snippets) > 0 {
+		if err := s.AddSnippets(ctx, snippets); err != nil {
+			return "", 0, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return kind, records, nil
+}
+
+func check(m *Manifest, seen map[string]seenFile, order []string) error {
+	if m.Format != Format {
+		return fmt.Errorf("not a codelet backup, format is %q", m.Format)
+	}
+	if m.Version > Version {
+		return fmt.Errorf("backup format version %d is newer than this binary understands (%d)", m.Version, Version)
+	}
+
+	if len(m.Files) != len(order) {
+		return fmt.Errorf("manifest lists %d files but the archive has %d", len(m.Files), len(order))
+	}
+
+	dictionaries, users, dataKeys, blobs, snippets := 0, 0, 0, 0, 0
+	for i, f := range m.Files {
+		got, ok := seen[f.Name]
+		if !ok || order[i] != f.Name {
+			return fmt.Errorf("%s is missing or out of order", f.Name)
+		}
+
+		if got.sha256 != f.SHA256 {
+			return fmt.Errorf("checksum mismatch for %s", f.Name)
+		}
+
+		if got.kind != f.Kind || got.records != f.Records {
+			return fmt.Errorf("%s does not match the manifest", f.Name)
+		}
+
+		switch f.Kind {
+		case kindDictionaries:
+			dictionaries += f.Records
+		case kindUsers:
+			users += f.Records
+		case kindDataKeys:
+			dataKeys += f.Records
+		case kindBlobs:
+			blobs += f.Records
+		default:
+			snippets += f.Records
+		}
+	}
+
+	if dictionaries != m.Dictionaries || blobs != m.Blobs {
+		return fmt.Errorf("manifest counts %d dictionaries and %d blobs, archive holds %d and %d", m.Dictionaries, m.Blobs, dictionaries, blobs)
+	}
+	if users != m.Users || dataKeys != m.DataKeys || snippets != m.Snippets {
+		return fmt.Errorf("manifest counts %d users, %d data keys and %d snippets, archive holds %d, %d and %d", m.Users, m.DataKeys, m.Snippets, users, dataKeys, snippets)
+	}
+	return nil
+}
+
+// discard is the sink of Verify, it only checks that data keys, blobs and
+// snippets point at rows that came before them.
+type discard struct {
+	dictionaries map[int64]bool
+	users        map[int]bool
+	dataKeys     map[int]bool
+	blobs        map[int64]bool
+}
+
+func (d *discard) AddDictionary(_ context.Context, dict dataAccess.BackupDictionary) error {
+	if d.dictionaries[dict.ID] {
+		return fmt.Errorf("dictionary %d appears twice", dict.ID)
+	}
+	d.dictionaries[dict.ID] = true
+	return nil
+}
+
+func (d *discard) AddUser(_ context.Context, u dataAccess.BackupUser) error {
+	if d.users[u.ID] {
+		return fmt.Errorf("user %d appears twice", u.ID)
+	}
+	d.users[u.ID] = true
+	return nil
+}
+
+func (d *discard) AddDataKey(_ context.Context, k dataAccess.BackupDataKey) error {
+	if !d.users[k.UserID] {
+		return fmt.Errorf("data key %d belongs to unknown user %d", k.ID, k.UserID)
+	}
+	if d.dataKeys[k.ID] {
+		return fmt.Errorf("data key %d appears twice", k.ID)
+	}
+	d.dataKeys[k.ID] = true
+	return nil
+}
+
+func (d *discard) AddBlob(_ context.Context, b dataAccess.BackupBlob) error {
+	if b.KeyID != nil && !d.dataKeys[*b.KeyID] {
+		return fmt.Errorf("blob %d is encrypted with unknown data key %d", b.ID, *b.KeyID)
+	}
+	if d.blobs[b.ID] {
+		return fmt.Errorf("blob %d appears twice", b.ID)
+	}
+	d.blobs[b.ID] = true
+	return nil
+}
+
+func (d *discard) AddSnippets(_ context.Context, snippets []dataAccess.BackupSnippet) error {
+	for _, s := range snippets {
+		if !d.users[s.UserID] {
+			return fmt.Errorf("snippet %d belongs to unknown user %d", s.ID, s.UserID)
+		}
+		if s.KeyID != nil && !d.dataKeys[*s.KeyID] {
+			return fmt.Errorf("snippet %d is encrypted with unknown data key %d", s.ID, *s.KeyID)
+		}
+		if s.BlobID != nil && !d.blobs[*s.BlobID] {
+			return fmt.Errorf("snippet %d points at unknown blob %d", s.ID, *s.BlobID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"time"
+)
+
+// Config holds every setting the server reads at startup. Values are layered
+// from the defaults below, a YAML file, environment variables and finally
+// command line flags, each layer overriding the previous one.
+//
+// The env and flag tags of nested structs are prefixes joined with "_" and
+// "-" respectively, so RateLimit.Auth.Limit is RATE_LIMIT_AUTH_LIMIT and
+// -rate-limit-auth-limit.
+type Config struct {
+	Server     Server     `yaml:"server" flag:"server"`
+	Admin      Admin      `yaml:"admin" env:"ADMIN" flag:"admin"`
+	Database   Database   `yaml:"database" flag:"database"`
+	Auth       Auth       `yaml:"auth" flag:"auth"`
+	Encryption Encryption `yaml:"encryption" env:"ENCRYPTION" flag:"encryption"`
+	Cors       Cors       `yaml:"cors" flag:"cors"`
+	Log        Log        `yaml:"log" env:"LOG" flag:"log"`
+	Tracing    Tracing    `yaml:"tracing" env:"TRACING" flag:"tracing"`
+	RateLimit  RateLimit  `yaml:"rate_limit" env:"RATE_LIMIT" flag:"rate-limit"`
+}
+
+type Server struct {
+	Addr               string        `yaml:"addr" env:"APP_PORT" flag:"addr" usage:"address the API listens on"`
+	ReadHeaderTimeout  time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT" flag:"read-header-timeout"`
+	ReadTimeout        time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT" flag:"read-timeout"`
+	WriteTimeout       time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT" flag:"write-timeout"`
+	IdleTimeout        time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" flag:"idle-timeout"`
+	MaxHeaderBytes     int           `yaml:"max_header_bytes" env:"SERVER_MAX_HEADER_BYTES" flag:"max-header-bytes"`
+	TrustedProxies     []string      `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" flag:"trusted-proxies" usage:"comma separated proxy addresses or CIDR ranges"`
+	HSTSMaxAge         time.Duration `yaml:"hsts_max_age" env:"SERVER_HSTS_MAX_AGE" flag:"hsts-max-age" usage:"0 disables Strict-Transport-Security"`
+	ShutdownTimeout    time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" usage:"how long in-flight requests get to finish on SIGTERM"`
+	ReadOnly           bool          `yaml:"read_only" env:"SERVER_READ_ONLY" flag:"read-only" usage:"start in read-only maintenance mode"`
+	ReadOnlyRetryAfter time.Duration `yaml:"read_only_retry_after" env:"SERVER_READ_ONLY_RETRY_AFTER" flag:"read-only-retry-after" usage:"Retry-After sent while in read-only mode"`
+	CompressMinSize    int           `yaml:"compress_min_size" env:"SERVER_COMPRESS_MIN_SIZE" flag:"compress-min-size" usage:"smallest response body compressed with zstd or gzip, negative disables compression"`
+}
+
+// Admin is a second listener for operational endpoints such as /metrics and
+// the unauthenticated PUT /read-only. It listens on loopback by default and
+// should not be exposed to the internet.
+type Admin struct {
+	Addr               string        `yaml:"addr" env:"ADDR" flag:"addr" usage:"address of the admin listener, empty disables it"`
+	BusinessMetricsTTL time.Duration `yaml:"business_metrics_ttl" env:"BUSINESS_METRICS_TTL" flag:"business-metrics-ttl" usage:"how long snippet and user counts are cached between scrapes"`
+}
+
+type Database struct {
+	URL               Secret        `yaml:"url" env:"DATABASE_URL" flag:"url" usage:"postgres connection string"`
+	QueryTimeout      time.Duration `yaml:"query_timeout" env:"DATABASE_QUERY_TIMEOUT" flag:"query-timeout" usage:"upper bound for a single query, 0 disables it"`
+	MigrateOnStart    bool          `yaml:"migrate_on_start" env:"DATABASE_MIGRATE_ON_START" flag:"migrate-on-start" usage:"apply pending schema migrations before serving"`
+	ConnectAttempts   int           `yaml:"connect_attempts" env:"DATABASE_CONNECT_ATTEMPTS" flag:"connect-attempts" usage:"connection attempts at startup, 0 retries until stopped"`
+	ConnectBackoff    time.Duration `yaml:"connect_backoff" env:"DATABASE_CONNECT_BACKOFF" flag:"connect-backoff" usage:"delay after the first failed attempt, doubled each time"`
+	ConnectMaxBackoff time.Duration `yaml:"connect_max_backoff" env:"DATABASE_CONNECT_MAX_BACKOFF" flag:"connect-max-backoff"`
+}
+
+type Auth struct {
+	JWTSecret       Secret        `yaml:"jwt_secret" env:"JWT_SECRET" flag:"jwt-secret" usage:"HMAC key for access and refresh tokens, at least 32 bytes"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL" flag:"access-token-ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL" flag:"refresh-token-ttl"`
+	DeletionGrace   time.Duration `yaml:"deletion_grace" env:"DELETION_GRACE" flag:"deletion-grace" usage:"how long a deleted account can still be recovered by logging in"`
+}
+
+// Encryption configures encryption at rest of snippet code. To rotate, put a
+// new key first, restart, run the rekey command, then drop the old key.
+type Encryption struct {
+	MasterKeys Secret `yaml:"master_keys" env:"MASTER_KEYS" flag:"master-keys" usage:"comma separated id:base64 master keys, the first wraps new data keys, empty stores code unencrypted"`
+}
+
+type Cors struct {
+	Origins []string `yaml:"origins" env:"CORS_ORIGINS" flag:"origins" usage:"comma separated allowed origins, *.domain wildcards allowed"`
+}
+
+type Log struct {
+	Level       string        `yaml:"level" env:"LEVEL" flag:"level" usage:"trace, debug, info, warn or error"`
+	Sink        string        `yaml:"sink" env:"SINK" flag:"sink" usage:"stdout, stderr or file"`
+	Path        string        `yaml:"path" env:"PATH" flag:"path" usage:"log file used by the file sink"`
+	MaxSizeMB   int           `yaml:"max_size_mb" env:"MAX_SIZE_MB" flag:"max-size-mb" usage:"rotate the log file at this size, 0 disables"`
+	RotateEvery time.Duration `yaml:"rotate_every" env:"ROTATE_EVERY" flag:"rotate-every" usage:"rotate the log file this often, 0 disables"`
+	MaxBackups  int           `yaml:"max_backups" env:"MAX_BACKUPS" flag:"max-backups" usage:"rotated files to keep, 0 keeps all"`
+	MaxAge      time.Duration `yaml:"max_age" env:"MAX_AGE" flag:"max-age" usage:"delete rotated files older than this, 0 keeps all"`
+}
+
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" env:"EXPORTER" flag:"exporter" usage:"none, otlp, stdout or file"`
+	Endpoint    string  `yaml:"endpoint" env:"ENDPOINT" flag:"endpoint" usage:"OTLP/HTTP collector host:port"`
+	Insecure    bool    `yaml:"insecure" env:"INSECURE" flag:"insecure" usage:"talk plain HTTP to the OTLP collector"`
+	Headers     Secret  `yaml:"headers" env:"HEADERS" flag:"headers" usage:"extra OTLP headers as key=value pairs separated by commas"`
+	File        string  `yaml:"file" env:"FILE" flag:"file" usage:"where the file exporter writes spans"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"SAMPLE_RATIO" flag:"sample-ratio" usage:"fraction of new traces that are recorded"`
+	ServiceName string  `yaml:"service_name" env:"SERVICE_NAME" flag:"service-name"`
+}
+
+type RateLimit struct {
+	Store  string `yaml:"store" env:"STORE" flag:"store" usage:"memory or postgres"`
+	Auth   Policy `yaml:"auth" env:"AUTH" flag:"auth"`
+	Public Policy `yaml:"public" env:"PUBLIC" flag:"public"`
+	User   Policy `yaml:"user" env:"USER" flag:"user"`
+}
+
+type Policy struct {
+	Limit  int           `yaml:"limit" env:"LIMIT" flag:"limit"`
+	Period time.Duration `yaml:"period" env:"PERIOD" flag:"period"`
+	Burst  int           `yaml:"burst" env:"BURST" flag:"burst"`
+}
+
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Addr:               ":3021",
+			ReadHeaderTimeout:  5 * time.Second,
+			ReadTimeout:        15 * time.Second,
+			WriteTimeout:       30 * time.Second,
+			IdleTimeout:        2 * time.Minute,
+			MaxHeaderBytes:     16 << 10,
+			HSTSMaxAge:         365 * 24 * time.Hour,
+			ShutdownTimeout:    20 * time.Second,
+			ReadOnlyRetryAfter: 5 * time.Minute,
+			CompressMinSize:    1 << 10,
+		},
+		Admin: Admin{
+			Addr:               "127.0.0.1:9091",
+			BusinessMetricsTTL: time.Minute,
+		},
+		Database: Database{
+			QueryTimeout:      5 * time.Second,
+			MigrateOnStart:    true,
+			ConnectAttempts:   10,
+			ConnectBackoff:    500 * time.Millisecond,
+			ConnectMaxBackoff: 30 * time.Second,
+		},
+		Auth: Auth{
+			AccessTokenTTL:  2 * time.Hour,
+			RefreshTokenTTL: 48 * time.Hour,
+			DeletionGrace:   7 * 24 * time.Hour,
+		},
+		Log: Log{
+			Level:       "info",
+			Sink:        "file",
+			Path:        "/src/logs/codelet_server_logs.json",
+			MaxSizeMB:   100,
+			RotateEvery: 24 * time.Hour,
+			MaxBackups:  14,
+			MaxAge:      30 * 24 * time.Hour,
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			Endpoint:    "localhost:4318",
+			SampleRatio: 1,
+			ServiceName: "codelet",
+		},
+		RateLimit: RateLimit{
+			Store:  "memory",
+			Auth:   Policy{Limit: 10, Period: time.Minute, Burst: 5},
+			Public: Policy{Limit: 60, Period: time.Minute},
+			User:   Policy{Limit: 300, Period: time.Minute, Burst: 60},
+		},
+	}
+}
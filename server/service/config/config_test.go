@@ -0,0 +1,181 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "codelet.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+server:
+  addr: ":1000"
+  read_timeout: 1m
+database:
+  url: postgres://file@localhost/db
+auth:
+  jwt_secret: `+testSecret+`
+cors:
+  origins: ["https://file.example.com"]
+rate_limit:
+  user:
+    limit: 7
+`)
+
+	t.Setenv(ConfigFileEnv, "")
+	t.Setenv("APP_PORT", ":2000")
+	t.Setenv("CORS_ORIGINS", "https://env.example.com, https://*.env.example.com")
+	t.Setenv("RATE_LIMIT_USER_BURST", "3")
+
+	cfg, err := Load([]string{"-config", path, "-server-addr", ":3000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		got      any
+		expected any
+	}{
+		{name: "flag beats env", got: cfg.Server.Addr, expected: ":3000"},
+		{name: "file beats default", got: cfg.Server.ReadTimeout, expected: time.Minute},
+		{name: "default kept", got: cfg.Server.WriteTimeout, expected: 30 * time.Second},
+		{name: "env beats file", got: strings.Join(cfg.Cors.Origins, " "), expected: "https://env.example.com https://*.env.example.com"},
+		{name: "nested file value", got: cfg.RateLimit.User.Limit, expected: 7},
+		{name: "nested env value", got: cfg.RateLimit.User.Burst, expected: 3},
+		{name: "secret from file", got: cfg.Database.URL.Value(), expected: "postgres://file@localhost/db"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("got %v, want %v", tt.got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Setenv(ConfigFileEnv, "")
+	t.Setenv("DATABASE_URL", "postgres://localhost/db")
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("CORS_ORIGINS", "https://codelet.dev")
+
+	tests := []struct {
+		name     string
+		args     []string
+		file     string
+		contains []string
+	}{
+		{name: "valid", args: nil},
+		{name: "bad duration flag", args: []string{"-auth-access-token-ttl", "soon"}, contains: []string{"-auth-access-token-ttl"}},
+		{name: "unknown file key", file: "server:\n  adress: \":1\"\n", contains: []string{"adress"}},
+		{
+			name:     "every problem reported",
+			args:     []string{"-server-addr", "nope", "-rate-limit-store", "redis", "-cors-origins", "*", "-auth-jwt-secret", "short"},
+			contains: []string{"server.addr", "rate_limit.store", "cors.origins", "auth.jwt_secret"},
+		},
+		{name: "refresh shorter than access", args: []string{"-auth-refresh-token-ttl", "1h"}, contains: []string{"auth.refresh_token_ttl"}},
+		{name: "no deletion grace", args: []string{"-auth-deletion-grace", "0s"}, contains: []string{"auth.deletion_grace"}},
+		{name: "short master key", args: []string{"-encryption-master-keys", "k1:c2hvcnQ="}, contains: []string{"encryption.master_keys"}},
+		{name: "bad proxy", args: []string{"-server-trusted-proxies", "10.0.0.0/33"}, contains: []string{"server.trusted_proxies"}},
+		{name: "unknown exporter", args: []string{"-tracing-exporter", "jaeger"}, contains: []string{"tracing.exporter"}},
+		{name: "file exporter without path", args: []string{"-tracing-exporter", "file"}, contains: []string{"tracing.file"}},
+		{name: "sample ratio out of range", args: []string{"-tracing-sample-ratio", "1.5"}, contains: []string{"tracing.sample_ratio"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, tt.file)}, args...)
+			}
+
+			_, err := Load(args)
+			if len(tt.contains) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			for _, want := range tt.contains {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSections(t *testing.T) {
+	cfg := Default()
+	cfg.Database.URL = "postgres://localhost/db"
+
+	if err := cfg.ValidateSections(SectionDatabase | SectionEncryption); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"auth.jwt_secret", "cors.origins"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	cfg.Database.URL = ""
+	if err := cfg.ValidateSections(SectionDatabase); err == nil || !strings.Contains(err.Error(), "database.url") {
+		t.Errorf("expected a database.url error, got %v", err)
+	}
+}
+
+func TestSecretNeverPrinted(t *testing.T) {
+	cfg := Default()
+	cfg.Database.URL = "postgres://admin:hunter2@db/codelet"
+	cfg.Auth.JWTSecret = testSecret
+
+	out, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{string(out), fmt.Sprintf("%v %+v %#v %s", cfg, cfg, cfg, cfg.Auth.JWTSecret)} {
+		if strings.Contains(s, "hunter2") || strings.Contains(s, testSecret) {
+			t.Errorf("secret leaked: %s", s)
+		}
+	}
+}
+
+func TestFlagsRegistered(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	NewLoader(fs)
+
+	for _, name := range []string{"config", "server-addr", "database-url", "log-path", "rate-limit-public-period"} {
+		if fs.Lookup(name) == nil {
+			t.Errorf("flag -%s is not registered", name)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the environment variable that points at the config
+// file when -config isn't given.
+const ConfigFileEnv = "CODELET_CONFIG"
+
+// Loader binds a flag set to the configuration. Create it before parsing the
+// flags and call Load afterwards.
+type Loader struct {
+	file   string
+	fields []*field
+}
+
+type field struct {
+	path  string
+	env   string
+	flag  string
+	usage string
+	index []int
+
+	set bool
+	raw string
+}
+
+func (f *field) String() string { return f.raw }
+
+func (f *field) Set(v string) error {
+	f.raw, f.set = v, true
+	return nil
+}
+
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{}
+	fs.StringVar(&l.file, "config", os.Getenv(ConfigFileEnv), "path to a YAML config file (env "+ConfigFileEnv+")")
+
+	collect(reflect.TypeOf(Config{}), nil, "", "", "", &l.fields)
+	for _, f := range l.fields {
+		usage := f.usage
+		if f.env != "" {
+			usage = strings.TrimSpace(usage + " (env " + f.env + ")")
+		}
+		fs.Var(f, f.flag, usage)
+	}
+
+	return l
+}
+
+// Load parses args with a throwaway flag set, for callers that don't need
+// flags of their own.
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("codelet", flag.ContinueOnError)
+	l := NewLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	return l.Load()
+}
+
+// Load layers file, environment and flags over the defaults and validates
+// the result.
+func (l *Loader) Load() (*Config, error) {
+	return l.LoadSections(AllSections)
+}
+
+// LoadSections is Load validating only sections, for commands that don't
+// read the rest.
+func (l *Loader) LoadSections(sections Section) (*Config, error) {
+	cfg := Default()
+
+	if l.file != "" {
+		if err := loadFile(cfg, l.file); err != nil {
+			return nil, err
+		}
+	}
+
+	v := reflect.ValueOf(cfg).Elem()
+	for _, f := range l.fields {
+		if f.env == "" {
+			continue
+		}
+
+		raw, ok := os.LookupEnv(f.env)
+		if !ok {
+			continue
+		}
+
+		if err := setValue(v.FieldByIndex(f.index), raw); err != nil {
+			return nil, fmt.Errorf("config: environment variable %s: %w", f.env, err)
+		}
+	}
+
+	for _, f := range l.fields {
+		if !f.set {
+			continue
+		}
+
+		if err := setValue(v.FieldByIndex(f.index), f.raw); err != nil {
+			return nil, fmt.Errorf("config: flag -%s: %w", f.flag, err)
+		}
+	}
+
+	if err := cfg.ValidateSections(sections); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func collect(t reflect.Type, index []int, path, env, flagName string, out *[]*field) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		idx := append(append([]int{}, index...), i)
+		name := join(path, sf.Tag.Get("yaml"), ".")
+		envName := join(env, sf.Tag.Get("env"), "_")
+		fName := join(flagName, sf.Tag.Get("flag"), "-")
+
+		if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeOf(time.Time{}) {
+			collect(sf.Type, idx, name, envName, fName, out)
+			continue
+		}
+
+		*out = append(*out, &field{
+			path:  name,
+			env:   envName,
+			flag:  fName,
+			usage: sf.Tag.Get("usage"),
+			index: idx,
+		})
+	}
+}
+
+func join(prefix, name, sep string) string {
+	if prefix == "" || name == "" {
+		return prefix + name
+	}
+	return prefix + sep + name
+}
+
+func setValue(v reflect.Value, raw string) error {
+	switch {
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items).Convert(v.Type()))
+	default:
+		return fmt.Errorf("unsupported config type %s", v.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package config
+
+// Secret is a string that never prints its value. fmt, JSON, YAML and zerolog
+// all go through one of the methods below, use Value to get the real thing.
+type Secret string
+
+const redacted = "[REDACTED]"
+
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return `config.Secret("` + s.String() + `")`
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s Secret) MarshalYAML() (any, error) {
+	return s.String(), nil
+}
+
+func (s *Secret) UnmarshalText(text []byte) error {
+	*s = Secret(text)
+	return nil
+}
@@ -0,0 +1,288 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+	"github.com/scott-mescudi/codelet/shared/encryption"
+)
+
+// Section is a set of top level configuration sections. Commands other than
+// the server validate only the sections they read, so a backup doesn't need
+// a JWT secret.
+type Section uint
+
+const (
+	SectionServer Section = 1 << iota
+	SectionAdmin
+	SectionDatabase
+	SectionAuth
+	SectionEncryption
+	SectionCors
+	SectionLog
+	SectionTracing
+	SectionRateLimit
+
+	// AllSections is everything the server reads.
+	AllSections = SectionServer | SectionAdmin | SectionDatabase | SectionAuth | SectionEncryption | SectionCors | SectionLog | SectionTracing | SectionRateLimit
+)
+
+// Validate checks the whole configuration and reports every problem at once
+// rather than stopping at the first one.
+func (c *Config) Validate() error {
+	return c.ValidateSections(AllSections)
+}
+
+// ValidateSections is Validate limited to sections, settings outside them
+// are not looked at.
+func (c *Config) ValidateSections(sections Section) error {
+	var errs []error
+	fail := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if sections&SectionServer != 0 {
+		c.validateServer(fail)
+	}
+
+	if sections&SectionAdmin != 0 {
+		c.validateAdmin(fail)
+	}
+
+	if sections&SectionDatabase != 0 {
+		c.validateDatabase(fail)
+	}
+
+	if sections&SectionAuth != 0 {
+		c.validateAuth(fail)
+	}
+
+	if sections&SectionEncryption != 0 {
+		c.validateEncryption(fail)
+	}
+
+	if sections&SectionCors != 0 {
+		c.validateCors(fail)
+	}
+
+	if sections&SectionLog != 0 {
+		c.validateLog(fail)
+	}
+
+	if sections&SectionTracing != 0 {
+		c.validateTracing(fail)
+	}
+
+	if sections&SectionRateLimit != 0 {
+		c.validateRateLimit(fail)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// failFunc records a problem with the setting key.
+type failFunc func(key, format string, args ...any)
+
+func (c *Config) validateServer(fail failFunc) {
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		fail("server.addr", "must be host:port or :port, got %q", c.Server.Addr)
+	}
+
+	for _, t := range []struct {
+		key string
+		d   time.Duration
+	}{
+		{"server.read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+	} {
+		if t.d <= 0 {
+			fail(t.key, "must be greater than 0")
+		}
+	}
+
+	if c.Server.MaxHeaderBytes < 1<<10 {
+		fail("server.max_header_bytes", "must be at least 1024")
+	}
+
+	if c.Server.HSTSMaxAge < 0 {
+		fail("server.hsts_max_age", "must not be negative")
+	}
+
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(proxy); err != nil {
+			fail("server.trusted_proxies", "%q is not an IP address or CIDR range", proxy)
+		}
+	}
+
+	if c.Server.ReadOnlyRetryAfter < 0 {
+		fail("server.read_only_retry_after", "must not be negative")
+	}
+}
+
+func (c *Config) validateAdmin(fail failFunc) {
+	if c.Admin.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Admin.Addr); err != nil {
+			fail("admin.addr", "must be host:port, :port or empty, got %q", c.Admin.Addr)
+		} else if c.Admin.Addr == c.Server.Addr {
+			fail("admin.addr", "must differ from server.addr")
+		}
+	}
+
+	if c.Admin.BusinessMetricsTTL <= 0 {
+		fail("admin.business_metrics_ttl", "must be greater than 0")
+	}
+}
+
+func (c *Config) validateDatabase(fail failFunc) {
+	if c.Database.URL == "" {
+		fail("database.url", "is required")
+	} else if _, err := pgxpool.ParseConfig(c.Database.URL.Value()); err != nil {
+		// The parse error can echo the connection string, so don't wrap it.
+		fail("database.url", "is not a valid postgres connection string")
+	}
+
+	if c.Database.QueryTimeout < 0 {
+		fail("database.query_timeout", "must not be negative")
+	}
+
+	if c.Database.ConnectAttempts < 0 {
+		fail("database.connect_attempts", "must not be negative")
+	}
+
+	if c.Database.ConnectBackoff <= 0 {
+		fail("database.connect_backoff", "must be greater than 0")
+	}
+
+	if c.Database.ConnectMaxBackoff < c.Database.ConnectBackoff {
+		fail("database.connect_max_backoff", "must not be shorter than database.connect_backoff")
+	}
+}
+
+func (c *Config) validateAuth(fail failFunc) {
+	if len(c.Auth.JWTSecret) < 32 {
+		fail("auth.jwt_secret", "must be at least 32 bytes")
+	}
+
+	if c.Auth.AccessTokenTTL <= 0 {
+		fail("auth.access_token_ttl", "must be greater than 0")
+	}
+
+	if c.Auth.RefreshTokenTTL <= c.Auth.AccessTokenTTL {
+		fail("auth.refresh_token_ttl", "must be longer than auth.access_token_ttl")
+	}
+
+	if c.Auth.DeletionGrace <= 0 {
+		fail("auth.deletion_grace", "must be greater than 0")
+	}
+}
+
+func (c *Config) validateEncryption(fail failFunc) {
+	if c.Encryption.MasterKeys != "" {
+		if _, err := encryption.ParseKeyring(c.Encryption.MasterKeys.Value()); err != nil {
+			fail("encryption.master_keys", "%s", err)
+		}
+	}
+}
+
+func (c *Config) validateCors(fail failFunc) {
+	if len(c.Cors.Origins) == 0 {
+		fail("cors.origins", "at least one origin is required")
+	}
+
+	for _, origin := range c.Cors.Origins {
+		if origin == "*" {
+			fail("cors.origins", "\"*\" can't be used because the API allows credentials")
+			continue
+		}
+
+		u, err := url.Parse(strings.Replace(origin, "*.", "", 1))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			fail("cors.origins", "%q must look like https://example.com or https://*.example.com", origin)
+		}
+	}
+}
+
+func (c *Config) validateLog(fail failFunc) {
+	if _, err := zerolog.ParseLevel(c.Log.Level); err != nil || c.Log.Level == "" {
+		fail("log.level", "must be trace, debug, info, warn or error, got %q", c.Log.Level)
+	}
+
+	switch c.Log.Sink {
+	case "stdout", "stderr":
+	case "file":
+		if c.Log.Path == "" {
+			fail("log.path", "is required when log.sink is file")
+		}
+	default:
+		fail("log.sink", "must be stdout, stderr or file, got %q", c.Log.Sink)
+	}
+
+	if c.Log.MaxSizeMB < 0 || c.Log.MaxBackups < 0 || c.Log.RotateEvery < 0 || c.Log.MaxAge < 0 {
+		fail("log", "rotation and retention limits must not be negative")
+	}
+}
+
+func (c *Config) validateTracing(fail failFunc) {
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		if _, _, err := net.SplitHostPort(c.Tracing.Endpoint); err != nil {
+			fail("tracing.endpoint", "must be host:port, got %q", c.Tracing.Endpoint)
+		}
+	case "file":
+		if c.Tracing.File == "" {
+			fail("tracing.file", "is required when tracing.exporter is file")
+		}
+	default:
+		fail("tracing.exporter", "must be none, otlp, stdout or file, got %q", c.Tracing.Exporter)
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("tracing.sample_ratio", "must be between 0 and 1")
+	}
+
+	if c.Tracing.ServiceName == "" {
+		fail("tracing.service_name", "is required")
+	}
+}
+
+func (c *Config) validateRateLimit(fail failFunc) {
+	switch c.RateLimit.Store {
+	case "memory", "postgres":
+	default:
+		fail("rate_limit.store", "must be memory or postgres, got %q", c.RateLimit.Store)
+	}
+
+	for _, p := range []struct {
+		key    string
+		policy Policy
+	}{
+		{"rate_limit.auth", c.RateLimit.Auth},
+		{"rate_limit.public", c.RateLimit.Public},
+		{"rate_limit.user", c.RateLimit.User},
+	} {
+		if p.policy.Limit <= 0 || p.policy.Period <= 0 {
+			fail(p.key, "limit and period must be greater than 0")
+		}
+		if p.policy.Burst < 0 {
+			fail(p.key, "burst must not be negative")
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package dataaccess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/scott-mescudi/codelet/shared/vault"
+)
+
+var ErrDatabaseNotEmpty = errors.New("database already contains users")
+
+// BackupUser is a users row as it goes into a backup. Refresh tokens are
+// left out on purpose, restored users simply sign in again.
+type BackupUser struct {
+	ID           int           `json:"id"`
+	Username     string        `json:"username"`
+	Email        string        `json:"email"`
+	Role         string        `json:"role"`
+	PasswordHash string        `json:"password_hash"`
+	Disabled     bool          `json:"disabled"`
+	DeleteAfter  *time.Time    `json:"delete_after,omitempty"`
+	Vault        *vault.Header `json:"vault,omitempty"`
+	LastLogin    *time.Time    `json:"last_login"`
+	Created      *time.Time    `json:"created"`
+	Updated      *time.Time    `json:"updated"`
+}
+
+// BackupDataKey is a data_keys row. The data key stays wrapped, restoring it
+// needs the same master key configured.
+type BackupDataKey struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"userid"`
+	MasterKeyID string     `json:"master_key_id"`
+	WrappedKey  []byte     `json:"wrapped_key"`
+	Created     time.Time  `json:"created"`
+	Rotated     *time.Time `json:"rotated,omitempty"`
+}
+
+// BackupDictionary is a zstd_dictionaries row. It keeps its ID, compressed
+// code refers to it by that ID.
+type BackupDictionary struct {
+	ID       int64     `json:"id"`
+	Language string    `json:"language"`
+	Data     []byte    `json:"data"`
+	Samples  int       `json:"samples"`
+	Created  time.Time `json:"created"`
+}
+
+// BackupBlob is a code_blobs row with the code still zstd compressed, and
+// encrypted when KeyID is set, so a backup never has to decompress or
+// decrypt anything. Reference counts aren't kept, restoring the snippets
+// counts them again.
+type BackupBlob struct {
+	ID       int64     `json:"id"`
+	Hash     []byte    `json:"hash"`
+	KeyID    *int      `json:"key_id,omitempty"`
+	Language string    `json:"language"`
+	Code     []byte    `json:"code"`
+	Created  time.Time `json:"created"`
+}
+
+// BackupSnippet is a snippets row. Its code is in the blob BlobID names, or
+// for rows not moved to blobs yet inline, compressed and encrypted like a
+// blob.
+type BackupSnippet struct {
+	ID               int        `json:"id"`
+	UserID           int        `json:"userid"`
+	Language         string     `json:"language"`
+	Title            string     `json:"title"`
+	BlobID           *int64     `json:"blob_id,omitempty"`
+	Code             []byte     `json:"code,omitempty"`
+	KeyID            *int       `json:"key_id,omitempty"`
+	Vault            bool       `json:"vault,omitempty"`
+	VaultTitle       []byte     `json:"vault_title,omitempty"`
+	VaultDescription []byte     `json:"vault_description,omitempty"`
+	Description      *string    `json:"description"`
+	Private          bool       `json:"private"`
+	Favorite         *bool      `json:"favorite"`
+	Tags             []string   `json:"tags"`
+	Created          *time.Time `json:"created"`
+	Updated          *time.Time `json:"updated"`
+}
+
+// Snapshot is a read only view of the whole database at one point in time.
+type Snapshot struct {
+	tx            pgx.Tx
+	SchemaVersion int
+}
+
+// BeginSnapshot opens a repeatable read transaction so users and snippets
+// are read as of the same moment even while the server keeps writing.
+func BeginSnapshot(ctx context.Context, dbConn *pgxpool.Pool) (*Snapshot, error) {
+	tx, err := dbConn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{tx: tx}
+	if err := tx.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&s.SchemaVersion); err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Snapshot) Close(ctx context.Context) error {
+	return s.tx.Rollback(ctx)
+}
+
+func (s *Snapshot) Dictionaries(ctx context.Context, fn func(BackupDictionary) error) error {
+	rows, err := s.tx.Query(ctx, "SELECT id, language, data, samples, created FROM zstd_dictionaries ORDER BY created, id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d BackupDictionary
+		if err := rows.Scan(&d.ID, &d.Language, &d.Data, &d.Samples, &d.Created); err != nil {
+			return err
+		}
+
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *Snapshot) Users(ctx context.Context, fn func(BackupUser) error) error {
+	rows, err := s.tx.Query(ctx, "SELECT id, username, email, role, password_hash, disabled, delete_after, vault, last_login, created, updated FROM users ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u BackupUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.Role, &u.PasswordHash, &u.Disabled, &u.DeleteAfter, &u.Vault, &u.LastLogin, &u.Created, &u.Updated); err != nil {
+			return err
+		}
+
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *Snapshot) DataKeys(ctx context.Context, fn func(BackupDataKey) error) error {
+	rows, err := s.tx.Query(ctx, "SELECT id, user_id, master_key_id, wrapped_key, created, rotated FROM data_keys ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k BackupDataKey
+		if err := rows.Scan(&k.ID, &k.UserID, &k.MasterKeyID, &k.WrappedKey, &k.Created, &k.Rotated); err != nil {
+			return err
+		}
+
+		if err := fn(k); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *Snapshot) Blobs(ctx context.Context, fn func(BackupBlob) error) error {
+	rows, err := s.tx.Query(ctx, "SELECT id, hash, key_id, language, code, created FROM code_blobs WHERE refs > 0 ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b BackupBlob
+		if err := rows.Scan(&b.ID, &b.Hash, &b.KeyID, &b.Language, &b.Code, &b.Created); err != nil {
+			return err
+		}
+
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *Snapshot) Snippets(ctx context.Context, fn func(BackupSnippet) error) error {
+	rows, err := s.tx.Query(ctx, "SELECT id, userid, language, title, blob_id, code, key_id, vault, vault_title, vault_description, description, private, favorite, tags, created, updated FROM snippets ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sn BackupSnippet
+		if err := rows.Scan(&sn.ID, &sn.UserID, &sn.Language, &sn.Title, &sn.BlobID, &sn.Code, &sn.KeyID, &sn.Vault, &sn.VaultTitle, &sn.VaultDescription, &sn.Description, &sn.Private, &sn.Favorite, &sn.Tags, &sn.Created, &sn.Updated); err != nil {
+			return err
+		}
+
+		if err := fn(sn); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Restore loads a backup inside one transaction. Rows get fresh IDs from the
+// target database, users, data keys and blobs are remapped as they are added
+// so their snippets follow them. Nothing is visible until Commit.
+type Restore struct {
+	tx       pgx.Tx
+	users    map[int]int
+	dataKeys map[int]int
+	blobs    map[int64]int64
+}
+
+// BeginRestore refuses to touch a database that already has users, merging
+// two user tables is not something a restore should guess at.
+func BeginRestore(ctx context.Context, dbConn *pgxpool.Pool) (*Restore, error) {
+	tx, err := dbConn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, "LOCK TABLE users, data_keys, code_blobs, snippets, zstd_dictionaries IN EXCLUSIVE MODE"); err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	var exists bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM users)").Scan(&exists); err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	if exists {
+		tx.Rollback(ctx)
+		return nil, ErrDatabaseNotEmpty
+	}
+
+	return &Restore{tx: tx, users: map[int]int{}, dataKeys: map[int]int{}, blobs: map[int64]int64{}}, nil
+}
+
+// AddDictionary adds a dictionary under its original ID. The target may
+// already have it, from an earlier restore attempt or the same training, but
+// an ID holding different data would make code unreadable and is an error.
+func (r *Restore) AddDictionary(ctx context.Context, d BackupDictionary) error {
+	tag, err := r.tx.Exec(ctx, "INSERT INTO zstd_dictionaries(id, language, data, samples, created) VALUES($1, $2, $3, $4, $5) ON CONFLICT (id) DO NOTHING",
+		d.ID, d.Language, d.Data, d.Samples, d.Created)
+	if err != nil {
+		return fmt.Errorf("dictionary %d: %w", d.ID, err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		var same bool
+		if err := r.tx.QueryRow(ctx, "SELECT data=$2 FROM zstd_dictionaries WHERE id=$1", d.ID, d.Data).Scan(&same); err != nil {
+			return fmt.Errorf("dictionary %d: %w", d.ID, err)
+		}
+		if !same {
+			return fmt.Errorf("dictionary %d already exists with different data", d.ID)
+		}
+	}
+	return nil
+}
+
+func (r *Restore) AddUser(ctx context.Context, u BackupUser) error {
+	if _, ok := r.users[u.ID]; ok {
+		return fmt.Errorf("user %d appears twice", u.ID)
+	}
+
+	var id int
+	err := r.tx.QueryRow(ctx, "INSERT INTO users(username, email, role, password_hash, disabled, delete_after, vault, last_login, created, updated) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id",
+		u.Username, u.Email, u.Role, u.PasswordHash, u.Disabled, u.DeleteAfter, u.Vault, u.LastLogin, u.Created, u.Updated).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("user %d: %w", u.ID, err)
+	}
+
+	r.users[u.ID] = id
+	return nil
+}
+
+// AddDataKey adds a data key, its user must already be added.
+func (r *Restore) AddDataKey(ctx context.Context, k BackupDataKey) error {
+	userID, ok := r.users[k.UserID]
+	if !ok {
+		return fmt.Errorf("data key %d belongs to unknown user %d", k.ID, k.UserID)
+	}
+
+	if _, ok := r.dataKeys[k.ID]; ok {
+		return fmt.Errorf("data key %d appears twice", k.ID)
+	}
+
+	var id int
+	err := r.tx.QueryRow(ctx, "INSERT INTO data_keys(user_id, master_key_id, wrapped_key, created, rotated) VALUES($1, $2, $3, $4, $5) RETURNING id",
+		userID, k.MasterKeyID, k.WrappedKey, k.Created, k.Rotated).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("data key %d: %w", k.ID, err)
+	}
+
+	r.dataKeys[k.ID] = id
+	return nil
+}
+
+// AddBlob adds a blob, its data key must already be added.
+func (r *Restore) AddBlob(ctx context.Context, b BackupBlob) error {
+	if _, ok := r.blobs[b.ID]; ok {
+		return fmt.Errorf("blob %d appears twice", b.ID)
+	}
+
+	var keyID *int
+	if b.KeyID != nil {
+		id, ok := r.dataKeys[*b.KeyID]
+		if !ok {
+			return fmt.Errorf("blob %d is encrypted with unknown data key %d", b.ID, *b.KeyID)
+		}
+		keyID = &id
+	}
+
+	var id int64
+	err := r.tx.QueryRow(ctx, "INSERT INTO code_blobs(hash, key_id, language, code, created) VALUES($1, $2, $3, $4, $5) RETURNING id",
+		b.Hash, keyID, b.Language, b.Code, b.Created).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("blob %d: %w", b.ID, err)
+	}
+
+	r.blobs[b.ID] = id
+	return nil
+}
+
+// AddSnippets copies a batch of snippets, their user, data key and blob must
+// already be added.
+func (r *Restore) AddSnippets(ctx context.Context, snippets []BackupSnippet) error {
+	rows := make([][]any, 0, len(snippets))
+	for _, s := range snippets {
+		userID, ok := r.users[s.UserID]
+		if !ok {
+			return fmt.Errorf("snippet %d belongs to unknown user %d", s.ID, s.UserID)
+		}
+
+		var keyID *int
+		if s.KeyID != nil {
+			id, ok := r.dataKeys[*s.KeyID]
+			if !ok {
+				return fmt.Errorf("snippet %d is encrypted with unknown data key %d", s.ID, *s.KeyID)
+			}
+			keyID = &id
+		}
+
+		var blobID *int64
+		if s.BlobID != nil {
+			id, ok := r.blobs[*s.BlobID]
+			if !ok {
+				return fmt.Errorf("snippet %d points at unknown blob %d", s.ID, *s.BlobID)
+			}
+			blobID = &id
+		}
+
+		rows = append(rows, []any{userID, s.Language, s.Title, blobID, s.Code, keyID, s.Vault, s.VaultTitle, s.VaultDescription, s.Description, s.Private, s.Favorite, s.Tags, s.Created, s.Updated})
+	}
+
+	_, err := r.tx.CopyFrom(ctx, pgx.Identifier{"snippets"},
+		[]string{"userid", "language", "title", "blob_id", "code", "key_id", "vault", "vault_title", "vault_description", "description", "private", "favorite", "tags", "created", "updated"},
+		pgx.CopyFromRows(rows))
+	return err
+}
+
+func (r *Restore) Commit(ctx context.Context) error {
+	return r.tx.Commit(ctx)
+}
+
+func (r *Restore) Rollback(ctx context.Context) error {
+	return r.tx.Rollback(ctx)
+}
@@ -0,0 +1,219 @@
+package dataaccess
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrUnknownBlob is returned when code is referenced by a hash the user has
+// no blob for.
+var ErrUnknownBlob = errors.New("no code with that hash")
+
+// Code is snippet code as a client sends it: the text itself, or only the
+// SHA-256 of text the same user stored before.
+type Code struct {
+	Text   string
+	SHA256 []byte
+}
+
+// CodeHash is the hash blobs are addressed by.
+func CodeHash(code []byte) []byte {
+	sum := sha256.Sum256(code)
+	return sum[:]
+}
+
+// codeSource joins a snippet to the blob its code lives in and the data key
+// that encrypts it. Rows not moved to a blob yet keep code and key_id inline.
+const codeSource = "snippets s LEFT JOIN code_blobs b ON b.id=s.blob_id LEFT JOIN data_keys k ON k.id=COALESCE(b.key_id, s.key_id)"
+
+// codeColumns are read by openCode, in this order.
+const codeColumns = "COALESCE(b.code, s.code), b.hash, COALESCE(b.key_id, s.key_id), k.master_key_id, k.wrapped_key"
+
+// storeBlob returns the blob holding code for userID, adding it when needed.
+// The caller must be in a transaction and point a snippet at the blob before
+// committing, the key share lock taken here keeps the garbage collector off
+// the blob until then.
+func storeBlob(ctx context.Context, q querier, cs *CodeStore, userID int, language string, code []byte) (int64, error) {
+	hash := CodeHash(code)
+
+	var keyID *int
+	var key []byte
+	if cs.Encrypted() {
+		id, dk, err := cs.userDataKey(ctx, q, userID)
+		if err != nil {
+			return 0, err
+		}
+		keyID, key = &id, dk
+	}
+
+	var id int64
+	err := q.QueryRow(ctx, "SELECT id FROM code_blobs WHERE hash=$1 AND key_id IS NOT DISTINCT FROM $2 FOR KEY SHARE", hash, keyID).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+
+	sealed, err := cs.seal(ctx, language, key, hash, code)
+	if err != nil {
+		return 0, err
+	}
+
+	// Two writers storing the same new code both get here, the update on
+	// conflict makes the second one wait and return the first one's blob.
+	err = q.QueryRow(ctx, "INSERT INTO code_blobs(hash, key_id, language, code) VALUES($1, $2, $3, $4) ON CONFLICT (hash, (COALESCE(key_id, 0))) DO UPDATE SET hash=EXCLUDED.hash RETURNING id",
+		hash, keyID, language, sealed).Scan(&id)
+	return id, err
+}
+
+// resolveCode returns the blob for code: the one its hash names when only
+// the hash is given, otherwise a stored one. A hash only resolves to blobs
+// userID already has a snippet of the same kind, vault or not, pointing at.
+func resolveCode(ctx context.Context, q querier, cs *CodeStore, userID int, language string, code Code, isVault bool) (int64, error) {
+	if code.Text != "" || code.SHA256 == nil {
+		return storeBlob(ctx, q, cs, userID, language, []byte(code.Text))
+	}
+
+	var id int64
+	err := q.QueryRow(ctx, "SELECT b.id FROM code_blobs b WHERE b.hash=$1 AND EXISTS (SELECT 1 FROM snippets s WHERE s.blob_id=b.id AND s.userid=$2 AND s.vault=$3) LIMIT 1 FOR KEY SHARE OF b",
+		code.SHA256, userID, isVault).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrUnknownBlob
+	}
+	return id, err
+}
+
+// HasBlob reports whether userID has a snippet whose code hashes to hash, in
+// which case it can be referenced by the hash instead of sent again.
+func HasBlob(ctx context.Context, dbConn *pgxpool.Pool, userID int, hash []byte) (bool, error) {
+	var exists bool
+	err := dbConn.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM code_blobs b JOIN snippets s ON s.blob_id=b.id WHERE b.hash=$1 AND s.userid=$2)", hash, userID).Scan(&exists)
+	return exists, err
+}
+
+// DeleteUnusedBlobs removes blobs no snippet has pointed at since before.
+func DeleteUnusedBlobs(ctx context.Context, dbConn *pgxpool.Pool, before time.Time) (int64, error) {
+	tag, err := dbConn.Exec(ctx, "DELETE FROM code_blobs WHERE refs=0 AND unreferenced < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Dedup moves code stored inline in snippets, from before blobs existed, into
+// blobs. Like Rekey it works in transactions of at most batchSize rows and
+// skips rows other transactions hold. It returns how many rows it moved.
+func Dedup(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, batchSize int, progress func(int)) (int, error) {
+	done := 0
+	for {
+		n, err := dedupBatch(ctx, dbConn, cs, batchSize)
+		if err != nil {
+			return done, err
+		}
+		if n == 0 {
+			return done, nil
+		}
+
+		done += n
+		if progress != nil {
+			progress(done)
+		}
+	}
+}
+
+func dedupBatch(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, batchSize int) (int, error) {
+	tx, err := dbConn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	type row struct {
+		ID          int
+		UserID      int
+		Language    string
+		Vault       bool
+		Code        []byte
+		KeyID       *int
+		MasterKeyID *string
+		WrappedKey  []byte
+	}
+
+	rows, _ := tx.Query(ctx, "SELECT s.id, s.userid, s.language, s.vault, s.code, s.key_id, k.master_key_id, k.wrapped_key FROM snippets s LEFT JOIN data_keys k ON k.id=s.key_id WHERE s.blob_id IS NULL ORDER BY s.id LIMIT $1 FOR UPDATE OF s SKIP LOCKED", batchSize)
+	snippets, err := pgx.CollectRows(rows, pgx.RowToStructByPos[row])
+	if err != nil {
+		return 0, err
+	}
+
+	for _, sn := range snippets {
+		plain, err := cs.openCode(ctx, sn.Code, nil, sn.KeyID, sn.MasterKeyID, sn.WrappedKey)
+		if err != nil {
+			return 0, fmt.Errorf("snippet %d: %w", sn.ID, err)
+		}
+
+		language := sn.Language
+		if sn.Vault {
+			language = ""
+		}
+
+		blobID, err := storeBlob(ctx, tx, cs, sn.UserID, language, plain)
+		if err != nil {
+			return 0, fmt.Errorf("snippet %d: %w", sn.ID, err)
+		}
+
+		if _, err := tx.Exec(ctx, "UPDATE snippets SET blob_id=$1, code=NULL, key_id=NULL WHERE id=$2", blobID, sn.ID); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(snippets), tx.Commit(ctx)
+}
+
+// encryptBlobBatch moves snippets whose blob is unencrypted onto a blob
+// encrypted with their user's data key, the old blob is left to the garbage
+// collector once nothing points at it. The keyring must be set.
+func encryptBlobBatch(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, batchSize int) (int, error) {
+	tx, err := dbConn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	type row struct {
+		ID       int
+		UserID   int
+		Language string
+		Code     []byte
+	}
+
+	rows, _ := tx.Query(ctx, "SELECT s.id, s.userid, b.language, b.code FROM snippets s JOIN code_blobs b ON b.id=s.blob_id WHERE b.key_id IS NULL ORDER BY s.id LIMIT $1 FOR UPDATE OF s SKIP LOCKED", batchSize)
+	snippets, err := pgx.CollectRows(rows, pgx.RowToStructByPos[row])
+	if err != nil {
+		return 0, err
+	}
+
+	for _, sn := range snippets {
+		plain, err := cs.decompress(ctx, sn.Code)
+		if err != nil {
+			return 0, fmt.Errorf("snippet %d: %w", sn.ID, err)
+		}
+
+		blobID, err := storeBlob(ctx, tx, cs, sn.UserID, sn.Language, plain)
+		if err != nil {
+			return 0, fmt.Errorf("snippet %d: %w", sn.ID, err)
+		}
+
+		if _, err := tx.Exec(ctx, "UPDATE snippets SET blob_id=$1 WHERE id=$2", blobID, sn.ID); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(snippets), tx.Commit(ctx)
+}
@@ -0,0 +1,80 @@
+package dataaccess
+
+import (
+	"context"
+	"errors"
+
+	cmp "github.com/scott-mescudi/codelet/shared/compression"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// acquireCodec returns the codec in use. It isn't closed before release is
+// called, which must not happen after a reload was started.
+func (cs *CodeStore) acquireCodec() (c *cmp.Codec, release func()) {
+	cs.codecMu.RLock()
+	return cs.codec, cs.codecMu.RUnlock
+}
+
+// currentDictionaryID is the dictionary compress uses for language.
+func (cs *CodeStore) currentDictionaryID(language string) uint32 {
+	c, release := cs.acquireCodec()
+	defer release()
+	return c.CurrentDictionaryID(language)
+}
+
+// compress and decompress wrap the codec with a span, and give up early once
+// ctx is done so a loop over many rows stops with the request. compress
+// uses the dictionary of language when there is one.
+func (cs *CodeStore) compress(ctx context.Context, language string, data []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	_, span := otel.Tracer(tracerName).Start(ctx, "zstd compress")
+	defer span.End()
+
+	c, release := cs.acquireCodec()
+	defer release()
+
+	span.SetAttributes(attribute.Int64("zstd.dictionary", int64(c.CurrentDictionaryID(language))))
+	out, err := c.Compress(language, data)
+	endCompressionSpan(span, len(data), len(out), err)
+	return out, err
+}
+
+func (cs *CodeStore) decompress(ctx context.Context, data []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	_, span := otel.Tracer(tracerName).Start(ctx, "zstd decompress")
+	defer span.End()
+
+	out, err := cs.decompressWithCodec(data)
+	if errors.Is(err, cmp.ErrUnknownDictionary) {
+		// Trained after this store loaded its dictionaries, fetch it
+		// and try once more.
+		if err = cs.reloadUnknownDictionary(ctx, data); err == nil {
+			out, err = cs.decompressWithCodec(data)
+		}
+	}
+	endCompressionSpan(span, len(data), len(out), err)
+	return out, err
+}
+
+func (cs *CodeStore) decompressWithCodec(data []byte) ([]byte, error) {
+	c, release := cs.acquireCodec()
+	defer release()
+	return c.Decompress(data)
+}
+
+func endCompressionSpan(span trace.Span, in, out int, err error) {
+	span.SetAttributes(attribute.Int("zstd.bytes_in", in), attribute.Int("zstd.bytes_out", out))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
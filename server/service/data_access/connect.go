@@ -0,0 +1,94 @@
+package dataaccess
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func ConnectToDatabase(postgresURI string) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(postgresURI)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse database URL: %w", err)
+	}
+
+	return connect(context.Background(), config)
+}
+
+// RetryOptions controls ConnectWithRetry. Attempts of 0 keeps trying until
+// the context is done. OnRetry, when set, is called before every wait.
+type RetryOptions struct {
+	Attempts     int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	OnRetry      func(attempt int, delay time.Duration, err error)
+}
+
+// ConnectWithRetry is ConnectToDatabase for a database that may still be
+// starting. Failed attempts are retried with exponential backoff and jitter,
+// a connection string that does not parse is not.
+func ConnectWithRetry(ctx context.Context, postgresURI string, opts RetryOptions) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(postgresURI)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse database URL: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		pool, err := connect(ctx, config.Copy())
+		if err == nil {
+			return pool, nil
+		}
+
+		if opts.Attempts > 0 && attempt >= opts.Attempts {
+			return nil, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		delay := RetryDelay(attempt, opts.InitialDelay, opts.MaxDelay)
+		if opts.OnRetry != nil {
+			opts.OnRetry(attempt, delay, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped retrying: %w", err)
+		case <-time.After(delay):
+		}
+	}
+}
+
+// RetryDelay doubles initial for every attempt up to max and picks a random
+// point in the upper half of that, so replicas restarted together don't
+// retry in lockstep.
+func RetryDelay(attempt int, initial, max time.Duration) time.Duration {
+	d := initial
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+func connect(ctx context.Context, config *pgxpool.Config) (*pgxpool.Pool, error) {
+	config.ConnConfig.Tracer = queryTracer{}
+
+	dbPool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create connection pool: %w", err)
+	}
+
+	if err := dbPool.Ping(ctx); err != nil {
+		dbPool.Close()
+		return nil, fmt.Errorf("unable to ping database: %w", err)
+	}
+
+	return dbPool, nil
+}
@@ -0,0 +1,242 @@
+package dataaccess
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	cmp "github.com/scott-mescudi/codelet/shared/compression"
+	"github.com/scott-mescudi/codelet/shared/encryption"
+)
+
+// LoadDictionaries makes cs compress and decompress with every stored zstd
+// dictionary, and remembers dbConn to fetch dictionaries trained later. It
+// returns how many it loaded.
+func (cs *CodeStore) LoadDictionaries(ctx context.Context, dbConn *pgxpool.Pool) (int, error) {
+	cs.reloadMu.Lock()
+	defer cs.reloadMu.Unlock()
+
+	cs.dictionaries = dbConn
+	return cs.reloadDictionaries(ctx)
+}
+
+// reloadDictionaries replaces the codec, reloadMu must be held.
+func (cs *CodeStore) reloadDictionaries(ctx context.Context) (int, error) {
+	dicts, err := ListDictionaries(ctx, cs.dictionaries)
+	if err != nil {
+		return 0, err
+	}
+
+	c, err := cmp.NewCodec(dicts)
+	if err != nil {
+		return 0, err
+	}
+
+	cs.codecMu.Lock()
+	old := cs.codec
+	cs.codec = c
+	cs.codecMu.Unlock()
+
+	// Calls still using the old codec held the read lock, getting the
+	// write lock waited for them.
+	old.Close()
+	return len(dicts), nil
+}
+
+// reloadUnknownDictionary is called when data needs a dictionary that isn't
+// loaded. Concurrent callers share one reload, the first one to get the lock
+// does it and the rest find the dictionary already there.
+func (cs *CodeStore) reloadUnknownDictionary(ctx context.Context, data []byte) error {
+	cs.reloadMu.Lock()
+	defer cs.reloadMu.Unlock()
+
+	if cs.dictionaries == nil {
+		return cmp.ErrUnknownDictionary
+	}
+
+	id, err := cmp.DictionaryID(data)
+	if err != nil {
+		return err
+	}
+
+	c, release := cs.acquireCodec()
+	known := c.KnownDictionary(id)
+	release()
+	if known {
+		return nil
+	}
+
+	_, err = cs.reloadDictionaries(ctx)
+	return err
+}
+
+// ListDictionaries returns every stored dictionary, oldest first, which is
+// the order cmp.NewCodec expects.
+func ListDictionaries(ctx context.Context, dbConn *pgxpool.Pool) ([]cmp.Dictionary, error) {
+	rows, err := dbConn.Query(ctx, "SELECT id, language, data FROM zstd_dictionaries ORDER BY created, id")
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (cmp.Dictionary, error) {
+		var d cmp.Dictionary
+		var id int64
+		err := row.Scan(&id, &d.Language, &d.Data)
+		d.ID = uint32(id)
+		return d, err
+	})
+}
+
+// NextDictionaryID returns an unused dictionary ID.
+func NextDictionaryID(ctx context.Context, dbConn *pgxpool.Pool) (uint32, error) {
+	var id int64
+	err := dbConn.QueryRow(ctx, "SELECT COALESCE(MAX(id)+1, $1) FROM zstd_dictionaries", cmp.MinDictionaryID).Scan(&id)
+	return uint32(id), err
+}
+
+// AddDictionary stores d, trained from samples snippets. Servers pick it up
+// for new snippets of its language after their next restart, and for reading
+// as soon as they meet a blob compressed with it.
+func AddDictionary(ctx context.Context, dbConn *pgxpool.Pool, d *cmp.Dictionary, samples int) error {
+	_, err := dbConn.Exec(ctx, "INSERT INTO zstd_dictionaries(id, language, data, samples) VALUES($1, $2, $3, $4)", int64(d.ID), d.Language, d.Data, samples)
+	return err
+}
+
+// DictionarySamples returns the uncompressed code of up to limit of the most
+// recently updated snippets in language. Vault snippets are left out, their
+// code is ciphertext and would only make the dictionary worse.
+func DictionarySamples(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, language string, limit int) ([][]byte, error) {
+	rows, err := dbConn.Query(ctx, "SELECT "+codeColumns+" FROM "+codeSource+" WHERE NOT s.vault AND lower(s.language)=$1 ORDER BY s.updated DESC LIMIT $2",
+		strings.ToLower(strings.TrimSpace(language)), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples [][]byte
+	for rows.Next() {
+		var code, hash, wrapped []byte
+		var keyID *int
+		var masterID *string
+		if err := rows.Scan(&code, &hash, &keyID, &masterID, &wrapped); err != nil {
+			return nil, err
+		}
+
+		plain, err := cs.openCode(ctx, code, hash, keyID, masterID, wrapped)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, plain)
+	}
+
+	return samples, rows.Err()
+}
+
+// RecompressProgress counts what Recompress has done so far.
+type RecompressProgress struct {
+	// Checked blobs were looked at.
+	Checked int
+	// Recompressed blobs were compressed with another dictionary than the
+	// current one of their language and have been rewritten.
+	Recompressed int
+}
+
+// Recompress rewrites blobs whose code isn't compressed with the current
+// dictionary of their language, so they benefit from a newly trained one.
+// Encrypted blobs stay encrypted with the same data key. Code still stored
+// inline in snippets is left alone, Dedup moves it into blobs compressed
+// with the current dictionaries.
+//
+// Like Rekey it works in transactions of at most batchSize rows and skips
+// rows other transactions hold. Skipped rows are picked up by the next run.
+func Recompress(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, batchSize int, progress func(RecompressProgress)) (RecompressProgress, error) {
+	var done RecompressProgress
+	var after int64
+	for {
+		checked, recompressed, last, err := recompressBatch(ctx, dbConn, cs, after, batchSize)
+		if err != nil {
+			return done, err
+		}
+		if checked == 0 {
+			return done, nil
+		}
+
+		after = last
+		done.Checked += checked
+		done.Recompressed += recompressed
+		if progress != nil {
+			progress(done)
+		}
+	}
+}
+
+func recompressBatch(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, after int64, batchSize int) (checked, recompressed int, last int64, err error) {
+	tx, err := dbConn.Begin(ctx)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	type row struct {
+		ID          int64
+		Hash        []byte
+		Language    string
+		Code        []byte
+		KeyID       *int
+		MasterKeyID *string
+		WrappedKey  []byte
+	}
+
+	// Blobs of vault snippets have no language and never get a dictionary.
+	rows, _ := tx.Query(ctx, "SELECT b.id, b.hash, b.language, b.code, b.key_id, k.master_key_id, k.wrapped_key FROM code_blobs b LEFT JOIN data_keys k ON k.id=b.key_id WHERE b.id > $1 ORDER BY b.id LIMIT $2 FOR UPDATE OF b SKIP LOCKED", after, batchSize)
+	blobs, err := pgx.CollectRows(rows, pgx.RowToStructByPos[row])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	for _, b := range blobs {
+		last = b.ID
+
+		var key []byte
+		compressed := b.Code
+		if b.KeyID != nil {
+			if b.MasterKeyID == nil {
+				return 0, 0, 0, fmt.Errorf("blob %d points at a missing data key", b.ID)
+			}
+
+			if key, err = cs.unwrapDataKey(*b.KeyID, *b.MasterKeyID, b.WrappedKey); err != nil {
+				return 0, 0, 0, fmt.Errorf("blob %d: %w", b.ID, err)
+			}
+			if compressed, err = encryption.Open(key, b.Code, blobAAD(b.Hash)); err != nil {
+				return 0, 0, 0, fmt.Errorf("blob %d: %w", b.ID, err)
+			}
+		}
+
+		id, err := cmp.DictionaryID(compressed)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("blob %d: %w", b.ID, err)
+		}
+		if id == cs.currentDictionaryID(b.Language) {
+			continue
+		}
+
+		plain, err := cs.decompress(ctx, compressed)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("blob %d: %w", b.ID, err)
+		}
+
+		code, err := cs.seal(ctx, b.Language, key, b.Hash, plain)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+
+		if _, err := tx.Exec(ctx, "UPDATE code_blobs SET code=$1 WHERE id=$2", code, b.ID); err != nil {
+			return 0, 0, 0, err
+		}
+		recompressed++
+	}
+
+	return len(blobs), recompressed, last, tx.Commit(ctx)
+}
@@ -0,0 +1,162 @@
+package dataaccess
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	cmp "github.com/scott-mescudi/codelet/shared/compression"
+	"github.com/scott-mescudi/codelet/shared/encryption"
+)
+
+var ErrNoKeyring = errors.New("snippet is encrypted but no master keys are configured")
+
+// CodeStore seals snippet code on its way into the database and opens it on
+// the way out, it holds the master keys and the zstd dictionaries for that.
+// Every function reading or writing code takes one.
+type CodeStore struct {
+	// keyring encrypts new code when set. Without one new snippets are
+	// stored only compressed, and encrypted ones can't be read.
+	keyring *encryption.Keyring
+
+	// dataKeys caches unwrapped data keys by data_keys.id. A data key never
+	// changes once created, rekeying only changes how it is wrapped.
+	dataKeys sync.Map
+
+	// codec compresses with the dictionaries loaded by LoadDictionaries,
+	// it is used under a read lock so a reload can close the one it
+	// replaces. Before any are loaded it is nil and uses none.
+	codecMu sync.RWMutex
+	codec   *cmp.Codec
+
+	// dictionaries is where dictionaries are reloaded from when a blob
+	// needs one codec doesn't know, because it was trained after they were
+	// loaded. reloadMu makes concurrent reloads share one.
+	reloadMu     sync.Mutex
+	dictionaries *pgxpool.Pool
+}
+
+// NewCodeStore returns a CodeStore encrypting code with k, which may be nil.
+func NewCodeStore(k *encryption.Keyring) *CodeStore {
+	return &CodeStore{keyring: k}
+}
+
+// Close releases the codec. Nothing may use cs afterwards.
+func (cs *CodeStore) Close() {
+	cs.codecMu.Lock()
+	defer cs.codecMu.Unlock()
+	cs.codec.Close()
+	cs.codec = nil
+}
+
+// Encrypted reports whether new code is encrypted.
+func (cs *CodeStore) Encrypted() bool {
+	return cs.keyring != nil
+}
+
+// querier is the part of a pool or transaction the helpers below need.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// blobAAD binds the ciphertext of a blob to its hash, so it can't be passed
+// off as another blob encrypted with the same data key.
+func blobAAD(hash []byte) []byte {
+	return append([]byte("codelet blob "), hash...)
+}
+
+// seal compresses code with the dictionary of language and, unless key is
+// nil, encrypts it with that data key for the blob hash names.
+func (cs *CodeStore) seal(ctx context.Context, language string, key, hash, code []byte) ([]byte, error) {
+	compressed, err := cs.compress(ctx, language, code)
+	if err != nil || key == nil {
+		return compressed, err
+	}
+	return encryption.Seal(key, compressed, blobAAD(hash))
+}
+
+// openCode reverses seal. hash is nil for code still stored inline, which
+// was encrypted before blobs existed. masterID and wrapped come from the
+// data_keys row keyID points at, they are unused for unencrypted code.
+func (cs *CodeStore) openCode(ctx context.Context, code, hash []byte, keyID *int, masterID *string, wrapped []byte) ([]byte, error) {
+	if keyID != nil {
+		if masterID == nil {
+			return nil, errors.New("snippet points at a missing data key")
+		}
+
+		key, err := cs.unwrapDataKey(*keyID, *masterID, wrapped)
+		if err != nil {
+			return nil, err
+		}
+
+		var aad []byte
+		if hash != nil {
+			aad = blobAAD(hash)
+		}
+		if code, err = encryption.Open(key, code, aad); err != nil {
+			return nil, err
+		}
+	}
+
+	return cs.decompress(ctx, code)
+}
+
+func (cs *CodeStore) unwrapDataKey(keyID int, masterID string, wrapped []byte) ([]byte, error) {
+	if key, ok := cs.dataKeys.Load(keyID); ok {
+		return key.([]byte), nil
+	}
+
+	if cs.keyring == nil {
+		return nil, ErrNoKeyring
+	}
+
+	key, err := cs.keyring.Unwrap(masterID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.dataKeys.Store(keyID, key)
+	return key, nil
+}
+
+// userDataKey returns the data key of userID, creating it on first use. The
+// keyring must be set.
+func (cs *CodeStore) userDataKey(ctx context.Context, q querier, userID int) (int, []byte, error) {
+	for range 2 {
+		var keyID int
+		var masterID string
+		var wrapped []byte
+		err := q.QueryRow(ctx, "SELECT id, master_key_id, wrapped_key FROM data_keys WHERE user_id=$1", userID).Scan(&keyID, &masterID, &wrapped)
+		if err == nil {
+			key, err := cs.unwrapDataKey(keyID, masterID, wrapped)
+			return keyID, key, err
+		}
+
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil, err
+		}
+
+		key, masterID, wrapped, err := cs.keyring.NewDataKey()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		// Two writes racing for a new user both get here, the loser reads
+		// back the winner's key on the second pass.
+		err = q.QueryRow(ctx, "INSERT INTO data_keys(user_id, master_key_id, wrapped_key) VALUES($1, $2, $3) ON CONFLICT (user_id) DO NOTHING RETURNING id", userID, masterID, wrapped).Scan(&keyID)
+		if err == nil {
+			cs.dataKeys.Store(keyID, key)
+			return keyID, key, nil
+		}
+
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil, err
+		}
+	}
+
+	return 0, nil, errors.New("data key was created and removed concurrently")
+}
@@ -0,0 +1,75 @@
+package dataaccess
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/scott-mescudi/codelet/shared/encryption"
+)
+
+func TestOpenCode(t *testing.T) {
+	k, err := encryption.ParseKeyring("k1:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, encryption.KeySize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, masterID, wrapped, err := k.NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	compressed, err := NewCodeStore(nil).compress(ctx, "sql", []byte("SELECT 1;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := CodeHash([]byte("SELECT 1;"))
+	sealed, err := encryption.Seal(key, compressed, blobAAD(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inline, err := encryption.Seal(key, compressed, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyID := 1
+	tests := []struct {
+		name     string
+		keyring  *encryption.Keyring
+		code     []byte
+		hash     []byte
+		keyID    *int
+		masterID *string
+		wantErr  error
+	}{
+		{name: "Unencrypted", code: compressed, hash: hash},
+		{name: "Encrypted", keyring: k, code: sealed, hash: hash, keyID: &keyID, masterID: &masterID},
+		{name: "Encrypted inline", keyring: k, code: inline, keyID: &keyID, masterID: &masterID},
+		{name: "Encrypted without keyring", code: sealed, hash: hash, keyID: &keyID, masterID: &masterID, wantErr: ErrNoKeyring},
+		{name: "Wrong master key", keyring: k, code: sealed, hash: hash, keyID: &keyID, masterID: new(string), wantErr: encryption.ErrUnknownMasterKey},
+		{name: "Moved to another blob", keyring: k, code: sealed, hash: CodeHash([]byte("SELECT 2;")), keyID: &keyID, masterID: &masterID, wantErr: encryption.ErrDecrypt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := NewCodeStore(tt.keyring)
+			got, err := cs.openCode(ctx, tt.code, tt.hash, tt.keyID, tt.masterID, wrapped)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil || string(got) != "SELECT 1;" {
+				t.Fatalf("openCode = %q, %v", got, err)
+			}
+		})
+	}
+}
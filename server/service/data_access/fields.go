@@ -0,0 +1,310 @@
+package dataaccess
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/scott-mescudi/codelet/shared/vault"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// Fields is a set of DBsnippet fields to read and send. The zero value is
+// every field.
+type Fields uint16
+
+const (
+	FieldID Fields = 1 << iota
+	FieldLanguage
+	FieldTitle
+	FieldCode
+	FieldCodeSHA256
+	FieldPrivate
+	FieldFavorite
+	FieldTags
+	FieldDescription
+	FieldCreated
+	FieldUpdated
+	FieldVault
+
+	AllFields = FieldID | FieldLanguage | FieldTitle | FieldCode | FieldCodeSHA256 | FieldPrivate |
+		FieldFavorite | FieldTags | FieldDescription | FieldCreated | FieldUpdated | FieldVault
+)
+
+// fieldNames are the JSON names of the fields, in the order DBsnippet has
+// them.
+var fieldNames = []struct {
+	field Fields
+	name  string
+}{
+	{FieldID, "id"},
+	{FieldLanguage, "language"},
+	{FieldTitle, "title"},
+	{FieldCode, "code"},
+	{FieldCodeSHA256, "code_sha256"},
+	{FieldPrivate, "private"},
+	{FieldFavorite, "favorite"},
+	{FieldTags, "tags"},
+	{FieldDescription, "description"},
+	{FieldCreated, "created"},
+	{FieldUpdated, "updated"},
+	{FieldVault, "vault"},
+}
+
+// ParseFields reads a comma separated list of field names as sent in the
+// fields query parameter. An empty list is every field.
+func ParseFields(list string) (Fields, error) {
+	var f Fields
+	for name := range strings.SplitSeq(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		found := false
+		for _, n := range fieldNames {
+			if n.name == name {
+				f |= n.field
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown field %q", name)
+		}
+	}
+
+	if f == 0 {
+		return AllFields, nil
+	}
+	return f, nil
+}
+
+// Has reports whether every field of o is in f.
+func (f Fields) Has(o Fields) bool {
+	return f == 0 || f&o == o
+}
+
+// View is what of a snippet is read. The zero View reads everything.
+type View struct {
+	Fields Fields
+	// PreviewLines cuts code after that many lines, 0 keeps all of it.
+	// Vault code is never cut, it is ciphertext.
+	PreviewLines int
+}
+
+// snippetQuery reads the columns a View needs. Code is only fetched, and
+// decompressed, when code or vault is asked for. The hash alone comes from
+// the blob without touching the code.
+type snippetQuery struct {
+	View
+	store    *CodeStore
+	readCode bool
+	readHash bool
+}
+
+func newSnippetQuery(cs *CodeStore, v View) snippetQuery {
+	q := snippetQuery{View: v, store: cs}
+	q.readCode = v.Fields.Has(FieldCode) || v.Fields.Has(FieldVault)
+	q.readHash = !q.readCode && v.Fields.Has(FieldCodeSHA256)
+	return q
+}
+
+// sql returns the SELECT ... FROM part, the caller adds the conditions.
+func (q snippetQuery) sql() string {
+	// The id and update time are always read, they make up the version of
+	// the snippet.
+	cols := []string{"s.vault", "s.id", "s.updated"}
+	for _, c := range []struct {
+		field  Fields
+		column string
+	}{
+		{FieldLanguage, "s.language"},
+		{FieldTitle, "s.title"},
+		{FieldPrivate, "s.private"},
+		{FieldFavorite, "s.favorite"},
+		{FieldTags, "s.tags"},
+		{FieldDescription, "s.description"},
+		{FieldCreated, "s.created"},
+		{FieldVault, "s.vault_title, s.vault_description"},
+	} {
+		if q.Fields.Has(c.field) {
+			cols = append(cols, c.column)
+		}
+	}
+
+	from := "snippets s"
+	switch {
+	case q.readCode:
+		cols = append(cols, codeColumns)
+		from = codeSource
+	case q.readHash:
+		cols = append(cols, "b.hash")
+		from = "snippets s LEFT JOIN code_blobs b ON b.id=s.blob_id"
+	}
+
+	return "SELECT " + strings.Join(cols, ", ") + " FROM " + from
+}
+
+// scan reads a row of sql into a DBsnippet that only sends the fields of
+// the View.
+func (q snippetQuery) scan(ctx context.Context, row pgx.Row) (*DBsnippet, error) {
+	snippet := DBsnippet{fields: q.Fields}
+	var isVault bool
+	var code, wrapped, hash, vaultTitle, vaultDescription []byte
+	var keyID *int
+	var masterID *string
+
+	dest := []any{&isVault, &snippet.ID, &snippet.Updated}
+	for _, d := range []struct {
+		field Fields
+		dest  []any
+	}{
+		{FieldLanguage, []any{&snippet.Language}},
+		{FieldTitle, []any{&snippet.Title}},
+		{FieldPrivate, []any{&snippet.Private}},
+		{FieldFavorite, []any{&snippet.Favorite}},
+		{FieldTags, []any{&snippet.Tags}},
+		{FieldDescription, []any{&snippet.Description}},
+		{FieldCreated, []any{&snippet.Created}},
+		{FieldVault, []any{&vaultTitle, &vaultDescription}},
+	} {
+		if q.Fields.Has(d.field) {
+			dest = append(dest, d.dest...)
+		}
+	}
+
+	switch {
+	case q.readCode:
+		dest = append(dest, &code, &hash, &keyID, &masterID, &wrapped)
+	case q.readHash:
+		dest = append(dest, &hash)
+	}
+
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	if q.readHash {
+		// Rows not moved to a blob yet have no stored hash, it is left
+		// out until the dedup command has run.
+		if hash != nil {
+			snippet.CodeSHA256 = hex.EncodeToString(hash)
+		}
+		return &snippet, nil
+	}
+	if !q.readCode {
+		return &snippet, nil
+	}
+
+	plain, err := q.store.openCode(ctx, code, hash, keyID, masterID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Fields.Has(FieldCodeSHA256) {
+		snippet.CodeSHA256 = hex.EncodeToString(CodeHash(plain))
+	}
+
+	if isVault {
+		if q.Fields.Has(FieldVault) {
+			snippet.Vault = &vault.Snippet{Title: vaultTitle, Code: plain, Description: vaultDescription}
+		}
+		return &snippet, nil
+	}
+
+	if q.Fields.Has(FieldCode) {
+		plain, snippet.Truncated = previewLines(plain, q.PreviewLines)
+		snippet.Code = string(plain)
+	}
+	return &snippet, nil
+}
+
+// previewLines returns the first n lines of code, and whether anything was
+// cut. n <= 0 keeps everything.
+func previewLines(code []byte, n int) ([]byte, bool) {
+	if n <= 0 {
+		return code, false
+	}
+
+	end := 0
+	for range n {
+		i := bytes.IndexByte(code[end:], '\n')
+		if i < 0 {
+			return code, false
+		}
+		end += i + 1
+	}
+
+	if end == len(code) {
+		return code, false
+	}
+	return code[:end-1], true
+}
+
+// MarshalJSON sends only the fields the snippet was read with.
+func (s DBsnippet) MarshalJSON() ([]byte, error) {
+	type all DBsnippet
+	if s.fields == 0 || s.fields == AllFields {
+		return json.Marshal(all(s))
+	}
+
+	values := map[Fields]any{
+		FieldID:          s.ID,
+		FieldLanguage:    s.Language,
+		FieldTitle:       s.Title,
+		FieldCode:        s.Code,
+		FieldCodeSHA256:  s.CodeSHA256,
+		FieldPrivate:     s.Private,
+		FieldFavorite:    s.Favorite,
+		FieldTags:        s.Tags,
+		FieldDescription: s.Description,
+		FieldCreated:     s.Created,
+		FieldUpdated:     s.Updated,
+	}
+
+	stream := json.BorrowStream(nil)
+	defer json.ReturnStream(stream)
+
+	stream.WriteObjectStart()
+	first := true
+	for _, n := range fieldNames {
+		if !s.fields.Has(n.field) {
+			continue
+		}
+
+		value, ok := values[n.field]
+		if n.field == FieldVault {
+			// Vault stays left out for regular snippets, like it is when
+			// every field is sent.
+			value, ok = s.Vault, s.Vault != nil
+		}
+		if !ok {
+			continue
+		}
+
+		if !first {
+			stream.WriteMore()
+		}
+		first = false
+		stream.WriteObjectField(n.name)
+		stream.WriteVal(value)
+
+		if n.field == FieldCode && s.Truncated {
+			stream.WriteMore()
+			stream.WriteObjectField("truncated")
+			stream.WriteTrue()
+		}
+	}
+	stream.WriteObjectEnd()
+
+	if stream.Error != nil {
+		return nil, stream.Error
+	}
+	return append([]byte(nil), stream.Buffer()...), nil
+}
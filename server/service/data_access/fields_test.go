@@ -0,0 +1,130 @@
+package dataaccess
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    Fields
+		wantErr bool
+	}{
+		{name: "Empty", list: "", want: AllFields},
+		{name: "Only commas", list: ", ,", want: AllFields},
+		{name: "Some", list: "id, title,tags", want: FieldID | FieldTitle | FieldTags},
+		{name: "Repeated", list: "code,code", want: FieldCode},
+		{name: "Unknown", list: "id,userid", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFields(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want one: %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %b, want %b", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnippetQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   Fields
+		contains string
+		absent   string
+	}{
+		{name: "All", fields: 0, contains: codeSource},
+		{name: "No code", fields: FieldID | FieldTitle, contains: "FROM snippets s", absent: "code"},
+		{name: "Hash only", fields: FieldID | FieldCodeSHA256, contains: "b.hash", absent: codeColumns},
+		{name: "Code", fields: FieldCode, contains: codeColumns},
+		{name: "Vault", fields: FieldVault, contains: "s.vault_title"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql := newSnippetQuery(nil, View{Fields: tt.fields}).sql()
+			if !strings.Contains(sql, tt.contains) {
+				t.Errorf("%q does not contain %q", sql, tt.contains)
+			}
+			if tt.absent != "" && strings.Contains(sql, tt.absent) {
+				t.Errorf("%q contains %q", sql, tt.absent)
+			}
+		})
+	}
+}
+
+func TestPreviewLines(t *testing.T) {
+	tests := []struct {
+		name      string
+		code      string
+		n         int
+		want      string
+		truncated bool
+	}{
+		{name: "No preview", code: "a\nb\nc", n: 0, want: "a\nb\nc"},
+		{name: "Cut", code: "a\nb\nc", n: 2, want: "a\nb", truncated: true},
+		{name: "Exact", code: "a\nb", n: 2, want: "a\nb"},
+		{name: "Trailing newline", code: "a\nb\n", n: 2, want: "a\nb\n"},
+		{name: "Trailing newline cut", code: "a\nb\n", n: 1, want: "a", truncated: true},
+		{name: "Short", code: "a", n: 5, want: "a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := previewLines([]byte(tt.code), tt.n)
+			if string(got) != tt.want || truncated != tt.truncated {
+				t.Errorf("got %q, %v, want %q, %v", got, truncated, tt.want, tt.truncated)
+			}
+		})
+	}
+}
+
+func TestSparseSnippetJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet DBsnippet
+		want    string
+	}{
+		{
+			name:    "Selected fields",
+			snippet: DBsnippet{ID: 1, Title: "t", Code: "c", Tags: []string{"go"}, fields: FieldID | FieldTitle | FieldTags},
+			want:    `{"id":1,"title":"t","tags":["go"]}`,
+		},
+		{
+			name:    "Truncated code",
+			snippet: DBsnippet{Code: "a", Truncated: true, fields: FieldCode},
+			want:    `{"code":"a","truncated":true}`,
+		},
+		{
+			name:    "No vault",
+			snippet: DBsnippet{ID: 2, fields: FieldID | FieldVault},
+			want:    `{"id":2}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.snippet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	full, err := json.Marshal(DBsnippet{ID: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(full), `"description"`) {
+		t.Errorf("snippet without fields is missing fields: %s", full)
+	}
+}
@@ -0,0 +1,32 @@
+package dataaccess
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Tables lists the tables the application owns, parents before children.
+var Tables = []string{"users", "data_keys", "code_blobs", "snippets", "zstd_dictionaries", "rate_limits"}
+
+// Reindex rebuilds the indexes of every application table and refreshes the
+// planner statistics. REINDEX takes locks that block writes, so run it in a
+// quiet period or with the server in read-only mode.
+func Reindex(ctx context.Context, dbConn *pgxpool.Pool, progress func(table string)) error {
+	for _, table := range Tables {
+		if progress != nil {
+			progress(table)
+		}
+
+		if _, err := dbConn.Exec(ctx, "REINDEX TABLE "+table); err != nil {
+			return fmt.Errorf("reindex %s: %w", table, err)
+		}
+
+		if _, err := dbConn.Exec(ctx, "ANALYZE "+table); err != nil {
+			return fmt.Errorf("analyze %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
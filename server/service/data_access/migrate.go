@@ -0,0 +1,138 @@
+package dataaccess
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLock is the advisory lock key held while migrating, so replicas
+// starting together don't apply the same migration twice.
+const migrationLock = 0x636f64656c6574
+
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Migrations returns the embedded migrations ordered by version. Files are
+// named NNNN_description.sql.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, e := range entries {
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration %q is not named NNNN_description.sql", e.Name())
+		}
+
+		sql, err := migrationFiles.ReadFile("migrations/" + e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, Migration{Version: version, Name: name, SQL: string(sql)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// LatestSchemaVersion is the version the database is at once every embedded
+// migration has run.
+func LatestSchemaVersion() int {
+	migrations, err := Migrations()
+	if err != nil || len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the highest applied migration, 0 for a database that
+// has never been migrated.
+func SchemaVersion(ctx context.Context, dbConn *pgxpool.Pool) (int, error) {
+	var exists bool
+	if err := dbConn.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return 0, err
+	}
+
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	if err := dbConn.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// Migrate applies every embedded migration newer than the database, each in
+// its own transaction, and returns the ones it ran.
+func Migrate(ctx context.Context, dbConn *pgxpool.Pool) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dbConn.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLock); err != nil {
+		return nil, err
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLock)
+
+	_, err = conn.Exec(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version INT PRIMARY KEY, name TEXT NOT NULL, applied TIMESTAMPTZ NOT NULL DEFAULT now())")
+	if err != nil {
+		return nil, err
+	}
+
+	var current int
+	if err := conn.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, m.SQL); err != nil {
+				return err
+			}
+
+			_, err := tx.Exec(ctx, "INSERT INTO schema_migrations(version, name) VALUES($1, $2)", m.Version, m.Name)
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+
+		applied = append(applied, m)
+	}
+
+	return applied, nil
+}
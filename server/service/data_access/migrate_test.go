@@ -0,0 +1,55 @@
+package dataaccess
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/scott-mescudi/codelet/shared/languages"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %s has version %d, expected %d", m.Name, m.Version, i+1)
+		}
+		if strings.TrimSpace(m.SQL) == "" {
+			t.Errorf("migration %04d_%s is empty", m.Version, m.Name)
+		}
+	}
+
+	if got := LatestSchemaVersion(); got != migrations[len(migrations)-1].Version {
+		t.Errorf("latest version %d does not match last migration", got)
+	}
+}
+
+// Rows stored before the registry existed are normalized by migrations, so
+// every name the registry knows needs one. Names added later go into a new
+// migration like 0009_normalize_languages.
+func TestLanguagesNormalized(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sql strings.Builder
+	for _, m := range migrations {
+		sql.WriteString(m.SQL)
+	}
+
+	for _, l := range languages.All() {
+		for _, name := range append([]string{l.ID, strings.ToLower(l.Name)}, l.Aliases...) {
+			if row := "('" + name + "', '" + l.ID + "')"; !strings.Contains(sql.String(), row) {
+				t.Errorf("no migration maps %q to %q", name, l.ID)
+			}
+		}
+	}
+}
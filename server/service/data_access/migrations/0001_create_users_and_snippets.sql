@@ -10,7 +10,6 @@ CREATE TABLE IF NOT EXISTS users (
   updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
-
 CREATE TABLE IF NOT EXISTS snippets (
   id SERIAL PRIMARY KEY,
   userid INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -23,4 +22,4 @@ CREATE TABLE IF NOT EXISTS snippets (
   tags VARCHAR(50)[],
   created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
   updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
\ No newline at end of file
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS data_keys (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+  master_key_id TEXT NOT NULL,
+  wrapped_key BYTEA NOT NULL,
+  created TIMESTAMPTZ NOT NULL DEFAULT now(),
+  rotated TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS data_keys_master_key_id_idx ON data_keys(master_key_id);
+
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS key_id INT REFERENCES data_keys(id);
+CREATE INDEX IF NOT EXISTS snippets_unencrypted_idx ON snippets(id) WHERE key_id IS NULL;
@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS vault JSONB;
+
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS vault BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS vault_title BYTEA;
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS vault_description BYTEA;
+
+-- Vault snippets keep everything readable in the vault_ columns and code,
+-- encrypted by the client. Nothing that could leak content is left in plain
+-- columns, and they never show up in public listings.
+ALTER TABLE snippets ADD CONSTRAINT snippets_vault_opaque CHECK (
+  NOT vault OR (
+    private AND title = '' AND vault_title IS NOT NULL
+    AND COALESCE(description, '') = '' AND COALESCE(cardinality(tags), 0) = 0
+  )
+);
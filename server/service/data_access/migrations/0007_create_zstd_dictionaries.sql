@@ -0,0 +1,11 @@
+-- The id is the dictionary ID written into every zstd frame compressed with
+-- it, so rows must never be renumbered or removed while code still uses them.
+CREATE TABLE IF NOT EXISTS zstd_dictionaries (
+  id BIGINT PRIMARY KEY CHECK (id >= 32768 AND id < 4294967296),
+  language TEXT NOT NULL,
+  data BYTEA NOT NULL,
+  samples INT NOT NULL,
+  created TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS zstd_dictionaries_language_idx ON zstd_dictionaries(language);
@@ -0,0 +1,50 @@
+-- Snippet code is stored once per distinct content and data key. hash is the
+-- SHA-256 of the uncompressed code, code is compressed and, when key_id is
+-- set, encrypted with that data key. Blobs are never shared across data
+-- keys, so encrypted users never share anything.
+CREATE TABLE IF NOT EXISTS code_blobs (
+  id BIGSERIAL PRIMARY KEY,
+  hash BYTEA NOT NULL CHECK (length(hash) = 32),
+  key_id INT REFERENCES data_keys(id) ON DELETE CASCADE,
+  language TEXT NOT NULL DEFAULT '',
+  code BYTEA NOT NULL,
+  refs INT NOT NULL DEFAULT 0 CHECK (refs >= 0),
+  created TIMESTAMPTZ NOT NULL DEFAULT now(),
+  unreferenced TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS code_blobs_hash_key_idx ON code_blobs(hash, COALESCE(key_id, 0));
+CREATE INDEX IF NOT EXISTS code_blobs_unreferenced_idx ON code_blobs(unreferenced) WHERE refs = 0;
+
+-- Rows from before this migration keep their code inline until the dedup
+-- command moves them, every other row points at a blob.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS blob_id BIGINT REFERENCES code_blobs(id);
+ALTER TABLE snippets ALTER COLUMN code DROP NOT NULL;
+ALTER TABLE snippets ADD CONSTRAINT snippets_code_or_blob CHECK ((code IS NULL) <> (blob_id IS NULL));
+CREATE INDEX IF NOT EXISTS snippets_blob_id_idx ON snippets(blob_id);
+CREATE INDEX IF NOT EXISTS snippets_inline_code_idx ON snippets(id) WHERE blob_id IS NULL;
+
+-- refs is kept by a trigger rather than by the application so that snippets
+-- removed by ON DELETE CASCADE, when an account goes, are counted too.
+-- unreferenced records when refs last dropped to 0, the garbage collector
+-- gives blobs a grace period from there.
+CREATE OR REPLACE FUNCTION code_blobs_count_refs() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.blob_id IS NOT NULL THEN
+    UPDATE code_blobs SET refs = refs - 1,
+      unreferenced = CASE WHEN refs = 1 THEN now() END
+      WHERE id = OLD.blob_id;
+  END IF;
+
+  IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.blob_id IS NOT NULL THEN
+    UPDATE code_blobs SET refs = refs + 1, unreferenced = NULL WHERE id = NEW.blob_id;
+  END IF;
+
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS snippets_count_blob_refs ON snippets;
+CREATE TRIGGER snippets_count_blob_refs
+  AFTER INSERT OR DELETE OR UPDATE OF blob_id ON snippets
+  FOR EACH ROW EXECUTE FUNCTION code_blobs_count_refs();
@@ -0,0 +1,126 @@
+-- Snippet languages were free text, so the same language was stored under
+-- several spellings. Every name the registry in shared/languages knows is
+-- moved onto its canonical id. Unknown languages become text, the same rule
+-- the API applies to new snippets.
+CREATE TEMPORARY TABLE language_names (name TEXT PRIMARY KEY, id TEXT NOT NULL) ON COMMIT DROP;
+
+INSERT INTO language_names(name, id) VALUES
+  ('bash', 'bash'),
+  ('sh', 'bash'),
+  ('shell', 'bash'),
+  ('zsh', 'bash'),
+  ('c', 'c'),
+  ('clojure', 'clojure'),
+  ('clj', 'clojure'),
+  ('cpp', 'cpp'),
+  ('c++', 'cpp'),
+  ('cxx', 'cpp'),
+  ('csharp', 'csharp'),
+  ('c#', 'csharp'),
+  ('cs', 'csharp'),
+  ('css', 'css'),
+  ('dart', 'dart'),
+  ('diff', 'diff'),
+  ('patch', 'diff'),
+  ('dockerfile', 'dockerfile'),
+  ('docker', 'dockerfile'),
+  ('elixir', 'elixir'),
+  ('ex', 'elixir'),
+  ('erlang', 'erlang'),
+  ('erl', 'erlang'),
+  ('fsharp', 'fsharp'),
+  ('f#', 'fsharp'),
+  ('fs', 'fsharp'),
+  ('go', 'go'),
+  ('golang', 'go'),
+  ('graphql', 'graphql'),
+  ('gql', 'graphql'),
+  ('groovy', 'groovy'),
+  ('gradle', 'groovy'),
+  ('haskell', 'haskell'),
+  ('hs', 'haskell'),
+  ('hcl', 'hcl'),
+  ('terraform', 'hcl'),
+  ('tf', 'hcl'),
+  ('html', 'html'),
+  ('htm', 'html'),
+  ('ini', 'ini'),
+  ('cfg', 'ini'),
+  ('conf', 'ini'),
+  ('java', 'java'),
+  ('javascript', 'javascript'),
+  ('js', 'javascript'),
+  ('node', 'javascript'),
+  ('nodejs', 'javascript'),
+  ('json', 'json'),
+  ('jsx', 'jsx'),
+  ('julia', 'julia'),
+  ('jl', 'julia'),
+  ('kotlin', 'kotlin'),
+  ('kt', 'kotlin'),
+  ('lua', 'lua'),
+  ('makefile', 'makefile'),
+  ('make', 'makefile'),
+  ('mk', 'makefile'),
+  ('markdown', 'markdown'),
+  ('md', 'markdown'),
+  ('objective-c', 'objective-c'),
+  ('objc', 'objective-c'),
+  ('obj-c', 'objective-c'),
+  ('objectivec', 'objective-c'),
+  ('ocaml', 'ocaml'),
+  ('ml', 'ocaml'),
+  ('perl', 'perl'),
+  ('pl', 'perl'),
+  ('php', 'php'),
+  ('powershell', 'powershell'),
+  ('ps1', 'powershell'),
+  ('pwsh', 'powershell'),
+  ('posh', 'powershell'),
+  ('protobuf', 'protobuf'),
+  ('protocol buffers', 'protobuf'),
+  ('proto', 'protobuf'),
+  ('python', 'python'),
+  ('py', 'python'),
+  ('python3', 'python'),
+  ('r', 'r'),
+  ('ruby', 'ruby'),
+  ('rb', 'ruby'),
+  ('rust', 'rust'),
+  ('rs', 'rust'),
+  ('scala', 'scala'),
+  ('scss', 'scss'),
+  ('sass', 'scss'),
+  ('sql', 'sql'),
+  ('postgresql', 'sql'),
+  ('postgres', 'sql'),
+  ('mysql', 'sql'),
+  ('sqlite', 'sql'),
+  ('plpgsql', 'sql'),
+  ('swift', 'swift'),
+  ('text', 'text'),
+  ('plain text', 'text'),
+  ('plaintext', 'text'),
+  ('plain', 'text'),
+  ('txt', 'text'),
+  ('toml', 'toml'),
+  ('tsx', 'tsx'),
+  ('typescript', 'typescript'),
+  ('ts', 'typescript'),
+  ('vue', 'vue'),
+  ('xml', 'xml'),
+  ('yaml', 'yaml'),
+  ('yml', 'yaml'),
+  ('zig', 'zig');
+
+-- The language is part of what a snippet's ETag stands for, so it gets a new
+-- version.
+UPDATE snippets s SET language=n.id, updated=s.updated + interval '1 microsecond' FROM language_names n WHERE lower(trim(s.language))=n.name AND s.language<>n.id;
+UPDATE code_blobs b SET language=n.id FROM language_names n WHERE lower(trim(b.language))=n.name AND b.language<>n.id;
+UPDATE zstd_dictionaries d SET language=n.id FROM language_names n WHERE lower(trim(d.language))=n.name AND d.language<>n.id;
+
+-- Dictionaries of unknown languages are kept for the frames that name them,
+-- renaming them would make one of them the dictionary for text. Vault blobs
+-- have no language and stay that way.
+UPDATE snippets SET language='text', updated=updated + interval '1 microsecond' WHERE language NOT IN (SELECT id FROM language_names);
+UPDATE code_blobs SET language='text' WHERE language<>'' AND language NOT IN (SELECT id FROM language_names);
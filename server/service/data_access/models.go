@@ -1,23 +1,30 @@
 package dataaccess
 
-import "time"
+import (
+	"time"
+
+	"github.com/scott-mescudi/codelet/shared/vault"
+)
 
 type DBsnippet struct {
-	ID          int       `json:"id"`
-	Language    string    `json:"language"`
-	Title       string    `json:"title"`
-	Code        string    `json:"code"`
+	ID       int    `json:"id"`
+	Language string `json:"language"`
+	Title    string `json:"title"`
+	Code     string `json:"code"`
+	// CodeSHA256 is the hex SHA-256 of the code, of the sealed code for
+	// vault snippets. It can be sent instead of the code it stands for.
+	CodeSHA256  string    `json:"code_sha256"`
 	Private     bool      `json:"private"`
 	Favorite    bool      `json:"favorite"`
 	Tags        []string  `json:"tags"`
 	Description string    `json:"description"`
 	Created     time.Time `json:"created"`
 	Updated     time.Time `json:"updated"`
-}
+	// Vault is set instead of Title, Code and Description for snippets the
+	// client encrypted.
+	Vault *vault.Snippet `json:"vault,omitempty"`
+	// Truncated is set when Code was cut short by View.PreviewLines.
+	Truncated bool `json:"truncated,omitempty"`
 
-type SmallDBsnippet struct {
-	ID       int    `json:"id"`
-	Language string `json:"language"`
-	Title    string `json:"title"`
-	Favorite bool   `json:"favorite"`
+	fields Fields
 }
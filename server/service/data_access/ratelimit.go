@@ -0,0 +1,58 @@
+package dataaccess
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/scott-mescudi/codelet/shared/ratelimit"
+)
+
+// RateLimitStore keeps token buckets in the rate_limits table so every
+// replica of the server enforces the same limits.
+type RateLimitStore struct {
+	Db *pgxpool.Pool
+}
+
+func (s *RateLimitStore) Take(ctx context.Context, key string, policy ratelimit.Policy) (ratelimit.Result, error) {
+	return TakeRateLimitToken(ctx, s.Db, policy.Name+":"+key, policy, time.Now())
+}
+
+func TakeRateLimitToken(ctx context.Context, dbConn *pgxpool.Pool, key string, policy ratelimit.Policy, now time.Time) (ratelimit.Result, error) {
+	tx, err := dbConn.Begin(ctx)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	bucket := ratelimit.NewBucket(policy, now)
+	_, err = tx.Exec(ctx, "INSERT INTO rate_limits(key, tokens, updated) VALUES($1, $2, $3) ON CONFLICT (key) DO NOTHING", key, bucket.Tokens, bucket.Updated)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	err = tx.QueryRow(ctx, "SELECT tokens, updated FROM rate_limits WHERE key=$1 FOR UPDATE", key).Scan(&bucket.Tokens, &bucket.Updated)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	res := bucket.Take(policy, now)
+
+	_, err = tx.Exec(ctx, "UPDATE rate_limits SET tokens=$1, updated=$2 WHERE key=$3", bucket.Tokens, bucket.Updated, key)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	return res, tx.Commit(ctx)
+}
+
+// DeleteIdleRateLimits removes buckets last used before before. Callers pass
+// a time by which every policy has refilled them, so nothing is forgotten
+// that a new bucket wouldn't also allow.
+func DeleteIdleRateLimits(ctx context.Context, dbConn *pgxpool.Pool, before time.Time) (int64, error) {
+	tag, err := dbConn.Exec(ctx, "DELETE FROM rate_limits WHERE updated < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
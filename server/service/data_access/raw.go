@@ -0,0 +1,71 @@
+package dataaccess
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	cmp "github.com/scott-mescudi/codelet/shared/compression"
+)
+
+// RawCode is the code of a snippet with what it takes to serve it as a file.
+type RawCode struct {
+	ID       int
+	Language string
+	Title    string
+	Updated  time.Time
+	// Vault snippets have neither Code nor Frame, their code is ciphertext
+	// only the owner's client can open.
+	Vault bool
+	Code  []byte
+	// Frame is the zstd frame the code is stored in, set instead of Code
+	// when it was asked for and any zstd decoder can read it: the code is
+	// not encrypted and was compressed without a dictionary.
+	Frame []byte
+}
+
+const rawSelect = "SELECT s.id, s.language, s.title, s.updated, s.vault, " + codeColumns + " FROM " + codeSource
+
+func getRawCode(ctx context.Context, cs *CodeStore, row pgx.Row, frame bool) (*RawCode, error) {
+	var raw RawCode
+	var code, hash, wrapped []byte
+	var keyID *int
+	var masterID *string
+	err := row.Scan(&raw.ID, &raw.Language, &raw.Title, &raw.Updated, &raw.Vault, &code, &hash, &keyID, &masterID, &wrapped)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSnippetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if raw.Vault {
+		return &raw, nil
+	}
+
+	if frame && keyID == nil {
+		if id, err := cmp.DictionaryID(code); err == nil && id == 0 {
+			raw.Frame = code
+			return &raw, nil
+		}
+	}
+
+	if raw.Code, err = cs.openCode(ctx, code, hash, keyID, masterID, wrapped); err != nil {
+		return nil, err
+	}
+	return &raw, nil
+}
+
+// GetSnippetCode returns the code of a snippet owned by userID, or
+// ErrSnippetNotFound. With frame set the stored zstd frame is returned when
+// it can be served as it is.
+func GetSnippetCode(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, userID, snippetID int, frame bool) (*RawCode, error) {
+	return getRawCode(ctx, cs, dbConn.QueryRow(ctx, rawSelect+" WHERE s.userid=$1 AND s.id=$2", userID, snippetID), frame)
+}
+
+// GetPublicSnippetCode is GetSnippetCode for any public snippet.
+func GetPublicSnippetCode(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, snippetID int, frame bool) (*RawCode, error) {
+	return getRawCode(ctx, cs, dbConn.QueryRow(ctx, rawSelect+" WHERE "+publicSnippet+" AND s.id=$1", snippetID), frame)
+}
@@ -0,0 +1,122 @@
+package dataaccess
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/scott-mescudi/codelet/shared/encryption"
+)
+
+// RekeyProgress counts what Rekey has done so far.
+type RekeyProgress struct {
+	// DataKeys were rewrapped with the active master key.
+	DataKeys int
+	// Snippets were stored unencrypted or inline and are now in a blob
+	// encrypted with their user's data key.
+	Snippets int
+}
+
+// Rekey moves everything onto the active master key of cs while the server
+// keeps serving: data keys wrapped by an older master key are rewrapped,
+// and snippets written before encryption was turned on, or before blobs
+// existed, are moved to a blob encrypted with their user's data key.
+// Snippet ciphertexts are left alone otherwise, their data keys don't
+// change.
+//
+// Work happens in transactions of at most batchSize rows that skip rows
+// other transactions hold, so it never waits behind live traffic. Every
+// server must already have the new master key configured, the old one can
+// be dropped from the configuration once Rekey returns.
+func Rekey(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, batchSize int, progress func(RekeyProgress)) (RekeyProgress, error) {
+	var done RekeyProgress
+	if !cs.Encrypted() {
+		return done, ErrNoKeyring
+	}
+
+	for {
+		n, err := rewrapBatch(ctx, dbConn, cs.keyring, batchSize)
+		if err != nil {
+			return done, err
+		}
+		if n == 0 {
+			break
+		}
+
+		done.DataKeys += n
+		if progress != nil {
+			progress(done)
+		}
+	}
+
+	for {
+		n, err := dedupBatch(ctx, dbConn, cs, batchSize)
+		if err != nil {
+			return done, err
+		}
+		if n == 0 {
+			break
+		}
+
+		done.Snippets += n
+		if progress != nil {
+			progress(done)
+		}
+	}
+
+	for {
+		n, err := encryptBlobBatch(ctx, dbConn, cs, batchSize)
+		if err != nil {
+			return done, err
+		}
+		if n == 0 {
+			break
+		}
+
+		done.Snippets += n
+		if progress != nil {
+			progress(done)
+		}
+	}
+
+	return done, nil
+}
+
+func rewrapBatch(ctx context.Context, dbConn *pgxpool.Pool, k *encryption.Keyring, batchSize int) (int, error) {
+	tx, err := dbConn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	type row struct {
+		ID          int
+		MasterKeyID string
+		WrappedKey  []byte
+	}
+
+	rows, _ := tx.Query(ctx, "SELECT id, master_key_id, wrapped_key FROM data_keys WHERE master_key_id <> $1 ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED", k.ActiveID(), batchSize)
+	keys, err := pgx.CollectRows(rows, pgx.RowToStructByPos[row])
+	if err != nil {
+		return 0, err
+	}
+
+	for _, dk := range keys {
+		key, err := k.Unwrap(dk.MasterKeyID, dk.WrappedKey)
+		if err != nil {
+			return 0, fmt.Errorf("data key %d: %w", dk.ID, err)
+		}
+
+		masterID, wrapped, err := k.Wrap(key)
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err := tx.Exec(ctx, "UPDATE data_keys SET master_key_id=$1, wrapped_key=$2, rotated=now() WHERE id=$3", masterID, wrapped, dk.ID); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(keys), tx.Commit(ctx)
+}
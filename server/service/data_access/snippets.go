@@ -7,48 +7,36 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/scott-mescudi/codelet/shared/compression"
-	cmp "github.com/scott-mescudi/codelet/shared/compression"
+	"github.com/scott-mescudi/codelet/shared/vault"
 )
 
-func AddSnippet(dbConn *pgxpool.Pool, userID int, language, description, title string, code string, private, favorite bool, tags []string, created time.Time, updated time.Time) error {
-	compressed, err := cmp.CompressZSTD([]byte(code))
-	if err != nil {
-		return err
-	}
-
-	_, err = dbConn.Exec(context.Background(), "INSERT INTO snippets(userid, language, title, code, description, private, tags, created, updated, favorite) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)", userID, language, title, compressed, description, private, tags, created, updated, favorite)
-	if err != nil {
-		return err
-	}
+var ErrSnippetNotFound = errors.New("snippet not found")
 
-	return nil
-}
+// publicSnippet is the condition of snippets anyone can read. Accounts
+// scheduled for deletion drop out of sight for their grace period, a login
+// that calls the deletion off brings their snippets back.
+const publicSnippet = "s.private=false AND s.userid IN (SELECT id FROM users WHERE delete_after IS NULL)"
 
-func GetSnippetsByUserID(dbConn *pgxpool.Pool, userID, limit, offset int) ([]DBsnippet, error) {
-	var data []DBsnippet
-	rows, err := dbConn.Query(context.Background(), "SELECT id, language, title, code, description, private, tags, created, updated, favorite FROM snippets WHERE userid=$1 LIMIT $2 OFFSET $3", userID, limit, offset)
+// querySnippets reads the snippets matching where, which may use args, as
+// far as v asks for them.
+func querySnippets(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, v View, where string, args ...any) ([]DBsnippet, error) {
+	q := newSnippetQuery(cs, v)
+	rows, err := dbConn.Query(ctx, q.sql()+" "+where, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	var data []DBsnippet
 	for rows.Next() {
-		var snippet DBsnippet
-		var code []byte
-		err := rows.Scan(&snippet.ID, &snippet.Language, &snippet.Title, &code, &snippet.Description, &snippet.Private, &snippet.Tags, &snippet.Created, &snippet.Updated, &snippet.Favorite)
-		if err != nil {
-			return nil, err
-		}
-
-		decompressedData, err := cmp.DecompressZSTD(code)
+		snippet, err := q.scan(ctx, rows)
 		if err != nil {
 			return nil, err
 		}
 
-		snippet.Code = string(decompressedData)
-		data = append(data, snippet)
+		data = append(data, *snippet)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -56,130 +44,88 @@ func GetSnippetsByUserID(dbConn *pgxpool.Pool, userID, limit, offset int) ([]DBs
 	}
 
 	return data, nil
-
 }
 
-func GetAllSnippetsByUserID(dbConn *pgxpool.Pool, userID int) ([]DBsnippet, error) {
-	var data []DBsnippet
-	rows, err := dbConn.Query(context.Background(), "SELECT id, language, title, code, description, private, tags, created, updated, favorite FROM snippets WHERE userid=$1", userID)
+// AddSnippet stores a snippet of userID. It returns ErrUnknownBlob when code
+// is only a hash that userID has no code for.
+func AddSnippet(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, userID int, language, description, title string, code Code, private, favorite bool, tags []string, created time.Time, updated time.Time) error {
+	tx, err := dbConn.Begin(ctx)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var snippet DBsnippet
-		var code []byte
-		err := rows.Scan(&snippet.ID, &snippet.Language, &snippet.Title, &code, &snippet.Description, &snippet.Private, &snippet.Tags, &snippet.Created, &snippet.Updated, &snippet.Favorite)
-		if err != nil {
-			return nil, err
-		}
-
-		decompressedData, err := cmp.DecompressZSTD(code)
-		if err != nil {
-			return nil, err
-		}
-
-		snippet.Code = string(decompressedData)
-		data = append(data, snippet)
+		return err
 	}
+	defer tx.Rollback(ctx)
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+	blobID, err := resolveCode(ctx, tx, cs, userID, language, code, false)
+	if err != nil {
+		return err
 	}
 
-	return data, nil
-
-}
-
-func GetPublicSnippets(dbConn *pgxpool.Pool, limit, offset int) ([]DBsnippet, error) {
-	var data []DBsnippet
-	rows, err := dbConn.Query(context.Background(), "SELECT id, language, title, code, description, private, tags, created, updated, favorite FROM snippets WHERE private=false LIMIT $1 OFFSET $2", limit, offset)
+	_, err = tx.Exec(ctx, "INSERT INTO snippets(userid, language, title, blob_id, description, private, tags, created, updated, favorite) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)", userID, language, title, blobID, description, private, tags, created, updated, favorite)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var snippet DBsnippet
-		var code []byte
-		err := rows.Scan(&snippet.ID, &snippet.Language, &snippet.Title, &code, &snippet.Description, &snippet.Private, &snippet.Tags, &snippet.Created, &snippet.Updated, &snippet.Favorite)
-		if err != nil {
-			return nil, err
-		}
-
-		decompressedData, err := cmp.DecompressZSTD(code)
-		if err != nil {
-			return nil, err
-		}
-
-		snippet.Code = string(decompressedData)
-		data = append(data, snippet)
-	}
+	return tx.Commit(ctx)
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
+// GetSnippetsByUserID reads a page of a user's snippets, a limit of 0 reads
+// all of them.
+func GetSnippetsByUserID(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, userID, limit, offset int, v View) ([]DBsnippet, error) {
+	return querySnippets(ctx, dbConn, cs, v, "WHERE s.userid=$1 ORDER BY s.id LIMIT NULLIF($2, 0) OFFSET $3", userID, limit, offset)
+}
 
-	return data, nil
+func GetAllSnippetsByUserID(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, userID int) ([]DBsnippet, error) {
+	return querySnippets(ctx, dbConn, cs, View{}, "WHERE s.userid=$1 ORDER BY s.id", userID)
+}
 
+func GetPublicSnippets(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, limit, offset int, v View) ([]DBsnippet, error) {
+	return querySnippets(ctx, dbConn, cs, v, "WHERE "+publicSnippet+" ORDER BY s.id LIMIT $1 OFFSET $2", limit, offset)
 }
 
-func DeleteSnippet(dbConn *pgxpool.Pool, snippetID int) error {
-	tx, err := dbConn.Begin(context.Background())
+// DeleteSnippet removes a snippet owned by userID, or returns
+// ErrSnippetNotFound. Its blob is left to the garbage collector.
+func DeleteSnippet(ctx context.Context, dbConn *pgxpool.Pool, userID, snippetID int) error {
+	tag, err := dbConn.Exec(ctx, "DELETE FROM snippets WHERE id=$1 AND userid=$2", snippetID, userID)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback(context.Background())
 
-	_, err = dbConn.Exec(context.Background(), "DELETE FROM snippets WHERE id=$1", snippetID)
-	if err != nil {
-		return err
+	if tag.RowsAffected() == 0 {
+		return ErrSnippetNotFound
 	}
-	return tx.Commit(context.Background())
+	return nil
 }
 
-func GetSmallUserSnippets(dbConn *pgxpool.Pool, userID int) ([]SmallDBsnippet, error) {
-	var data []SmallDBsnippet
-	row, err := dbConn.Query(context.Background(), "SELECT id, language, title, favorite FROM snippets where userid=$1", userID)
-	if err != nil {
-		return nil, err
-	}
-
-	for row.Next() {
-		var snippet SmallDBsnippet
-		err = row.Scan(&snippet.ID, &snippet.Language, &snippet.Title, &snippet.Favorite)
-		if err != nil {
-			return nil, err
-		}
-
-		data = append(data, snippet)
-	}
-
-	return data, nil
+func GetSnippetByIDAndUserID(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, userID, snippetID int, v View) (*DBsnippet, error) {
+	q := newSnippetQuery(cs, v)
+	return q.scan(ctx, dbConn.QueryRow(ctx, q.sql()+" WHERE s.userid=$1 AND s.id=$2", userID, snippetID))
 }
 
-func GetSnippetByIDAndUserID(dbConn *pgxpool.Pool, userID, snippetID int) (*DBsnippet, error) {
-	var snippet DBsnippet
-	var code []byte
-	err := dbConn.QueryRow(context.Background(), "SELECT id, language, title, code, description, private, tags, created, updated, favorite FROM snippets WHERE userid=$1 AND id=$2", userID, snippetID).Scan(
-		&snippet.ID, &snippet.Language, &snippet.Title, &code, &snippet.Description,
-		&snippet.Private, &snippet.Tags, &snippet.Created, &snippet.Updated, &snippet.Favorite,
-	)
-	if err != nil {
-		return nil, err
+// GetPublicSnippetByID returns a public snippet, or ErrSnippetNotFound.
+func GetPublicSnippetByID(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, snippetID int, v View) (*DBsnippet, error) {
+	q := newSnippetQuery(cs, v)
+	snippet, err := q.scan(ctx, dbConn.QueryRow(ctx, q.sql()+" WHERE "+publicSnippet+" AND s.id=$1", snippetID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSnippetNotFound
 	}
+	return snippet, err
+}
 
-	decompressedData, err := cmp.DecompressZSTD(code)
+// UpdateUserSnippetByID changes the given fields of a snippet owned by
+// userID and returns its new update time. It returns ErrSnippetNotFound when
+// there is no such snippet, and ErrVaultMismatch when sealed is given for a
+// regular snippet or title, code, tags or description for a vault snippet,
+// and ErrUnknownBlob when code is a hash userID has no code for. When version
+// is set the snippet must not have been updated since, ErrSnippetChanged is
+// returned otherwise.
+func UpdateUserSnippetByID(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, userID, snippetID int, language *string, title *string, code *Code, favorite *bool, private *bool, tags *[]string, description *string, sealed *vault.Snippet, version *time.Time) (time.Time, error) {
+	var updated time.Time
+	tx, err := dbConn.Begin(ctx)
 	if err != nil {
-		return nil, err
+		return updated, err
 	}
+	defer tx.Rollback(ctx)
 
-	snippet.Code = string(decompressedData)
-	return &snippet, nil
-}
-
-func UpdateUserSnippetByID(dbConn *pgxpool.Pool, snippetID int, language *string, title *string, code *string, favorite *bool, private *bool, tags *[]string, description *string) error {
 	var builder strings.Builder
 	args := []interface{}{}
 	argIndex := 1
@@ -208,14 +154,19 @@ func UpdateUserSnippetByID(dbConn *pgxpool.Pool, snippetID int, language *string
 		if len(args) > 0 {
 			builder.WriteString(", ")
 		}
-		builder.WriteString(fmt.Sprintf(" code=$%d", argIndex))
+		builder.WriteString(fmt.Sprintf(" blob_id=$%d, code=NULL, key_id=NULL", argIndex))
+
+		lang, err := snippetLanguage(ctx, tx, userID, snippetID, language)
+		if err != nil {
+			return updated, err
+		}
 
-		newcode, err := compression.CompressZSTD([]byte(*code))
+		blobID, err := resolveCode(ctx, tx, cs, userID, lang, *code, false)
 		if err != nil {
-			return errors.New("failed to compress code snippet")
+			return updated, fmt.Errorf("failed to store code snippet: %w", err)
 		}
 
-		args = append(args, newcode)
+		args = append(args, blobID)
 		argIndex++
 	}
 
@@ -255,19 +206,92 @@ func UpdateUserSnippetByID(dbConn *pgxpool.Pool, snippetID int, language *string
 		argIndex++
 	}
 
+	if sealed != nil {
+		if len(args) > 0 {
+			builder.WriteString(", ")
+		}
+		builder.WriteString(fmt.Sprintf(" blob_id=$%d, code=NULL, key_id=NULL, vault_title=$%d, vault_description=$%d", argIndex, argIndex+1, argIndex+2))
+
+		blobID, err := storeBlob(ctx, tx, cs, userID, "", sealed.Code)
+		if err != nil {
+			return updated, fmt.Errorf("failed to store code snippet: %w", err)
+		}
+
+		args = append(args, blobID, sealed.Title, sealed.Description)
+		argIndex += 3
+	}
+
 	if len(args) == 0 {
-		return errors.New("no fields to update")
+		return updated, errors.New("no fields to update")
+	}
+
+	if sealed != nil && (title != nil || code != nil || tags != nil || description != nil) {
+		return updated, ErrVaultMismatch
 	}
 
-	builder.WriteString(fmt.Sprintf(" WHERE id=$%d", argIndex))
-	args = append(args, snippetID)
+	// Updates a microsecond apart, or a clock that went back, still give
+	// the snippet a new version.
+	builder.WriteString(fmt.Sprintf(", updated=GREATEST($%d, updated + interval '1 microsecond')", argIndex))
+	args = append(args, time.Now())
+	argIndex++
+
+	builder.WriteString(fmt.Sprintf(" WHERE id=$%d AND userid=$%d", argIndex, argIndex+1))
+	args = append(args, snippetID, userID)
+	argIndex += 2
+
+	if version != nil {
+		builder.WriteString(fmt.Sprintf(" AND updated=$%d", argIndex))
+		args = append(args, *version)
+	}
 
+	switch {
+	case sealed != nil:
+		builder.WriteString(" AND vault")
+	case title != nil || code != nil || tags != nil || description != nil:
+		builder.WriteString(" AND NOT vault")
+	}
+
+	builder.WriteString(" RETURNING updated")
 	query := builder.String()
 
-	_, err := dbConn.Exec(context.Background(), query, args...)
+	err = tx.QueryRow(ctx, query, args...).Scan(&updated)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var stored time.Time
+		err := tx.QueryRow(ctx, "SELECT updated FROM snippets WHERE id=$1 AND userid=$2", snippetID, userID).Scan(&stored)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return updated, ErrSnippetNotFound
+		case err != nil:
+			return updated, err
+		case version != nil && !stored.Equal(*version):
+			return updated, ErrSnippetChanged
+		}
+		return updated, ErrVaultMismatch
+	}
 	if err != nil {
-		return fmt.Errorf("failed to execute query: %w", err)
+		return updated, fmt.Errorf("failed to execute query: %w", err)
 	}
 
-	return nil
+	return updated, tx.Commit(ctx)
+}
+
+// snippetLanguage is the language new code of a snippet is compressed for,
+// the one being set by the same update or else the stored one. A missing
+// snippet gets "", the update itself reports it.
+func snippetLanguage(ctx context.Context, q querier, userID, snippetID int, language *string) (string, error) {
+	if language != nil {
+		return *language, nil
+	}
+
+	var stored string
+	err := q.QueryRow(ctx, "SELECT language FROM snippets WHERE id=$1 AND userid=$2", snippetID, userID).Scan(&stored)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return "", err
+	}
+	return stored, nil
+}
+
+func CountSnippets(ctx context.Context, dbConn *pgxpool.Pool) (total int, public int, err error) {
+	err = dbConn.QueryRow(ctx, "SELECT COUNT(*), COUNT(*) FILTER (WHERE private=false) FROM snippets").Scan(&total, &public)
+	return total, public, err
 }
@@ -0,0 +1,44 @@
+package dataaccess
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/scott-mescudi/codelet/service/data_access"
+
+// queryTracer opens a span around every statement pgx runs, as a child of
+// whatever span lives in the context the query was given.
+type queryTracer struct{}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = otel.Tracer(tracerName).Start(ctx, "db "+operation(data.SQL),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.statement", data.SQL),
+		),
+	)
+	return ctx
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	if data.Err != nil && data.Err != pgx.ErrNoRows {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	}
+	span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	span.End()
+}
+
+func operation(sql string) string {
+	op, _, _ := strings.Cut(strings.TrimSpace(sql), " ")
+	return strings.ToUpper(op)
+}
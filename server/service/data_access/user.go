@@ -2,34 +2,29 @@ package dataaccess
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func ConnectToDatabase(postgresURI string) (*pgxpool.Pool, error) {
-	config, err := pgxpool.ParseConfig(postgresURI)
-	if err != nil {
-		return nil, fmt.Errorf("unable to parse database URL: %w", err)
-	}
+var ErrUserNotFound = errors.New("user not found")
 
-	dbPool, err := pgxpool.NewWithConfig(context.Background(), config)
-	if err != nil {
-		return nil, fmt.Errorf("unable to create connection pool: %w", err)
-	}
+// Roles lists the values the users.role check constraint accepts.
+var Roles = []string{"admin", "moderator", "user"}
 
-	if err := dbPool.Ping(context.Background()); err != nil {
-		dbPool.Close()
-		return nil, fmt.Errorf("unable to ping database: %w", err)
+func ValidRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
 	}
-
-	return dbPool, nil
+	return false
 }
 
-func AddUser(dbConn *pgxpool.Pool, username, email, role, password string) error {
-	_, err := dbConn.Exec(context.Background(), "INSERT INTO users(username, email, role, password_hash) VALUES($1, $2, $3, $4)", username, email, role, password)
+func AddUser(ctx context.Context, dbConn *pgxpool.Pool, username, email, role, password string) error {
+	_, err := dbConn.Exec(ctx, "INSERT INTO users(username, email, role, password_hash) VALUES($1, $2, $3, $4)", username, email, role, password)
 	if err != nil {
 		return err
 	}
@@ -37,11 +32,11 @@ func AddUser(dbConn *pgxpool.Pool, username, email, role, password string) error
 	return nil
 }
 
-func GetUserPasswordHashAndLastLogin(dbConn *pgxpool.Pool, email string) (int, string, *time.Time, error) {
+func GetUserPasswordHashAndLastLogin(ctx context.Context, dbConn *pgxpool.Pool, email string) (int, string, *time.Time, error) {
 	var id int
 	var hash string
 	var ll pgtype.Timestamptz
-	row := dbConn.QueryRow(context.Background(), "SELECT password_hash, last_login, id FROM users WHERE email=$1", email)
+	row := dbConn.QueryRow(ctx, "SELECT password_hash, last_login, id FROM users WHERE email=$1 AND NOT disabled", email)
 	if err := row.Scan(&hash, &ll, &id); err != nil {
 		return -1, "", nil, err
 	}
@@ -54,9 +49,9 @@ func GetUserPasswordHashAndLastLogin(dbConn *pgxpool.Pool, email string) (int, s
 	return id, hash, lastLogin, nil
 }
 
-func GetUserPasswordHashViaID(dbConn *pgxpool.Pool, id int) (string, error) {
+func GetUserPasswordHashViaID(ctx context.Context, dbConn *pgxpool.Pool, id int) (string, error) {
 	var hash string
-	row := dbConn.QueryRow(context.Background(), "SELECT password_hash FROM users WHERE id=$1", id)
+	row := dbConn.QueryRow(ctx, "SELECT password_hash FROM users WHERE id=$1", id)
 	if err := row.Scan(&hash); err != nil {
 		return "", err
 	}
@@ -64,8 +59,8 @@ func GetUserPasswordHashViaID(dbConn *pgxpool.Pool, id int) (string, error) {
 	return hash, nil
 }
 
-func UpdatePassword(dbConn *pgxpool.Pool, passwordHash string, updatedAt time.Time, userID int) error {
-	_, err := dbConn.Exec(context.Background(), "UPDATE users SET password_hash=$1, updated=$2 WHERE id=$3", passwordHash, updatedAt, userID)
+func UpdatePassword(ctx context.Context, dbConn *pgxpool.Pool, passwordHash string, updatedAt time.Time, userID int) error {
+	_, err := dbConn.Exec(ctx, "UPDATE users SET password_hash=$1, updated=$2 WHERE id=$3", passwordHash, updatedAt, userID)
 	if err != nil {
 		return err
 	}
@@ -73,8 +68,10 @@ func UpdatePassword(dbConn *pgxpool.Pool, passwordHash string, updatedAt time.Ti
 	return nil
 }
 
-func UpdateTokenAndLoginTime(dbConn *pgxpool.Pool, acessToken string, loginTime time.Time, userID int) error {
-	_, err := dbConn.Exec(context.Background(), "UPDATE users SET refresh_token=$1, last_login=$2 WHERE id=$3", acessToken, loginTime, userID)
+// UpdateTokenAndLoginTime records a successful login. Signing in also calls
+// off a pending account deletion.
+func UpdateTokenAndLoginTime(ctx context.Context, dbConn *pgxpool.Pool, acessToken string, loginTime time.Time, userID int) error {
+	_, err := dbConn.Exec(ctx, "UPDATE users SET refresh_token=$1, last_login=$2, delete_after=NULL WHERE id=$3", acessToken, loginTime, userID)
 	if err != nil {
 		return err
 	}
@@ -82,8 +79,8 @@ func UpdateTokenAndLoginTime(dbConn *pgxpool.Pool, acessToken string, loginTime
 	return nil
 }
 
-func AddRefreshToken(dbConn *pgxpool.Pool, acessToken string, userID int) error {
-	_, err := dbConn.Exec(context.Background(), "UPDATE users SET refresh_token=$1 WHERE id=$2", acessToken, userID)
+func AddRefreshToken(ctx context.Context, dbConn *pgxpool.Pool, acessToken string, userID int) error {
+	_, err := dbConn.Exec(ctx, "UPDATE users SET refresh_token=$1 WHERE id=$2", acessToken, userID)
 	if err != nil {
 		return err
 	}
@@ -91,9 +88,9 @@ func AddRefreshToken(dbConn *pgxpool.Pool, acessToken string, userID int) error
 	return nil
 }
 
-func GetRefreshToken(dbConn *pgxpool.Pool, userID int) (string, error) {
+func GetRefreshToken(ctx context.Context, dbConn *pgxpool.Pool, userID int) (string, error) {
 	var refreshToken string
-	row := dbConn.QueryRow(context.Background(), "SELECT refresh_token FROM users WHERE id=$1", userID)
+	row := dbConn.QueryRow(ctx, "SELECT refresh_token FROM users WHERE id=$1 AND NOT disabled", userID)
 	if err := row.Scan(&refreshToken); err != nil {
 		return "", err
 	}
@@ -101,12 +98,90 @@ func GetRefreshToken(dbConn *pgxpool.Pool, userID int) (string, error) {
 	return refreshToken, nil
 }
 
-func GetUsernameByID(dbConn *pgxpool.Pool, userid int) (string,error){
+func GetUsernameByID(ctx context.Context, dbConn *pgxpool.Pool, userid int) (string, error) {
 	var username string
-	row := dbConn.QueryRow(context.Background(), "SELECT username FROM users WHERE id=$1", userid)
+	row := dbConn.QueryRow(ctx, "SELECT username FROM users WHERE id=$1", userid)
 	if err := row.Scan(&username); err != nil {
 		return "", err
 	}
 
 	return username, nil
-}
\ No newline at end of file
+}
+
+func GetUserRole(ctx context.Context, dbConn *pgxpool.Pool, userID int) (string, error) {
+	var role string
+	err := dbConn.QueryRow(ctx, "SELECT role FROM users WHERE id=$1 AND NOT disabled", userID).Scan(&role)
+	return role, err
+}
+
+func CountUsers(ctx context.Context, dbConn *pgxpool.Pool) (int, error) {
+	var total int
+	err := dbConn.QueryRow(ctx, "SELECT COUNT(*) FROM users").Scan(&total)
+	return total, err
+}
+
+func SetUserRole(ctx context.Context, dbConn *pgxpool.Pool, email, role string) error {
+	tag, err := dbConn.Exec(ctx, "UPDATE users SET role=$1, updated=$2 WHERE email=$3", role, time.Now(), email)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// ResetPassword replaces the password of the user with email and signs them
+// out everywhere by dropping their refresh token.
+func ResetPassword(ctx context.Context, dbConn *pgxpool.Pool, email, passwordHash string) error {
+	tag, err := dbConn.Exec(ctx, "UPDATE users SET password_hash=$1, refresh_token=NULL, updated=$2 WHERE email=$3", passwordHash, time.Now(), email)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// SetUserDisabled blocks or unblocks logins for the user with email. Disabling
+// also drops the refresh token, so the account is locked out once its
+// current access token expires.
+func SetUserDisabled(ctx context.Context, dbConn *pgxpool.Pool, email string, disabled bool) error {
+	tag, err := dbConn.Exec(ctx, "UPDATE users SET disabled=$1, refresh_token=CASE WHEN $1 THEN NULL ELSE refresh_token END, updated=$2 WHERE email=$3", disabled, time.Now(), email)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// ScheduleUserDeletion marks the account for deletion at deleteAfter, signs
+// it out and hides its public snippets. DeleteExpiredUsers removes it once
+// that time has passed unless a login cancelled it first.
+func ScheduleUserDeletion(ctx context.Context, dbConn *pgxpool.Pool, userID int, deleteAfter time.Time) error {
+	tag, err := dbConn.Exec(ctx, "UPDATE users SET delete_after=$1, refresh_token=NULL WHERE id=$2", deleteAfter, userID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// DeleteExpiredUsers deletes accounts whose grace period ended before now,
+// their snippets go with them through ON DELETE CASCADE.
+func DeleteExpiredUsers(ctx context.Context, dbConn *pgxpool.Pool, now time.Time) (int64, error) {
+	tag, err := dbConn.Exec(ctx, "DELETE FROM users WHERE delete_after <= $1", now)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,78 @@
+package dataaccess
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/scott-mescudi/codelet/shared/vault"
+)
+
+var (
+	ErrNoVault = errors.New("user has no vault")
+	// ErrVaultInUse means the vault header can't change because snippets
+	// are encrypted with the key it describes.
+	ErrVaultInUse = errors.New("vault has snippets")
+	// ErrVaultMismatch is returned when plain fields are sent for a vault
+	// snippet or sealed ones for a regular snippet.
+	ErrVaultMismatch = errors.New("snippet is of the other kind")
+)
+
+func GetVault(ctx context.Context, dbConn *pgxpool.Pool, userID int) (*vault.Header, error) {
+	var h *vault.Header
+	err := dbConn.QueryRow(ctx, "SELECT vault FROM users WHERE id=$1", userID).Scan(&h)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if h == nil {
+		return nil, ErrNoVault
+	}
+	return h, nil
+}
+
+// SetVault stores the vault header of userID. It can be replaced as long as
+// no vault snippets exist, after that the passphrase is fixed.
+func SetVault(ctx context.Context, dbConn *pgxpool.Pool, userID int, h *vault.Header) error {
+	tag, err := dbConn.Exec(ctx, "UPDATE users SET vault=$1, updated=$2 WHERE id=$3 AND NOT EXISTS (SELECT 1 FROM snippets WHERE userid=$3 AND vault)", h, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrVaultInUse
+	}
+	return nil
+}
+
+// AddVaultSnippet stores a snippet the client encrypted. Vault snippets are
+// always private. It returns ErrNoVault when userID hasn't set up a vault.
+func AddVaultSnippet(ctx context.Context, dbConn *pgxpool.Pool, cs *CodeStore, userID int, language string, sealed *vault.Snippet, favorite bool, created, updated time.Time) error {
+	tx, err := dbConn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Client side encrypted code doesn't compress, a dictionary won't help.
+	blobID, err := storeBlob(ctx, tx, cs, userID, "", sealed.Code)
+	if err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, "INSERT INTO snippets(userid, language, title, description, blob_id, vault, vault_title, vault_description, private, created, updated, favorite) SELECT $1, $2, '', '', $3, true, $4, $5, true, $6, $7, $8 WHERE EXISTS (SELECT 1 FROM users WHERE id=$1 AND vault IS NOT NULL)",
+		userID, language, blobID, sealed.Title, sealed.Description, created, updated, favorite)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoVault
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,113 @@
+package dataaccess
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrSnippetChanged is returned when a snippet was updated since the
+// version an update was based on.
+var ErrSnippetChanged = errors.New("snippet changed since it was read")
+
+// PageVersion identifies a page of snippets. It changes when any snippet on
+// the page is updated, or when the page holds other snippets.
+type PageVersion struct {
+	// Tag is a hash of the ids and update times of the snippets.
+	Tag string
+	// Modified is the latest update time of the snippets.
+	Modified time.Time
+	// Snippets is how many snippets are on the page.
+	Snippets int
+}
+
+// pageVersion hashes the id and update time of each snippet in order.
+type pageVersion struct {
+	buf      []byte
+	modified time.Time
+	n        int
+}
+
+func (p *pageVersion) add(id int, updated time.Time) {
+	p.buf = binary.BigEndian.AppendUint64(p.buf, uint64(id))
+	p.buf = binary.BigEndian.AppendUint64(p.buf, uint64(updated.UnixMicro()))
+	if updated.After(p.modified) {
+		p.modified = updated
+	}
+	p.n++
+}
+
+func (p *pageVersion) version() PageVersion {
+	sum := sha256.Sum256(p.buf)
+	return PageVersion{Tag: hex.EncodeToString(sum[:16]), Modified: p.modified, Snippets: p.n}
+}
+
+// VersionOf returns the version of snippets as read by the Get functions,
+// the same one the Version functions return for that page.
+func VersionOf(snippets []DBsnippet) PageVersion {
+	var p pageVersion
+	for _, s := range snippets {
+		p.add(s.ID, s.Updated)
+	}
+	return p.version()
+}
+
+func queryVersion(ctx context.Context, dbConn *pgxpool.Pool, where string, args ...any) (PageVersion, error) {
+	rows, err := dbConn.Query(ctx, "SELECT s.id, s.updated FROM snippets s "+where, args...)
+	if err != nil {
+		return PageVersion{}, err
+	}
+	defer rows.Close()
+
+	var p pageVersion
+	var id int
+	var updated time.Time
+	_, err = pgx.ForEachRow(rows, []any{&id, &updated}, func() error {
+		p.add(id, updated)
+		return nil
+	})
+	if err != nil {
+		return PageVersion{}, err
+	}
+	return p.version(), nil
+}
+
+// UserSnippetsVersion is the version of the page GetSnippetsByUserID reads,
+// without reading any code.
+func UserSnippetsVersion(ctx context.Context, dbConn *pgxpool.Pool, userID, limit, offset int) (PageVersion, error) {
+	return queryVersion(ctx, dbConn, "WHERE s.userid=$1 ORDER BY s.id LIMIT NULLIF($2, 0) OFFSET $3", userID, limit, offset)
+}
+
+// PublicSnippetsVersion is the version of the page GetPublicSnippets reads,
+// without reading any code.
+func PublicSnippetsVersion(ctx context.Context, dbConn *pgxpool.Pool, limit, offset int) (PageVersion, error) {
+	return queryVersion(ctx, dbConn, "WHERE "+publicSnippet+" ORDER BY s.id LIMIT $1 OFFSET $2", limit, offset)
+}
+
+// SnippetVersion returns when a snippet owned by userID was last updated, or
+// ErrSnippetNotFound.
+func SnippetVersion(ctx context.Context, dbConn *pgxpool.Pool, userID, snippetID int) (time.Time, error) {
+	var updated time.Time
+	err := dbConn.QueryRow(ctx, "SELECT updated FROM snippets WHERE id=$1 AND userid=$2", snippetID, userID).Scan(&updated)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, ErrSnippetNotFound
+	}
+	return updated, err
+}
+
+// PublicSnippetVersion returns when a public snippet was last updated, or
+// ErrSnippetNotFound.
+func PublicSnippetVersion(ctx context.Context, dbConn *pgxpool.Pool, snippetID int) (time.Time, error) {
+	var updated time.Time
+	err := dbConn.QueryRow(ctx, "SELECT s.updated FROM snippets s WHERE s.id=$1 AND "+publicSnippet, snippetID).Scan(&updated)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, ErrSnippetNotFound
+	}
+	return updated, err
+}
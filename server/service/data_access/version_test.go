@@ -0,0 +1,36 @@
+package dataaccess
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVersionOf(t *testing.T) {
+	t0 := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	page := []DBsnippet{{ID: 1, Updated: t0}, {ID: 2, Updated: t0.Add(time.Minute)}}
+	base := VersionOf(page)
+
+	if base.Snippets != 2 || !base.Modified.Equal(t0.Add(time.Minute)) {
+		t.Fatalf("got %+v", base)
+	}
+
+	tests := []struct {
+		name string
+		page []DBsnippet
+		same bool
+	}{
+		{name: "Same", page: []DBsnippet{{ID: 1, Updated: t0}, {ID: 2, Updated: t0.Add(time.Minute)}}, same: true},
+		{name: "Other fields", page: []DBsnippet{{ID: 1, Updated: t0, Title: "x"}, {ID: 2, Updated: t0.Add(time.Minute)}}, same: true},
+		{name: "Updated", page: []DBsnippet{{ID: 1, Updated: t0.Add(time.Microsecond)}, {ID: 2, Updated: t0.Add(time.Minute)}}},
+		{name: "Removed", page: []DBsnippet{{ID: 2, Updated: t0.Add(time.Minute)}}},
+		{name: "Replaced", page: []DBsnippet{{ID: 1, Updated: t0}, {ID: 3, Updated: t0.Add(time.Minute)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VersionOf(tt.page).Tag == base.Tag; got != tt.same {
+				t.Errorf("same tag: got %v, want %v", got, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	jsoniter "github.com/json-iterator/go"
+	dataAccess "github.com/scott-mescudi/codelet/service/data_access"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// Health serves the liveness and readiness probes. Liveness only says the
+// process is serving, readiness also needs a reachable database on the
+// schema this binary was built for, and turns false as soon as shutdown
+// starts so load balancers stop sending new requests.
+type Health struct {
+	Db       *pgxpool.Pool
+	Timeout  time.Duration
+	draining atomic.Bool
+}
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		writeHealth(w, http.StatusServiceUnavailable, healthResponse{Status: "draining"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.Timeout)
+	defer cancel()
+
+	res := healthResponse{Status: "ok", Checks: map[string]string{"database": "ok", "migrations": "ok"}}
+	if err := h.Db.Ping(ctx); err != nil {
+		res.Checks["database"] = "unreachable"
+		res.Checks["migrations"] = "unknown"
+	} else if version, err := dataAccess.SchemaVersion(ctx, h.Db); err != nil {
+		res.Checks["migrations"] = "unknown"
+	} else if latest := dataAccess.LatestSchemaVersion(); version != latest {
+		res.Checks["migrations"] = fmt.Sprintf("schema at version %d, expected %d", version, latest)
+	}
+
+	code := http.StatusOK
+	for _, v := range res.Checks {
+		if v != "ok" {
+			res.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+		}
+	}
+
+	writeHealth(w, code, res)
+}
+
+// Drain marks the server as shutting down, Ready fails from then on.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+func writeHealth(w http.ResponseWriter, code int, res healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthProbes(t *testing.T) {
+	h := &Health{Timeout: time.Second}
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		drain    bool
+		expected int
+		body     string
+	}{
+		{name: "Live", handler: h.Live, expected: http.StatusOK, body: `"status":"ok"`},
+		{name: "Ready while draining", handler: h.Ready, drain: true, expected: http.StatusServiceUnavailable, body: `"status":"draining"`},
+		{name: "Live while draining", handler: h.Live, drain: true, expected: http.StatusOK, body: `"status":"ok"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.drain {
+				h.Drain()
+			}
+
+			rw := httptest.NewRecorder()
+			tt.handler(rw, httptest.NewRequest("GET", "/", nil))
+
+			if rw.Code != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, rw.Code)
+			}
+			if !strings.Contains(rw.Body.String(), tt.body) {
+				t.Errorf("expected body to contain %s, got %s", tt.body, rw.Body.String())
+			}
+		})
+	}
+}
+
+func TestShutdownDrainsInFlight(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(ln)
+
+	closed := false
+	c := &Codelet{Health: &Health{}, closers: []func(){func() { closed = true }}}
+
+	body := make(chan string, 1)
+	go func() {
+		res, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		b := make([]byte, 4)
+		n, _ := res.Body.Read(b)
+		body <- string(b[:n])
+	}()
+	<-started
+
+	done := make(chan error, 1)
+	go func() { done <- c.Shutdown(context.Background(), server) }()
+
+	time.Sleep(20 * time.Millisecond)
+	if !c.Health.draining.Load() {
+		t.Error("readiness was not failed before draining")
+	}
+	close(release)
+
+	if err := <-done; err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if got := <-body; got != "done" {
+		t.Errorf("in-flight request was cut off: %q", got)
+	}
+	if !closed {
+		t.Error("resources were not released after shutdown")
+	}
+}
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rs/zerolog"
+	"github.com/scott-mescudi/codelet/service/config"
+)
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// New builds the server logger described by cfg. Everything it writes passes
+// through a Redactor. The returned closer releases the log file, if any.
+func New(cfg config.Log) (zerolog.Logger, io.Closer, error) {
+	level, err := zerolog.ParseLevel(cfg.Level)
+	if err != nil {
+		return zerolog.Nop(), nil, fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+	}
+
+	var sink io.Writer
+	var closer io.Closer = nopCloser{}
+
+	switch cfg.Sink {
+	case "stdout":
+		sink = os.Stdout
+	case "stderr":
+		sink = os.Stderr
+	case "file":
+		file, err := OpenRotatingFile(RotateOptions{
+			Path:        cfg.Path,
+			MaxSize:     int64(cfg.MaxSizeMB) << 20,
+			RotateEvery: cfg.RotateEvery,
+			MaxBackups:  cfg.MaxBackups,
+			MaxAge:      cfg.MaxAge,
+		})
+		if err != nil {
+			return zerolog.Nop(), nil, err
+		}
+		sink, closer = file, file
+	default:
+		return zerolog.Nop(), nil, fmt.Errorf("unknown log sink %q", cfg.Sink)
+	}
+
+	logger := zerolog.New(NewRedactor(sink)).Level(level).With().Timestamp().Logger()
+	return logger, closer, nil
+}
@@ -0,0 +1,158 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// Keys whose values are always masked, matched case-insensitively anywhere
+// in the field name.
+var sensitiveKeys = []string{
+	"password", "passwd", "secret", "token", "authorization", "cookie",
+	"api_key", "apikey", "private_key", "database_url", "database uri", "dsn",
+}
+
+var (
+	urlCredentials = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^:/@\s]+:)[^@/\s]+@`)
+	bearerToken    = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`)
+	jwtToken       = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	emailAddress   = regexp.MustCompile(`\b([A-Za-z0-9._%+-])[A-Za-z0-9._%+-]*@([A-Za-z0-9.-]+\.[A-Za-z]{2,})\b`)
+)
+
+// Redactor masks credentials, tokens and email addresses in JSON log lines
+// before passing them on. It works on the encoded output rather than as a
+// zerolog hook because hooks can't see fields that were already added.
+type Redactor struct {
+	next io.Writer
+}
+
+func NewRedactor(next io.Writer) *Redactor {
+	return &Redactor{next: next}
+}
+
+func (r *Redactor) Write(p []byte) (int, error) {
+	out, err := RedactJSON(p)
+	if err != nil {
+		// Not JSON, e.g. a console writer. Fall back to the string patterns.
+		out = []byte(RedactString(string(p)))
+	}
+
+	if _, err := r.next.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// RedactString masks secrets that can be recognised by their shape alone.
+func RedactString(s string) string {
+	s = urlCredentials.ReplaceAllString(s, "${1}"+redacted+"@")
+	s = bearerToken.ReplaceAllString(s, "${1} "+redacted)
+	s = jwtToken.ReplaceAllString(s, redacted)
+	s = emailAddress.ReplaceAllString(s, "${1}***@${2}")
+	return s
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range sensitiveKeys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactJSON rewrites one JSON document, keeping the field order intact.
+func RedactJSON(p []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+
+	var buf bytes.Buffer
+	buf.Grow(len(p))
+	if err := redactValue(dec, &buf, false); err != nil {
+		return nil, err
+	}
+
+	// Keep the trailing newline zerolog writes after every event.
+	if bytes.HasSuffix(p, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func redactValue(dec *json.Decoder, buf *bytes.Buffer, sensitive bool) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch v := tok.(type) {
+	case json.Delim:
+		closing := byte('}')
+		if v == '[' {
+			closing = ']'
+		}
+		buf.WriteByte(byte(v))
+
+		for first := true; dec.More(); first = false {
+			if !first {
+				buf.WriteByte(',')
+			}
+
+			childSensitive := sensitive
+			if v == '{' {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				key := keyTok.(string)
+				writeString(buf, key)
+				buf.WriteByte(':')
+				childSensitive = sensitive || isSensitiveKey(key)
+			}
+
+			if err := redactValue(dec, buf, childSensitive); err != nil {
+				return err
+			}
+		}
+
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		buf.WriteByte(closing)
+	case string:
+		if sensitive && v != "" {
+			writeString(buf, redacted)
+		} else {
+			writeString(buf, RedactString(v))
+		}
+	case json.Number:
+		if sensitive {
+			writeString(buf, redacted)
+		} else {
+			buf.WriteString(v.String())
+		}
+	case bool:
+		if v {
+			buf.WriteString("true")
+		} else {
+			buf.WriteString("false")
+		}
+	case nil:
+		buf.WriteString("null")
+	}
+
+	return nil
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	buf.Truncate(buf.Len() - 1) // Encode appends a newline
+}
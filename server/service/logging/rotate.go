@@ -0,0 +1,157 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "20060102T150405.000"
+
+type RotateOptions struct {
+	Path string
+	// MaxSize rotates the file before a write would grow it past this many
+	// bytes. Zero disables size based rotation.
+	MaxSize int64
+	// RotateEvery rotates the file once it has been open this long. Zero
+	// disables time based rotation.
+	RotateEvery time.Duration
+	// MaxBackups and MaxAge bound how many rotated files are kept and for how
+	// long. Zero means no limit.
+	MaxBackups int
+	MaxAge     time.Duration
+}
+
+// RotatingFile is an io.Writer over a log file that moves the file aside to
+// <name>-<timestamp><ext> when it grows too large or too old.
+type RotatingFile struct {
+	opts RotateOptions
+	now  func() time.Time
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func OpenRotatingFile(opts RotateOptions) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	rf := &RotatingFile{opts: opts, now: time.Now}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	file, err := os.OpenFile(rf.opts.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+
+	rf.file = file
+	rf.size = info.Size()
+	rf.opened = rf.now()
+	return nil
+}
+
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	tooBig := rf.opts.MaxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.opts.MaxSize
+	tooOld := rf.opts.RotateEvery > 0 && rf.now().Sub(rf.opened) >= rf.opts.RotateEvery
+	if tooBig || tooOld {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
+
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(rf.opts.Path)
+	base := strings.TrimSuffix(rf.opts.Path, ext)
+	backup := base + "-" + rf.now().UTC().Format(backupTimeFormat) + ext
+	if err := os.Rename(rf.opts.Path, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	rf.prune(base, ext)
+	return nil
+}
+
+// prune deletes rotated files past the retention limits. Backup names sort
+// chronologically, so the newest ones are at the end.
+func (rf *RotatingFile) prune(base, ext string) {
+	backups, err := filepath.Glob(base + "-*" + ext)
+	if err != nil {
+		return
+	}
+
+	var stamped []string
+	for _, b := range backups {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(b, base+"-"), ext)
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			stamped = append(stamped, b)
+		}
+	}
+	sort.Strings(stamped)
+
+	cutoff := rf.now().Add(-rf.opts.MaxAge)
+	for i, b := range stamped {
+		expired := rf.opts.MaxAge > 0 && rf.backupTime(b, base, ext).Before(cutoff)
+		excess := rf.opts.MaxBackups > 0 && i < len(stamped)-rf.opts.MaxBackups
+		if expired || excess {
+			os.Remove(b)
+		}
+	}
+}
+
+func (rf *RotatingFile) backupTime(path, base, ext string) time.Time {
+	stamp := strings.TrimSuffix(strings.TrimPrefix(path, base+"-"), ext)
+	t, _ := time.Parse(backupTimeFormat, stamp)
+	return t
+}
@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rf, err := OpenRotatingFile(RotateOptions{
+		Path:        filepath.Join(dir, "server.json"),
+		MaxSize:     10,
+		RotateEvery: time.Hour,
+		MaxBackups:  2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	rf.now = func() time.Time { return now }
+	rf.opened = now
+
+	write := func(s string) {
+		t.Helper()
+		if _, err := rf.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+
+	write("12345\n")
+	write("12345\n") // over MaxSize, rotates first
+	now = now.Add(2 * time.Hour)
+	write("abc\n") // too old, rotates first
+	write("12345678\n")
+	write("x\n")
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "server-*.json"))
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups after pruning, got %v", backups)
+	}
+
+	current, err := os.ReadFile(filepath.Join(dir, "server.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(current) != "x\n" {
+		t.Errorf("current file = %q, want %q", current, "x\n")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "server.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0007 != 0 {
+		t.Errorf("log file is world accessible: %v", info.Mode())
+	}
+
+	newest, _ := os.ReadFile(backups[1])
+	if !strings.HasPrefix(string(newest), "12345678") {
+		t.Errorf("newest backup = %q", newest)
+	}
+}
+
+func TestRotatingFileMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "server-20000101T000000.000.json")
+	if err := os.WriteFile(old, []byte("old\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	rf, err := OpenRotatingFile(RotateOptions{Path: filepath.Join(dir, "server.json"), MaxSize: 1, MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	rf.Write([]byte("first\n"))
+	rf.Write([]byte("second\n"))
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("expired backup was not removed")
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	dataAccess "github.com/scott-mescudi/codelet/service/data_access"
+	errs "github.com/scott-mescudi/codelet/shared/errors"
+)
+
+type readOnlyState struct {
+	Enabled *bool `json:"enabled"`
+}
+
+func (c *Codelet) readOnlyState(w http.ResponseWriter, r *http.Request) {
+	enabled := c.ReadOnly.Enabled()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(readOnlyState{Enabled: &enabled})
+}
+
+func (c *Codelet) setReadOnly(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var state readOnlyState
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&state); err != nil || state.Enabled == nil {
+		errs.ErrorWithJson(w, http.StatusBadRequest, `expected {"enabled": true|false}`)
+		return
+	}
+
+	if c.ReadOnly.Set(*state.Enabled) {
+		c.Logger.Warn().Bool("read_only", *state.Enabled).Str("origin", r.RemoteAddr).Msg("Read-only mode changed")
+	}
+
+	c.readOnlyState(w, r)
+}
+
+// sweepInterval is how often accounts past their deletion grace period and
+// unused code blobs are removed.
+const sweepInterval = time.Hour
+
+// blobGrace is how long a blob nothing points at is kept. Within it a client
+// that just learnt the blob's hash can still reference it.
+const blobGrace = time.Hour
+
+// sweep removes accounts whose deletion grace period ran out, then the code
+// blobs they and deleted snippets no longer need and idle rate limit
+// buckets, until ctx is cancelled. Sweeps are skipped in read-only mode.
+func (c *Codelet) sweep(ctx context.Context, interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if !c.ReadOnly.Enabled() {
+			sweepCtx, cancel := context.WithTimeout(ctx, timeout)
+			deleted, err := dataAccess.DeleteExpiredUsers(sweepCtx, c.Db, time.Now())
+			switch {
+			case err != nil && ctx.Err() == nil:
+				c.Logger.Error().Err(err).Msg("Failed to delete expired accounts")
+			case deleted > 0:
+				c.Logger.Info().Int64("accounts", deleted).Msg("Deleted accounts past their grace period")
+			}
+
+			blobs, err := dataAccess.DeleteUnusedBlobs(sweepCtx, c.Db, time.Now().Add(-blobGrace))
+			switch {
+			case err != nil && ctx.Err() == nil:
+				c.Logger.Error().Err(err).Msg("Failed to delete unused code blobs")
+			case blobs > 0:
+				c.Logger.Info().Int64("blobs", blobs).Msg("Deleted unused code blobs")
+			}
+
+			if c.rateLimitIdle > 0 {
+				buckets, err := dataAccess.DeleteIdleRateLimits(sweepCtx, c.Db, time.Now().Add(-c.rateLimitIdle))
+				switch {
+				case err != nil && ctx.Err() == nil:
+					c.Logger.Error().Err(err).Msg("Failed to delete idle rate limit buckets")
+				case buckets > 0:
+					c.Logger.Info().Int64("buckets", buckets).Msg("Deleted idle rate limit buckets")
+				}
+			}
+			cancel()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
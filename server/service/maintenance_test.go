@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	adminMethods "github.com/scott-mescudi/codelet/service/api/admin"
+	snippetMethods "github.com/scott-mescudi/codelet/service/api/snippets"
+	userMethods "github.com/scott-mescudi/codelet/service/api/users"
+	"github.com/scott-mescudi/codelet/service/config"
+	"github.com/scott-mescudi/codelet/service/middleware"
+	auth "github.com/scott-mescudi/codelet/shared/auth"
+	"github.com/scott-mescudi/codelet/shared/ratelimit"
+)
+
+// testSecret signs the tokens of the tests.
+var testSecret = []byte("codelet-test-secret-codelet-test-secret")
+
+func TestSetReadOnly(t *testing.T) {
+	c := &Codelet{ReadOnly: &middleware.ReadOnly{}}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+		enabled  bool
+	}{
+		{name: "Enable", body: `{"enabled": true}`, expected: http.StatusOK, enabled: true},
+		{name: "Missing field", body: `{}`, expected: http.StatusBadRequest, enabled: true},
+		{name: "Disable", body: `{"enabled": false}`, expected: http.StatusOK, enabled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			c.setReadOnly(rw, httptest.NewRequest("PUT", "/read-only", strings.NewReader(tt.body)))
+
+			if rw.Code != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, rw.Code)
+			}
+			if c.ReadOnly.Enabled() != tt.enabled {
+				t.Errorf("expected read-only %v", tt.enabled)
+			}
+		})
+	}
+}
+
+// The services have no database, a guarded route that reaches its handler
+// while read-only panics on the nil pool. Login and refresh are let through
+// and stop before the database on these requests.
+func TestReadOnlyRoutes(t *testing.T) {
+	c := &Codelet{ReadOnly: &middleware.ReadOnly{}, Health: &Health{}}
+	c.ReadOnly.Set(true)
+	rl := &middleware.RateLimiter{Store: ratelimit.NewMemoryStore()}
+	app := c.routes(config.Default(), rl, userMethods.UserService{JWTSecret: testSecret, ReadOnly: c.ReadOnly}, snippetMethods.SnippetService{}, adminMethods.AdminService{})
+
+	csrf := auth.GenerateCSRFToken()
+	access := auth.GenerateHMac(testSecret, 1, middleware.ACCESS, time.Now().Add(time.Minute))
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		headers  map[string]string
+		expected int
+	}{
+		{name: "Register", path: "/api/v1/register", body: `{"username": "john", "password": "secret"}`, expected: http.StatusServiceUnavailable},
+		{name: "Login", path: "/api/v1/login", body: `{"username": "john", "password": "secret"}`, expected: http.StatusUnprocessableEntity},
+		{name: "Refresh", path: "/api/v1/refresh", headers: map[string]string{"Cookie": auth.CSRFCookieName + "=" + csrf, auth.CSRFHeaderName: csrf}, expected: http.StatusUnauthorized},
+		{name: "Logout", path: "/api/v1/logout", headers: map[string]string{"Authorization": access}, expected: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			rw := httptest.NewRecorder()
+			app.ServeHTTP(rw, req)
+
+			if rw.Code != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, rw.Code)
+			}
+		})
+	}
+}
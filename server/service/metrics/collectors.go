@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	dba "github.com/scott-mescudi/codelet/service/data_access"
+)
+
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquired      *prometheus.Desc
+	idle          *prometheus.Desc
+	total         *prometheus.Desc
+	max           *prometheus.Desc
+	acquires      *prometheus.Desc
+	waited        *prometheus.Desc
+	canceled      *prometheus.Desc
+	acquireWait   *prometheus.Desc
+	newConns      *prometheus.Desc
+	destroyedIdle *prometheus.Desc
+}
+
+// NewPoolCollector exports pgxpool statistics, read fresh on every scrape.
+func NewPoolCollector(pool *pgxpool.Pool) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+
+	return &poolCollector{
+		pool:          pool,
+		acquired:      desc("acquired_connections", "Connections currently checked out of the pool."),
+		idle:          desc("idle_connections", "Idle connections in the pool."),
+		total:         desc("total_connections", "Open connections, acquired, idle and being constructed."),
+		max:           desc("max_connections", "Maximum size of the pool."),
+		acquires:      desc("acquires_total", "Successful connection acquires."),
+		waited:        desc("empty_acquires_total", "Acquires that had to wait because no connection was idle."),
+		canceled:      desc("canceled_acquires_total", "Acquires canceled by their context."),
+		acquireWait:   desc("acquire_wait_seconds_total", "Total time spent waiting to acquire a connection."),
+		newConns:      desc("new_connections_total", "Connections opened."),
+		destroyedIdle: desc("idle_destroyed_total", "Connections closed for exceeding the idle time."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.waited, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceled, prometheus.CounterValue, float64(s.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireWait, prometheus.CounterValue, s.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.newConns, prometheus.CounterValue, float64(s.NewConnsCount()))
+	ch <- prometheus.MustNewConstMetric(c.destroyedIdle, prometheus.CounterValue, float64(s.MaxIdleDestroyCount()))
+}
+
+// businessCollector reports row counts. The queries are cached for ttl so a
+// tight scrape interval doesn't turn into a table scan every few seconds.
+type businessCollector struct {
+	db     *pgxpool.Pool
+	ttl    time.Duration
+	logger zerolog.Logger
+
+	snippets       *prometheus.Desc
+	publicSnippets *prometheus.Desc
+	users          *prometheus.Desc
+
+	mu        sync.Mutex
+	fetched   time.Time
+	counts    [3]float64
+	haveCount bool
+}
+
+func NewBusinessCollector(db *pgxpool.Pool, ttl time.Duration, logger zerolog.Logger) prometheus.Collector {
+	return &businessCollector{
+		db:             db,
+		ttl:            ttl,
+		logger:         logger,
+		snippets:       prometheus.NewDesc(namespace+"_snippets", "Stored snippets.", nil, nil),
+		publicSnippets: prometheus.NewDesc(namespace+"_public_snippets", "Stored snippets visible to everyone.", nil, nil),
+		users:          prometheus.NewDesc(namespace+"_users", "Registered users.", nil, nil),
+	}
+}
+
+func (c *businessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.snippets
+	ch <- c.publicSnippets
+	ch <- c.users
+}
+
+func (c *businessCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.haveCount || time.Since(c.fetched) > c.ttl {
+		if err := c.refresh(); err != nil {
+			c.logger.Warn().Err(err).Msg("failed to refresh business metrics")
+		}
+	}
+
+	if !c.haveCount {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.snippets, prometheus.GaugeValue, c.counts[0])
+	ch <- prometheus.MustNewConstMetric(c.publicSnippets, prometheus.GaugeValue, c.counts[1])
+	ch <- prometheus.MustNewConstMetric(c.users, prometheus.GaugeValue, c.counts[2])
+}
+
+func (c *businessCollector) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	total, public, err := dba.CountSnippets(ctx, c.db)
+	if err != nil {
+		return err
+	}
+
+	users, err := dba.CountUsers(ctx, c.db)
+	if err != nil {
+		return err
+	}
+
+	c.counts = [3]float64{float64(total), float64(public), float64(users)}
+	c.fetched = time.Now()
+	c.haveCount = true
+	return nil
+}
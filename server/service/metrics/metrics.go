@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/scott-mescudi/codelet/shared/compression"
+)
+
+const namespace = "codelet"
+
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	requests    *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+	inFlight    prometheus.Gauge
+	zstdBytes   *prometheus.CounterVec
+	zstdSeconds *prometheus.HistogramVec
+	zstdErrors  *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route pattern, method and status code.",
+		}, []string{"route", "method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests currently being served.",
+		}),
+		zstdBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "zstd_bytes_total",
+			Help:      "Bytes passed through zstd, by operation and side (in or out).",
+		}, []string{"op", "side"}),
+		zstdSeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "zstd_duration_seconds",
+			Help:      "Time spent in a single zstd compress or decompress call.",
+			Buckets:   []float64{.00001, .00005, .0001, .00025, .0005, .001, .0025, .005, .01, .05},
+		}, []string{"op"}),
+		zstdErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "zstd_errors_total",
+			Help:      "Failed zstd calls by operation.",
+		}, []string{"op"}),
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.duration, m.inFlight,
+		m.zstdBytes, m.zstdSeconds, m.zstdErrors,
+	)
+
+	return m
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// Middleware records every request under the route pattern the ServeMux
+// matched, so paths like /snippets/{id} don't explode label cardinality.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		rw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+
+		m.requests.WithLabelValues(route, r.Method, strconv.Itoa(rw.Status())).Inc()
+		m.duration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+func (m *Metrics) ObserveCompression(op string, in, out int, took time.Duration, err error) {
+	if err != nil {
+		m.zstdErrors.WithLabelValues(op).Inc()
+		return
+	}
+
+	m.zstdBytes.WithLabelValues(op, "in").Add(float64(in))
+	m.zstdBytes.WithLabelValues(op, "out").Add(float64(out))
+	m.zstdSeconds.WithLabelValues(op).Observe(took.Seconds())
+}
+
+var _ compression.Observer = (*Metrics)(nil)
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 && code >= 200 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
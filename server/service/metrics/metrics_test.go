@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/scott-mescudi/codelet/shared/compression"
+)
+
+func TestMiddleware(t *testing.T) {
+	m := New()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /snippets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	handler := m.Middleware(mux)
+
+	tests := []struct {
+		path  string
+		route string
+		code  string
+	}{
+		{path: "/snippets/1", route: "GET /snippets/{id}", code: "202"},
+		{path: "/snippets/2", route: "GET /snippets/{id}", code: "202"},
+		{path: "/nope", route: "unmatched", code: "404"},
+	}
+
+	for _, tt := range tests {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.path, nil))
+	}
+
+	if got := testutil.ToFloat64(m.requests.WithLabelValues("GET /snippets/{id}", "GET", "202")); got != 2 {
+		t.Errorf("expected 2 requests for the pattern, got %v", got)
+	}
+
+	if got := testutil.ToFloat64(m.requests.WithLabelValues("unmatched", "GET", "404")); got != 1 {
+		t.Errorf("expected 1 unmatched request, got %v", got)
+	}
+
+	if got := testutil.CollectAndCount(m.duration); got != 2 {
+		t.Errorf("expected 2 latency series, got %d", got)
+	}
+}
+
+func TestCompressionMetrics(t *testing.T) {
+	m := New()
+	compression.SetObserver(m)
+	defer compression.SetObserver(nil)
+
+	data, err := compression.CompressZSTD([]byte(strings.Repeat("codelet ", 100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := compression.DecompressZSTD(data); err != nil {
+		t.Fatal(err)
+	}
+
+	compression.DecompressZSTD([]byte("not zstd"))
+
+	if got := testutil.ToFloat64(m.zstdBytes.WithLabelValues(compression.OpCompress, "in")); got != 800 {
+		t.Errorf("expected 800 bytes compressed, got %v", got)
+	}
+
+	if got := testutil.ToFloat64(m.zstdBytes.WithLabelValues(compression.OpDecompress, "out")); got != 800 {
+		t.Errorf("expected 800 bytes decompressed, got %v", got)
+	}
+
+	if got := testutil.ToFloat64(m.zstdErrors.WithLabelValues(compression.OpDecompress)); got != 1 {
+		t.Errorf("expected 1 decompress error, got %v", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+	rw := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rw, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rw.Code)
+	}
+
+	if !strings.Contains(rw.Body.String(), "codelet_http_requests_in_flight") {
+		t.Error("metrics output is missing codelet_http_requests_in_flight")
+	}
+}
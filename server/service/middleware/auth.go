@@ -5,31 +5,51 @@ import (
 	"strconv"
 
 	auth "github.com/scott-mescudi/codelet/shared/auth"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const ACCESS = 0
 const REFRESH = 1
 
-func AuthMiddleware(next http.HandlerFunc) http.Handler {
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/scott-mescudi/codelet/service/middleware")
+}
+
+// AuthMiddleware lets requests with an access token signed with secret
+// through, with the user in the X-USERID header.
+func AuthMiddleware(secret []byte, next http.HandlerFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer().Start(r.Context(), "auth")
+		defer span.End()
+		r = r.WithContext(ctx)
+
 		token := r.Header.Get("Authorization")
 		if token == "" {
+			span.SetStatus(codes.Error, "missing token")
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
 
-		userID, tokenType, err := auth.ValidateHmac(token)
+		userID, tokenType, err := auth.ValidateHmac(secret, token)
 		if err != nil {
+			span.SetStatus(codes.Error, "invalid token")
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
 
 		if tokenType != ACCESS {
+			span.SetStatus(codes.Error, "wrong token type")
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
 
-		r.Header.Add("X-USERID", strconv.Itoa(userID))
+		span.SetAttributes(attribute.Int("enduser.id", userID))
+
+		r.Header.Set("X-USERID", strconv.Itoa(userID))
+		setLoggerUserID(r, userID)
 		next.ServeHTTP(w, r)
 	})
 }
@@ -10,6 +10,9 @@ import (
 	auth "github.com/scott-mescudi/codelet/shared/auth"
 )
 
+// testSecret signs the tokens of the tests.
+var testSecret = []byte("codelet-test-secret-codelet-test-secret")
+
 func TestAuthMiddleware(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -21,7 +24,7 @@ func TestAuthMiddleware(t *testing.T) {
 		{
 			name: "Valid Token",
 			setupAuth: func() (string, error) {
-				return auth.GenerateHMac(123, ACCESS, time.Now().Add(2*time.Minute)), nil
+				return auth.GenerateHMac(testSecret, 123, ACCESS, time.Now().Add(2*time.Minute)), nil
 			},
 			expectCode: http.StatusOK,
 			userID:     123,
@@ -41,7 +44,7 @@ func TestAuthMiddleware(t *testing.T) {
 		{
 			name: "Wrong Token Type",
 			setupAuth: func() (string, error) {
-				return auth.GenerateHMac(123, REFRESH, time.Now().Add(2*time.Minute)), nil // Wrong token type
+				return auth.GenerateHMac(testSecret, 123, REFRESH, time.Now().Add(2*time.Minute)), nil // Wrong token type
 			},
 			expectCode: http.StatusForbidden,
 		},
@@ -62,7 +65,7 @@ func TestAuthMiddleware(t *testing.T) {
 			}
 
 			rw := httptest.NewRecorder()
-			handler := AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler := AuthMiddleware(testSecret, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusOK)
 			}))
 			handler.ServeHTTP(rw, req)
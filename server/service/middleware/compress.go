@@ -0,0 +1,334 @@
+package middleware
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressConfig configures CompressMiddleware.
+type CompressConfig struct {
+	// MinSize is the smallest body worth compressing, smaller ones go out as
+	// they are. A negative MinSize turns compression off.
+	MinSize int
+}
+
+// encodings are the content codings the server speaks, in the order it
+// prefers them when a client accepts several equally.
+var encodings = []string{"zstd", "gzip"}
+
+var (
+	zstdEncoders = sync.Pool{New: func() any {
+		// One goroutine per response, requests already run in parallel.
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return enc
+	}}
+	gzipEncoders = sync.Pool{New: func() any {
+		return gzip.NewWriter(nil)
+	}}
+)
+
+// encoder is a pooled zstd or gzip writer.
+type encoder interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+	Flush() error
+}
+
+func getEncoder(encoding string, w io.Writer) encoder {
+	var enc encoder
+	if encoding == "zstd" {
+		enc = zstdEncoders.Get().(*zstd.Encoder)
+	} else {
+		enc = gzipEncoders.Get().(*gzip.Writer)
+	}
+	enc.Reset(w)
+	return enc
+}
+
+func putEncoder(encoding string, enc encoder) {
+	enc.Reset(nil)
+	if encoding == "zstd" {
+		zstdEncoders.Put(enc)
+	} else {
+		gzipEncoders.Put(enc)
+	}
+}
+
+// NegotiateEncoding picks the coding of Accept-Encoding with the highest
+// weight, "" when the body should go out as it is. Handlers that have a body
+// in that coding already can send it themselves, see EncodedETag.
+func NegotiateEncoding(acceptEncoding string) string {
+	weights := map[string]float64{}
+	wildcard := -1.0
+	for part := range strings.SplitSeq(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		weights[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range encodings {
+		q, ok := weights[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressible reports whether a body of contentType gains from compression.
+// Images, media and archives already are compressed.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType == ""
+	}
+
+	switch {
+	case mediaType == "image/svg+xml":
+		return true
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "video/"), strings.HasPrefix(mediaType, "audio/"):
+		return false
+	}
+
+	switch mediaType {
+	case "application/zstd", "application/gzip", "application/zip", "application/x-tar+zstd", "application/x-7z-compressed", "application/octet-stream":
+		return false
+	}
+	return true
+}
+
+// etagSuffix marks the strong ETag of a compressed response, the compressed
+// bytes are a different representation than the plain ones.
+func etagSuffix(encoding string) string {
+	return "-" + encoding
+}
+
+// EncodedETag is the ETag of the body with etag in the given coding. Weak
+// ETags stay as they are.
+func EncodedETag(etag, encoding string) string {
+	if len(etag) < 2 || !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return etag[:len(etag)-1] + etagSuffix(encoding) + `"`
+}
+
+// stripETagSuffix removes the suffix of encoding from the strong ETags in an
+// If-Match or If-None-Match header, so handlers compare against their own
+// ETags. It reports whether any tag had the suffix.
+func stripETagSuffix(header, encoding string) (string, bool) {
+	suffix := etagSuffix(encoding) + `"`
+	if !strings.Contains(header, suffix) {
+		return header, false
+	}
+	return strings.ReplaceAll(header, suffix, `"`), true
+}
+
+// CompressMiddleware compresses response bodies with the best coding the
+// client accepts. Bodies are streamed, only the first MinSize bytes are held
+// back to decide whether compressing is worth it. Responses that already
+// have a Content-Encoding, such as code served in its stored zstd frame, are
+// left alone.
+func CompressMiddleware(cfg CompressConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.MinSize < 0 || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		encoding := NegotiateEncoding(r.Header.Get("Accept-Encoding"))
+		w.Header().Add("Vary", "Accept-Encoding")
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Strong ETags the client got from a compressed response carry the
+		// coding, handlers only know the plain one.
+		var revalidating bool
+		for _, name := range []string{"If-None-Match", "If-Match"} {
+			if header := r.Header.Get(name); header != "" {
+				stripped, found := stripETagSuffix(header, encoding)
+				r.Header.Set(name, stripped)
+				revalidating = revalidating || (found && name == "If-None-Match")
+			}
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: cfg.MinSize, revalidating: revalidating}
+		// Deferred so a handler aborting with http.ErrAbortHandler still
+		// hands its encoder back to the pool.
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter holds back the start of a body until it knows whether to
+// compress it, then either streams it through an encoder or passes it on.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	// revalidating is set when the client sent an ETag of a compressed
+	// response, a 304 gets that ETag back.
+	revalidating bool
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.status != 0 {
+		return
+	}
+
+	if code >= 100 && code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	cw.status = code
+	if !bodyAllowed(code) {
+		if code == http.StatusNotModified && cw.revalidating {
+			cw.markETag()
+		}
+		cw.decided = true
+		cw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func bodyAllowed(code int) bool {
+	return code != http.StatusNoContent && code != http.StatusNotModified
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) < cw.minSize {
+		return len(b), nil
+	}
+
+	if err := cw.decide(true); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// decide sends the headers, compressing when wanted and the response allows
+// it, and writes out what was held back.
+func (cw *compressWriter) decide(wanted bool) error {
+	cw.decided = true
+	h := cw.Header()
+	if wanted && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		cw.markETag()
+		cw.enc = getEncoder(cw.encoding, cw.ResponseWriter)
+	}
+
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// markETag adds the coding to a strong ETag.
+func (cw *compressWriter) markETag() {
+	if etag := cw.Header().Get("ETag"); etag != "" {
+		cw.Header().Set("ETag", EncodedETag(etag, cw.encoding))
+	}
+}
+
+// Flush sends what was written so far. A handler that flushes streams, so
+// it is compressed regardless of how much it wrote yet.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		if err := cw.decide(true); err != nil {
+			return
+		}
+	}
+
+	if cw.enc != nil {
+		if err := cw.enc.Flush(); err != nil {
+			return
+		}
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Close writes out a body too small to compress, or ends the compressed
+// stream.
+func (cw *compressWriter) Close() {
+	if !cw.decided {
+		if cw.status == 0 && len(cw.buf) == 0 {
+			// The handler wrote nothing, net/http sends its 200.
+			return
+		}
+		cw.decide(false)
+	}
+
+	if cw.enc != nil {
+		cw.enc.Close()
+		putEncoder(cw.encoding, cw.enc)
+		cw.enc = nil
+	}
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: ""},
+		{accept: "gzip", want: "gzip"},
+		{accept: "gzip, deflate, br, zstd", want: "zstd"},
+		{accept: "zstd;q=0.5, gzip", want: "gzip"},
+		{accept: "zstd;q=0, gzip;q=0", want: ""},
+		{accept: "*", want: "zstd"},
+		{accept: "*;q=0.1, zstd;q=0", want: "gzip"},
+		{accept: "br", want: ""},
+		{accept: "GZIP;q=0.8", want: "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			if got := NegotiateEncoding(tt.accept); got != tt.want {
+				t.Errorf("Expected %q but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func decodeBody(t *testing.T, encoding string, body []byte) []byte {
+	t.Helper()
+	var r io.Reader
+	switch encoding {
+	case "zstd":
+		dec, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dec.Close()
+		r = dec
+	case "gzip":
+		dec, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = dec
+	default:
+		return body
+	}
+
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plain
+}
+
+func TestCompressMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"code":"fmt.Println(\"hello\")"},`, 100)
+
+	tests := []struct {
+		name         string
+		accept       string
+		contentType  string
+		encoding     string
+		body         string
+		flush        bool
+		wantEncoding string
+	}{
+		{name: "zstd", accept: "gzip, zstd", contentType: "application/json", body: large, wantEncoding: "zstd"},
+		{name: "gzip", accept: "gzip", contentType: "application/json", body: large, wantEncoding: "gzip"},
+		{name: "Not accepted", accept: "br", contentType: "application/json", body: large},
+		{name: "Too small", accept: "zstd", contentType: "application/json", body: `{"id":1}`},
+		{name: "Small but streamed", accept: "zstd", contentType: "application/json", body: `{"id":1}`, flush: true, wantEncoding: "zstd"},
+		{name: "Already compressed type", accept: "zstd", contentType: "image/png", body: large},
+		{name: "Encoded by handler", accept: "zstd", contentType: "text/plain", encoding: "zstd", body: large, wantEncoding: "zstd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := CompressMiddleware(CompressConfig{MinSize: 256}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				half := len(tt.body) / 2
+				w.Write([]byte(tt.body[:half]))
+				if tt.flush {
+					http.NewResponseController(w).Flush()
+				}
+				w.Write([]byte(tt.body[half:]))
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept-Encoding", tt.accept)
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if got := rw.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Expected Content-Encoding %q but got %q", tt.wantEncoding, got)
+			}
+
+			if !strings.Contains(rw.Header().Get("Vary"), "Accept-Encoding") {
+				t.Error("Missing Vary: Accept-Encoding")
+			}
+
+			body := rw.Body.Bytes()
+			if tt.encoding == "" {
+				body = decodeBody(t, tt.wantEncoding, body)
+			}
+			if string(body) != tt.body {
+				t.Errorf("Body did not survive, got %d bytes", len(body))
+			}
+		})
+	}
+}
+
+func TestCompressMiddlewareAbort(t *testing.T) {
+	large := strings.Repeat("fmt.Println(\"hello\")\n", 100)
+	handler := CompressMiddleware(CompressConfig{MinSize: 256}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(large))
+		panic(http.ErrAbortHandler)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rw := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if err := recover(); err != http.ErrAbortHandler {
+				t.Fatalf("Expected the abort to propagate, got %v", err)
+			}
+		}()
+		handler.ServeHTTP(rw, req)
+	}()
+
+	// The stream is only complete when the encoder was closed.
+	if body := decodeBody(t, "gzip", rw.Body.Bytes()); string(body) != large {
+		t.Errorf("Body did not survive, got %d bytes", len(body))
+	}
+}
+
+func TestCompressMiddlewareETags(t *testing.T) {
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		status      int
+		etag        string
+		wantSeen    string
+		wantETag    string
+	}{
+		{name: "Strong ETag gets the coding", status: http.StatusOK, etag: `"1.2"`, wantETag: `"1.2-gzip"`},
+		{name: "Weak ETag stays", status: http.StatusOK, etag: `W/"abc"`, wantETag: `W/"abc"`},
+		{name: "Revalidation sees the plain ETag", ifNoneMatch: `"1.2-gzip"`, status: http.StatusNotModified, etag: `"1.2"`, wantSeen: `"1.2"`, wantETag: `"1.2-gzip"`},
+		{name: "Plain revalidation", ifNoneMatch: `"1.2"`, status: http.StatusNotModified, etag: `"1.2"`, wantSeen: `"1.2"`, wantETag: `"1.2"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := CompressMiddleware(CompressConfig{MinSize: 0}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = r.Header.Get("If-None-Match")
+				w.Header().Set("ETag", tt.etag)
+				w.WriteHeader(tt.status)
+				if tt.status == http.StatusOK {
+					w.Write([]byte("body"))
+				}
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != tt.status {
+				t.Fatalf("Expected status %d but got %d", tt.status, rw.Code)
+			}
+			if seen != tt.wantSeen {
+				t.Errorf("Handler saw If-None-Match %q, expected %q", seen, tt.wantSeen)
+			}
+			if got := rw.Header().Get("ETag"); got != tt.wantETag {
+				t.Errorf("Expected ETag %q but got %q", tt.wantETag, got)
+			}
+		})
+	}
+}
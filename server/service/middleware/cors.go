@@ -2,25 +2,155 @@ package middleware
 
 import (
 	"net/http"
-	"os"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
-var CORS_ORIGIN = os.Getenv("CORS_ORIGIN")
+// CorsPolicy describes which cross-origin requests a group of routes accepts.
+// AllowedOrigins holds exact origins ("https://codelet.dev"), wildcard
+// subdomains ("https://*.codelet.dev") or "*". A "*" entry never matches when
+// AllowCredentials is set, browsers refuse that combination anyway.
+type CorsPolicy struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// CorsRoute applies Policy to every request whose path starts with Prefix.
+type CorsRoute struct {
+	Prefix string
+	Policy CorsPolicy
+}
+
+type CorsConfig struct {
+	Default CorsPolicy
+	Routes  []CorsRoute
+}
+
+func (c *CorsConfig) policyFor(path string) *CorsPolicy {
+	for i := range c.Routes {
+		if strings.HasPrefix(path, c.Routes[i].Prefix) {
+			return &c.Routes[i].Policy
+		}
+	}
+	return &c.Default
+}
 
-func CorsMiddleware(next http.Handler) http.Handler {
+func CorsMiddleware(cfg CorsConfig, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", CORS_ORIGIN) // Replace with your frontend URL, in testing with postman set to *
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Credentials", "true") // Allow credentials (cookies, etc.)
+		ctx, span := tracer().Start(r.Context(), "cors")
+		defer span.End()
 
-		// If the request method is OPTIONS (preflight), just return No Content
-		if r.Method == http.MethodOptions {
+		policy := cfg.policyFor(r.URL.Path)
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		// The response differs per origin, so caches must key on it even when
+		// the origin is rejected.
+		w.Header().Add("Vary", "Origin")
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		allowed := origin != "" && policy.allows(origin)
+		span.SetAttributes(attribute.Bool("cors.preflight", preflight), attribute.Bool("cors.allowed", allowed))
+		if allowed {
+			if policy.AllowCredentials || !policy.allowsAny() {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			}
+
+			if policy.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if len(policy.ExposedHeaders) > 0 && !preflight {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+			}
+		}
+
+		if preflight {
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(policy.AllowedMethods, ", "))
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+				if policy.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+				}
+			}
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
-		// Proceed with the actual request
-		next.ServeHTTP(w, r)
+		serveWithContext(ctx, next, w, r)
 	})
 }
+
+func (p *CorsPolicy) allowsAny() bool {
+	for _, o := range p.AllowedOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *CorsPolicy) allows(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+
+	for _, pattern := range p.AllowedOrigins {
+		if pattern == "*" {
+			if !p.AllowCredentials {
+				return true
+			}
+			continue
+		}
+
+		if MatchOrigin(pattern, u) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchOrigin reports whether origin matches pattern. A "*." host prefix in
+// pattern matches any number of subdomain labels but not the bare domain.
+func MatchOrigin(pattern string, origin *url.URL) bool {
+	scheme, host, ok := strings.Cut(pattern, "://")
+	if !ok || !strings.EqualFold(scheme, origin.Scheme) {
+		return false
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "/"))
+	originHost := strings.ToLower(origin.Host)
+
+	if suffix, ok := strings.CutPrefix(host, "*."); ok {
+		sub, found := strings.CutSuffix(originHost, "."+suffix)
+		return found && sub != "" && !strings.HasSuffix(sub, ".")
+	}
+
+	return host == originHost
+}
+
+// ParseOrigins splits a comma separated origin list.
+func ParseOrigins(list string) []string {
+	var origins []string
+	for _, o := range strings.Split(list, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	return origins
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCorsMiddleware(t *testing.T) {
+	cfg := CorsConfig{
+		Default: CorsPolicy{
+			AllowedOrigins:   []string{"https://codelet.dev", "https://*.codelet.dev"},
+			AllowedMethods:   []string{"GET", "POST"},
+			AllowedHeaders:   []string{"Content-Type"},
+			AllowCredentials: true,
+		},
+		Routes: []CorsRoute{
+			{Prefix: "/public/", Policy: CorsPolicy{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}}},
+		},
+	}
+
+	handler := CorsMiddleware(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		origin      string
+		expectCode  int
+		allowOrigin string
+		credentials string
+	}{
+		{name: "exact origin", method: "GET", path: "/", origin: "https://codelet.dev", expectCode: http.StatusOK, allowOrigin: "https://codelet.dev", credentials: "true"},
+		{name: "wildcard subdomain", method: "GET", path: "/", origin: "https://app.codelet.dev", expectCode: http.StatusOK, allowOrigin: "https://app.codelet.dev", credentials: "true"},
+		{name: "nested subdomain", method: "GET", path: "/", origin: "https://a.b.codelet.dev", expectCode: http.StatusOK, allowOrigin: "https://a.b.codelet.dev", credentials: "true"},
+		{name: "suffix attack", method: "GET", path: "/", origin: "https://evilcodelet.dev", expectCode: http.StatusOK},
+		{name: "wrong scheme", method: "GET", path: "/", origin: "http://codelet.dev", expectCode: http.StatusOK},
+		{name: "unknown origin preflight", method: "OPTIONS", path: "/", origin: "https://evil.com", expectCode: http.StatusNoContent},
+		{name: "allowed preflight", method: "OPTIONS", path: "/", origin: "https://codelet.dev", expectCode: http.StatusNoContent, allowOrigin: "https://codelet.dev", credentials: "true"},
+		{name: "public route any origin", method: "GET", path: "/public/snippets", origin: "https://evil.com", expectCode: http.StatusOK, allowOrigin: "*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Origin", tt.origin)
+			if tt.method == "OPTIONS" {
+				req.Header.Set("Access-Control-Request-Method", "POST")
+			}
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != tt.expectCode {
+				t.Errorf("Expected code %d but got %d", tt.expectCode, rw.Code)
+			}
+
+			if got := rw.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Expected Allow-Origin %q but got %q", tt.allowOrigin, got)
+			}
+
+			if got := rw.Header().Get("Access-Control-Allow-Credentials"); got != tt.credentials {
+				t.Errorf("Expected Allow-Credentials %q but got %q", tt.credentials, got)
+			}
+
+			if rw.Header().Get("Vary") != "Origin" {
+				t.Errorf("Expected Vary: Origin but got %v", rw.Header().Values("Vary"))
+			}
+		})
+	}
+}
+
+func TestCorsCredentialsIgnoreWildcard(t *testing.T) {
+	policy := CorsPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+	if policy.allows("https://evil.com") {
+		t.Error("wildcard origin was allowed together with credentials")
+	}
+}
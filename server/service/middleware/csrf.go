@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+
+	auth "github.com/scott-mescudi/codelet/shared/auth"
+	errs "github.com/scott-mescudi/codelet/shared/errors"
+)
+
+// CSRFMiddleware protects endpoints that authenticate through cookies. The
+// token handed out at login is stored in a cookie and must be echoed back in
+// the X-CSRF-Token header, which a cross-site form or fetch can't do.
+func CSRFMiddleware(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie(auth.CSRFCookieName)
+		if err != nil || !auth.CompareCSRFToken(cookie.Value, r.Header.Get(auth.CSRFHeaderName)) {
+			errs.ErrorWithJson(w, http.StatusForbidden, "missing or invalid CSRF token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
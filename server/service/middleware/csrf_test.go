@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	auth "github.com/scott-mescudi/codelet/shared/auth"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	token := auth.GenerateCSRFToken()
+
+	tests := []struct {
+		name       string
+		method     string
+		cookie     string
+		header     string
+		expectCode int
+	}{
+		{name: "Safe method", method: "GET", expectCode: http.StatusOK},
+		{name: "Matching token", method: "POST", cookie: token, header: token, expectCode: http.StatusOK},
+		{name: "Missing header", method: "POST", cookie: token, expectCode: http.StatusForbidden},
+		{name: "Missing cookie", method: "POST", header: token, expectCode: http.StatusForbidden},
+		{name: "Mismatched token", method: "POST", cookie: token, header: auth.GenerateCSRFToken(), expectCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: auth.CSRFCookieName, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set(auth.CSRFHeaderName, tt.header)
+			}
+
+			rw := httptest.NewRecorder()
+			handler := CSRFMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != tt.expectCode {
+				t.Errorf("Expected code %d but got %d", tt.expectCode, rw.Code)
+			}
+		})
+	}
+}
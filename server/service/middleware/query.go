@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+	errs "github.com/scott-mescudi/codelet/shared/errors"
+)
+
+// QueryContext bounds a single data access call by timeout, no timeout when
+// it is 0. The request context stays the parent, so a client that hangs up
+// still cancels the query.
+func QueryContext(r *http.Request, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// Interrupted answers requests whose database work stopped because the
+// client went away or the query timeout passed, neither of which is a server
+// fault. It reports false for any other error.
+func Interrupted(w http.ResponseWriter, logger *zerolog.Logger, function string, timeout time.Duration, err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled):
+		logger.Info().Str("function", function).Msg("Request cancelled by client")
+		w.WriteHeader(errs.StatusClientClosedRequest)
+	case errors.Is(err, context.DeadlineExceeded):
+		logger.Warn().Str("function", function).Dur("timeout", timeout).Msg("Database query timed out")
+		errs.ErrorWithJson(w, http.StatusGatewayTimeout, "database query timed out")
+	default:
+		return false
+	}
+	return true
+}
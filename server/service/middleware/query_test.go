@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	errs "github.com/scott-mescudi/codelet/shared/errors"
+)
+
+func TestInterrupted(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		interrupted bool
+		status      int
+	}{
+		{name: "Client cancelled", err: fmt.Errorf("query: %w", context.Canceled), interrupted: true, status: errs.StatusClientClosedRequest},
+		{name: "Query timeout", err: fmt.Errorf("query: %w", context.DeadlineExceeded), interrupted: true, status: http.StatusGatewayTimeout},
+		{name: "Other error", err: errors.New("duplicate key"), interrupted: false, status: http.StatusOK},
+	}
+
+	logger := zerolog.Nop()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			if got := Interrupted(rw, &logger, "Test", time.Second, tt.err); got != tt.interrupted {
+				t.Fatalf("expected %v, got %v", tt.interrupted, got)
+			}
+
+			if rw.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rw.Code)
+			}
+		})
+	}
+}
+
+func TestQueryContext(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+
+	ctx, cancel := QueryContext(req, time.Millisecond)
+	defer cancel()
+
+	<-ctx.Done()
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Errorf("expected the query timeout to fire, got %v", ctx.Err())
+	}
+
+	parent, stop := context.WithCancel(context.Background())
+	ctx, cancel = QueryContext(req.WithContext(parent), time.Millisecond)
+	defer cancel()
+
+	stop()
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Errorf("expected request cancellation to reach the query, got %v", ctx.Err())
+	}
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	errs "github.com/scott-mescudi/codelet/shared/errors"
+	"github.com/scott-mescudi/codelet/shared/ratelimit"
+)
+
+// KeyFunc picks the identity a request is rate limited under.
+type KeyFunc func(r *http.Request) string
+
+type RateLimiter struct {
+	Store          ratelimit.Store
+	TrustedProxies []netip.Prefix
+}
+
+// ByIP keys requests on the client address, see ClientIP.
+func (rl *RateLimiter) ByIP(r *http.Request) string {
+	return "ip:" + ClientIP(r, rl.TrustedProxies)
+}
+
+// ByUserID keys requests on the user set by AuthMiddleware and falls back to
+// the client address for anonymous requests.
+func (rl *RateLimiter) ByUserID(r *http.Request) string {
+	if userID := r.Header.Get("X-USERID"); userID != "" {
+		return "user:" + userID
+	}
+	return rl.ByIP(r)
+}
+
+// Limit wraps next in a token bucket described by policy. It returns a
+// HandlerFunc so it can sit on either side of AuthMiddleware.
+func (rl *RateLimiter) Limit(policy ratelimit.Policy, key KeyFunc, next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res, err := rl.Store.Take(r.Context(), key(r), policy)
+		if err != nil {
+			// A broken limiter store should not take the whole API down with it.
+			zerolog.Ctx(r.Context()).Warn().Err(err).Str("policy", policy.Name).Msg("rate limit store unavailable, allowing request")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		w.Header().Set("RateLimit-Policy", strconv.Itoa(policy.Limit)+";w="+strconv.Itoa(ceilSeconds(policy.Period)))
+
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			errs.ErrorWithJson(w, http.StatusTooManyRequests, "rate limit exceeded, try again later")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// ClientIP returns the address of the client that sent r. X-Forwarded-For is
+// only honoured when the direct peer is a trusted proxy, and is walked from
+// the right so a client can't spoof its way past the proxies.
+func ClientIP(r *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !isTrusted(peer, trusted) {
+		return host
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		addr, err := netip.ParseAddr(hop)
+		if err != nil {
+			break
+		}
+
+		if !isTrusted(addr, trusted) {
+			return addr.String()
+		}
+		peer = addr
+	}
+
+	return peer.String()
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses a list of addresses or CIDR ranges.
+func ParseTrustedProxies(list []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range list {
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d-1)/time.Second) + 1
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/scott-mescudi/codelet/shared/ratelimit"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		expected   string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:1234", expected: "203.0.113.7"},
+		{name: "untrusted peer ignores header", remoteAddr: "203.0.113.7:1234", forwarded: "1.2.3.4", expected: "203.0.113.7"},
+		{name: "trusted proxy", remoteAddr: "10.1.2.3:80", forwarded: "198.51.100.2", expected: "198.51.100.2"},
+		{name: "spoofed left most hop", remoteAddr: "10.1.2.3:80", forwarded: "1.1.1.1, 198.51.100.2, 192.168.1.1", expected: "198.51.100.2"},
+		{name: "garbage hop", remoteAddr: "10.1.2.3:80", forwarded: "not-an-ip", expected: "10.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+
+			if got := ClientIP(req, trusted); got != tt.expected {
+				t.Errorf("ClientIP() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	rl := &RateLimiter{Store: ratelimit.NewMemoryStore()}
+	policy := ratelimit.Policy{Name: "test", Limit: 2, Period: time.Minute}
+
+	handler := rl.Limit(policy, rl.ByUserID, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		userID     string
+		expectCode int
+		remaining  string
+	}{
+		{name: "first request", userID: "1", expectCode: http.StatusOK, remaining: "1"},
+		{name: "second request", userID: "1", expectCode: http.StatusOK, remaining: "0"},
+		{name: "limited", userID: "1", expectCode: http.StatusTooManyRequests, remaining: "0"},
+		{name: "other user", userID: "2", expectCode: http.StatusOK, remaining: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("X-USERID", tt.userID)
+			rw := httptest.NewRecorder()
+
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != tt.expectCode {
+				t.Errorf("Expected code %d but got %d", tt.expectCode, rw.Code)
+			}
+
+			if rw.Header().Get("RateLimit-Limit") != "2" {
+				t.Errorf("Expected RateLimit-Limit 2 but got %s", rw.Header().Get("RateLimit-Limit"))
+			}
+
+			if got := rw.Header().Get("RateLimit-Remaining"); got != tt.remaining {
+				t.Errorf("Expected RateLimit-Remaining %s but got %s", tt.remaining, got)
+			}
+
+			if tt.expectCode == http.StatusTooManyRequests && rw.Header().Get("Retry-After") != "30" {
+				t.Errorf("Expected Retry-After 30 but got %s", rw.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
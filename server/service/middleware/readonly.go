@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	errs "github.com/scott-mescudi/codelet/shared/errors"
+)
+
+// ReadOnly is the maintenance switch for routes that write to the database.
+// While it is on, guarded handlers answer 503 and reads keep working.
+type ReadOnly struct {
+	RetryAfter time.Duration
+	enabled    atomic.Bool
+}
+
+func (ro *ReadOnly) Enabled() bool {
+	return ro.enabled.Load()
+}
+
+// Set switches read-only mode and reports whether it changed anything.
+func (ro *ReadOnly) Set(enabled bool) bool {
+	return ro.enabled.Swap(enabled) != enabled
+}
+
+func (ro *ReadOnly) Guard(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ro.enabled.Load() {
+			if ro.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(ro.RetryAfter.Seconds())))
+			}
+			errs.ErrorWithJson(w, http.StatusServiceUnavailable, "codelet is in read-only maintenance mode")
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadOnlyGuard(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		expected   int
+		retryAfter string
+	}{
+		{name: "Writes allowed", enabled: false, expected: http.StatusCreated, retryAfter: ""},
+		{name: "Maintenance", enabled: true, expected: http.StatusServiceUnavailable, retryAfter: "300"},
+	}
+
+	ro := &ReadOnly{RetryAfter: 5 * time.Minute}
+	handler := ro.Guard(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ro.Set(tt.enabled)
+
+			rw := httptest.NewRecorder()
+			handler(rw, httptest.NewRequest("POST", "/api/v1/user/snippets", nil))
+
+			if rw.Code != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, rw.Code)
+			}
+			if got := rw.Header().Get("Retry-After"); got != tt.retryAfter {
+				t.Errorf("expected Retry-After %q, got %q", tt.retryAfter, got)
+			}
+		})
+	}
+
+	if ro.Set(true) {
+		t.Error("Set reported a change when the mode was already on")
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestLogger gives every request an ID, taken from X-Request-ID when the
+// caller sent a sane one, and stores a logger carrying it in the request
+// context. Handlers pick it up with zerolog.Ctx. Once the request is done a
+// single access line is written.
+func RequestLogger(base zerolog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		lc := base.With().Str("request_id", id).Str("origin", r.RemoteAddr)
+		if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+			lc = lc.Str("trace_id", sc.TraceID().String())
+		}
+		logger := lc.Logger()
+		ctx := logger.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+
+		rw := newResponseRecorder(w)
+		serveWithContext(ctx, next, rw, r)
+
+		status := rw.Status()
+		event := zerolog.Ctx(ctx).Info()
+		if status >= 500 {
+			event = zerolog.Ctx(ctx).Error()
+		}
+
+		// r.Pattern is filled in by the ServeMux further down the chain.
+		event.Str("method", r.Method).
+			Str("route", r.Pattern).
+			Str("path", r.URL.Path).
+			Int("status", status).
+			Int64("bytes", rw.bytes).
+			Dur("latency", time.Since(start)).
+			Msg("Handled request")
+	})
+}
+
+// serveWithContext hands next a copy of r carrying ctx and copies the route
+// pattern the mux sets on that copy back, so layers outside the mux can still
+// label the request with it.
+func serveWithContext(ctx context.Context, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	inner := r.WithContext(ctx)
+	next.ServeHTTP(w, inner)
+	r.Pattern = inner.Pattern
+}
+
+// RequestID returns the ID RequestLogger assigned to the request behind ctx.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// setLoggerUserID adds the authenticated user to the request logger so the
+// handler's lines and the access line both carry it.
+func setLoggerUserID(r *http.Request, userID int) {
+	zerolog.Ctx(r.Context()).UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Int("userID", userID)
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	auth "github.com/scott-mescudi/codelet/shared/auth"
+)
+
+func TestRequestLogger(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		keepID    bool
+	}{
+		{name: "Generated ID", requestID: "", keepID: false},
+		{name: "Propagated ID", requestID: "abc-123", keepID: true},
+		{name: "Rejected ID", requestID: "bad id\n", keepID: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			mux := http.NewServeMux()
+			mux.Handle("GET /snippets/{id}", AuthMiddleware(testSecret, func(w http.ResponseWriter, r *http.Request) {
+				zerolog.Ctx(r.Context()).Info().Msg("inside handler")
+				w.WriteHeader(http.StatusTeapot)
+				w.Write([]byte("hello"))
+			}))
+
+			req := httptest.NewRequest("GET", "/snippets/5", nil)
+			req.Header.Set("Authorization", auth.GenerateHMac(testSecret, 42, ACCESS, time.Now().Add(time.Minute)))
+			if tt.requestID != "" {
+				req.Header.Set(RequestIDHeader, tt.requestID)
+			}
+
+			rw := httptest.NewRecorder()
+			RequestLogger(zerolog.New(&out), mux).ServeHTTP(rw, req)
+
+			id := rw.Header().Get(RequestIDHeader)
+			if id == "" || (id == tt.requestID) != tt.keepID {
+				t.Fatalf("unexpected request id %q", id)
+			}
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if len(lines) != 2 {
+				t.Fatalf("expected a handler line and an access line, got %v", lines)
+			}
+
+			for _, line := range lines {
+				if !strings.Contains(line, `"request_id":"`+id+`"`) || !strings.Contains(line, `"userID":42`) {
+					t.Errorf("line is missing request scope: %s", line)
+				}
+			}
+
+			for _, want := range []string{`"route":"GET /snippets/{id}"`, `"status":418`, `"bytes":5`, `"latency":`} {
+				if !strings.Contains(lines[1], want) {
+					t.Errorf("access line is missing %s: %s", want, lines[1])
+				}
+			}
+		})
+	}
+}
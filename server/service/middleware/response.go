@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// responseRecorder remembers what a handler wrote so middleware can act on
+// it afterwards. beforeHeader runs once, right before the status line goes
+// out, while headers can still be changed.
+type responseRecorder struct {
+	http.ResponseWriter
+	status       int
+	bytes        int64
+	beforeHeader func(h http.Header, status int)
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (rw *responseRecorder) WriteHeader(code int) {
+	if rw.status != 0 {
+		return
+	}
+
+	if code >= 100 && code < 200 {
+		rw.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	rw.status = code
+	if rw.beforeHeader != nil {
+		rw.beforeHeader(rw.Header(), code)
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+func (rw *responseRecorder) Status() int {
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+	return rw.status
+}
+
+func (rw *responseRecorder) Flush() {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	errs "github.com/scott-mescudi/codelet/shared/errors"
+)
+
+// SecurityHeaders are sent with every response, the Content-Security-Policy
+// only with HTML. Handlers that set a policy of their own keep it, and may
+// drop X-Frame-Options for responses meant to be embedded.
+type SecurityHeaders struct {
+	// HSTSMaxAge is only sent when non zero, leave it unset when the server
+	// isn't reachable over TLS.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	ContentSecurityPolicy string
+	ReferrerPolicy        string
+}
+
+func SecurityHeadersMiddleware(cfg SecurityHeaders, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		if cfg.ReferrerPolicy != "" {
+			h.Set("Referrer-Policy", cfg.ReferrerPolicy)
+		}
+
+		if cfg.HSTSMaxAge > 0 {
+			hsts := "max-age=" + strconv.Itoa(int(cfg.HSTSMaxAge.Seconds()))
+			if cfg.HSTSIncludeSubdomains {
+				hsts += "; includeSubDomains"
+			}
+			h.Set("Strict-Transport-Security", hsts)
+		}
+
+		if cfg.ContentSecurityPolicy == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The content type is only known once the handler starts writing.
+		rw := newResponseRecorder(w)
+		rw.beforeHeader = func(h http.Header, _ int) {
+			if strings.HasPrefix(h.Get("Content-Type"), "text/html") && h.Get("Content-Security-Policy") == "" {
+				h.Set("Content-Security-Policy", cfg.ContentSecurityPolicy)
+			}
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// RecoverMiddleware turns a panicking handler into a regular JSON 500 instead
+// of a dropped connection.
+func RecoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := newResponseRecorder(w)
+
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			zerolog.Ctx(r.Context()).Error().Interface("panic", rec).Str("method", r.Method).Str("path", r.URL.Path).Bytes("stack", debug.Stack()).Msg("Recovered from panic in handler")
+			if rw.status == 0 {
+				errs.ErrorWithJson(rw, http.StatusInternalServerError, "internal server error")
+			}
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// MaxBytes caps the request body of next at limit bytes. Reading past it
+// fails with an *http.MaxBytesError, see errs.IsBodyTooLarge.
+func MaxBytes(limit int64, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			errs.ErrorWithJson(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	cfg := SecurityHeaders{
+		HSTSMaxAge:            time.Hour,
+		ContentSecurityPolicy: "default-src 'none'",
+		ReferrerPolicy:        "no-referrer",
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		handlerCSP  string
+		expectCSP   string
+	}{
+		{name: "HTML response", contentType: "text/html; charset=utf-8", expectCSP: "default-src 'none'"},
+		{name: "JSON response", contentType: "application/json", expectCSP: ""},
+		{name: "Handler policy", contentType: "text/html; charset=utf-8", handlerCSP: "style-src 'unsafe-inline'", expectCSP: "style-src 'unsafe-inline'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := SecurityHeadersMiddleware(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				if tt.handlerCSP != "" {
+					w.Header().Set("Content-Security-Policy", tt.handlerCSP)
+				}
+				w.Write([]byte("hi"))
+			}))
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+
+			if got := rw.Header().Get("Content-Security-Policy"); got != tt.expectCSP {
+				t.Errorf("Expected CSP %q but got %q", tt.expectCSP, got)
+			}
+
+			if rw.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Error("Missing X-Content-Type-Options")
+			}
+
+			if rw.Header().Get("Strict-Transport-Security") != "max-age=3600" {
+				t.Errorf("Unexpected HSTS header %q", rw.Header().Get("Strict-Transport-Security"))
+			}
+
+			if rw.Header().Get("Referrer-Policy") != "no-referrer" {
+				t.Error("Missing Referrer-Policy")
+			}
+		})
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	handler := RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest("GET", "/", nil))
+
+	if rw.Code != http.StatusInternalServerError {
+		t.Errorf("Expected code 500 but got %d", rw.Code)
+	}
+
+	if !strings.Contains(rw.Body.String(), `"code":500`) {
+		t.Errorf("Expected JSON error body but got %s", rw.Body.String())
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		expectCode int
+	}{
+		{name: "Within limit", body: "1234", expectCode: http.StatusOK},
+		{name: "Over limit", body: "123456789", expectCode: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := MaxBytes(8, func(w http.ResponseWriter, r *http.Request) {
+				if _, err := io.ReadAll(r.Body); err != nil {
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			req.ContentLength = -1
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != tt.expectCode {
+				t.Errorf("Expected code %d but got %d", tt.expectCode, rw.Code)
+			}
+		})
+	}
+}
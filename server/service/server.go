@@ -1,62 +1,360 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
-	"os"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	adminMethods "github.com/scott-mescudi/codelet/service/api/admin"
 	snippetMethods "github.com/scott-mescudi/codelet/service/api/snippets"
 	userMethods "github.com/scott-mescudi/codelet/service/api/users"
+	"github.com/scott-mescudi/codelet/service/config"
 	dataAccess "github.com/scott-mescudi/codelet/service/data_access"
+	"github.com/scott-mescudi/codelet/service/logging"
+	"github.com/scott-mescudi/codelet/service/metrics"
 	middleware "github.com/scott-mescudi/codelet/service/middleware"
+	"github.com/scott-mescudi/codelet/service/tracing"
+	auth "github.com/scott-mescudi/codelet/shared/auth"
+	"github.com/scott-mescudi/codelet/shared/compression"
+	"github.com/scott-mescudi/codelet/shared/encryption"
+	"github.com/scott-mescudi/codelet/shared/ratelimit"
 )
 
-func NewCodeletServer() (*http.ServeMux, func()) {
-	file, err := os.OpenFile("/src/logs/codelet_server_logs.json", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+// Request body limits, snippet code itself is capped at 3072 bytes by the
+// handlers but descriptions and tags ride along in the same body.
+const (
+	noBody      = 1 << 10
+	authBody    = 4 << 10
+	snippetBody = 64 << 10
+)
+
+// NewCorsConfig lets the frontend origins call every route with credentials,
+// while the public snippet feed can be embedded from anywhere without them.
+func NewCorsConfig(origins []string) middleware.CorsConfig {
+	return middleware.CorsConfig{
+		Default: middleware.CorsPolicy{
+			AllowedOrigins:   origins,
+			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedHeaders:   []string{"Content-Type", "Authorization", "If-Match", "If-None-Match", "If-Modified-Since", auth.CSRFHeaderName, middleware.RequestIDHeader},
+			ExposedHeaders:   []string{"ETag", "Content-Disposition", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", middleware.RequestIDHeader},
+			AllowCredentials: true,
+			MaxAge:           10 * time.Minute,
+		},
+		Routes: []middleware.CorsRoute{
+			{
+				Prefix: "/api/v1/public/",
+				Policy: middleware.CorsPolicy{
+					AllowedOrigins: []string{"*"},
+					AllowedMethods: []string{"GET", "OPTIONS"},
+					AllowedHeaders: []string{"Content-Type", "If-None-Match", "If-Modified-Since"},
+					ExposedHeaders: []string{"ETag", "Content-Disposition", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", middleware.RequestIDHeader},
+					MaxAge:         10 * time.Minute,
+				},
+			},
+		},
+	}
+}
+
+func policy(name string, p config.Policy) ratelimit.Policy {
+	return ratelimit.Policy{Name: name, Limit: p.Limit, Period: p.Period, Burst: p.Burst}
+}
+
+// NewAdminServer serves the admin handler on its own address with the same
+// timeouts as the API.
+func NewAdminServer(cfg *config.Config, handler http.Handler) *http.Server {
+	server := NewHTTPServer(cfg, handler)
+	server.Addr = cfg.Admin.Addr
+	return server
+}
+
+// NewHTTPServer applies the timeouts and header limits from cfg to handler.
+func NewHTTPServer(cfg *config.Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+}
+
+// Codelet is a wired up server: the public API handler, the admin handler and
+// everything that has to be released when it shuts down.
+type Codelet struct {
+	Handler http.Handler
+	Admin   http.Handler
+	Logger  zerolog.Logger
+	Db      *pgxpool.Pool
+	Health  *Health
+
+	// ReadOnly is the maintenance switch for mutating routes, operators flip
+	// it through PUT /read-only on the admin listener.
+	ReadOnly *middleware.ReadOnly
+
+	// rateLimitIdle is how long a bucket in the rate_limits table has to sit
+	// unused before the sweep deletes it, 0 when limits are kept in memory.
+	rateLimitIdle time.Duration
+
+	closers []func()
+}
+
+// Close releases resources in the reverse order they were acquired.
+func (c *Codelet) Close() {
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		c.closers[i]()
+	}
+	c.closers = nil
+}
+
+// Shutdown fails readiness, stops the servers from accepting connections and
+// waits for in-flight requests until ctx expires, after which the remaining
+// connections are cut. Everything NewCodeletServer set up is released last.
+func (c *Codelet) Shutdown(ctx context.Context, servers ...*http.Server) error {
+	c.Health.Drain()
+
+	errc := make(chan error, len(servers))
+	for _, s := range servers {
+		go func() {
+			err := s.Shutdown(ctx)
+			if err != nil {
+				s.Close()
+			}
+			errc <- err
+		}()
+	}
+
+	var errs []error
+	for range servers {
+		if err := <-errc; err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	c.Close()
+	return errors.Join(errs...)
+}
+
+// OpenDatabase connects to the configured database, retrying while it is
+// unreachable. The server and the command line tools share it.
+func OpenDatabase(ctx context.Context, cfg *config.Config, logger zerolog.Logger) (*pgxpool.Pool, error) {
+	return dataAccess.ConnectWithRetry(ctx, cfg.Database.URL.Value(), dataAccess.RetryOptions{
+		Attempts:     cfg.Database.ConnectAttempts,
+		InitialDelay: cfg.Database.ConnectBackoff,
+		MaxDelay:     cfg.Database.ConnectMaxBackoff,
+		OnRetry: func(attempt int, delay time.Duration, err error) {
+			logger.Warn().Err(err).Int("attempt", attempt).Dur("retry_in", delay).Msg("Database not reachable yet")
+		},
+	})
+}
+
+// NewCodeStore returns the store sealing snippet code with the configured
+// master keys. Without any code is stored unencrypted.
+func NewCodeStore(cfg *config.Config) (*dataAccess.CodeStore, error) {
+	if cfg.Encryption.MasterKeys == "" {
+		return dataAccess.NewCodeStore(nil), nil
+	}
+
+	k, err := encryption.ParseKeyring(cfg.Encryption.MasterKeys.Value())
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to open log file")
+		return nil, err
 	}
+	return dataAccess.NewCodeStore(k), nil
+}
 
-	log.Logger = zerolog.New(file).With().Timestamp().Logger()
+// NewCodeletServer wires up everything the API needs. ctx only bounds
+// startup, cancelling it stops the database connection retries.
+func NewCodeletServer(ctx context.Context, cfg *config.Config) (*Codelet, error) {
+	logger, logCloser, err := logging.New(cfg.Log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up logging: %w", err)
+	}
 
-	logger := log.Logger
+	log.Logger = logger
+	c := &Codelet{Logger: logger}
+	c.closers = append(c.closers, func() { logCloser.Close() })
 
-	app := http.NewServeMux()
+	logger.Info().Interface("config", cfg).Msg("Loaded configuration")
 
-	logger.Info().Str("Database uri", os.Getenv("DATABASE_URL")).Msg("Trying to connect to database")
-	db, err := dataAccess.ConnectToDatabase(os.Getenv("DATABASE_URL"))
+	store, err := NewCodeStore(cfg)
 	if err != nil {
-		logger.Fatal().Err(err).Msg("Failed to connect to database")
-		return nil, nil
+		c.Close()
+		return nil, fmt.Errorf("invalid master keys: %w", err)
 	}
+	c.closers = append(c.closers, store.Close)
+	if !store.Encrypted() {
+		logger.Warn().Msg("No master keys configured, snippet code is stored unencrypted")
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	c.closers = append(c.closers, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Warn().Err(err).Msg("Failed to flush traces")
+		}
+	})
+
+	logger.Info().Msg("Trying to connect to database")
+	db, err := OpenDatabase(ctx, cfg, logger)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	c.Db = db
+	c.closers = append(c.closers, db.Close)
 
-	clean := func() {
-		db.Close()
+	if cfg.Database.MigrateOnStart {
+		applied, err := dataAccess.Migrate(ctx, db)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
+
+		for _, m := range applied {
+			logger.Info().Int("version", m.Version).Str("name", m.Name).Msg("Applied migration")
+		}
 	}
 
+	dicts, err := store.LoadDictionaries(ctx, db)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to load compression dictionaries: %w", err)
+	}
+	logger.Info().Int("count", dicts).Msg("Loaded compression dictionaries")
+
+	c.Health = &Health{Db: db, Timeout: 2 * time.Second}
+
 	logger.Info().Msg("Connected to database")
-	srv := userMethods.UserService{Db: db}
-	srv2 := snippetMethods.SnippetService{Db: db, Logger: logger}
+	c.ReadOnly = &middleware.ReadOnly{RetryAfter: cfg.Server.ReadOnlyRetryAfter}
+	c.ReadOnly.Set(cfg.Server.ReadOnly)
+
+	srv := userMethods.UserService{Db: db, Logger: logger, AccessTokenTTL: cfg.Auth.AccessTokenTTL, RefreshTokenTTL: cfg.Auth.RefreshTokenTTL, QueryTimeout: cfg.Database.QueryTimeout, DeletionGrace: cfg.Auth.DeletionGrace, JWTSecret: []byte(cfg.Auth.JWTSecret.Value()), ReadOnly: c.ReadOnly}
+	adminSrv := adminMethods.AdminService{Db: db, Logger: logger}
+	srv2 := snippetMethods.SnippetService{Db: db, Store: store, Logger: logger, QueryTimeout: cfg.Database.QueryTimeout}
+
+	m := metrics.New()
+	m.Registry.MustRegister(
+		metrics.NewPoolCollector(db),
+		metrics.NewBusinessCollector(db, cfg.Admin.BusinessMetricsTTL, logger),
+	)
+	compression.SetObserver(m)
+	c.closers = append(c.closers, func() { compression.SetObserver(nil) })
+
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
+	rl := &middleware.RateLimiter{Store: ratelimit.NewMemoryStore(), TrustedProxies: trustedProxies}
+	if cfg.RateLimit.Store == "postgres" {
+		rl.Store = &dataAccess.RateLimitStore{Db: db}
+		for _, p := range []config.Policy{cfg.RateLimit.Auth, cfg.RateLimit.Public, cfg.RateLimit.User} {
+			c.rateLimitIdle = max(c.rateLimitIdle, policy("", p).RefillTime())
+		}
+	}
+
+	sweepCtx, stopSweep := context.WithCancel(context.Background())
+	sweepDone := make(chan struct{})
+	go func() {
+		defer close(sweepDone)
+		c.sweep(sweepCtx, sweepInterval, time.Minute)
+	}()
+	c.closers = append(c.closers, func() {
+		stopSweep()
+		<-sweepDone
+	})
+
+	app := c.routes(cfg, rl, srv, srv2, adminSrv)
+
+	headers := middleware.SecurityHeaders{
+		HSTSMaxAge:            cfg.Server.HSTSMaxAge,
+		HSTSIncludeSubdomains: true,
+		ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'; base-uri 'none'",
+		ReferrerPolicy:        "no-referrer",
+	}
+
+	handler := middleware.CompressMiddleware(middleware.CompressConfig{MinSize: cfg.Server.CompressMinSize}, app)
+	handler = middleware.CorsMiddleware(NewCorsConfig(cfg.Cors.Origins), handler)
+	handler = middleware.SecurityHeadersMiddleware(headers, handler)
+	handler = middleware.RecoverMiddleware(handler)
+	handler = m.Middleware(handler)
+	handler = middleware.RequestLogger(logger, handler)
+	handler = tracing.Middleware(handler)
+	c.Handler = handler
+
+	admin := http.NewServeMux()
+	admin.Handle("GET /metrics", m.Handler())
+	admin.HandleFunc("GET /healthz", c.Health.Live)
+	admin.HandleFunc("GET /readyz", c.Health.Ready)
+	admin.HandleFunc("GET /read-only", c.readOnlyState)
+	admin.HandleFunc("PUT /read-only", c.setReadOnly)
+	c.Admin = admin
+
+	return c, nil
+}
+
+// routes registers the API on a new mux. Every route that writes to the
+// database goes through the read-only guard, except login and refresh,
+// which would otherwise lock users out for the whole maintenance.
+func (c *Codelet) routes(cfg *config.Config, rl *middleware.RateLimiter, srv userMethods.UserService, srv2 snippetMethods.SnippetService, adminSrv adminMethods.AdminService) *http.ServeMux {
+	app := http.NewServeMux()
+	writes := c.ReadOnly.Guard
+
+	authPolicy := policy("auth", cfg.RateLimit.Auth)
+	publicPolicy := policy("public", cfg.RateLimit.Public)
+	userPolicy := policy("user", cfg.RateLimit.User)
+
+	limitUser := func(bodyLimit int64, next http.HandlerFunc) http.Handler {
+		return middleware.AuthMiddleware(srv.JWTSecret, rl.Limit(userPolicy, rl.ByUserID, middleware.MaxBytes(bodyLimit, next)))
+	}
 
 	app.HandleFunc("/api/v1/ping", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("pong"))
 	})
+	app.HandleFunc("GET /healthz", c.Health.Live)
+	app.HandleFunc("GET /readyz", c.Health.Ready)
+
+	app.Handle("POST /api/v1/register", rl.Limit(authPolicy, rl.ByIP, middleware.MaxBytes(authBody, writes(srv.Signup))))
+	app.Handle("POST /api/v1/login", rl.Limit(authPolicy, rl.ByIP, middleware.MaxBytes(authBody, srv.Login)))
+	app.Handle("POST /api/v1/refresh", rl.Limit(authPolicy, rl.ByIP, middleware.CSRFMiddleware(middleware.MaxBytes(noBody, srv.Refresh))))
+	app.Handle("GET /api/v1/username", limitUser(noBody, srv.GetUsernameByID))
+	app.Handle("POST /api/v1/update/password", limitUser(authBody, writes(srv.ChangePassword)))
+	app.Handle("POST /api/v1/logout", limitUser(noBody, writes(srv.Logout)))
+	app.Handle("DELETE /api/v1/user", limitUser(authBody, writes(srv.DeleteAccount)))
+	app.Handle("POST /api/v1/user/export", limitUser(noBody, srv2.ExportSnippets))
+	app.Handle("GET /api/v1/user/vault", limitUser(noBody, srv2.GetVault))
+	app.Handle("PUT /api/v1/user/vault", limitUser(authBody, writes(srv2.SetVault)))
+	app.Handle("POST /api/v1/user/snippets", limitUser(snippetBody, writes(srv2.AddSnippet)))
+	app.Handle("DELETE /api/v1/user/snippets/{id}", limitUser(noBody, writes(srv2.DeleteSnippet)))
+	app.Handle("GET /api/v1/user/snippets/{id}", limitUser(noBody, srv2.GetUserSnippetByID))
+	app.Handle("GET /api/v1/user/snippets/{id}/raw", limitUser(noBody, srv2.GetUserSnippetRaw))
+	app.Handle("GET /api/v1/user/snippets/{id}/download", limitUser(noBody, srv2.GetUserSnippetDownload))
+	app.Handle("GET /api/v1/user/code/{sha256}", limitUser(noBody, srv2.CheckCode))
+	app.Handle("GET /api/v1/user/small/snippets", limitUser(noBody, srv2.GetSmallUserSnippets))
+	app.Handle("GET /api/v1/user/snippets", limitUser(noBody, srv2.GetUserSnippets))
+	app.Handle("PUT /api/v1/user/snippets/{id}", limitUser(snippetBody, writes(srv2.UpdateUserSnippetByID)))
+	app.Handle("GET /api/v1/admin/backup", limitUser(noBody, adminSrv.Backup))
+	app.Handle("GET /api/v1/languages", rl.Limit(publicPolicy, rl.ByIP, middleware.MaxBytes(noBody, srv2.GetLanguages)))
+	app.Handle("POST /api/v1/detect-language", rl.Limit(publicPolicy, rl.ByIP, middleware.MaxBytes(snippetBody, srv2.DetectLanguage)))
+	app.Handle("GET /api/v1/highlight/{file}", rl.Limit(publicPolicy, rl.ByIP, middleware.MaxBytes(noBody, srv2.GetThemeCSS)))
+	app.Handle("GET /api/v1/public/snippets", rl.Limit(publicPolicy, rl.ByIP, middleware.MaxBytes(noBody, srv2.GetPublicSnippets)))
+	app.Handle("GET /api/v1/public/snippets/{id}", rl.Limit(publicPolicy, rl.ByIP, middleware.MaxBytes(noBody, srv2.GetPublicSnippetByID)))
+	app.Handle("GET /api/v1/public/snippets/{id}/raw", rl.Limit(publicPolicy, rl.ByIP, middleware.MaxBytes(noBody, srv2.GetPublicSnippetRaw)))
+	app.Handle("GET /api/v1/public/snippets/{id}/download", rl.Limit(publicPolicy, rl.ByIP, middleware.MaxBytes(noBody, srv2.GetPublicSnippetDownload)))
 
-	app.HandleFunc("POST /api/v1/register", srv.Signup)
-	app.HandleFunc("POST /api/v1/login", srv.Login)
-	app.HandleFunc("GET /api/v1/refresh", srv.Refresh)
-	app.Handle("GET /api/v1/username", middleware.AuthMiddleware(srv.GetUsernameByID))
-	app.Handle("POST /api/v1/update/password", middleware.AuthMiddleware(srv.ChangePassword))
-	app.Handle("POST /api/v1/logout", middleware.AuthMiddleware(srv.Logout))
-	app.Handle("POST /api/v1/user/snippets", middleware.AuthMiddleware(srv2.AddSnippet))
-	app.Handle("DELETE /api/v1/user/snippets/{id}", middleware.AuthMiddleware(srv2.DeleteSnippet))
-	app.Handle("GET /api/v1/user/snippets/{id}", middleware.AuthMiddleware(srv2.GetUserSnippetByID))
-	app.Handle("GET /api/v1/user/small/snippets", middleware.AuthMiddleware(srv2.GetSmallUserSnippets))
-	app.Handle("GET /api/v1/user/snippets", middleware.AuthMiddleware(srv2.GetUserSnippets))
-	app.Handle("PUT /api/v1/user/snippets/{id}", middleware.AuthMiddleware(srv2.UpdateUserSnippetByID))
-	app.HandleFunc("GET /api/v1/public/snippets", srv2.GetPublicSnippets)
-
-	return app, clean
+	return app
 }
@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/scott-mescudi/codelet/service/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Setup installs the global tracer provider and W3C propagators described by
+// cfg. The returned function flushes pending spans and must be called before
+// the process exits. With the "none" exporter nothing is installed and the
+// otel defaults keep every span a no-op.
+func Setup(ctx context.Context, cfg config.Tracing) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, closer, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res := resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closer != nil {
+			closer.Close()
+		}
+		return err
+	}, nil
+}
+
+func newExporter(ctx context.Context, cfg config.Tracing) (sdktrace.SpanExporter, io.Closer, error) {
+	switch cfg.Exporter {
+	case "none":
+		return nil, nil, nil
+	case "stdout":
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		return exp, nil, err
+	case "file":
+		if err := os.MkdirAll(filepath.Dir(cfg.File), 0750); err != nil {
+			return nil, nil, fmt.Errorf("failed to create trace directory: %w", err)
+		}
+
+		file, err := os.OpenFile(cfg.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return exp, file, nil
+	case "otlp":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if headers := parseHeaders(cfg.Headers.Value()); len(headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(headers))
+		}
+
+		exp, err := otlptracehttp.New(ctx, opts...)
+		return exp, nil, err
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+}
+
+func parseHeaders(raw string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(raw, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if key = strings.TrimSpace(key); ok && key != "" {
+			headers[key] = strings.TrimSpace(value)
+		}
+	}
+	return headers
+}
@@ -0,0 +1,115 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/scott-mescudi/codelet/service/config"
+	"github.com/scott-mescudi/codelet/service/middleware"
+	auth "github.com/scott-mescudi/codelet/shared/auth"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// testSecret signs the tokens of the tests.
+var testSecret = []byte("codelet-test-secret-codelet-test-secret")
+
+func TestMiddlewareSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer tp.Shutdown(context.Background())
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /snippets/{id}", middleware.AuthMiddleware(testSecret, func(w http.ResponseWriter, r *http.Request) {
+		_, span := otel.Tracer("test").Start(r.Context(), "handler")
+		span.End()
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	var logs bytes.Buffer
+	cors := middleware.CorsConfig{Default: middleware.CorsPolicy{AllowedOrigins: []string{"https://codelet.dev"}}}
+	handler := Middleware(middleware.RequestLogger(zerolog.New(&logs), middleware.CorsMiddleware(cors, mux)))
+
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest("GET", "/snippets/5", nil)
+	req.Header.Set("traceparent", parent)
+	req.Header.Set("Authorization", auth.GenerateHMac(testSecret, 42, middleware.ACCESS, time.Now().Add(time.Minute)))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	byName := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range spans {
+		byName[s.Name()] = s
+	}
+
+	tests := []struct {
+		child  string
+		parent string
+	}{
+		{child: "cors", parent: "GET /snippets/{id}"},
+		{child: "auth", parent: "cors"},
+		{child: "handler", parent: "auth"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.child, func(t *testing.T) {
+			child, ok := byName[tt.child]
+			if !ok {
+				t.Fatalf("span %q not recorded, got %d spans", tt.child, len(spans))
+			}
+			if child.Parent().SpanID() != byName[tt.parent].SpanContext().SpanID() {
+				t.Errorf("expected %q to be a child of %q", tt.child, tt.parent)
+			}
+		})
+	}
+
+	server := byName["GET /snippets/{id}"]
+	if server == nil {
+		t.Fatal("server span was not renamed to the route")
+	}
+	if got := server.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace was not continued from traceparent, got %s", got)
+	}
+	if !strings.Contains(logs.String(), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`) {
+		t.Errorf("access line is missing the trace id: %s", logs.String())
+	}
+}
+
+func TestSetupFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces", "spans.json")
+	cfg := config.Default().Tracing
+	cfg.Exporter = "file"
+	cfg.File = path
+
+	shutdown, err := Setup(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "written")
+	span.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"Name":"written"`) {
+		t.Errorf("span missing from trace file: %s", data)
+	}
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+const CSRFCookieName = "CODELET-CSRF-TOKEN"
+const CSRFHeaderName = "X-CSRF-Token"
+
+func GenerateCSRFToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func CompareCSRFToken(cookie, header string) bool {
+	if cookie == "" || header == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
@@ -5,7 +5,6 @@ import (
 	"time"
 )
 
-var HMACSecretKey = []byte("apeirbvpijebvejbfpvibfevqepirjvb")
 var Issuer = "codelet"
 
 type Claims struct {
@@ -14,7 +13,8 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-func GenerateHMac(userID int, tokenType int8, timeframe time.Time) string {
+// GenerateHMac signs a token for userID with secret, valid until timeframe.
+func GenerateHMac(secret []byte, userID int, tokenType int8, timeframe time.Time) string {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
 		UserID:    userID,
 		TokenType: tokenType,
@@ -25,7 +25,7 @@ func GenerateHMac(userID int, tokenType int8, timeframe time.Time) string {
 		},
 	})
 
-	tkstring, err := token.SignedString(HMACSecretKey)
+	tkstring, err := token.SignedString(secret)
 	if err != nil {
 		panic(err)
 	}
@@ -6,12 +6,14 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func ValidateHmac(tokenString string) (int, int8, error) {
+// ValidateHmac checks a token signed with secret and returns its user and
+// token type.
+func ValidateHmac(secret []byte, tokenString string) (int, int8, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return HMACSecretKey, nil
+		return secret, nil
 	})
 
 	if err != nil {
@@ -0,0 +1,38 @@
+package compression
+
+import (
+	"errors"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+// MinDictionaryID is the first ID outside the range zstd reserves.
+const MinDictionaryID = 32768
+
+// Dictionary is a trained zstd dictionary. ID is written into every frame
+// compressed with it, which is how a blob finds its dictionary again.
+type Dictionary struct {
+	ID       uint32
+	Language string
+	Data     []byte
+}
+
+// TrainDictionary builds a dictionary of at most maxSize bytes from samples,
+// which should be typical uncompressed snippets of language.
+func TrainDictionary(language string, id uint32, samples [][]byte, maxSize int) (*Dictionary, error) {
+	if id < MinDictionaryID {
+		return nil, errors.New("dictionary IDs below 32768 are reserved")
+	}
+
+	data, err := dict.BuildZstdDict(samples, dict.Options{
+		MaxDictSize: maxSize,
+		HashBytes:   6,
+		ZstdDictID:  id,
+		ZstdLevel:   zstd.SpeedDefault,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Dictionary{ID: id, Language: languageKey(language), Data: data}, nil
+}
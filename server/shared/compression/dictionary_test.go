@@ -0,0 +1,138 @@
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// goSamples returns n small, similar but not identical Go snippets, the kind
+// of input a dictionary is meant for.
+func goSamples(n int) [][]byte {
+	samples := make([][]byte, n)
+	for i := range samples {
+		samples[i] = fmt.Appendf(nil, `package handler%d
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+func (s *Service) Get%dByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return errors.New("invalid id %d")
+	}
+	return s.store.Load(ctx, id+%d)
+}
+`, i, i, i*7, i*13)
+	}
+	return samples
+}
+
+func trained(t testing.TB, language string, id uint32) Dictionary {
+	d, err := TrainDictionary(language, id, goSamples(300), 8<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *d
+}
+
+func newCodec(t testing.TB, dicts ...Dictionary) *Codec {
+	c, err := NewCodec(dicts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestDictionaries(t *testing.T) {
+	first := trained(t, "Go", MinDictionaryID)
+	second := trained(t, "go", MinDictionaryID+1)
+	data := goSamples(301)[300]
+
+	var none *Codec
+	plain, err := none.Compress("go", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := newCodec(t, first).Compress(" GO ", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newCodec(t, first, second)
+	current, err := c.Compress("go", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := c.Compress("python", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		blob []byte
+		id   uint32
+	}{
+		{name: "No dictionary", blob: plain, id: 0},
+		{name: "Replaced dictionary", blob: old, id: first.ID},
+		{name: "Current dictionary", blob: current, id: second.ID},
+		{name: "Language without dictionary", blob: other, id: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := DictionaryID(tt.blob)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != tt.id {
+				t.Errorf("expected dictionary %d, got %d", tt.id, id)
+			}
+
+			got, err := c.Decompress(tt.blob)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Error("round trip changed the data")
+			}
+		})
+	}
+
+	if len(current) >= len(plain) {
+		t.Errorf("dictionary did not help: %d bytes with, %d without", len(current), len(plain))
+	}
+	if got := c.CurrentDictionaryID("Go"); got != second.ID {
+		t.Errorf("expected current dictionary %d, got %d", second.ID, got)
+	}
+
+	t.Run("Unknown dictionary", func(t *testing.T) {
+		c := newCodec(t, second)
+		if c.KnownDictionary(first.ID) {
+			t.Error("dropped dictionary is still known")
+		}
+		if _, err := c.Decompress(old); !errors.Is(err, ErrUnknownDictionary) {
+			t.Errorf("expected ErrUnknownDictionary, got %v", err)
+		}
+	})
+}
+
+func TestTrainDictionaryReservedID(t *testing.T) {
+	if _, err := TrainDictionary("go", 1, goSamples(300), 8<<10); err == nil {
+		t.Error("reserved dictionary ID was accepted")
+	}
+}
+
+func TestDictionaryIDEmpty(t *testing.T) {
+	id, err := DictionaryID(nil)
+	if err != nil || id != 0 {
+		t.Errorf("expected 0 for an empty blob, got %d, %v", id, err)
+	}
+}
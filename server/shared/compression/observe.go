@@ -0,0 +1,33 @@
+package compression
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	OpCompress   = "compress"
+	OpDecompress = "decompress"
+)
+
+// Observer is told about every compress and decompress call, it is how the
+// metrics package sees this one without the two depending on each other.
+type Observer interface {
+	ObserveCompression(op string, in, out int, took time.Duration, err error)
+}
+
+var observer atomic.Pointer[Observer]
+
+func SetObserver(o Observer) {
+	if o == nil {
+		observer.Store(nil)
+		return
+	}
+	observer.Store(&o)
+}
+
+func observe(op string, in, out int, start time.Time, err error) {
+	if o := observer.Load(); o != nil {
+		(*o).ObserveCompression(op, in, out, time.Since(start), err)
+	}
+}
@@ -1,39 +1,180 @@
 package compression
 
 import (
-	"bytes"
-	"io"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/klauspost/compress/zstd"
 )
 
-func CompressZSTD(data []byte) ([]byte, error) {
-	var buf bytes.Buffer
-	encoder, err := zstd.NewWriter(&buf)
+// ErrUnknownDictionary is returned by Decompress for a blob compressed with
+// a dictionary the Codec wasn't created with.
+var ErrUnknownDictionary = zstd.ErrUnknownDictionary
+
+// maxDecodedSize caps what a single blob may decompress to, a damaged or
+// hostile blob can't make the decoder allocate more.
+const maxDecodedSize = 64 << 20
+
+// Codec is a set of dictionaries with the encoders and the decoder for them.
+// Encoder.EncodeAll and Decoder.DecodeAll are safe for concurrent use and
+// keep a pool of up to GOMAXPROCS workers each, so one Codec serves every
+// caller. A nil Codec knows no dictionaries.
+type Codec struct {
+	plain      *zstd.Encoder
+	byLanguage map[string]*zstd.Encoder
+	ids        map[string]uint32
+	known      map[uint32]bool
+	decoder    *zstd.Decoder
+}
+
+// plain is what a nil Codec uses. It is never closed.
+var plain *Codec
+
+func init() {
+	c, err := NewCodec(nil)
+	if err != nil {
+		panic(err)
+	}
+	plain = c
+}
+
+func newEncoder(opts ...zstd.EOption) (*zstd.Encoder, error) {
+	return zstd.NewWriter(nil, append([]zstd.EOption{
+		zstd.WithEncoderConcurrency(runtime.GOMAXPROCS(0)),
+		// An empty snippet still gets a frame, so every stored blob is one.
+		zstd.WithZeroFrames(true),
+	}, opts...)...)
+}
+
+// NewCodec returns a Codec for dicts, oldest first. Every one of them can be
+// decompressed from, and the last one of each language is used to compress.
+// The caller must Close it once nothing uses it anymore.
+func NewCodec(dicts []Dictionary) (*Codec, error) {
+	enc, err := newEncoder()
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = encoder.Write(data)
+	c := &Codec{plain: enc, byLanguage: map[string]*zstd.Encoder{}, ids: map[string]uint32{}, known: map[uint32]bool{}}
+	raw := make([][]byte, 0, len(dicts))
+	for _, d := range dicts {
+		raw = append(raw, d.Data)
+		c.known[d.ID] = true
+
+		// Later dictionaries of a language replace earlier ones for new
+		// blobs, the earlier ones stay with the decoder.
+		enc, err := newEncoder(zstd.WithEncoderDict(d.Data))
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		key := languageKey(d.Language)
+		if old, ok := c.byLanguage[key]; ok {
+			old.Close()
+		}
+		c.byLanguage[key] = enc
+		c.ids[key] = d.ID
+	}
+
+	c.decoder, err = zstd.NewReader(nil,
+		zstd.WithDecoderConcurrency(0),
+		zstd.WithDecoderMaxMemory(maxDecodedSize),
+		zstd.WithDecoderDicts(raw...),
+	)
 	if err != nil {
+		c.Close()
 		return nil, err
 	}
+	return c, nil
+}
+
+// Close stops the workers of the encoders and the decoder. The Codec must
+// not be used afterwards.
+func (c *Codec) Close() {
+	if c == nil {
+		return
+	}
 
-	encoder.Close()
-	return buf.Bytes(), err
+	c.plain.Close()
+	for _, enc := range c.byLanguage {
+		enc.Close()
+	}
+	if c.decoder != nil {
+		c.decoder.Close()
+	}
+}
+
+func (c *Codec) orPlain() *Codec {
+	if c == nil {
+		return plain
+	}
+	return c
 }
 
+func languageKey(language string) string {
+	return strings.ToLower(strings.TrimSpace(language))
+}
+
+// CurrentDictionaryID is the dictionary Compress uses for language, or 0 when
+// there is none.
+func (c *Codec) CurrentDictionaryID(language string) uint32 {
+	return c.orPlain().ids[languageKey(language)]
+}
+
+// KnownDictionary reports whether blobs compressed with dictionary id can be
+// decompressed.
+func (c *Codec) KnownDictionary(id uint32) bool {
+	return id == 0 || c.orPlain().known[id]
+}
+
+// DictionaryID reads the dictionary a blob was compressed with from its frame
+// header, 0 means none. Older empty blobs have no frame at all.
+func DictionaryID(data []byte) (uint32, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	var h zstd.Header
+	if err := h.Decode(data); err != nil {
+		return 0, err
+	}
+	return h.DictionaryID, nil
+}
+
+// CompressZSTD compresses data without a dictionary.
+func CompressZSTD(data []byte) ([]byte, error) {
+	return plain.Compress("", data)
+}
+
+// DecompressZSTD decompresses data compressed without a dictionary.
 func DecompressZSTD(data []byte) ([]byte, error) {
-	b := bytes.NewBuffer(data)
-	decoder, err := zstd.NewReader(b)
-	if err != nil {
-		return nil, err
+	return plain.Decompress(data)
+}
+
+// Compress compresses data with the dictionary trained for language, or
+// without one when there is none.
+func (c *Codec) Compress(language string, data []byte) (out []byte, err error) {
+	start := time.Now()
+	defer func() { observe(OpCompress, len(data), len(out), start, err) }()
+
+	c = c.orPlain()
+	enc, ok := c.byLanguage[languageKey(language)]
+	if !ok {
+		enc = c.plain
 	}
-	defer decoder.Close()
+	return enc.EncodeAll(data, make([]byte, 0, len(data)/2+16)), nil
+}
 
-	var out bytes.Buffer
-	if _, err = io.Copy(&out, decoder); err != nil {
+// Decompress decompresses data compressed with no dictionary or one of those
+// of c, ErrUnknownDictionary is returned for any other.
+func (c *Codec) Decompress(data []byte) (decompressed []byte, err error) {
+	start := time.Now()
+	defer func() { observe(OpDecompress, len(data), len(decompressed), start, err) }()
+
+	decompressed, err = c.orPlain().decoder.DecodeAll(data, nil)
+	if err != nil {
 		return nil, err
 	}
-	return out.Bytes(), nil
+	return decompressed, nil
 }
@@ -0,0 +1,104 @@
+package compression
+
+import (
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Run with go test -bench . -benchmem ./shared/compression. The NewWriter and
+// NewReader benchmarks are how every call used to work and are kept as the
+// baseline.
+
+func benchSnippet() []byte {
+	return goSamples(301)[300]
+}
+
+func BenchmarkCompressNewWriter(b *testing.B) {
+	data := benchSnippet()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for b.Loop() {
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		enc.EncodeAll(data, nil)
+		enc.Close()
+	}
+}
+
+func BenchmarkDecompressNewReader(b *testing.B) {
+	data := benchSnippet()
+	blob, _ := CompressZSTD(data)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for b.Loop() {
+		dec, err := zstd.NewReader(nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := dec.DecodeAll(blob, nil); err != nil {
+			b.Fatal(err)
+		}
+		dec.Close()
+	}
+}
+
+func BenchmarkCompressZSTD(b *testing.B) {
+	data := benchSnippet()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := CompressZSTD(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDecompressZSTD(b *testing.B) {
+	data := benchSnippet()
+	blob, _ := CompressZSTD(data)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := DecompressZSTD(blob); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkCompressZSTDDictionary(b *testing.B) {
+	c := newCodec(b, trained(b, "go", MinDictionaryID))
+	data := benchSnippet()
+	blob, _ := c.Compress("go", data)
+	b.ReportMetric(float64(len(blob)), "bytes/blob")
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := c.Compress("go", data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDecompressZSTDDictionary(b *testing.B) {
+	c := newCodec(b, trained(b, "go", MinDictionaryID))
+	data := benchSnippet()
+	blob, _ := c.Compress("go", data)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := c.Decompress(blob); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,186 @@
+// Package encryption implements envelope encryption for data at rest.
+//
+// Every user gets a random data key that encrypts their snippets with
+// AES-256-GCM. Data keys are stored wrapped, that is encrypted, by a master
+// key from the configuration. Rotating the master key only means rewrapping
+// the data keys, the snippets themselves stay untouched.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the length of master and data keys, AES-256.
+const KeySize = 32
+
+// version prefixes every ciphertext so the format can change later.
+const version = 1
+
+var (
+	ErrUnknownMasterKey = errors.New("unknown master key")
+	ErrDecrypt          = errors.New("ciphertext is damaged or was encrypted with another key")
+)
+
+// Keyring holds the master keys by ID. The active key wraps new data keys,
+// the others are only kept to unwrap data keys that have not been rekeyed
+// yet.
+type Keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// ParseKeyring reads master keys written as comma separated id:base64 pairs,
+// the first one becomes the active key. Generate a key with
+// `openssl rand -base64 32`.
+func ParseKeyring(spec string) (*Keyring, error) {
+	k := &Keyring{keys: map[string]cipher.AEAD{}}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(item, ":")
+		if !ok || !validID(id) {
+			return nil, errors.New("master keys must look like id:base64key, ids use letters, digits, '-' and '_'")
+		}
+
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("master key %q is listed twice", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("master key %q is not valid base64", id)
+		}
+
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("master key %q is %d bytes, want %d", id, len(key), KeySize)
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if k.active == "" {
+			k.active = id
+		}
+		k.keys[id] = aead
+	}
+
+	if k.active == "" {
+		return nil, errors.New("no master keys given")
+	}
+	return k, nil
+}
+
+func validID(id string) bool {
+	if id == "" || len(id) > 32 {
+		return false
+	}
+
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// ActiveID is the ID of the master key new data keys are wrapped with.
+func (k *Keyring) ActiveID() string {
+	return k.active
+}
+
+// NewDataKey returns a fresh data key together with its wrapped form.
+func (k *Keyring) NewDataKey() (key []byte, masterID string, wrapped []byte, err error) {
+	key = make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, "", nil, err
+	}
+
+	masterID, wrapped, err = k.Wrap(key)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return key, masterID, wrapped, nil
+}
+
+// Wrap encrypts a data key with the active master key.
+func (k *Keyring) Wrap(key []byte) (masterID string, wrapped []byte, err error) {
+	wrapped, err = seal(k.keys[k.active], key, wrapAAD(k.active))
+	return k.active, wrapped, err
+}
+
+// Unwrap decrypts a data key wrapped by the master key masterID.
+func (k *Keyring) Unwrap(masterID string, wrapped []byte) ([]byte, error) {
+	aead, ok := k.keys[masterID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownMasterKey, masterID)
+	}
+	return open(aead, wrapped, wrapAAD(masterID))
+}
+
+// The master key ID is authenticated along with the data key, so a wrapped
+// key can't be passed off as belonging to another master key.
+func wrapAAD(masterID string) []byte {
+	return []byte("codelet data key " + masterID)
+}
+
+// Seal encrypts plaintext with a data key. aad is authenticated along with
+// it and isn't stored, it ties the ciphertext to where it is kept so it
+// can't be moved elsewhere under the same data key.
+func Seal(key, plaintext, aad []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return seal(aead, plaintext, aad)
+}
+
+// Open decrypts what Seal produced with the same data key and aad.
+func Open(key, ciphertext, aad []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, ciphertext, aad)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal lays out a ciphertext as version byte, nonce, then the sealed data.
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	out := make([]byte, 1+aead.NonceSize(), 1+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	out[0] = version
+	if _, err := rand.Read(out[1:]); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, out[1:], plaintext, aad), nil
+}
+
+func open(aead cipher.AEAD, ciphertext, aad []byte) ([]byte, error) {
+	if len(ciphertext) < 1+aead.NonceSize()+aead.Overhead() || ciphertext[0] != version {
+		return nil, ErrDecrypt
+	}
+
+	nonce := ciphertext[1 : 1+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, ciphertext[1+aead.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,112 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, KeySize))
+}
+
+func TestParseKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		active  string
+		wantErr string
+	}{
+		{name: "Single key", spec: "k1:" + testKey(1), active: "k1"},
+		{name: "First key is active", spec: " 2024-b:" + testKey(2) + ", 2024-a:" + testKey(1), active: "2024-b"},
+		{name: "Empty", spec: " , ", wantErr: "no master keys"},
+		{name: "Missing id", spec: testKey(1), wantErr: "id:base64key"},
+		{name: "Bad id", spec: "a b:" + testKey(1), wantErr: "id:base64key"},
+		{name: "Bad base64", spec: "k1:not base64", wantErr: "not valid base64"},
+		{name: "Short key", spec: "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), wantErr: "5 bytes"},
+		{name: "Duplicate", spec: "k1:" + testKey(1) + ",k1:" + testKey(2), wantErr: "twice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseKeyring(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if k.ActiveID() != tt.active {
+				t.Errorf("active key is %q, want %q", k.ActiveID(), tt.active)
+			}
+		})
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	old, err := ParseKeyring("old:" + testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := ParseKeyring("new:" + testKey(2) + ",old:" + testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, masterID, wrapped, err := old.NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aad := []byte("blob 1")
+	ciphertext, err := Seal(key, []byte("secret code"), aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After rotation the old wrapping still opens, and rewrapping moves the
+	// data key to the new master key without touching the ciphertext.
+	unwrapped, err := rotated.Unwrap(masterID, wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newID, rewrapped, err := rotated.Wrap(unwrapped)
+	if err != nil || newID != "new" {
+		t.Fatalf("rewrap gave %q, %v", newID, err)
+	}
+
+	if _, err := old.Unwrap(newID, rewrapped); !errors.Is(err, ErrUnknownMasterKey) {
+		t.Errorf("expected ErrUnknownMasterKey, got %v", err)
+	}
+
+	if _, err := rotated.Unwrap("old", rewrapped); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("a wrapped key must not open under another master key id, got %v", err)
+	}
+
+	final, err := rotated.Unwrap(newID, rewrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := Open(final, ciphertext, aad)
+	if err != nil || string(plaintext) != "secret code" {
+		t.Fatalf("Open = %q, %v", plaintext, err)
+	}
+
+	if _, err := Open(final, ciphertext, []byte("blob 2")); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("ciphertext opened with other additional data, err %v", err)
+	}
+
+	ciphertext[len(ciphertext)-1] ^= 1
+	if _, err := Open(final, ciphertext, aad); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("tampered ciphertext opened, err %v", err)
+	}
+}
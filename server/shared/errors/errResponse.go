@@ -1,6 +1,7 @@
 package errors
 
 import (
+	stderrors "errors"
 	"log"
 	"net/http"
 
@@ -9,6 +10,10 @@ import (
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
+// StatusClientClosedRequest is the non standard status nginx made popular for
+// requests the client gave up on before an answer was ready.
+const StatusClientClosedRequest = 499
+
 func ErrorWithJson(w http.ResponseWriter, code int, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
@@ -23,3 +28,10 @@ func ErrorWithJson(w http.ResponseWriter, code int, message string) {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
+
+// IsBodyTooLarge reports whether err comes from reading past a body limit set
+// with http.MaxBytesReader.
+func IsBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return stderrors.As(err, &maxBytesErr)
+}
@@ -0,0 +1,103 @@
+// Package highlight colours code on the server, for clients that can't run
+// the frontend's highlighter: the CLI, email digests and embeds.
+//
+// Tokenize splits code into tokens with a lexer per language. Languages
+// without one come back as a single Plain token, so every snippet renders.
+// The tokens are rendered by HTML, with classes styled by CSS, by
+// InlineHTML, which needs no stylesheet, or by ANSI for terminals.
+package highlight
+
+import (
+	"strings"
+)
+
+// Kind is the syntactic role of a token, which picks its style.
+type Kind uint8
+
+const (
+	Plain Kind = iota
+	Comment
+	Keyword
+	// Builtin is a predeclared type or function, such as int or print.
+	Builtin
+	// Literal is a named constant, such as true, nil or None.
+	Literal
+	String
+	Number
+	Operator
+	Punctuation
+	// Function is a name that is called.
+	Function
+	// Key is a key of a mapping, in JSON and YAML.
+	Key
+	// Variable is a shell variable, $HOME.
+	Variable
+)
+
+var kindNames = [...]string{
+	Plain:       "plain",
+	Comment:     "comment",
+	Keyword:     "keyword",
+	Builtin:     "builtin",
+	Literal:     "literal",
+	String:      "string",
+	Number:      "number",
+	Operator:    "operator",
+	Punctuation: "punctuation",
+	Function:    "function",
+	Key:         "key",
+	Variable:    "variable",
+}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "plain"
+}
+
+// Token is a piece of code of one Kind. Joined, the tokens of some code
+// give the code back.
+type Token struct {
+	Kind Kind
+	Text string
+}
+
+// lexers holds the lexer of each supported language ID, see package
+// languages.
+var lexers = map[string]*lexer{
+	"go":         goLexer,
+	"python":     pythonLexer,
+	"javascript": javascriptLexer,
+	"jsx":        javascriptLexer,
+	"typescript": typescriptLexer,
+	"tsx":        typescriptLexer,
+	"sql":        sqlLexer,
+	"bash":       bashLexer,
+	"yaml":       yamlLexer,
+	"json":       jsonLexer,
+}
+
+// Supported reports whether language has a lexer.
+func Supported(language string) bool {
+	_, ok := lexers[language]
+	return ok
+}
+
+// Tokenize splits code in language into tokens.
+func Tokenize(language, code string) []Token {
+	l, ok := lexers[language]
+	if !ok {
+		if code == "" {
+			return nil
+		}
+		return []Token{{Kind: Plain, Text: code}}
+	}
+	return l.tokenize(code)
+}
+
+// lines splits the text of a token at newlines, keeping them, for renderers
+// that style line by line.
+func lines(text string) []string {
+	return strings.SplitAfter(text, "\n")
+}
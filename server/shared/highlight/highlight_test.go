@@ -0,0 +1,167 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		code     string
+		expected []Token
+	}{
+		{
+			name:     "Go",
+			language: "go",
+			code:     "func f() error { return nil } // done",
+			expected: []Token{
+				{Keyword, "func"}, {Plain, " "}, {Function, "f"}, {Punctuation, "()"}, {Plain, " "},
+				{Builtin, "error"}, {Plain, " "}, {Punctuation, "{"}, {Plain, " "}, {Keyword, "return"},
+				{Plain, " "}, {Literal, "nil"}, {Plain, " "}, {Punctuation, "}"}, {Plain, " "}, {Comment, "// done"},
+			},
+		},
+		{
+			name:     "Go raw string",
+			language: "go",
+			code:     "x := `a\n\"b`",
+			expected: []Token{{Plain, "x "}, {Operator, ":="}, {Plain, " "}, {String, "`a\n\"b`"}},
+		},
+		{
+			name:     "Python prefixed strings",
+			language: "python",
+			code:     "def f(): return f\"{x}\" + rb'\\x00'",
+			expected: []Token{
+				{Keyword, "def"}, {Plain, " "}, {Function, "f"}, {Punctuation, "()"}, {Operator, ":"}, {Plain, " "},
+				{Keyword, "return"}, {Plain, " "}, {String, "f\"{x}\""}, {Plain, " "}, {Operator, "+"}, {Plain, " "},
+				{String, "rb'\\x00'"},
+			},
+		},
+		{
+			name:     "Python docstring",
+			language: "python",
+			code:     "\"\"\"a\n'b'\"\"\"\nNone",
+			expected: []Token{{String, "\"\"\"a\n'b'\"\"\""}, {Plain, "\n"}, {Literal, "None"}},
+		},
+		{
+			name:     "JavaScript",
+			language: "javascript",
+			code:     "const $el = document.querySelector(`#${id}`);",
+			expected: []Token{
+				{Keyword, "const"}, {Plain, " $el "}, {Operator, "="}, {Plain, " "}, {Builtin, "document"},
+				{Operator, "."}, {Function, "querySelector"}, {Punctuation, "("}, {String, "`#${id}`"},
+				{Punctuation, ");"},
+			},
+		},
+		{
+			name:     "TypeScript",
+			language: "tsx",
+			code:     "interface A { b: number }",
+			expected: []Token{
+				{Keyword, "interface"}, {Plain, " A "}, {Punctuation, "{"}, {Plain, " b"}, {Operator, ":"},
+				{Plain, " "}, {Builtin, "number"}, {Plain, " "}, {Punctuation, "}"},
+			},
+		},
+		{
+			name:     "SQL in any case",
+			language: "sql",
+			code:     "select COUNT(*) From t -- all\nWHERE a = 'it''s'",
+			expected: []Token{
+				{Keyword, "select"}, {Plain, " "}, {Builtin, "COUNT"}, {Punctuation, "("}, {Operator, "*"},
+				{Punctuation, ")"}, {Plain, " "}, {Keyword, "From"}, {Plain, " t "}, {Comment, "-- all"},
+				{Plain, "\n"}, {Keyword, "WHERE"}, {Plain, " a "}, {Operator, "="}, {Plain, " "},
+				{String, "'it''s'"},
+			},
+		},
+		{
+			name:     "Bash",
+			language: "bash",
+			code:     "#!/bin/sh\nif [ $# -gt 0 ]; then echo \"${1}\"; fi # x",
+			expected: []Token{
+				{Comment, "#!/bin/sh"}, {Plain, "\n"}, {Keyword, "if"}, {Plain, " "}, {Punctuation, "["},
+				{Plain, " "}, {Variable, "$#"}, {Plain, " "}, {Operator, "-"}, {Plain, "gt "}, {Number, "0"},
+				{Plain, " "}, {Punctuation, "];"}, {Plain, " "}, {Keyword, "then"}, {Plain, " "},
+				{Builtin, "echo"}, {Plain, " "}, {String, "\"${1}\""}, {Punctuation, ";"}, {Plain, " "},
+				{Keyword, "fi"}, {Plain, " "}, {Comment, "# x"},
+			},
+		},
+		{
+			name:     "YAML",
+			language: "yaml",
+			code:     "runs-on: ubuntu-latest # ci\nurl: http://x\n\"on\": true",
+			expected: []Token{
+				{Key, "runs-on"}, {Operator, ":"}, {Plain, " ubuntu-latest "}, {Comment, "# ci"},
+				{Plain, "\n"}, {Key, "url"}, {Operator, ":"}, {Plain, " http"}, {Operator, "://"},
+				{Plain, "x\n"}, {Key, "\"on\""}, {Operator, ":"}, {Plain, " "}, {Literal, "true"},
+			},
+		},
+		{
+			name:     "JSON",
+			language: "json",
+			code:     `{"a": [1.5, null, "b"]}`,
+			expected: []Token{
+				{Punctuation, "{"}, {Key, `"a"`}, {Operator, ":"}, {Plain, " "}, {Punctuation, "["},
+				{Number, "1.5"}, {Punctuation, ","}, {Plain, " "}, {Literal, "null"}, {Punctuation, ","},
+				{Plain, " "}, {String, `"b"`}, {Punctuation, "]}"},
+			},
+		},
+		{
+			name:     "Unclosed string",
+			language: "go",
+			code:     "s := \"abc\nx",
+			expected: []Token{{Plain, "s "}, {Operator, ":="}, {Plain, " "}, {String, "\"abc"}, {Plain, "\nx"}},
+		},
+		{
+			name:     "Unsupported",
+			language: "cobol",
+			code:     "DISPLAY 'HI'.",
+			expected: []Token{{Plain, "DISPLAY 'HI'."}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Tokenize(tt.language, tt.code)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("expected %d tokens, got %d: %q", len(tt.expected), len(got), got)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("token %d: expected %v %q, got %v %q", i, tt.expected[i].Kind, tt.expected[i].Text, got[i].Kind, got[i].Text)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenizeKeepsCode(t *testing.T) {
+	inputs := []string{
+		"",
+		"\"unterminated",
+		"/* unterminated",
+		"a\\",
+		"'\\",
+		"${unterminated\n}",
+		"$",
+		"r",
+		"日本語 := \"ü\" // ö",
+		"1e-5 0x1F .5 1.2.3",
+		"\t\r\n",
+	}
+
+	for language := range lexers {
+		for _, code := range inputs {
+			var b strings.Builder
+			for _, tok := range Tokenize(language, code) {
+				if tok.Text == "" {
+					t.Errorf("%s: empty token in %q", language, code)
+				}
+				b.WriteString(tok.Text)
+			}
+			if b.String() != code {
+				t.Errorf("%s: tokens of %q give %q", language, code, b.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package highlight
+
+import (
+	"strings"
+)
+
+// delimiter opens and closes a string or a block comment.
+type delimiter struct {
+	open, close string
+	// escapes lets a backslash escape the close delimiter.
+	escapes bool
+	// multiline delimiters may span lines, others end with the line.
+	multiline bool
+}
+
+// lexer tokenizes code by rules shared by the languages it is set up for.
+// It doesn't parse, a token's kind follows from the token and the ones
+// right next to it.
+type lexer struct {
+	lineComments  []string
+	blockComments []delimiter
+	// strings are tried in order, so longer openers go first.
+	strings []delimiter
+	// stringPrefixes are letters that can open a string, as Python's f"".
+	stringPrefixes string
+	// commentAtWord only starts line comments at the start of a word, the
+	// # in the shell's $# isn't one.
+	commentAtWord bool
+
+	keywords map[string]bool
+	builtins map[string]bool
+	literals map[string]bool
+	// foldCase matches keywords, builtins and literals in any case, they
+	// are listed in lowercase.
+	foldCase bool
+
+	// identStart and identChars are characters besides letters, digits and
+	// _ that start and continue a name.
+	identStart string
+	identChars string
+
+	// functions marks names followed by ( as Function.
+	functions bool
+	// keys marks names and strings followed by : as Key. With keySpace the
+	// colon needs a space or the end of the line after it, as in YAML.
+	keys     bool
+	keySpace bool
+	// variables lexes $name and ${name} as Variable.
+	variables bool
+}
+
+// set builds a lookup set of words.
+func set(words ...string) map[string]bool {
+	m := make(map[string]bool, len(words))
+	for _, w := range words {
+		m[w] = true
+	}
+	return m
+}
+
+// tokens collects tokens, merging neighbours of the same kind.
+type tokens []Token
+
+func (t *tokens) add(kind Kind, text string) {
+	if text == "" {
+		return
+	}
+	if n := len(*t); n > 0 && (*t)[n-1].Kind == kind {
+		(*t)[n-1].Text += text
+		return
+	}
+	*t = append(*t, Token{Kind: kind, Text: text})
+}
+
+func (l *lexer) tokenize(code string) []Token {
+	var out tokens
+	for i := 0; i < len(code); {
+		c := code[i]
+		rest := code[i:]
+
+		if isSpace(c) {
+			j := i + 1
+			for j < len(code) && isSpace(code[j]) {
+				j++
+			}
+			out.add(Plain, code[i:j])
+			i = j
+			continue
+		}
+
+		if d, ok := l.blockComment(rest); ok {
+			j := scanDelimited(code, i, d)
+			out.add(Comment, code[i:j])
+			i = j
+			continue
+		}
+
+		if l.lineComment(code, i) {
+			j := strings.IndexByte(rest, '\n')
+			if j < 0 {
+				j = len(rest)
+			}
+			out.add(Comment, rest[:j])
+			i += j
+			continue
+		}
+
+		if d, start, ok := l.stringAt(code, i); ok {
+			j := scanDelimited(code, start, d)
+			out.add(l.keyOr(code, j, String), code[i:j])
+			i = j
+			continue
+		}
+
+		if l.variables && c == '$' {
+			j := scanVariable(code, i)
+			if j > i+1 {
+				out.add(Variable, code[i:j])
+				i = j
+				continue
+			}
+		}
+
+		if isDigit(c) || (c == '.' && i+1 < len(code) && isDigit(code[i+1])) {
+			j := i + 1
+			for j < len(code) && (isWordByte(code[j]) || (code[j] == '.' && j+1 < len(code) && isDigit(code[j+1]))) {
+				j++
+			}
+			out.add(Number, code[i:j])
+			i = j
+			continue
+		}
+
+		if l.isIdentStart(c) {
+			j := i + 1
+			for j < len(code) && l.isIdentChar(code[j]) {
+				j++
+			}
+			out.add(l.word(code, i, j), code[i:j])
+			i = j
+			continue
+		}
+
+		if strings.IndexByte("()[]{},;", c) >= 0 {
+			out.add(Punctuation, code[i:i+1])
+		} else {
+			out.add(Operator, code[i:i+1])
+		}
+		i++
+	}
+	return out
+}
+
+// word returns the kind of the name code[i:j].
+func (l *lexer) word(code string, i, j int) Kind {
+	w := code[i:j]
+	if l.foldCase {
+		w = strings.ToLower(w)
+	}
+
+	switch {
+	case l.keyOr(code, j, Plain) == Key:
+		return Key
+	case l.keywords[w]:
+		return Keyword
+	case l.literals[w]:
+		return Literal
+	}
+
+	if l.functions && next(code, j) == '(' {
+		return Function
+	}
+	if l.builtins[w] {
+		return Builtin
+	}
+	return Plain
+}
+
+// keyOr returns Key when what ends at j is the key of a mapping, and kind
+// otherwise.
+func (l *lexer) keyOr(code string, j int, kind Kind) Kind {
+	if !l.keys {
+		return kind
+	}
+
+	for j < len(code) && (code[j] == ' ' || code[j] == '\t') {
+		j++
+	}
+	if j >= len(code) || code[j] != ':' {
+		return kind
+	}
+	if l.keySpace && j+1 < len(code) && !isSpace(code[j+1]) {
+		return kind
+	}
+	return Key
+}
+
+func (l *lexer) blockComment(rest string) (delimiter, bool) {
+	for _, d := range l.blockComments {
+		if strings.HasPrefix(rest, d.open) {
+			return d, true
+		}
+	}
+	return delimiter{}, false
+}
+
+func (l *lexer) lineComment(code string, i int) bool {
+	if l.commentAtWord && i > 0 && !isSpace(code[i-1]) && code[i-1] != ';' {
+		return false
+	}
+	for _, open := range l.lineComments {
+		if strings.HasPrefix(code[i:], open) {
+			return true
+		}
+	}
+	return false
+}
+
+// stringAt finds a string opening at i, after the prefix letters of the
+// language if any. start is where the delimiter itself opens.
+func (l *lexer) stringAt(code string, i int) (d delimiter, start int, ok bool) {
+	start = i
+	for start < len(code) && start-i < 2 && strings.IndexByte(l.stringPrefixes, code[start]) >= 0 {
+		start++
+	}
+	// A prefix is only one when it isn't the start of a longer name.
+	if start > i && start < len(code) && l.isIdentChar(code[start]) {
+		return delimiter{}, 0, false
+	}
+
+	for _, d := range l.strings {
+		if strings.HasPrefix(code[start:], d.open) {
+			return d, start, true
+		}
+	}
+	return delimiter{}, 0, false
+}
+
+func (l *lexer) isIdentStart(c byte) bool {
+	return isLetter(c) || c == '_' || c >= 0x80 || strings.IndexByte(l.identStart, c) >= 0
+}
+
+func (l *lexer) isIdentChar(c byte) bool {
+	return isWordByte(c) || strings.IndexByte(l.identChars, c) >= 0
+}
+
+// scanDelimited returns the end of the string or comment opened by d at i.
+// One that isn't closed runs to the end of its line, or of the code when
+// it may span lines.
+func scanDelimited(code string, i int, d delimiter) int {
+	j := i + len(d.open)
+	for j < len(code) {
+		switch {
+		case d.escapes && code[j] == '\\':
+			j += 2
+			continue
+		case strings.HasPrefix(code[j:], d.close):
+			return j + len(d.close)
+		case code[j] == '\n' && !d.multiline:
+			return j
+		}
+		j++
+	}
+	return len(code)
+}
+
+// scanVariable returns the end of the shell variable at i, i+1 when the $
+// starts none.
+func scanVariable(code string, i int) int {
+	j := i + 1
+	if j >= len(code) {
+		return j
+	}
+
+	switch c := code[j]; {
+	case c == '{':
+		if end := strings.IndexByte(code[j:], '}'); end >= 0 && !strings.Contains(code[j:j+end], "\n") {
+			return j + end + 1
+		}
+		return j
+	case isDigit(c) || strings.IndexByte("@*#?$!-", c) >= 0:
+		return j + 1
+	}
+
+	for j < len(code) && (isLetter(code[j]) || isDigit(code[j]) || code[j] == '_') {
+		j++
+	}
+	return j
+}
+
+// next returns the first byte after j that isn't a space or tab, 0 at the
+// end.
+func next(code string, j int) byte {
+	for j < len(code) && (code[j] == ' ' || code[j] == '\t') {
+		j++
+	}
+	if j >= len(code) {
+		return 0
+	}
+	return code[j]
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordByte(c byte) bool {
+	return isLetter(c) || isDigit(c) || c == '_' || c >= 0x80
+}
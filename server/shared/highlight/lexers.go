@@ -0,0 +1,144 @@
+package highlight
+
+var cComments = []delimiter{{open: "/*", close: "*/", multiline: true}}
+
+var goLexer = &lexer{
+	lineComments:  []string{"//"},
+	blockComments: cComments,
+	strings: []delimiter{
+		{open: `"`, close: `"`, escapes: true},
+		{open: "`", close: "`", multiline: true},
+		{open: "'", close: "'", escapes: true},
+	},
+	keywords: set("break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough",
+		"for", "func", "go", "goto", "if", "import", "interface", "map", "package", "range", "return",
+		"select", "struct", "switch", "type", "var"),
+	builtins: set("any", "bool", "byte", "comparable", "complex64", "complex128", "error", "float32", "float64",
+		"int", "int8", "int16", "int32", "int64", "rune", "string", "uint", "uint8", "uint16", "uint32",
+		"uint64", "uintptr", "append", "cap", "clear", "close", "complex", "copy", "delete", "imag", "len",
+		"make", "max", "min", "new", "panic", "print", "println", "real", "recover"),
+	literals:  set("true", "false", "nil", "iota"),
+	functions: true,
+}
+
+var pythonLexer = &lexer{
+	lineComments: []string{"#"},
+	strings: []delimiter{
+		{open: `"""`, close: `"""`, escapes: true, multiline: true},
+		{open: `'''`, close: `'''`, escapes: true, multiline: true},
+		{open: `"`, close: `"`, escapes: true},
+		{open: "'", close: "'", escapes: true},
+	},
+	stringPrefixes: "rbfuRBFU",
+	keywords: set("and", "as", "assert", "async", "await", "break", "class", "continue", "def", "del",
+		"elif", "else", "except", "finally", "for", "from", "global", "if", "import", "in", "is", "lambda",
+		"match", "nonlocal", "not", "or", "pass", "raise", "return", "try", "while", "with", "yield"),
+	builtins: set("abs", "all", "any", "bool", "bytes", "callable", "dict", "dir", "enumerate", "filter",
+		"float", "format", "getattr", "hasattr", "hash", "id", "input", "int", "isinstance", "iter", "len",
+		"list", "map", "max", "min", "next", "object", "open", "print", "range", "repr", "reversed",
+		"round", "set", "setattr", "sorted", "str", "sum", "super", "tuple", "type", "zip", "self", "cls",
+		"Exception", "ValueError", "TypeError", "KeyError"),
+	literals:  set("True", "False", "None"),
+	functions: true,
+}
+
+var javascriptKeywords = []string{"async", "await", "break", "case", "catch", "class", "const", "continue",
+	"debugger", "default", "delete", "do", "else", "export", "extends", "finally", "for", "from", "function",
+	"if", "import", "in", "instanceof", "let", "new", "of", "return", "static", "super", "switch", "this",
+	"throw", "try", "typeof", "var", "void", "while", "with", "yield"}
+
+var javascriptBuiltins = []string{"Array", "Boolean", "Date", "Error", "JSON", "Map", "Math", "Number",
+	"Object", "Promise", "RegExp", "Set", "String", "Symbol", "console", "document", "exports", "globalThis",
+	"module", "process", "require", "window"}
+
+var javascriptStrings = []delimiter{
+	{open: `"`, close: `"`, escapes: true},
+	{open: "'", close: "'", escapes: true},
+	{open: "`", close: "`", escapes: true, multiline: true},
+}
+
+var javascriptLexer = &lexer{
+	lineComments:  []string{"//"},
+	blockComments: cComments,
+	strings:       javascriptStrings,
+	keywords:      set(javascriptKeywords...),
+	builtins:      set(javascriptBuiltins...),
+	literals:      set("true", "false", "null", "undefined", "NaN", "Infinity"),
+	identStart:    "$",
+	identChars:    "$",
+	functions:     true,
+}
+
+var typescriptLexer = &lexer{
+	lineComments:  []string{"//"},
+	blockComments: cComments,
+	strings:       javascriptStrings,
+	keywords: set(append([]string{"abstract", "as", "declare", "enum", "implements", "infer", "interface",
+		"is", "keyof", "namespace", "private", "protected", "public", "readonly", "satisfies", "type"},
+		javascriptKeywords...)...),
+	builtins: set(append([]string{"any", "bigint", "boolean", "never", "number", "object", "string",
+		"symbol", "unknown", "Partial", "Pick", "Omit", "Readonly", "Record", "Required"},
+		javascriptBuiltins...)...),
+	literals:   set("true", "false", "null", "undefined", "NaN", "Infinity"),
+	identStart: "$",
+	identChars: "$",
+	functions:  true,
+}
+
+var sqlLexer = &lexer{
+	lineComments:  []string{"--"},
+	blockComments: cComments,
+	strings: []delimiter{
+		{open: "'", close: "'", multiline: true},
+		{open: `"`, close: `"`},
+	},
+	keywords: set("add", "all", "alter", "and", "as", "asc", "begin", "between", "by", "cascade", "case",
+		"check", "column", "commit", "constraint", "create", "cross", "default", "delete", "desc",
+		"distinct", "drop", "else", "end", "exists", "foreign", "from", "full", "function", "grant",
+		"group", "having", "if", "in", "index", "inner", "insert", "into", "is", "join", "key", "left",
+		"like", "ilike", "limit", "not", "offset", "on", "or", "order", "outer", "over", "partition",
+		"primary", "references", "replace", "returning", "returns", "right", "rollback", "select", "set",
+		"table", "then", "transaction", "trigger", "union", "unique", "update", "using", "values", "view",
+		"when", "where", "with"),
+	builtins: set("bigint", "bigserial", "boolean", "bytea", "char", "date", "decimal", "float", "int",
+		"integer", "interval", "json", "jsonb", "numeric", "real", "serial", "smallint", "text", "time",
+		"timestamp", "timestamptz", "uuid", "varchar", "avg", "coalesce", "count", "max", "min", "now",
+		"sum", "lower", "upper", "length", "row_number"),
+	literals: set("true", "false", "null"),
+	foldCase: true,
+}
+
+var bashLexer = &lexer{
+	lineComments:  []string{"#"},
+	commentAtWord: true,
+	strings: []delimiter{
+		{open: `"`, close: `"`, escapes: true, multiline: true},
+		{open: "'", close: "'", multiline: true},
+	},
+	keywords: set("case", "do", "done", "elif", "else", "esac", "fi", "for", "function", "if", "in",
+		"select", "then", "until", "while", "time"),
+	builtins: set("alias", "cd", "declare", "echo", "eval", "exec", "exit", "export", "local", "printf",
+		"pwd", "read", "readonly", "return", "set", "shift", "source", "test", "trap", "unset"),
+	literals:   set("true", "false"),
+	identChars: "-",
+	variables:  true,
+}
+
+var yamlLexer = &lexer{
+	lineComments:  []string{"#"},
+	commentAtWord: true,
+	strings: []delimiter{
+		{open: `"`, close: `"`, escapes: true, multiline: true},
+		{open: "'", close: "'", multiline: true},
+	},
+	literals:   set("true", "false", "null", "yes", "no", "on", "off", "True", "False", "Null", "TRUE", "FALSE", "NULL"),
+	identChars: "-.",
+	keys:       true,
+	keySpace:   true,
+}
+
+var jsonLexer = &lexer{
+	strings:  []delimiter{{open: `"`, close: `"`, escapes: true}},
+	literals: set("true", "false", "null"),
+	keys:     true,
+}
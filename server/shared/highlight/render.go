@@ -0,0 +1,133 @@
+package highlight
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// HTML writes tokens as a <pre class="hl">, with every token that isn't
+// Plain in a span of class hl-<kind>. CSS styles the classes.
+func HTML(w io.Writer, tokens []Token) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`<pre class="hl"><code>`)
+	for _, t := range tokens {
+		if t.Kind == Plain {
+			bw.WriteString(html.EscapeString(t.Text))
+			continue
+		}
+		fmt.Fprintf(bw, `<span class="hl-%s">%s</span>`, t.Kind, html.EscapeString(t.Text))
+	}
+	bw.WriteString("</code></pre>\n")
+	return bw.Flush()
+}
+
+// InlineHTML writes tokens like HTML, styled by theme t in style attributes,
+// for pages without the stylesheet such as emails and embeds.
+func InlineHTML(w io.Writer, tokens []Token, t *Theme) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<pre style="background:%s;color:%s"><code>`, t.Background, t.Foreground)
+	for _, tok := range tokens {
+		d := t.Styles[tok.Kind].declarations()
+		if d == "" {
+			bw.WriteString(html.EscapeString(tok.Text))
+			continue
+		}
+		fmt.Fprintf(bw, `<span style="%s">%s</span>`, d, html.EscapeString(tok.Text))
+	}
+	bw.WriteString("</code></pre>\n")
+	return bw.Flush()
+}
+
+// ANSI writes tokens with 256 colour escape sequences of theme t, for
+// terminals. The background is left to the terminal. Styles are reset at
+// the end of every line, so pagers that show part of the code show it
+// right.
+func ANSI(w io.Writer, tokens []Token, t *Theme) error {
+	bw := bufio.NewWriter(w)
+	for _, tok := range tokens {
+		sgr := t.Styles[tok.Kind].sgr()
+		if sgr == "" {
+			bw.WriteString(tok.Text)
+			continue
+		}
+
+		for _, line := range lines(tok.Text) {
+			text, newline := strings.CutSuffix(line, "\n")
+			if text != "" {
+				bw.WriteString("\x1b[" + sgr + "m" + text + "\x1b[0m")
+			}
+			if newline {
+				bw.WriteByte('\n')
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// sgr is s as the parameters of an ANSI Select Graphic Rendition sequence,
+// "" for a zero Style.
+func (s Style) sgr() string {
+	var p []string
+	if s.Bold {
+		p = append(p, "1")
+	}
+	if s.Italic {
+		p = append(p, "3")
+	}
+	if s.Color != "" {
+		if c, ok := ansi256(s.Color); ok {
+			p = append(p, "38;5;"+strconv.Itoa(c))
+		}
+	}
+	return strings.Join(p, ";")
+}
+
+// cubeLevels are the channel values of the 6x6x6 colour cube of the 256
+// colour palette, which starts at 16.
+var cubeLevels = [6]int{0, 95, 135, 175, 215, 255}
+
+// ansi256 is the palette colour closest to the #rrggbb colour hex, from the
+// colour cube or the grey ramp at 232 to 255. The 16 colours below the
+// cube are left out, terminals change them.
+func ansi256(hex string) (int, bool) {
+	v, err := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+	if err != nil || len(hex) != 7 {
+		return 0, false
+	}
+	r, g, b := int(v>>16&0xff), int(v>>8&0xff), int(v&0xff)
+
+	nearest := func(c int) int {
+		best := 0
+		for i, level := range cubeLevels {
+			if abs(level-c) < abs(cubeLevels[best]-c) {
+				best = i
+			}
+		}
+		return best
+	}
+	ri, gi, bi := nearest(r), nearest(g), nearest(b)
+	cube := 16 + 36*ri + 6*gi + bi
+	cubeDist := distance(r, g, b, cubeLevels[ri], cubeLevels[gi], cubeLevels[bi])
+
+	grey := min(max((r+g+b)/3-8+5, 0)/10, 23)
+	level := 8 + 10*grey
+	if distance(r, g, b, level, level, level) < cubeDist {
+		return 232 + grey, true
+	}
+	return cube, true
+}
+
+func distance(r1, g1, b1, r2, g2, b2 int) int {
+	return (r1-r2)*(r1-r2) + (g1-g2)*(g1-g2) + (b1-b2)*(b1-b2)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
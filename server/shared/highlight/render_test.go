@@ -0,0 +1,102 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTML(t *testing.T) {
+	tokens := Tokenize("go", "if a < b && c > \"<x>\" {}")
+
+	var b strings.Builder
+	if err := HTML(&b, tokens); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<pre class="hl"><code><span class="hl-keyword">if</span> a <span class="hl-operator">&lt;</span> b ` +
+		`<span class="hl-operator">&amp;&amp;</span> c <span class="hl-operator">&gt;</span> ` +
+		`<span class="hl-string">&#34;&lt;x&gt;&#34;</span> <span class="hl-punctuation">{}</span></code></pre>` + "\n"
+	if b.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, b.String())
+	}
+}
+
+func TestInlineHTML(t *testing.T) {
+	theme, _ := ThemeByName("monokai")
+	tokens := Tokenize("python", "# <b>\nx = {}")
+
+	var b strings.Builder
+	if err := InlineHTML(&b, tokens, theme); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<pre style="background:#272822;color:#f8f8f2"><code>` +
+		`<span style="color:#75715e;font-style:italic"># &lt;b&gt;</span>` + "\n" +
+		`x <span style="color:#f92672">=</span> {}</code></pre>` + "\n"
+	if b.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, b.String())
+	}
+}
+
+func TestANSI(t *testing.T) {
+	theme, _ := ThemeByName("github")
+	tokens := Tokenize("python", "\"\"\"a\n\nb\"\"\" x")
+
+	var b strings.Builder
+	if err := ANSI(&b, tokens, theme); err != nil {
+		t.Fatal(err)
+	}
+	// Every line opens and resets its own style, empty lines get none.
+	expected := "\x1b[38;5;23m\"\"\"a\x1b[0m\n\n\x1b[38;5;23mb\"\"\"\x1b[0m x"
+	if b.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.String())
+	}
+}
+
+func TestANSI256(t *testing.T) {
+	tests := []struct {
+		hex      string
+		expected int
+		ok       bool
+	}{
+		{hex: "#000000", expected: 16, ok: true},
+		{hex: "#ffffff", expected: 231, ok: true},
+		{hex: "#ff0000", expected: 196, ok: true},
+		{hex: "#5f87af", expected: 67, ok: true},
+		{hex: "#808080", expected: 244, ok: true},
+		{hex: "#121212", expected: 233, ok: true},
+		{hex: "#fff", ok: false},
+		{hex: "red", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.hex, func(t *testing.T) {
+			got, ok := ansi256(tt.hex)
+			if got != tt.expected || ok != tt.ok {
+				t.Errorf("expected %d, %v, got %d, %v", tt.expected, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestThemes(t *testing.T) {
+	if _, ok := ThemeByName(DefaultTheme); !ok {
+		t.Fatalf("default theme %s missing", DefaultTheme)
+	}
+
+	for _, theme := range Themes() {
+		for _, c := range []string{theme.Background, theme.Foreground} {
+			if _, ok := ansi256(c); !ok {
+				t.Errorf("%s: bad colour %q", theme.Name, c)
+			}
+		}
+		for kind, style := range theme.Styles {
+			if _, ok := ansi256(style.Color); style.Color != "" && !ok {
+				t.Errorf("%s: bad colour %q for %s", theme.Name, style.Color, kind)
+			}
+		}
+
+		css := CSS(theme)
+		if !strings.HasPrefix(css, ".hl{background:"+theme.Background) || !strings.Contains(css, ".hl-keyword{") {
+			t.Errorf("%s: unexpected stylesheet\n%s", theme.Name, css)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package highlight
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Style is how a Kind of token looks.
+type Style struct {
+	// Color is a #rrggbb colour, empty for the foreground of the theme.
+	Color  string
+	Bold   bool
+	Italic bool
+}
+
+// Theme styles each Kind. Kinds it leaves out look like Plain.
+type Theme struct {
+	Name       string
+	Background string
+	Foreground string
+	Styles     map[Kind]Style
+}
+
+// DefaultTheme is the theme used when none is asked for.
+const DefaultTheme = "github"
+
+var themes = []*Theme{
+	{
+		Name:       "github",
+		Background: "#ffffff",
+		Foreground: "#24292f",
+		Styles: map[Kind]Style{
+			Comment:  {Color: "#6e7781", Italic: true},
+			Keyword:  {Color: "#cf222e"},
+			Builtin:  {Color: "#0550ae"},
+			Literal:  {Color: "#0550ae"},
+			String:   {Color: "#0a3069"},
+			Number:   {Color: "#0550ae"},
+			Operator: {Color: "#cf222e"},
+			Function: {Color: "#8250df"},
+			Key:      {Color: "#116329"},
+			Variable: {Color: "#953800"},
+		},
+	},
+	{
+		Name:       "monokai",
+		Background: "#272822",
+		Foreground: "#f8f8f2",
+		Styles: map[Kind]Style{
+			Comment:  {Color: "#75715e", Italic: true},
+			Keyword:  {Color: "#f92672"},
+			Builtin:  {Color: "#66d9ef", Italic: true},
+			Literal:  {Color: "#ae81ff"},
+			String:   {Color: "#e6db74"},
+			Number:   {Color: "#ae81ff"},
+			Operator: {Color: "#f92672"},
+			Function: {Color: "#a6e22e"},
+			Key:      {Color: "#f92672"},
+			Variable: {Color: "#fd971f"},
+		},
+	},
+	{
+		Name:       "dracula",
+		Background: "#282a36",
+		Foreground: "#f8f8f2",
+		Styles: map[Kind]Style{
+			Comment:  {Color: "#6272a4"},
+			Keyword:  {Color: "#ff79c6", Bold: true},
+			Builtin:  {Color: "#8be9fd", Italic: true},
+			Literal:  {Color: "#bd93f9"},
+			String:   {Color: "#f1fa8c"},
+			Number:   {Color: "#bd93f9"},
+			Operator: {Color: "#ff79c6"},
+			Function: {Color: "#50fa7b"},
+			Key:      {Color: "#8be9fd"},
+			Variable: {Color: "#ffb86c", Italic: true},
+		},
+	},
+}
+
+// Themes returns the built in themes. They must not be modified.
+func Themes() []*Theme {
+	return themes
+}
+
+// ThemeByName finds a built in theme.
+func ThemeByName(name string) (*Theme, bool) {
+	for _, t := range themes {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// ThemeNames lists the names of the built in themes.
+func ThemeNames() []string {
+	names := make([]string, len(themes))
+	for i, t := range themes {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// declarations is s as CSS declarations, "" for a zero Style.
+func (s Style) declarations() string {
+	var d []string
+	if s.Color != "" {
+		d = append(d, "color:"+s.Color)
+	}
+	if s.Bold {
+		d = append(d, "font-weight:bold")
+	}
+	if s.Italic {
+		d = append(d, "font-style:italic")
+	}
+	return strings.Join(d, ";")
+}
+
+// CSS is the stylesheet for the classes HTML writes, in theme t.
+func CSS(t *Theme) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, ".hl{background:%s;color:%s}\n", t.Background, t.Foreground)
+	for kind := range Kind(len(kindNames)) {
+		if d := t.Styles[kind].declarations(); d != "" {
+			fmt.Fprintf(&b, ".hl-%s{%s}\n", kind, d)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,187 @@
+package languages
+
+import (
+	"embed"
+	"math"
+	"path"
+	"strings"
+	"sync"
+)
+
+// corpus holds a sample of code per language, named after the language ID.
+// Languages without a sample are only found through hints.
+//
+//go:embed corpus/*.txt
+var corpus embed.FS
+
+const (
+	// minConfidence is the least confidence a classifier guess needs, less
+	// sure guesses are Text.
+	minConfidence = 0.5
+	// maxTokens caps the tokens classified, the start of the code is enough
+	// and the cost of a guess stays bounded.
+	maxTokens = 2000
+	// evidenceTokens is how many tokens the classifier trusts at most. Naive
+	// Bayes treats every token as independent evidence, so on long code its
+	// guesses would all be close to certain.
+	evidenceTokens = 40
+)
+
+// model is a naive Bayes classifier over the tokens of the corpus.
+type model struct {
+	languages []string
+	// logProb holds per language the log probability of each token of the
+	// vocabulary, with add one smoothing.
+	logProb []map[string]float64
+	// unseen is per language the log probability of a vocabulary token
+	// its sample doesn't contain.
+	unseen []float64
+	vocab  map[string]bool
+}
+
+var trained = sync.OnceValue(func() *model {
+	entries, err := corpus.ReadDir("corpus")
+	if err != nil {
+		panic(err)
+	}
+
+	m := &model{vocab: map[string]bool{}}
+	var counts []map[string]int
+	var totals []int
+	for _, e := range entries {
+		id := strings.TrimSuffix(e.Name(), path.Ext(e.Name()))
+		sample, err := corpus.ReadFile("corpus/" + e.Name())
+		if err != nil {
+			panic(err)
+		}
+
+		c := map[string]int{}
+		tokens := tokenize(string(sample), math.MaxInt)
+		for _, t := range tokens {
+			c[t]++
+			m.vocab[t] = true
+		}
+		m.languages = append(m.languages, id)
+		counts = append(counts, c)
+		totals = append(totals, len(tokens))
+	}
+
+	for i, c := range counts {
+		denom := float64(totals[i] + len(m.vocab))
+		p := make(map[string]float64, len(c))
+		for t, n := range c {
+			p[t] = math.Log(float64(n+1) / denom)
+		}
+		m.logProb = append(m.logProb, p)
+		m.unseen = append(m.unseen, math.Log(1/denom))
+	}
+	return m
+})
+
+// classify guesses the language of code from its tokens.
+func classify(code string) Detection {
+	m := trained()
+	tokens := tokenize(code, maxTokens)
+	known := tokens[:0]
+	for _, t := range tokens {
+		if m.vocab[t] {
+			known = append(known, t)
+		}
+	}
+	if len(known) == 0 {
+		return Detection{Language: Text, Source: SourceNone}
+	}
+
+	scores := make([]float64, len(m.languages))
+	best := 0
+	for i := range m.languages {
+		for _, t := range known {
+			p, ok := m.logProb[i][t]
+			if !ok {
+				p = m.unseen[i]
+			}
+			scores[i] += p
+		}
+		if scores[i] > scores[best] {
+			best = i
+		}
+	}
+
+	// The share of the best language in the posterior, with the evidence
+	// scaled down to evidenceTokens tokens.
+	scale := min(1, evidenceTokens/float64(len(known)))
+	var sum float64
+	for _, s := range scores {
+		sum += math.Exp((s - scores[best]) * scale)
+	}
+	confidence := 1 / sum
+	if confidence < minConfidence {
+		return Detection{Language: Text, Source: SourceNone}
+	}
+	return Detection{Language: m.languages[best], Confidence: confidence, Source: SourceClassifier}
+}
+
+// tokenize splits code into at most limit tokens: words, runs of up to
+// three punctuation characters, and the quote of each string literal. The
+// contents of strings and numbers say little about the language and are
+// skipped.
+func tokenize(code string, limit int) []string {
+	var tokens []string
+	for i := 0; i < len(code) && len(tokens) < limit; {
+		c := code[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9':
+			for i < len(code) && isWordByte(code[i]) {
+				i++
+			}
+		case isWordByte(c):
+			j := i
+			for j < len(code) && isWordByte(code[j]) {
+				j++
+			}
+			tokens = append(tokens, code[i:j])
+			i = j
+		case c == '"' || c == '\'' || c == '`':
+			tokens = append(tokens, code[i:i+1])
+			i = skipString(code, i)
+		default:
+			j := i
+			for j < len(code) && j-i < 3 && isPunct(code[j]) {
+				j++
+			}
+			tokens = append(tokens, code[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 0x80 || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isPunct(c byte) bool {
+	return !isWordByte(c) && c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != '"' && c != '\'' && c != '`'
+}
+
+// skipString returns the index after the string literal opened at i. A
+// quote that isn't closed on its line, an apostrophe or a Rust lifetime,
+// only skips itself.
+func skipString(code string, i int) int {
+	quote := code[i]
+	for j := i + 1; j < len(code); j++ {
+		switch code[j] {
+		case '\\':
+			j++
+		case '\n':
+			if quote != '`' {
+				return i + 1
+			}
+		case quote:
+			return j + 1
+		}
+	}
+	return i + 1
+}
@@ -0,0 +1,150 @@
+package languages
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Detection is a guess at the language of a piece of code.
+type Detection struct {
+	Language string `json:"language"`
+	// Confidence runs from 0, nothing to go on, to 1, the code names its
+	// language.
+	Confidence float64 `json:"confidence"`
+	// Source is what gave the language away, one of the Source constants.
+	Source string `json:"source"`
+}
+
+// Sources of a Detection.
+const (
+	SourceModeline   = "modeline"
+	SourceShebang    = "shebang"
+	SourceFilename   = "filename"
+	SourceClassifier = "classifier"
+	// SourceNone means nothing was recognised and the language is Text.
+	SourceNone = "none"
+)
+
+// Confidence of the hints, which name a language rather than suggest one.
+// A modeline is set on purpose, a shebang or file name can be a leftover.
+const (
+	modelineConfidence = 1
+	shebangConfidence  = 0.95
+	filenameConfidence = 0.9
+)
+
+// modelineLines is how many lines at the start and the end of the code are
+// searched for a modeline, editors only look there too.
+const modelineLines = 5
+
+var (
+	// vim: set ft=python: and vim: filetype=go
+	vimModeline = regexp.MustCompile(`(?:^|\s)(?:vi|vim|ex):.*?\b(?:ft|filetype|syntax)=([\w+#.-]+)`)
+	// -*- mode: python -*- and -*- python -*-
+	emacsModeline = regexp.MustCompile(`-\*-(.*?)-\*-`)
+	emacsMode     = regexp.MustCompile(`(?i)\bmode:\s*([\w+#.-]+)`)
+)
+
+// Detect guesses the language of code. The title of the snippet is searched
+// for a file name, "main.go" or "Dockerfile for the api". Hints in the code
+// itself come first, then the title, then a classifier trained on samples
+// of each language. Code the classifier isn't sure about is Text.
+func Detect(code, title string) Detection {
+	if id, ok := modeline(code); ok {
+		return Detection{Language: id, Confidence: modelineConfidence, Source: SourceModeline}
+	}
+	if id, ok := shebang(code); ok {
+		return Detection{Language: id, Confidence: shebangConfidence, Source: SourceShebang}
+	}
+	if id, ok := titleFile(title); ok {
+		return Detection{Language: id, Confidence: filenameConfidence, Source: SourceFilename}
+	}
+	return classify(code)
+}
+
+// modeline finds a vim or emacs modeline naming a known language.
+func modeline(code string) (string, bool) {
+	lines := strings.Split(code, "\n")
+	if len(lines) > 2*modelineLines {
+		lines = append(lines[:modelineLines], lines[len(lines)-modelineLines:]...)
+	}
+
+	for _, line := range lines {
+		if m := vimModeline.FindStringSubmatch(line); m != nil {
+			if id, ok := Normalize(m[1]); ok {
+				return id, true
+			}
+		}
+
+		m := emacsModeline.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		mode := strings.TrimSpace(m[1])
+		if strings.Contains(mode, ":") {
+			mm := emacsMode.FindStringSubmatch(mode)
+			if mm == nil {
+				continue
+			}
+			mode = mm[1]
+		}
+		if id, ok := Normalize(mode); ok {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// shebang finds the language of the interpreter a #! line runs, following
+// env to the program it starts.
+func shebang(code string) (string, bool) {
+	line, _, _ := strings.Cut(code, "\n")
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), "#!")
+	if !ok {
+		return "", false
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", false
+	}
+	program := path.Base(fields[0])
+	if program == "env" {
+		program = ""
+		for _, f := range fields[1:] {
+			// env -S and env VAR=value prog.
+			if strings.HasPrefix(f, "-") || strings.Contains(f, "=") {
+				continue
+			}
+			program = path.Base(f)
+			break
+		}
+	}
+
+	l, ok := byInterpreter[program]
+	if !ok {
+		// python3.12 runs python.
+		l, ok = byInterpreter[strings.TrimRight(program, "0123456789.")]
+	}
+	if !ok {
+		return "", false
+	}
+	return l.ID, true
+}
+
+// titleFile finds a file name in a snippet title.
+func titleFile(title string) (string, bool) {
+	words := strings.FieldsFunc(title, func(r rune) bool {
+		return r == ' ' || r == '\t' || strings.ContainsRune("()[]{}<>\"'`,;:", r)
+	})
+
+	for _, word := range words {
+		// A trailing dot ends a sentence, not an extension.
+		word = strings.TrimRight(word, ".")
+		if l, ok := ForFile(word); ok {
+			return l.ID, true
+		}
+	}
+	return "", false
+}
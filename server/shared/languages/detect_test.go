@@ -0,0 +1,90 @@
+package languages
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		title    string
+		expected string
+		source   string
+	}{
+		{name: "Vim modeline", code: "x = 1\n# vim: set ft=python ts=4:", expected: "python", source: SourceModeline},
+		{name: "Vim filetype alias", code: "// vim: filetype=javascript\nfoo()", expected: "javascript", source: SourceModeline},
+		{name: "Emacs mode", code: "# -*- mode: ruby; coding: utf-8 -*-\nputs 1", expected: "ruby", source: SourceModeline},
+		{name: "Emacs short", code: "/* -*- c++ -*- */\nint x;", expected: "cpp", source: SourceModeline},
+		{name: "Shebang", code: "#!/bin/bash\necho hi", expected: "bash", source: SourceShebang},
+		{name: "Shebang env", code: "#!/usr/bin/env python3\nprint(1)", expected: "python", source: SourceShebang},
+		{name: "Shebang env -S", code: "#!/usr/bin/env -S deno run\nconsole.log(1)", expected: "typescript", source: SourceShebang},
+		{name: "Shebang version", code: "#!/usr/local/bin/python3.12\n", expected: "python", source: SourceShebang},
+		{name: "Unknown shebang", code: "#!/usr/bin/awk -f\n{ print $1 }", title: "fields.awk", expected: Text, source: SourceNone},
+		{name: "Title file", code: "x", title: "Parse config (config.yaml)", expected: "yaml", source: SourceFilename},
+		{name: "Title Dockerfile", code: "x", title: "Dockerfile for the api", expected: "dockerfile", source: SourceFilename},
+		{name: "Title sentence", code: "", title: "Sort a slice.", expected: Text, source: SourceNone},
+		{name: "Empty", code: "", expected: Text, source: SourceNone},
+		{name: "Prose", code: "Remember to buy milk and eggs tomorrow morning", expected: Text, source: SourceNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Detect(tt.code, tt.title)
+			if got.Language != tt.expected || got.Source != tt.source {
+				t.Errorf("expected %s from %s, got %+v", tt.expected, tt.source, got)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		expected string
+		code     string
+	}{
+		{expected: "go", code: "func (c *Client) Do(req *http.Request) (*http.Response, error) {\n\tif err := c.limit.Wait(req.Context()); err != nil {\n\t\treturn nil, err\n\t}\n\treturn c.http.Do(req)\n}"},
+		{expected: "python", code: "def chunks(items, size):\n    for i in range(0, len(items), size):\n        yield items[i:i + size]\n\nprint(list(chunks([1, 2, 3], 2)))"},
+		{expected: "javascript", code: "const sleep = (ms) => new Promise((resolve) => setTimeout(resolve, ms));\nmodule.exports = sleep;"},
+		{expected: "typescript", code: "export function groupBy<T>(items: T[], key: (item: T) => string): Record<string, T[]> {\n  const out: Record<string, T[]> = {};\n  return out;\n}"},
+		{expected: "rust", code: "fn main() {\n    let v: Vec<u32> = (1..10).collect();\n    println!(\"{:?}\", v);\n}"},
+		{expected: "java", code: "public static void main(String[] args) {\n    List<String> names = new ArrayList<>();\n    System.out.println(names.size());\n}"},
+		{expected: "csharp", code: "public async Task<IActionResult> Index()\n{\n    var items = await _context.Items.ToListAsync();\n    return View(items);\n}"},
+		{expected: "c", code: "int main(void) {\n    char *s = malloc(16);\n    if (s == NULL) return 1;\n    printf(\"%p\\n\", s);\n    free(s);\n}"},
+		{expected: "cpp", code: "std::vector<int> v{1, 2, 3};\nfor (const auto& x : v) {\n    std::cout << x << std::endl;\n}"},
+		{expected: "php", code: "<?php\nforeach ($users as $user) {\n    echo $user->name;\n}"},
+		{expected: "ruby", code: "def greet(name)\n  puts \"Hello, #{name}\"\nend\n\n[1, 2].each do |n|\n  greet(n)\nend"},
+		{expected: "sql", code: "SELECT name, COUNT(*) FROM orders o JOIN users u ON u.id = o.user_id GROUP BY name ORDER BY 2 DESC;"},
+		{expected: "bash", code: "for f in *.log; do\n  gzip \"$f\"\ndone\nif [ -d \"$DIR\" ]; then echo ok; fi"},
+		{expected: "html", code: "<div class=\"row\">\n  <a href=\"/home\">Home</a>\n  <img src=\"a.png\" alt=\"\">\n</div>"},
+		{expected: "css", code: ".nav a {\n  color: #333;\n  padding: 4px 8px;\n  text-decoration: none;\n}"},
+		{expected: "yaml", code: "steps:\n  - name: Build\n    run: make build\n  - uses: actions/cache@v4\n    with:\n      path: ~/.cache"},
+		{expected: "json", code: "{\n  \"name\": \"demo\",\n  \"version\": \"1.0.0\",\n  \"dependencies\": {\n    \"lodash\": \"^4.17.21\"\n  }\n}"},
+		{expected: "kotlin", code: "fun main() {\n    val items = listOf(1, 2, 3)\n    items.forEach { println(it) }\n}"},
+		{expected: "swift", code: "guard let url = URL(string: path) else { return }\nlet task = URLSession.shared.dataTask(with: url) { data, _, _ in\n    print(data ?? \"\")\n}"},
+		{expected: "haskell", code: "main :: IO ()\nmain = do\n  let xs = map (*2) [1..10]\n  mapM_ print xs"},
+		{expected: "elixir", code: "defmodule Greeter do\n  def hello(name), do: IO.puts(\"Hello #{name}\")\nend"},
+		{expected: "dockerfile", code: "FROM ubuntu:22.04\nRUN apt-get update && apt-get install -y curl\nCOPY . /app\nWORKDIR /app\nCMD [\"./run.sh\"]"},
+		{expected: "lua", code: "local function add(a, b)\n  return a + b\nend\nfor i = 1, 10 do\n  print(add(i, 1))\nend"},
+		{expected: "powershell", code: "Get-ChildItem -Path C:\\Logs -Filter *.log | ForEach-Object {\n    Write-Host $_.Name\n}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			got := Detect(tt.code, "")
+			if got.Language != tt.expected || got.Source != SourceClassifier {
+				t.Errorf("expected %s, got %+v", tt.expected, got)
+			}
+			if got.Confidence < minConfidence || got.Confidence > 1 {
+				t.Errorf("confidence %v out of range", got.Confidence)
+			}
+		})
+	}
+}
+
+func TestCorpus(t *testing.T) {
+	m := trained()
+	for _, id := range m.languages {
+		if l, ok := Lookup(id); !ok || l.ID != id {
+			t.Errorf("corpus sample %s is not a language ID", id)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package languages
+
+// Extension returns the usual file extension, dot included, for a snippet
+// language as users type it. Unknown languages get ".txt".
+func Extension(language string) string {
+	if l, ok := Lookup(language); ok {
+		return l.Extensions[0]
+	}
+	return ".txt"
+}
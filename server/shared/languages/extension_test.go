@@ -0,0 +1,25 @@
+package languages
+
+import "testing"
+
+func TestExtension(t *testing.T) {
+	tests := []struct {
+		language string
+		expected string
+	}{
+		{language: "go", expected: ".go"},
+		{language: "  Python ", expected: ".py"},
+		{language: "C++", expected: ".cpp"},
+		{language: "TypeScript", expected: ".ts"},
+		{language: "brainfuck", expected: ".txt"},
+		{language: "", expected: ".txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.language, func(t *testing.T) {
+			if got := Extension(tt.language); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
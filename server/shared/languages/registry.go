@@ -0,0 +1,166 @@
+package languages
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Language is a language snippets can be written in.
+type Language struct {
+	// ID is the canonical name snippets store, lowercase.
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Aliases are other names users type for the language. Lookups ignore
+	// case, so they are lowercase.
+	Aliases []string `json:"aliases,omitempty"`
+	// Extensions include the dot, the first one is used for downloads.
+	Extensions []string `json:"extensions"`
+	// Filenames are files recognised by their whole name.
+	Filenames []string `json:"filenames,omitempty"`
+	// Interpreters are the programs a shebang line names to run the
+	// language, without their version.
+	Interpreters []string `json:"interpreters,omitempty"`
+	MIMEType     string   `json:"mime_type"`
+	// LineComment starts a comment that runs to the end of the line.
+	LineComment string `json:"line_comment,omitempty"`
+	// BlockComment holds the opening and closing delimiter of a comment
+	// that can span lines.
+	BlockComment []string `json:"block_comment,omitempty"`
+}
+
+// Text is the language of snippets that aren't code.
+const Text = "text"
+
+var (
+	cStyle   = []string{"/*", "*/"}
+	xmlStyle = []string{"<!--", "-->"}
+)
+
+var registry = []Language{
+	{ID: "bash", Name: "Bash", Aliases: []string{"sh", "shell", "zsh"}, Extensions: []string{".sh", ".bash", ".zsh"}, Interpreters: []string{"sh", "bash", "zsh", "dash", "ksh"}, MIMEType: "application/x-sh", LineComment: "#"},
+	{ID: "c", Name: "C", Extensions: []string{".c", ".h"}, MIMEType: "text/x-c", LineComment: "//", BlockComment: cStyle},
+	{ID: "clojure", Name: "Clojure", Aliases: []string{"clj"}, Extensions: []string{".clj", ".cljs", ".cljc"}, Interpreters: []string{"clojure", "bb"}, MIMEType: "text/x-clojure", LineComment: ";"},
+	{ID: "cpp", Name: "C++", Aliases: []string{"c++", "cxx"}, Extensions: []string{".cpp", ".cc", ".cxx", ".hpp", ".hh"}, MIMEType: "text/x-c++src", LineComment: "//", BlockComment: cStyle},
+	{ID: "csharp", Name: "C#", Aliases: []string{"c#", "cs"}, Extensions: []string{".cs"}, MIMEType: "text/x-csharp", LineComment: "//", BlockComment: cStyle},
+	{ID: "css", Name: "CSS", Extensions: []string{".css"}, MIMEType: "text/css", BlockComment: cStyle},
+	{ID: "dart", Name: "Dart", Extensions: []string{".dart"}, Interpreters: []string{"dart"}, MIMEType: "application/dart", LineComment: "//", BlockComment: cStyle},
+	{ID: "diff", Name: "Diff", Aliases: []string{"patch"}, Extensions: []string{".diff", ".patch"}, MIMEType: "text/x-diff"},
+	{ID: "dockerfile", Name: "Dockerfile", Aliases: []string{"docker"}, Extensions: []string{".dockerfile"}, Filenames: []string{"Dockerfile", "Containerfile"}, MIMEType: "text/x-dockerfile", LineComment: "#"},
+	{ID: "elixir", Name: "Elixir", Aliases: []string{"ex"}, Extensions: []string{".ex", ".exs"}, Interpreters: []string{"elixir"}, MIMEType: "text/x-elixir", LineComment: "#"},
+	{ID: "erlang", Name: "Erlang", Aliases: []string{"erl"}, Extensions: []string{".erl", ".hrl"}, Interpreters: []string{"escript"}, MIMEType: "text/x-erlang", LineComment: "%"},
+	{ID: "fsharp", Name: "F#", Aliases: []string{"f#", "fs"}, Extensions: []string{".fs", ".fsx", ".fsi"}, MIMEType: "text/x-fsharp", LineComment: "//", BlockComment: []string{"(*", "*)"}},
+	{ID: "go", Name: "Go", Aliases: []string{"golang"}, Extensions: []string{".go"}, MIMEType: "text/x-go", LineComment: "//", BlockComment: cStyle},
+	{ID: "graphql", Name: "GraphQL", Aliases: []string{"gql"}, Extensions: []string{".graphql", ".gql"}, MIMEType: "application/graphql", LineComment: "#"},
+	{ID: "groovy", Name: "Groovy", Aliases: []string{"gradle"}, Extensions: []string{".groovy", ".gradle"}, Interpreters: []string{"groovy"}, MIMEType: "text/x-groovy", LineComment: "//", BlockComment: cStyle},
+	{ID: "haskell", Name: "Haskell", Aliases: []string{"hs"}, Extensions: []string{".hs"}, Interpreters: []string{"runhaskell", "runghc"}, MIMEType: "text/x-haskell", LineComment: "--", BlockComment: []string{"{-", "-}"}},
+	{ID: "hcl", Name: "HCL", Aliases: []string{"terraform", "tf"}, Extensions: []string{".tf", ".hcl"}, MIMEType: "text/x-hcl", LineComment: "#", BlockComment: cStyle},
+	{ID: "html", Name: "HTML", Aliases: []string{"htm"}, Extensions: []string{".html", ".htm"}, MIMEType: "text/html", BlockComment: xmlStyle},
+	{ID: "ini", Name: "INI", Aliases: []string{"cfg", "conf"}, Extensions: []string{".ini", ".cfg", ".conf"}, MIMEType: "text/x-ini", LineComment: ";"},
+	{ID: "java", Name: "Java", Extensions: []string{".java"}, MIMEType: "text/x-java", LineComment: "//", BlockComment: cStyle},
+	{ID: "javascript", Name: "JavaScript", Aliases: []string{"js", "node", "nodejs"}, Extensions: []string{".js", ".mjs", ".cjs"}, Interpreters: []string{"node", "nodejs"}, MIMEType: "text/javascript", LineComment: "//", BlockComment: cStyle},
+	{ID: "json", Name: "JSON", Extensions: []string{".json"}, MIMEType: "application/json"},
+	{ID: "jsx", Name: "JSX", Extensions: []string{".jsx"}, MIMEType: "text/jsx", LineComment: "//", BlockComment: cStyle},
+	{ID: "julia", Name: "Julia", Aliases: []string{"jl"}, Extensions: []string{".jl"}, Interpreters: []string{"julia"}, MIMEType: "text/x-julia", LineComment: "#", BlockComment: []string{"#=", "=#"}},
+	{ID: "kotlin", Name: "Kotlin", Aliases: []string{"kt"}, Extensions: []string{".kt", ".kts"}, Interpreters: []string{"kotlin"}, MIMEType: "text/x-kotlin", LineComment: "//", BlockComment: cStyle},
+	{ID: "lua", Name: "Lua", Extensions: []string{".lua"}, Interpreters: []string{"lua", "luajit"}, MIMEType: "text/x-lua", LineComment: "--", BlockComment: []string{"--[[", "]]"}},
+	{ID: "makefile", Name: "Makefile", Aliases: []string{"make", "mk"}, Extensions: []string{".mk"}, Filenames: []string{"Makefile", "makefile", "GNUmakefile"}, Interpreters: []string{"make"}, MIMEType: "text/x-makefile", LineComment: "#"},
+	{ID: "markdown", Name: "Markdown", Aliases: []string{"md"}, Extensions: []string{".md", ".markdown"}, MIMEType: "text/markdown", BlockComment: xmlStyle},
+	{ID: "objective-c", Name: "Objective-C", Aliases: []string{"objc", "obj-c", "objectivec"}, Extensions: []string{".m", ".mm"}, MIMEType: "text/x-objectivec", LineComment: "//", BlockComment: cStyle},
+	{ID: "ocaml", Name: "OCaml", Aliases: []string{"ml"}, Extensions: []string{".ml", ".mli"}, Interpreters: []string{"ocaml"}, MIMEType: "text/x-ocaml", BlockComment: []string{"(*", "*)"}},
+	{ID: "perl", Name: "Perl", Aliases: []string{"pl"}, Extensions: []string{".pl", ".pm"}, Interpreters: []string{"perl"}, MIMEType: "text/x-perl", LineComment: "#"},
+	{ID: "php", Name: "PHP", Extensions: []string{".php"}, Interpreters: []string{"php"}, MIMEType: "application/x-httpd-php", LineComment: "//", BlockComment: cStyle},
+	{ID: "powershell", Name: "PowerShell", Aliases: []string{"ps1", "pwsh", "posh"}, Extensions: []string{".ps1", ".psm1"}, Interpreters: []string{"pwsh", "powershell"}, MIMEType: "application/x-powershell", LineComment: "#", BlockComment: []string{"<#", "#>"}},
+	{ID: "protobuf", Name: "Protocol Buffers", Aliases: []string{"proto"}, Extensions: []string{".proto"}, MIMEType: "text/x-protobuf", LineComment: "//", BlockComment: cStyle},
+	{ID: "python", Name: "Python", Aliases: []string{"py", "python3"}, Extensions: []string{".py", ".pyw"}, Interpreters: []string{"python", "pypy"}, MIMEType: "text/x-python", LineComment: "#"},
+	{ID: "r", Name: "R", Extensions: []string{".r", ".R"}, Interpreters: []string{"Rscript"}, MIMEType: "text/x-rsrc", LineComment: "#"},
+	{ID: "ruby", Name: "Ruby", Aliases: []string{"rb"}, Extensions: []string{".rb"}, Filenames: []string{"Gemfile", "Rakefile"}, Interpreters: []string{"ruby"}, MIMEType: "text/x-ruby", LineComment: "#"},
+	{ID: "rust", Name: "Rust", Aliases: []string{"rs"}, Extensions: []string{".rs"}, MIMEType: "text/x-rust", LineComment: "//", BlockComment: cStyle},
+	{ID: "scala", Name: "Scala", Extensions: []string{".scala", ".sc"}, Interpreters: []string{"scala"}, MIMEType: "text/x-scala", LineComment: "//", BlockComment: cStyle},
+	{ID: "scss", Name: "SCSS", Aliases: []string{"sass"}, Extensions: []string{".scss", ".sass"}, MIMEType: "text/x-scss", LineComment: "//", BlockComment: cStyle},
+	{ID: "sql", Name: "SQL", Aliases: []string{"postgresql", "postgres", "mysql", "sqlite", "plpgsql"}, Extensions: []string{".sql"}, MIMEType: "application/sql", LineComment: "--", BlockComment: cStyle},
+	{ID: "swift", Name: "Swift", Extensions: []string{".swift"}, Interpreters: []string{"swift"}, MIMEType: "text/x-swift", LineComment: "//", BlockComment: cStyle},
+	{ID: Text, Name: "Plain text", Aliases: []string{"plaintext", "plain", "txt"}, Extensions: []string{".txt"}, MIMEType: "text/plain"},
+	{ID: "toml", Name: "TOML", Extensions: []string{".toml"}, MIMEType: "application/toml", LineComment: "#"},
+	{ID: "tsx", Name: "TSX", Extensions: []string{".tsx"}, MIMEType: "text/tsx", LineComment: "//", BlockComment: cStyle},
+	{ID: "typescript", Name: "TypeScript", Aliases: []string{"ts"}, Extensions: []string{".ts", ".mts", ".cts"}, Interpreters: []string{"deno", "ts-node", "tsx", "bun"}, MIMEType: "text/typescript", LineComment: "//", BlockComment: cStyle},
+	{ID: "vue", Name: "Vue", Extensions: []string{".vue"}, MIMEType: "text/x-vue", BlockComment: xmlStyle},
+	{ID: "xml", Name: "XML", Extensions: []string{".xml", ".xsd", ".svg"}, MIMEType: "application/xml", BlockComment: xmlStyle},
+	{ID: "yaml", Name: "YAML", Aliases: []string{"yml"}, Extensions: []string{".yaml", ".yml"}, MIMEType: "application/yaml", LineComment: "#"},
+	{ID: "zig", Name: "Zig", Extensions: []string{".zig"}, MIMEType: "text/x-zig", LineComment: "//"},
+}
+
+var (
+	byName      = map[string]*Language{}
+	byExtension = map[string]*Language{}
+	byFilename  = map[string]*Language{}
+	// byInterpreter is keyed by program name, see Interpreters.
+	byInterpreter = map[string]*Language{}
+)
+
+func init() {
+	sort.Slice(registry, func(i, j int) bool { return registry[i].ID < registry[j].ID })
+
+	for i := range registry {
+		l := &registry[i]
+		for _, name := range append([]string{l.ID, l.Name}, l.Aliases...) {
+			key := strings.ToLower(name)
+			if _, dup := byName[key]; dup && byName[key] != l {
+				panic("languages: " + name + " names two languages")
+			}
+			byName[key] = l
+		}
+
+		for _, ext := range l.Extensions {
+			// The first language to claim an extension keeps it.
+			if _, ok := byExtension[strings.ToLower(ext)]; !ok {
+				byExtension[strings.ToLower(ext)] = l
+			}
+		}
+		for _, name := range l.Filenames {
+			byFilename[name] = l
+		}
+		for _, name := range l.Interpreters {
+			byInterpreter[name] = l
+		}
+	}
+}
+
+// All returns every language ordered by ID. It must not be modified.
+func All() []Language {
+	return registry
+}
+
+// Lookup finds a language by its ID, display name or an alias, ignoring
+// case and surrounding space.
+func Lookup(name string) (Language, bool) {
+	l, ok := byName[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return Language{}, false
+	}
+	return *l, true
+}
+
+// Normalize returns the canonical ID of a language name, and false when the
+// name is unknown.
+func Normalize(name string) (string, bool) {
+	l, ok := Lookup(name)
+	return l.ID, ok
+}
+
+// ForFile finds the language of a file by its name or extension.
+func ForFile(name string) (Language, bool) {
+	base := filepath.Base(name)
+	if l, ok := byFilename[base]; ok {
+		return *l, true
+	}
+
+	ext := strings.ToLower(filepath.Ext(base))
+	if ext == "" {
+		return Language{}, false
+	}
+	if l, ok := byExtension[ext]; ok {
+		return *l, true
+	}
+	return Language{}, false
+}
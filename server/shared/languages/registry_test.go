@@ -0,0 +1,85 @@
+package languages
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	for _, l := range All() {
+		if l.ID != strings.ToLower(l.ID) || l.ID == "" {
+			t.Errorf("%q is not a lowercase id", l.ID)
+		}
+		if l.Name == "" || l.MIMEType == "" {
+			t.Errorf("%s is missing a name or MIME type", l.ID)
+		}
+		if len(l.Extensions) == 0 {
+			t.Errorf("%s has no extensions", l.ID)
+		}
+		for _, ext := range l.Extensions {
+			if !strings.HasPrefix(ext, ".") {
+				t.Errorf("%s extension %q has no dot", l.ID, ext)
+			}
+		}
+		if l.BlockComment != nil && len(l.BlockComment) != 2 {
+			t.Errorf("%s block comment needs an opening and closing delimiter", l.ID)
+		}
+		for _, alias := range l.Aliases {
+			if alias != strings.ToLower(alias) {
+				t.Errorf("%s alias %q is not lowercase", l.ID, alias)
+			}
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		ok       bool
+	}{
+		{name: "go", expected: "go", ok: true},
+		{name: "Go", expected: "go", ok: true},
+		{name: " GOLANG ", expected: "go", ok: true},
+		{name: "C++", expected: "cpp", ok: true},
+		{name: "c#", expected: "csharp", ok: true},
+		{name: "Objective-C", expected: "objective-c", ok: true},
+		{name: "yml", expected: "yaml", ok: true},
+		{name: "Plain text", expected: Text, ok: true},
+		{name: "brainfuck", ok: false},
+		{name: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Normalize(tt.name)
+			if got != tt.expected || ok != tt.ok {
+				t.Errorf("expected %q, %v, got %q, %v", tt.expected, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestForFile(t *testing.T) {
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{file: "main.go", expected: "go"},
+		{file: "src/App.TSX", expected: "tsx"},
+		{file: "Dockerfile", expected: "dockerfile"},
+		{file: "build/Makefile", expected: "makefile"},
+		{file: "notes.txt", expected: Text},
+		{file: "README", expected: ""},
+		{file: "archive.tar.gz", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			l, _ := ForFile(tt.file)
+			if l.ID != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, l.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Policy describes a token bucket: Limit requests may be made per Period,
+// with up to Burst requests allowed back to back. Burst defaults to Limit.
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+func (p Policy) capacity() float64 {
+	if p.Burst > 0 {
+		return float64(p.Burst)
+	}
+	return float64(p.Limit)
+}
+
+func (p Policy) rate() float64 {
+	if p.Period <= 0 {
+		return 0
+	}
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// RefillTime is how long an empty bucket takes to fill up again. A bucket
+// left alone for longer is as good as a new one.
+func (p Policy) RefillTime() time.Duration {
+	return secondsToDuration(p.capacity(), p.rate())
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+type Store interface {
+	Take(ctx context.Context, key string, policy Policy) (Result, error)
+}
+
+// Bucket is the persisted state of a single token bucket. It is shared by
+// every Store implementation so they all agree on the refill maths.
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+func NewBucket(policy Policy, now time.Time) Bucket {
+	return Bucket{Tokens: policy.capacity(), Updated: now}
+}
+
+// Take refills the bucket up to now and tries to remove one token from it.
+func (b *Bucket) Take(policy Policy, now time.Time) Result {
+	capacity := policy.capacity()
+	rate := policy.rate()
+
+	if elapsed := now.Sub(b.Updated).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(capacity, b.Tokens+elapsed*rate)
+	}
+	b.Updated = now
+
+	res := Result{Limit: policy.Limit}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsToDuration(1-b.Tokens, rate)
+	}
+
+	res.Remaining = int(math.Floor(b.Tokens))
+	res.Reset = secondsToDuration(capacity-b.Tokens, rate)
+	return res
+}
+
+// Full reports whether the bucket would be completely refilled at now, in
+// which case its state is indistinguishable from a fresh bucket.
+func (b *Bucket) Full(policy Policy, now time.Time) bool {
+	return b.Tokens+now.Sub(b.Updated).Seconds()*policy.rate() >= policy.capacity()
+}
+
+func secondsToDuration(tokens, rate float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	if rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(math.Ceil(tokens / rate * float64(time.Second)))
+}
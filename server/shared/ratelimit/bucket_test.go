@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBucketTake(t *testing.T) {
+	policy := Policy{Name: "test", Limit: 2, Period: time.Second}
+	start := time.Unix(0, 0)
+
+	tests := []struct {
+		name      string
+		at        time.Duration
+		allowed   bool
+		remaining int
+	}{
+		{name: "first request", at: 0, allowed: true, remaining: 1},
+		{name: "second request", at: 0, allowed: true, remaining: 0},
+		{name: "bucket empty", at: 0, allowed: false, remaining: 0},
+		{name: "refilled one token", at: 500 * time.Millisecond, allowed: true, remaining: 0},
+		{name: "refill capped at capacity", at: 10 * time.Second, allowed: true, remaining: 1},
+	}
+
+	bucket := NewBucket(policy, start)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := bucket.Take(policy, start.Add(tt.at))
+			if res.Allowed != tt.allowed {
+				t.Errorf("Allowed = %v, want %v", res.Allowed, tt.allowed)
+			}
+
+			if res.Remaining != tt.remaining {
+				t.Errorf("Remaining = %d, want %d", res.Remaining, tt.remaining)
+			}
+
+			if !res.Allowed && res.RetryAfter <= 0 {
+				t.Errorf("RetryAfter = %v, want > 0", res.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestBucketBurst(t *testing.T) {
+	policy := Policy{Name: "burst", Limit: 60, Period: time.Minute, Burst: 3}
+	now := time.Unix(0, 0)
+	bucket := NewBucket(policy, now)
+
+	for i := 0; i < 3; i++ {
+		if res := bucket.Take(policy, now); !res.Allowed {
+			t.Fatalf("request %d was denied inside the burst", i)
+		}
+	}
+
+	res := bucket.Take(policy, now)
+	if res.Allowed {
+		t.Fatal("request past the burst was allowed")
+	}
+
+	if res.RetryAfter != time.Second {
+		t.Errorf("RetryAfter = %v, want 1s", res.RetryAfter)
+	}
+}
+
+func TestPolicyRefillTime(t *testing.T) {
+	policy := Policy{Name: "burst", Limit: 60, Period: time.Minute, Burst: 3}
+	if got := policy.RefillTime(); got != 3*time.Second {
+		t.Errorf("RefillTime = %v, want 3s", got)
+	}
+
+	bucket := NewBucket(policy, time.Unix(0, 0))
+	for i := 0; i < 3; i++ {
+		bucket.Take(policy, time.Unix(0, 0))
+	}
+	if !bucket.Full(policy, time.Unix(0, 0).Add(policy.RefillTime())) {
+		t.Error("bucket is not full after RefillTime")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Unix(0, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	policy := Policy{Name: "mem", Limit: 1, Period: time.Minute}
+
+	if res, _ := store.Take(context.Background(), "a", policy); !res.Allowed {
+		t.Fatal("first request for key a was denied")
+	}
+
+	if res, _ := store.Take(context.Background(), "a", policy); res.Allowed {
+		t.Fatal("second request for key a was allowed")
+	}
+
+	if res, _ := store.Take(context.Background(), "b", policy); !res.Allowed {
+		t.Fatal("keys are not isolated from each other")
+	}
+
+	now = now.Add(2 * time.Minute)
+	store.Take(context.Background(), "c", policy)
+	if _, ok := store.buckets["mem:a"]; ok {
+		t.Error("idle bucket was not swept")
+	}
+}
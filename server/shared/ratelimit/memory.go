@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+type entry struct {
+	bucket Bucket
+	policy Policy
+}
+
+// MemoryStore keeps buckets in process memory. Limits are not shared between
+// replicas, use a database backed store for that.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*entry),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryStore) Take(_ context.Context, key string, policy Policy) (Result, error) {
+	now := m.now()
+	key = policy.Name + ":" + key
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) > sweepInterval {
+		m.sweep(now)
+	}
+
+	e, ok := m.buckets[key]
+	if !ok {
+		e = &entry{bucket: NewBucket(policy, now), policy: policy}
+		m.buckets[key] = e
+	}
+
+	return e.bucket.Take(policy, now), nil
+}
+
+// sweep drops buckets that have refilled completely so idle clients don't
+// keep memory alive forever.
+func (m *MemoryStore) sweep(now time.Time) {
+	for key, e := range m.buckets {
+		if e.bucket.Full(e.policy, now) {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
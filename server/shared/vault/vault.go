@@ -0,0 +1,221 @@
+// Package vault is the client side of vault snippets, whose title, code and
+// description are encrypted before they leave the client. The server only
+// ever stores the ciphertexts and the Header, so it can't read them.
+//
+// A vault key is derived from a passphrase with argon2id, using the salt and
+// cost parameters in the Header, and encrypts fields with
+// XChaCha20-Poly1305. The Header also carries a key check value, which lets
+// a client tell a wrong passphrase apart from damaged data without trying to
+// decrypt anything.
+package vault
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	Version  = 1
+	SaltSize = 16
+	// CheckSize is the length of Header.Check.
+	CheckSize = sha256.Size
+	// Overhead is how much longer a sealed field is than its plaintext.
+	Overhead = chacha20poly1305.NonceSizeX + chacha20poly1305.Overhead
+)
+
+// Fields that can be sealed. Each one is bound to its ciphertext, so the
+// server can't swap an encrypted title for an encrypted code.
+const (
+	FieldTitle       = "title"
+	FieldCode        = "code"
+	FieldDescription = "description"
+)
+
+var (
+	ErrWrongPassphrase = errors.New("wrong vault passphrase")
+	ErrDecrypt         = errors.New("vault ciphertext is damaged")
+)
+
+// Params are the argon2id costs. Memory is in KiB.
+type Params struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// DefaultParams follow the second recommendation of RFC 9106 for memory
+// constrained environments.
+var DefaultParams = Params{Time: 3, Memory: 64 << 10, Threads: 4}
+
+// Bounds a Header has to stay within. The upper ones stop a stored header
+// from making clients burn unbounded memory or time.
+const (
+	minTime    = 1
+	maxTime    = 16
+	minMemory  = 19 << 10
+	maxMemory  = 1 << 20
+	minThreads = 1
+	maxThreads = 16
+)
+
+// Header is everything needed to derive and check a vault key, apart from
+// the passphrase. It is safe to store on the server.
+type Header struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Params  Params `json:"params"`
+	Check   []byte `json:"check"`
+}
+
+// Validate checks that h is well formed. It can't tell whether the check
+// value matches any passphrase, that is what Unlock is for.
+func (h *Header) Validate() error {
+	switch {
+	case h.Version != Version:
+		return fmt.Errorf("unsupported vault version %d", h.Version)
+	case len(h.Salt) != SaltSize:
+		return fmt.Errorf("salt must be %d bytes", SaltSize)
+	case len(h.Check) != CheckSize:
+		return fmt.Errorf("check must be %d bytes", CheckSize)
+	case h.Params.Time < minTime || h.Params.Time > maxTime:
+		return fmt.Errorf("time must be between %d and %d", minTime, maxTime)
+	case h.Params.Memory < minMemory || h.Params.Memory > maxMemory:
+		return fmt.Errorf("memory must be between %d and %d KiB", minMemory, maxMemory)
+	case h.Params.Threads < minThreads || h.Params.Threads > maxThreads:
+		return fmt.Errorf("threads must be between %d and %d", minThreads, maxThreads)
+	}
+	return nil
+}
+
+// Key encrypts and decrypts the fields of vault snippets.
+type Key struct {
+	key []byte
+}
+
+// New sets up a vault for passphrase with a fresh salt.
+func New(passphrase string, params Params) (*Key, *Header, error) {
+	h := &Header{Version: Version, Salt: make([]byte, SaltSize), Params: params}
+	if _, err := rand.Read(h.Salt); err != nil {
+		return nil, nil, err
+	}
+
+	key, check := derive(passphrase, h)
+	h.Check = check
+	if err := h.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return &Key{key: key}, h, nil
+}
+
+// Unlock derives the key of the vault described by h. It returns
+// ErrWrongPassphrase when the check value does not match.
+func Unlock(passphrase string, h *Header) (*Key, error) {
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+
+	key, check := derive(passphrase, h)
+	if subtle.ConstantTimeCompare(check, h.Check) != 1 {
+		return nil, ErrWrongPassphrase
+	}
+	return &Key{key: key}, nil
+}
+
+// derive stretches the passphrase into 64 bytes. The first half is the
+// encryption key, the check value is a hash of the second half so it gives
+// nothing away about the first.
+func derive(passphrase string, h *Header) (key, check []byte) {
+	out := argon2.IDKey([]byte(passphrase), h.Salt, h.Params.Time, h.Params.Memory, h.Params.Threads, 2*chacha20poly1305.KeySize)
+	sum := sha256.Sum256(append([]byte("codelet vault check "), out[chacha20poly1305.KeySize:]...))
+	return out[:chacha20poly1305.KeySize], sum[:]
+}
+
+// Seal encrypts the plaintext of field.
+func (k *Key) Seal(field string, plaintext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(k.key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(out); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, out, plaintext, aad(field)), nil
+}
+
+// Open decrypts what Seal produced for the same field.
+func (k *Key) Open(field string, ciphertext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(k.key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < Overhead {
+		return nil, ErrDecrypt
+	}
+
+	nonce := ciphertext[:aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, ciphertext[aead.NonceSize():], aad(field))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func aad(field string) []byte {
+	return []byte("codelet vault v1 " + field)
+}
+
+// Snippet holds the sealed fields of a vault snippet as they travel to and
+// from the server. An empty Description means the snippet has none.
+type Snippet struct {
+	Title       []byte `json:"title"`
+	Code        []byte `json:"code"`
+	Description []byte `json:"description,omitempty"`
+}
+
+// SealSnippet encrypts the fields of a snippet.
+func (k *Key) SealSnippet(title, code, description string) (*Snippet, error) {
+	var s Snippet
+	var err error
+	if s.Title, err = k.Seal(FieldTitle, []byte(title)); err != nil {
+		return nil, err
+	}
+	if s.Code, err = k.Seal(FieldCode, []byte(code)); err != nil {
+		return nil, err
+	}
+	if description != "" {
+		if s.Description, err = k.Seal(FieldDescription, []byte(description)); err != nil {
+			return nil, err
+		}
+	}
+	return &s, nil
+}
+
+// OpenSnippet decrypts what SealSnippet produced.
+func (k *Key) OpenSnippet(s *Snippet) (title, code, description string, err error) {
+	t, err := k.Open(FieldTitle, s.Title)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	c, err := k.Open(FieldCode, s.Code)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	var d []byte
+	if len(s.Description) > 0 {
+		if d, err = k.Open(FieldDescription, s.Description); err != nil {
+			return "", "", "", err
+		}
+	}
+	return string(t), string(c), string(d), nil
+}
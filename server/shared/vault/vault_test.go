@@ -0,0 +1,109 @@
+package vault
+
+import (
+	"errors"
+	"testing"
+)
+
+// testParams keep the tests fast, real vaults use DefaultParams.
+var testParams = Params{Time: 1, Memory: minMemory, Threads: 1}
+
+func TestUnlock(t *testing.T) {
+	_, h, err := New("correct horse", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		passphrase string
+		edit       func(h Header) Header
+		wantErr    error
+	}{
+		{name: "Right passphrase", passphrase: "correct horse"},
+		{name: "Wrong passphrase", passphrase: "battery staple", wantErr: ErrWrongPassphrase},
+		{name: "Other salt", passphrase: "correct horse", edit: func(h Header) Header {
+			h.Salt = make([]byte, SaltSize)
+			return h
+		}, wantErr: ErrWrongPassphrase},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := *h
+			if tt.edit != nil {
+				header = tt.edit(header)
+			}
+
+			_, err := Unlock(tt.passphrase, &header)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Header{Version: Version, Salt: make([]byte, SaltSize), Params: DefaultParams, Check: make([]byte, CheckSize)}
+
+	tests := []struct {
+		name  string
+		edit  func(h *Header)
+		valid bool
+	}{
+		{name: "Valid", edit: func(h *Header) {}, valid: true},
+		{name: "Future version", edit: func(h *Header) { h.Version = 2 }},
+		{name: "Short salt", edit: func(h *Header) { h.Salt = h.Salt[:8] }},
+		{name: "Missing check", edit: func(h *Header) { h.Check = nil }},
+		{name: "Too little memory", edit: func(h *Header) { h.Params.Memory = 1024 }},
+		{name: "Too much memory", edit: func(h *Header) { h.Params.Memory = 4 << 20 }},
+		{name: "No threads", edit: func(h *Header) { h.Params.Threads = 0 }},
+		{name: "Too many passes", edit: func(h *Header) { h.Params.Time = 100 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := valid
+			h.Salt = append([]byte(nil), valid.Salt...)
+			tt.edit(&h)
+			if err := h.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestSealSnippet(t *testing.T) {
+	key, _, err := New("correct horse", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := key.SealSnippet("db creds", "PGPASSWORD=hunter2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sealed.Description != nil {
+		t.Error("an empty description should stay empty")
+	}
+
+	title, code, description, err := key.OpenSnippet(sealed)
+	if err != nil || title != "db creds" || code != "PGPASSWORD=hunter2" || description != "" {
+		t.Fatalf("OpenSnippet = %q, %q, %q, %v", title, code, description, err)
+	}
+
+	// A server swapping fields around must be caught.
+	sealed.Title, sealed.Code = sealed.Code, sealed.Title
+	if _, _, _, err := key.OpenSnippet(sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("swapped fields opened, err %v", err)
+	}
+
+	other, _, err := New("correct horse", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Open(FieldCode, sealed.Title); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("a key with another salt opened the code, err %v", err)
+	}
+}
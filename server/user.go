@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/scott-mescudi/codelet/service/api/users"
+	"github.com/scott-mescudi/codelet/service/config"
+	dataAccess "github.com/scott-mescudi/codelet/service/data_access"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func runUserCreate(c *cli, path string, args []string) error {
+	fs, l := c.flags(path, "Create a user. Without -password-stdin a random password is generated and\nprinted once.")
+	username := fs.String("username", "", "display name (required)")
+	email := fs.String("email", "", "login email (required)")
+	role := fs.String("role", "user", "one of "+strings.Join(dataAccess.Roles, ", "))
+	fromStdin := fs.Bool("password-stdin", false, "read the password from the first line of stdin")
+	cfg, err := c.parse(fs, l, args)
+	if err != nil {
+		return err
+	}
+
+	if *username == "" {
+		return usageError("-username is required")
+	}
+	if !users.VerifyEmail(*email) {
+		return usageError("-email must be a valid email address")
+	}
+	if !dataAccess.ValidRole(*role) {
+		return usageError("-role must be one of %s", strings.Join(dataAccess.Roles, ", "))
+	}
+
+	password, generated, err := c.password(*fromStdin)
+	if err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	err = c.withDatabase(cfg, func(db *pgxpool.Pool) error {
+		return dataAccess.AddUser(c.ctx, db, *username, *email, *role, string(hash))
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stdout, "created %s user %s\n", *role, *email)
+	if generated {
+		fmt.Fprintf(c.stdout, "password: %s\n", password)
+	}
+	return nil
+}
+
+func runUserSetRole(c *cli, path string, args []string) error {
+	fs, l := c.flags(path, "Change the role of a user.")
+	email := fs.String("email", "", "login email of the user (required)")
+	role := fs.String("role", "", "one of "+strings.Join(dataAccess.Roles, ", ")+" (required)")
+	cfg, err := c.parse(fs, l, args)
+	if err != nil {
+		return err
+	}
+
+	if *email == "" {
+		return usageError("-email is required")
+	}
+	if !dataAccess.ValidRole(*role) {
+		return usageError("-role must be one of %s", strings.Join(dataAccess.Roles, ", "))
+	}
+
+	err = c.withDatabase(cfg, func(db *pgxpool.Pool) error {
+		return dataAccess.SetUserRole(c.ctx, db, *email, *role)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stdout, "%s is now %s\n", *email, *role)
+	return nil
+}
+
+func runUserResetPassword(c *cli, path string, args []string) error {
+	fs, l := c.flags(path, "Set a new password for a user and sign them out everywhere. Without\n-password-stdin a random password is generated and printed once.")
+	email := fs.String("email", "", "login email of the user (required)")
+	fromStdin := fs.Bool("password-stdin", false, "read the password from the first line of stdin")
+	cfg, err := c.parse(fs, l, args)
+	if err != nil {
+		return err
+	}
+
+	if *email == "" {
+		return usageError("-email is required")
+	}
+
+	password, generated, err := c.password(*fromStdin)
+	if err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	err = c.withDatabase(cfg, func(db *pgxpool.Pool) error {
+		return dataAccess.ResetPassword(c.ctx, db, *email, string(hash))
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stdout, "password of %s was reset\n", *email)
+	if generated {
+		fmt.Fprintf(c.stdout, "password: %s\n", password)
+	}
+	return nil
+}
+
+func runUserDisable(c *cli, path string, args []string) error {
+	fs, l := c.flags(path, "Block a user from signing in and drop their refresh token. Access tokens that\nwere already issued stay valid until they expire.")
+	email := fs.String("email", "", "login email of the user (required)")
+	enable := fs.Bool("enable", false, "lift the block instead")
+	cfg, err := c.parse(fs, l, args)
+	if err != nil {
+		return err
+	}
+
+	if *email == "" {
+		return usageError("-email is required")
+	}
+
+	err = c.withDatabase(cfg, func(db *pgxpool.Pool) error {
+		return dataAccess.SetUserDisabled(c.ctx, db, *email, !*enable)
+	})
+	if err != nil {
+		return err
+	}
+
+	if *enable {
+		fmt.Fprintf(c.stdout, "%s can sign in again\n", *email)
+	} else {
+		fmt.Fprintf(c.stdout, "%s is disabled\n", *email)
+	}
+	return nil
+}
+
+// withDatabase runs fn against a fresh connection. A missing user is not an
+// operational failure, so it gets its own exit code.
+func (c *cli) withDatabase(cfg *config.Config, fn func(db *pgxpool.Pool) error) error {
+	db, err := c.openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = fn(db)
+	if errors.Is(err, dataAccess.ErrUserNotFound) {
+		return &exitError{code: exitNotFound, err: err}
+	}
+	return err
+}
+
+// password reads the password from stdin or generates one. The second
+// return value reports whether it was generated and has to be shown.
+func (c *cli) password(fromStdin bool) (string, bool, error) {
+	if !fromStdin {
+		return rand.Text(), true, nil
+	}
+
+	line, err := bufio.NewReader(c.stdin).ReadString('\n')
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		if err != nil {
+			return "", false, usageError("no password on stdin: %v", err)
+		}
+		return "", false, usageError("password on stdin is empty")
+	}
+	return line, false, nil
+}
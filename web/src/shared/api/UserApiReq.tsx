@@ -5,6 +5,7 @@ interface LoginRequest {
 
 interface LoginResponse {
 	access_token: string
+	csrf_token: string
 }
 
 interface SignupRequest {
@@ -76,6 +77,7 @@ export async function Login(email: string, password: string): Promise<number> {
 
 		const token = (await resp.json()) as LoginResponse
 		localStorage.setItem('ACCESS_TOKEN', token.access_token)
+		localStorage.setItem('CSRF_TOKEN', token.csrf_token)
 
 		return 200
 	} catch (err) {